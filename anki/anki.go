@@ -0,0 +1,122 @@
+// Package anki reads and writes Anki .apkg packages (collection schema 11).
+package anki
+
+import "time"
+
+const (
+	// FieldSeparator separates the fields of a note in notes.flds.
+	FieldSeparator = "\x1f"
+	// DeckSeparator separates the levels of a deck name, e.g. "Japanese::JLPT N5".
+	DeckSeparator = "::"
+
+	ModelTypeStandard = 0
+	ModelTypeCloze    = 1
+
+	CardTypeNew        = 0
+	CardTypeLearning   = 1
+	CardTypeReview     = 2
+	CardTypeRelearning = 3
+
+	QueueSuspended = -1
+	QueueNew       = 0
+	QueueLearning  = 1
+	QueueReview    = 2
+	QueueDayLearn  = 3
+
+	RevlogTypeLearn    = 0
+	RevlogTypeReview   = 1
+	RevlogTypeRelearn  = 2
+	RevlogTypeFiltered = 3
+	RevlogTypeManual   = 4
+
+	collectionFile       = "collection.anki2"
+	collectionFileAnki21 = "collection.anki21"
+	collectionFileLatest = "collection.anki21b"
+	mediaFile            = "media"
+)
+
+type Collection struct {
+	Created time.Time
+	Models  map[int64]*Model
+	Decks   map[int64]*Deck
+	Notes   map[int64]*Note
+	Cards   []*Card
+	Revlog  map[int64][]*Revlog
+}
+
+type Model struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Type      int          `json:"type"`
+	Fields    []ModelField `json:"flds"`
+	Templates []Template   `json:"tmpls"`
+	CSS       string       `json:"css"`
+}
+
+type ModelField struct {
+	Name string `json:"name"`
+	Ord  int    `json:"ord"`
+}
+
+type Template struct {
+	Name        string `json:"name"`
+	Ord         int    `json:"ord"`
+	QuestionFmt string `json:"qfmt"`
+	AnswerFmt   string `json:"afmt"`
+}
+
+type Deck struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Note struct {
+	ID      int64
+	GUID    string
+	ModelID int64
+	Tags    []string
+	Fields  []string
+}
+
+type Card struct {
+	ID             int64
+	NoteID         int64
+	DeckID         int64
+	OriginalDeckID int64
+	Ord            int
+	Type           int
+	Queue          int
+	Due            int64
+	Interval       int64
+	Factor         int64
+	Reps           int64
+	Lapses         int64
+	Left           int64
+}
+
+type Revlog struct {
+	ID           int64
+	CardID       int64
+	Ease         int
+	Interval     int64
+	LastInterval int64
+	Factor       int64
+	TimeMs       int64
+	Type         int
+}
+
+// ReviewedAt returns the time of the review, revlog ids are epoch milliseconds.
+func (r *Revlog) ReviewedAt() time.Time {
+	return time.UnixMilli(r.ID)
+}
+
+// FieldMap returns the fields of the note keyed by the field names of its model.
+func (n *Note) FieldMap(model *Model) map[string]string {
+	fields := make(map[string]string, len(model.Fields))
+	for _, field := range model.Fields {
+		if field.Ord < len(n.Fields) {
+			fields[field.Name] = n.Fields[field.Ord]
+		}
+	}
+	return fields
+}
@@ -0,0 +1,70 @@
+package anki
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestPackage(t *testing.T, media []MediaFile) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	collection := &Collection{Created: time.Now(), Models: map[int64]*Model{}, Decks: map[int64]*Deck{}}
+	if err := Write(&buffer, collection, media); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "test.apkg")
+	if err := os.WriteFile(path, buffer.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenMediaLimit(t *testing.T) {
+	const size = 64 << 10
+	path := writeTestPackage(t, []MediaFile{{
+		Name: "sound.mp3",
+		Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(strings.Repeat("a", size))), nil },
+	}})
+
+	tests := []struct {
+		maxEntrySize int64
+		wantErr      error
+	}{
+		{maxEntrySize: size, wantErr: nil},
+		{maxEntrySize: size - 1, wantErr: ErrEntryTooLarge},
+	}
+	for _, tt := range tests {
+		pkg, err := Open(path, tt.maxEntrySize)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		_, err = pkg.OpenMedia("sound.mp3")
+		pkg.Close()
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("OpenMedia() with limit %d error = %v, want %v", tt.maxEntrySize, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLimitedReadCloser(t *testing.T) {
+	// the size declared by the archive can be forged, reads stop at the limit anyway
+	reader := &limitedReadCloser{ReadCloser: io.NopCloser(strings.NewReader("0123456789")), remaining: 4}
+	got, err := io.ReadAll(reader)
+	if !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("ReadAll() error = %v, want %v", err, ErrEntryTooLarge)
+	}
+	if string(got) != "0123" {
+		t.Errorf("ReadAll() = %q, want %q", got, "0123")
+	}
+
+	reader = &limitedReadCloser{ReadCloser: io.NopCloser(strings.NewReader("0123")), remaining: 4}
+	if got, err := io.ReadAll(reader); err != nil || string(got) != "0123" {
+		t.Errorf("ReadAll() = %q, %v, want %q", got, err, "0123")
+	}
+}
@@ -0,0 +1,310 @@
+package anki
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var ErrUnsupportedPackage = errors.New("unsupported package, export it from Anki with \"Support older Anki versions\" enabled")
+
+var ErrEntryTooLarge = errors.New("package contains a file larger than allowed")
+
+// Package is an opened .apkg file. Close must be called to release the extracted collection.
+type Package struct {
+	Collection *Collection
+	// Media maps the media file names used in notes to their entry names in the zip.
+	Media map[string]string
+
+	archive      *zip.ReadCloser
+	tempDir      string
+	maxEntrySize int64
+}
+
+// Open reads the collection and the media index of the .apkg at path. Files of the package that
+// unpack to more than maxEntrySize bytes fail with ErrEntryTooLarge.
+func Open(path string, maxEntrySize int64) (*Package, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("open package: %w", err)
+	}
+	pkg := &Package{archive: archive, Media: map[string]string{}, maxEntrySize: maxEntrySize}
+
+	entries := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		entries[file.Name] = file
+	}
+	// packages made by Anki 2.1 ship a dummy collection.anki2 next to the real collection.anki21
+	collectionEntry := entries[collectionFileAnki21]
+	if collectionEntry == nil {
+		collectionEntry = entries[collectionFile]
+	}
+	if collectionEntry == nil {
+		archive.Close()
+		if entries[collectionFileLatest] != nil {
+			return nil, ErrUnsupportedPackage
+		}
+		return nil, fmt.Errorf("package does not contain a collection")
+	}
+
+	pkg.tempDir, err = os.MkdirTemp("", "apkg-*")
+	if err != nil {
+		pkg.Close()
+		return nil, err
+	}
+	collectionPath := filepath.Join(pkg.tempDir, collectionFile)
+	if err := extractFile(collectionEntry, collectionPath, maxEntrySize); err != nil {
+		pkg.Close()
+		return nil, err
+	}
+	pkg.Collection, err = readCollection(collectionPath)
+	if err != nil {
+		pkg.Close()
+		return nil, err
+	}
+
+	if mediaEntry := entries[mediaFile]; mediaEntry != nil {
+		if err := readMediaIndex(mediaEntry, entries, pkg.Media, maxEntrySize); err != nil {
+			pkg.Close()
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
+
+// OpenMedia opens the content of a media file by the name notes refer to it with.
+func (p *Package) OpenMedia(filename string) (io.ReadCloser, error) {
+	entryName, ok := p.Media[filename]
+	if !ok {
+		return nil, fmt.Errorf("media %q not found in package", filename)
+	}
+	for _, file := range p.archive.File {
+		if file.Name == entryName {
+			return openEntry(file, p.maxEntrySize)
+		}
+	}
+	return nil, fmt.Errorf("media %q is missing from package", filename)
+}
+
+func (p *Package) Close() error {
+	var err error
+	if p.archive != nil {
+		err = p.archive.Close()
+	}
+	if p.tempDir != "" {
+		if removeErr := os.RemoveAll(p.tempDir); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// openEntry opens a file of the archive, failing once more than maxSize bytes are read since the
+// size declared by the archive can not be trusted.
+func openEntry(file *zip.File, maxSize int64) (io.ReadCloser, error) {
+	if file.UncompressedSize64 > uint64(maxSize) {
+		return nil, ErrEntryTooLarge
+	}
+	source, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReadCloser{ReadCloser: source, remaining: maxSize}, nil
+}
+
+type limitedReadCloser struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	// read one byte past the limit to tell an entry of exactly maxSize from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrEntryTooLarge
+	}
+	return n, err
+}
+
+func extractFile(file *zip.File, destination string, maxSize int64) error {
+	source, err := openEntry(file, maxSize)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+func readMediaIndex(file *zip.File, entries map[string]*zip.File, media map[string]string, maxSize int64) error {
+	source, err := openEntry(file, maxSize)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	var index map[string]string
+	if err := json.NewDecoder(source).Decode(&index); err != nil {
+		if errors.Is(err, ErrEntryTooLarge) {
+			return err
+		}
+		// newer packages store the media index as zstd compressed protobuf
+		return ErrUnsupportedPackage
+	}
+	for entryName, filename := range index {
+		if _, ok := entries[entryName]; ok {
+			media[filename] = entryName
+		}
+	}
+	return nil
+}
+
+func readCollection(path string) (*Collection, error) {
+	database, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+
+	collection := &Collection{
+		Notes:  map[int64]*Note{},
+		Revlog: map[int64][]*Revlog{},
+	}
+	var created int64
+	var modelsJSON, decksJSON string
+	err = database.QueryRow("SELECT crt, models, decks FROM col LIMIT 1").Scan(&created, &modelsJSON, &decksJSON)
+	if err != nil {
+		return nil, fmt.Errorf("read col: %w", err)
+	}
+	collection.Created = time.Unix(created, 0)
+	if err := json.Unmarshal([]byte(modelsJSON), &collection.Models); err != nil {
+		return nil, fmt.Errorf("read models: %w", err)
+	}
+	if err := json.Unmarshal([]byte(decksJSON), &collection.Decks); err != nil {
+		return nil, fmt.Errorf("read decks: %w", err)
+	}
+
+	if err := readNotes(database, collection); err != nil {
+		return nil, err
+	}
+	if err := readCards(database, collection); err != nil {
+		return nil, err
+	}
+	if err := readRevlog(database, collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func readNotes(database *sql.DB, collection *Collection) error {
+	rows, err := database.Query("SELECT id, guid, mid, tags, flds FROM notes")
+	if err != nil {
+		return fmt.Errorf("read notes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var note Note
+		var tags, fields string
+		if err := rows.Scan(&note.ID, &note.GUID, &note.ModelID, &tags, &fields); err != nil {
+			return fmt.Errorf("read notes: %w", err)
+		}
+		note.Tags = strings.Fields(tags)
+		note.Fields = strings.Split(fields, FieldSeparator)
+		collection.Notes[note.ID] = &note
+	}
+	return rows.Err()
+}
+
+func readCards(database *sql.DB, collection *Collection) error {
+	rows, err := database.Query("SELECT id, nid, did, odid, ord, type, queue, due, ivl, factor, reps, lapses, left FROM cards ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("read cards: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var card Card
+		err := rows.Scan(&card.ID, &card.NoteID, &card.DeckID, &card.OriginalDeckID, &card.Ord, &card.Type,
+			&card.Queue, &card.Due, &card.Interval, &card.Factor, &card.Reps, &card.Lapses, &card.Left)
+		if err != nil {
+			return fmt.Errorf("read cards: %w", err)
+		}
+		collection.Cards = append(collection.Cards, &card)
+	}
+	return rows.Err()
+}
+
+func readRevlog(database *sql.DB, collection *Collection) error {
+	rows, err := database.Query("SELECT id, cid, ease, ivl, lastIvl, factor, time, type FROM revlog ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("read revlog: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var revlog Revlog
+		err := rows.Scan(&revlog.ID, &revlog.CardID, &revlog.Ease, &revlog.Interval, &revlog.LastInterval,
+			&revlog.Factor, &revlog.TimeMs, &revlog.Type)
+		if err != nil {
+			return fmt.Errorf("read revlog: %w", err)
+		}
+		collection.Revlog[revlog.CardID] = append(collection.Revlog[revlog.CardID], &revlog)
+	}
+	return rows.Err()
+}
+
+// UnmarshalJSON accepts the ids of models and decks both as numbers and as strings,
+// older collections store some of them quoted.
+func (m *Model) UnmarshalJSON(data []byte) error {
+	type model Model
+	var raw struct {
+		model
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Model(raw.model)
+	id, err := parseID(raw.ID)
+	m.ID = id
+	return err
+}
+
+func (d *Deck) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID   json.RawMessage `json:"id"`
+		Name string          `json:"name"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	d.Name = raw.Name
+	id, err := parseID(raw.ID)
+	d.ID = id
+	return err
+}
+
+func parseID(raw json.RawMessage) (int64, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(strings.Trim(string(raw), `"`), 10, 64)
+}
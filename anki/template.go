@@ -0,0 +1,166 @@
+package anki
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	clozePattern    = regexp.MustCompile(`(?s)\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+	htmlTagPattern  = regexp.MustCompile(`(?s)<[^>]*>`)
+	answerHrPattern = regexp.MustCompile(`(?i)^\s*<hr\s+id\s*=\s*["']?answer["']?\s*/?>`)
+	mediaPattern    = regexp.MustCompile(`(?i)<img\s[^>]*src\s*=|\[sound:[^\]]+\]`)
+)
+
+// Render returns the question and the answer of the card with the given template ord of a note.
+// The answer does not repeat the question, {{FrontSide}} renders empty.
+func Render(model *Model, note *Note, ord int, deckName string) (string, string, error) {
+	template, clozeNumber, err := cardTemplate(model, ord)
+	if err != nil {
+		return "", "", err
+	}
+	fields := note.FieldMap(model)
+	fields["Tags"] = strings.Join(note.Tags, " ")
+	fields["Type"] = model.Name
+	fields["Card"] = template.Name
+	fields["Deck"] = deckName
+	if index := strings.LastIndex(deckName, DeckSeparator); index >= 0 {
+		fields["Subdeck"] = deckName[index+len(DeckSeparator):]
+	} else {
+		fields["Subdeck"] = deckName
+	}
+	fields["FrontSide"] = ""
+
+	question := strings.TrimSpace(renderTemplate(template.QuestionFmt, fields, clozeNumber, true))
+	answer := renderTemplate(template.AnswerFmt, fields, clozeNumber, false)
+	answer = strings.TrimSpace(answerHrPattern.ReplaceAllString(answer, ""))
+	return question, answer, nil
+}
+
+// StripHTML returns the visible text of an html snippet.
+func StripHTML(s string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(s, "")))
+}
+
+// ContainsMedia reports whether the html refers to an image or a sound.
+func ContainsMedia(s string) bool {
+	return mediaPattern.MatchString(s)
+}
+
+func cardTemplate(model *Model, ord int) (*Template, int, error) {
+	if model.Type == ModelTypeCloze {
+		if len(model.Templates) == 0 {
+			return nil, 0, fmt.Errorf("note type %q has no template", model.Name)
+		}
+		return &model.Templates[0], ord + 1, nil
+	}
+	for index := range model.Templates {
+		if model.Templates[index].Ord == ord {
+			return &model.Templates[index], 0, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("note type %q has no template %d", model.Name, ord)
+}
+
+// renderTemplate implements the subset of the Anki template language used by note types:
+// field replacements with filters and conditional sections.
+func renderTemplate(format string, fields map[string]string, clozeNumber int, question bool) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(format, "{{")
+		if start < 0 {
+			out.WriteString(format)
+			return out.String()
+		}
+		end := strings.Index(format[start:], "}}")
+		if end < 0 {
+			out.WriteString(format)
+			return out.String()
+		}
+		end += start
+		out.WriteString(format[:start])
+		tag := strings.TrimSpace(format[start+2 : end])
+		format = format[end+2:]
+
+		switch {
+		case strings.HasPrefix(tag, "#") || strings.HasPrefix(tag, "^"):
+			name := strings.TrimSpace(tag[1:])
+			inner, rest := splitSection(format, name)
+			format = rest
+			filled := StripHTML(fields[name]) != ""
+			if filled == (tag[0] == '#') {
+				out.WriteString(renderTemplate(inner, fields, clozeNumber, question))
+			}
+		case strings.HasPrefix(tag, "/"):
+			// closing tag without an opening one
+		default:
+			out.WriteString(renderField(tag, fields, clozeNumber, question))
+		}
+	}
+}
+
+// splitSection returns the body of a section up to its closing tag and the template after it.
+func splitSection(format string, name string) (string, string) {
+	depth := 0
+	for position := 0; position < len(format); {
+		start := strings.Index(format[position:], "{{")
+		if start < 0 {
+			break
+		}
+		start += position
+		end := strings.Index(format[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start
+		tag := strings.TrimSpace(format[start+2 : end])
+		if (strings.HasPrefix(tag, "#") || strings.HasPrefix(tag, "^")) && strings.TrimSpace(tag[1:]) == name {
+			depth++
+		} else if strings.HasPrefix(tag, "/") && strings.TrimSpace(tag[1:]) == name {
+			if depth == 0 {
+				return format[:start], format[end+2:]
+			}
+			depth--
+		}
+		position = end + 2
+	}
+	return format, ""
+}
+
+func renderField(tag string, fields map[string]string, clozeNumber int, question bool) string {
+	parts := strings.Split(tag, ":")
+	name := strings.TrimSpace(parts[len(parts)-1])
+	value := fields[name]
+	for index := len(parts) - 2; index >= 0; index-- {
+		switch strings.TrimSpace(parts[index]) {
+		case "text":
+			value = StripHTML(value)
+		case "cloze":
+			value = renderCloze(value, clozeNumber, question)
+		case "type":
+			// typing the answer is handled by the client
+			value = ""
+		}
+	}
+	return value
+}
+
+func renderCloze(text string, clozeNumber int, question bool) string {
+	return clozePattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := clozePattern.FindStringSubmatch(match)
+		number, _ := strconv.Atoi(groups[1])
+		if number != clozeNumber {
+			return groups[2]
+		}
+		if !question {
+			return `<span class="cloze">` + groups[2] + `</span>`
+		}
+		if groups[3] != "" {
+			return "[" + groups[3] + "]"
+		}
+		return "[...]"
+	})
+}
@@ -0,0 +1,404 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultDeckID = 1
+
+var mediaReferencePattern = regexp.MustCompile(`(?i)<img\s[^>]*src\s*=\s*["']?([^"'>\s]+)|\[sound:([^\]]+)\]`)
+
+const schema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn on notes (usn);
+CREATE INDEX ix_cards_usn on cards (usn);
+CREATE INDEX ix_revlog_usn on revlog (usn);
+CREATE INDEX ix_cards_nid on cards (nid);
+CREATE INDEX ix_cards_sched on cards (did, queue, due);
+CREATE INDEX ix_revlog_cid on revlog (cid);
+CREATE INDEX ix_notes_csum on notes (csum);
+`
+
+// MediaFile is a media file to bundle in a package, opened lazily while the package is written.
+type MediaFile struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+// MediaReferences returns the media file names an html snippet refers to.
+func MediaReferences(s string) []string {
+	var names []string
+	for _, groups := range mediaReferencePattern.FindAllStringSubmatch(s, -1) {
+		if groups[1] != "" {
+			names = append(names, groups[1])
+		} else if groups[2] != "" {
+			names = append(names, groups[2])
+		}
+	}
+	return names
+}
+
+// BasicModel returns the "Basic" note type with a Front and a Back field.
+func BasicModel(id int64) *Model {
+	return &Model{
+		ID:   id,
+		Name: "Basic",
+		Type: ModelTypeStandard,
+		Fields: []ModelField{
+			{Name: "Front", Ord: 0},
+			{Name: "Back", Ord: 1},
+		},
+		Templates: []Template{{
+			Name:        "Card 1",
+			Ord:         0,
+			QuestionFmt: "{{Front}}",
+			AnswerFmt:   "{{FrontSide}}\n\n<hr id=answer>\n\n{{Back}}",
+		}},
+		CSS: ".card {\n font-family: arial;\n font-size: 20px;\n text-align: center;\n color: black;\n background-color: white;\n}\n",
+	}
+}
+
+// Write writes the collection and the media as an .apkg to out.
+func Write(out io.Writer, collection *Collection, media []MediaFile) error {
+	tempDir, err := os.MkdirTemp("", "apkg-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	collectionPath := filepath.Join(tempDir, collectionFile)
+	if err := writeCollection(collectionPath, collection); err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(out)
+	if err := addFile(archive, collectionFile, collectionPath); err != nil {
+		return err
+	}
+	index := make(map[string]string, len(media))
+	for number, file := range media {
+		entryName := strconv.Itoa(number)
+		if err := addMedia(archive, entryName, file); err != nil {
+			return fmt.Errorf("write media %q: %w", file.Name, err)
+		}
+		index[entryName] = file.Name
+	}
+	entry, err := archive.Create(mediaFile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(entry).Encode(index); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func addFile(archive *zip.Writer, entryName string, path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	entry, err := archive.Create(entryName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, source)
+	return err
+}
+
+func addMedia(archive *zip.Writer, entryName string, file MediaFile) error {
+	source, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	entry, err := archive.Create(entryName)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, source)
+	return err
+}
+
+func writeCollection(path string, collection *Collection) error {
+	database, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+	if _, err := database.Exec(schema); err != nil {
+		return fmt.Errorf("create schema: %w", err)
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := insertCol(tx, collection, now); err != nil {
+		return err
+	}
+	if err := insertNotes(tx, collection, now); err != nil {
+		return err
+	}
+	if err := insertCards(tx, collection, now); err != nil {
+		return err
+	}
+	if err := insertRevlog(tx, collection); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertCol(tx *sql.Tx, collection *Collection, now time.Time) error {
+	var currentModel int64
+	models := make(map[string]any, len(collection.Models))
+	for id, model := range collection.Models {
+		models[strconv.FormatInt(id, 10)] = modelJSON(model, now)
+		currentModel = id
+	}
+	decks := map[string]any{strconv.Itoa(DefaultDeckID): deckJSON(&Deck{ID: DefaultDeckID, Name: "Default"}, now)}
+	for id, deck := range collection.Decks {
+		decks[strconv.FormatInt(id, 10)] = deckJSON(deck, now)
+	}
+	conf := map[string]any{
+		"nextPos":       1,
+		"estTimes":      true,
+		"activeDecks":   []int{DefaultDeckID},
+		"sortType":      "noteFld",
+		"timeLim":       0,
+		"sortBackwards": false,
+		"addToCur":      true,
+		"curDeck":       DefaultDeckID,
+		"newBury":       true,
+		"newSpread":     0,
+		"dueCounts":     true,
+		"curModel":      strconv.FormatInt(currentModel, 10),
+		"collapseTime":  1200,
+	}
+	dconf := map[string]any{strconv.Itoa(DefaultDeckID): deckConfJSON(now)}
+
+	values := make([]string, 0, 4)
+	for _, value := range []any{conf, models, decks, dconf} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		values = append(values, string(encoded))
+	}
+	_, err := tx.Exec("INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')",
+		collection.Created.Unix(), now.UnixMilli(), now.UnixMilli(), values[0], values[1], values[2], values[3])
+	if err != nil {
+		return fmt.Errorf("write col: %w", err)
+	}
+	return nil
+}
+
+func insertNotes(tx *sql.Tx, collection *Collection, now time.Time) error {
+	statement, err := tx.Prepare("INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')")
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+	for _, id := range sortedKeys(collection.Notes) {
+		note := collection.Notes[id]
+		fields := make([]string, len(note.Fields))
+		for index, field := range note.Fields {
+			fields[index] = strings.ReplaceAll(field, FieldSeparator, " ")
+		}
+		var sortField string
+		if len(fields) > 0 {
+			sortField = StripHTML(fields[0])
+		}
+		tags := ""
+		if len(note.Tags) > 0 {
+			tags = " " + strings.Join(note.Tags, " ") + " "
+		}
+		_, err := statement.Exec(note.ID, note.GUID, note.ModelID, now.Unix(), tags,
+			strings.Join(fields, FieldSeparator), sortField, checksum(sortField))
+		if err != nil {
+			return fmt.Errorf("write note %d: %w", note.ID, err)
+		}
+	}
+	return nil
+}
+
+func insertCards(tx *sql.Tx, collection *Collection, now time.Time) error {
+	statement, err := tx.Prepare("INSERT INTO cards VALUES (?, ?, ?, ?, ?, -1, ?, ?, ?, ?, ?, ?, ?, ?, 0, 0, 0, '')")
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+	for _, card := range collection.Cards {
+		_, err := statement.Exec(card.ID, card.NoteID, card.DeckID, card.Ord, now.Unix(), card.Type, card.Queue,
+			card.Due, card.Interval, card.Factor, card.Reps, card.Lapses, card.Left)
+		if err != nil {
+			return fmt.Errorf("write card %d: %w", card.ID, err)
+		}
+	}
+	return nil
+}
+
+func insertRevlog(tx *sql.Tx, collection *Collection) error {
+	statement, err := tx.Prepare("INSERT INTO revlog VALUES (?, ?, -1, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+	for _, cardID := range sortedKeys(collection.Revlog) {
+		for _, revlog := range collection.Revlog[cardID] {
+			_, err := statement.Exec(revlog.ID, revlog.CardID, revlog.Ease, revlog.Interval, revlog.LastInterval,
+				revlog.Factor, revlog.TimeMs, revlog.Type)
+			if err != nil {
+				return fmt.Errorf("write revlog %d: %w", revlog.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checksum is the first 8 hex digits of the sha1 of the sort field, Anki uses it to find duplicates.
+func checksum(field string) int64 {
+	sum := sha1.Sum([]byte(field))
+	value, _ := strconv.ParseInt(hex.EncodeToString(sum[:])[:8], 16, 64)
+	return value
+}
+
+func sortedKeys[T any](values map[int64]T) []int64 {
+	keys := make([]int64, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func modelJSON(model *Model, now time.Time) map[string]any {
+	fields := make([]map[string]any, len(model.Fields))
+	requiredFields := make([]int, 0, len(model.Fields))
+	for index, field := range model.Fields {
+		fields[index] = map[string]any{
+			"name":   field.Name,
+			"ord":    field.Ord,
+			"sticky": false,
+			"rtl":    false,
+			"font":   "Arial",
+			"size":   20,
+			"media":  []string{},
+		}
+		if index == 0 {
+			requiredFields = append(requiredFields, field.Ord)
+		}
+	}
+	templates := make([]map[string]any, len(model.Templates))
+	requirements := make([]any, len(model.Templates))
+	for index, template := range model.Templates {
+		templates[index] = map[string]any{
+			"name":  template.Name,
+			"ord":   template.Ord,
+			"qfmt":  template.QuestionFmt,
+			"afmt":  template.AnswerFmt,
+			"did":   nil,
+			"bqfmt": "",
+			"bafmt": "",
+		}
+		requirements[index] = []any{template.Ord, "any", requiredFields}
+	}
+	return map[string]any{
+		"id":        model.ID,
+		"name":      model.Name,
+		"type":      model.Type,
+		"mod":       now.Unix(),
+		"usn":       -1,
+		"sortf":     0,
+		"did":       DefaultDeckID,
+		"flds":      fields,
+		"tmpls":     templates,
+		"css":       model.CSS,
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"req":       requirements,
+		"tags":      []string{},
+		"vers":      []any{},
+	}
+}
+
+func deckJSON(deck *Deck, now time.Time) map[string]any {
+	return map[string]any{
+		"id":               deck.ID,
+		"name":             deck.Name,
+		"mod":              now.Unix(),
+		"usn":              -1,
+		"desc":             "",
+		"dyn":              0,
+		"conf":             DefaultDeckID,
+		"collapsed":        false,
+		"browserCollapsed": false,
+		"newToday":         []int{0, 0},
+		"revToday":         []int{0, 0},
+		"lrnToday":         []int{0, 0},
+		"timeToday":        []int{0, 0},
+		"extendNew":        10,
+		"extendRev":        50,
+	}
+}
+
+func deckConfJSON(now time.Time) map[string]any {
+	return map[string]any{
+		"id":       DefaultDeckID,
+		"name":     "Default",
+		"mod":      now.Unix(),
+		"usn":      -1,
+		"dyn":      false,
+		"maxTaken": 60,
+		"timer":    0,
+		"autoplay": true,
+		"replayq":  true,
+		"new": map[string]any{
+			"bury":          true,
+			"delays":        []float64{1, 10},
+			"initialFactor": 2500,
+			"ints":          []int{1, 4, 7},
+			"order":         1,
+			"perDay":        20,
+			"separate":      true,
+		},
+		"rev": map[string]any{
+			"bury":       true,
+			"ease4":      1.3,
+			"fuzz":       0.05,
+			"ivlFct":     1,
+			"maxIvl":     36500,
+			"minSpace":   1,
+			"perDay":     200,
+			"hardFactor": 1.2,
+		},
+		"lapse": map[string]any{
+			"delays":      []float64{10},
+			"leechAction": 0,
+			"leechFails":  8,
+			"minInt":      1,
+			"mult":        0,
+		},
+	}
+}
@@ -1,10 +1,131 @@
 package config
 
 type Config struct {
-	MysqlConfig      *MysqlConfig
-	Port             string
-	AccessKeySecret  string
-	RefreshKeySecret string
+	MysqlConfig  *MysqlConfig
+	MailerConfig *MailerConfig
+	// ThrottleConfig limits the failed logins per account and per IP
+	ThrottleConfig *ThrottleConfig
+	// OIDCProviders are the external providers users can sign in with
+	OIDCProviders []*OIDCProviderConfig
+	Port          string
+	// AccessKeySecret signs the access tokens with HS256, it is required unless AccessTokenKeys are set
+	AccessKeySecret string
+	// AccessTokenKeys sign the access tokens with RS256 or EdDSA instead of AccessKeySecret, their
+	// public keys are published at /.well-known/jwks.json
+	AccessTokenKeys []*SigningKeyConfig
+	// RefreshKeySecret signs the refresh tokens, it is required
+	RefreshKeySecret   string
+	TrashRetentionDays int
+	StorageDir         string
+	MaxUploadSizeMB    int64
+	// MaxUnpackedSizeMB bounds every file unpacked from an uploaded package, a small archive can
+	// otherwise expand to fill the disk
+	MaxUnpackedSizeMB int64
+	// AccountDeletionGraceDays is how long a requested account deletion can still be cancelled
+	AccountDeletionGraceDays int
+	// LibraryReportHideThreshold is the number of abuse reports that hides a deck from the library
+	LibraryReportHideThreshold int32
+	// CardRevisionRetentionDays is how long the edit history of cards is kept, 0 keeps it forever
+	CardRevisionRetentionDays int
+	// CardRevisionMaxPerCard is the number of revisions kept per card, 0 keeps them all
+	CardRevisionMaxPerCard int
+	// AccessTokenTTLMinutes is how long an access token is valid
+	AccessTokenTTLMinutes int
+	// RefreshTokenTTLDays is how long a session stays logged in without being refreshed
+	RefreshTokenTTLDays int
+	// SessionCacheTTLSeconds is how long authenticated requests trust a session without reading it
+	// again, which bounds how late a revocation by another instance applies
+	SessionCacheTTLSeconds int
+	// ActionKeySecret signs the tokens mailed to verify an email or reset a password, the two-factor
+	// login challenges and the OIDC state cookie, it is required
+	ActionKeySecret string
+	// AppURL is the address of the web app, the links of the emails point to it
+	AppURL string
+	// EmailVerificationTTLHours is how long an email verification link is valid
+	EmailVerificationTTLHours int
+	// PasswordResetTTLMinutes is how long a password reset link is valid
+	PasswordResetTTLMinutes int
+	// PasswordMinLength is the minimum number of characters of a new password
+	PasswordMinLength int
+	// PasswordMinClasses is how many of lowercase, uppercase, digits and symbols a new password uses
+	PasswordMinClasses int
+	// PublicURL is the address the API is reached at, external providers redirect back to it
+	PublicURL string
+	// TwoFactorKey is the base64 AES-256 key the TOTP secrets are encrypted with, two-factor
+	// authentication can not be enabled without it
+	TwoFactorKey string
+	// TwoFactorIssuer is the name authenticator apps show the codes under
+	TwoFactorIssuer string
+	// TwoFactorChallengeTTLMinutes is how long after the password the second factor can be entered
+	TwoFactorChallengeTTLMinutes int
+	// AccessTokenMaxDays is the longest lifetime of a personal access token, 0 allows tokens that
+	// never expire
+	AccessTokenMaxDays int
+}
+
+// MailerConfig selects how emails are sent: through SMTP, written as files to Dir or to the log.
+type MailerConfig struct {
+	Driver   string
+	From     string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Dir      string
+	// TemplateDir holds <name>.tmpl files overriding the built-in email templates
+	TemplateDir string
+	// TimeoutSeconds bounds the whole exchange with the SMTP server
+	TimeoutSeconds int
+}
+
+// ThrottleConfig selects where the failed attempts are counted, in memory for a single instance or
+// in a Redis shared by every instance, and how many are allowed.
+type ThrottleConfig struct {
+	Driver        string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// AccountAttempts is the number of failed logins of an email before it is locked
+	AccountAttempts int
+	// IPAttempts is the number of failed logins from an address before it is locked, higher as
+	// many users can share one
+	IPAttempts int
+	// LockoutSeconds is the first lockout, it doubles on every further failure up to
+	// MaxLockoutMinutes
+	LockoutSeconds    int
+	MaxLockoutMinutes int
+	// WindowMinutes is how long failures are remembered after the last one
+	WindowMinutes int
+}
+
+// SigningKeyConfig is a PEM private key file, RSA of at least 2048 bits or Ed25519. The key signs
+// from SignFrom on, until a key with a later SignFrom takes over, and its tokens are accepted until
+// RetireAt.
+type SigningKeyConfig struct {
+	// ID is the kid of the key, its RFC 7638 thumbprint when empty
+	ID   string
+	File string
+	// SignFrom and RetireAt are RFC 3339 times, empty for no bound
+	SignFrom string
+	RetireAt string
+}
+
+// OIDCProviderConfig is an external sign-in provider. Type oidc is an OpenID Connect issuer found
+// through the discovery document of Issuer, such as Google. Type github is the built-in GitHub
+// provider, which only speaks OAuth2 and is read through its API instead.
+type OIDCProviderConfig struct {
+	// Name identifies the provider in the sign-in URLs and the linked identities
+	Name         string
+	Type         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested on top of the ones the type needs
+	Scopes []string
+	// AuthURL, TokenURL and APIURL replace the endpoints of GitHub, such as for GitHub Enterprise
+	AuthURL  string
+	TokenURL string
+	APIURL   string
 }
 
 type MysqlConfig struct {
@@ -29,8 +150,46 @@ func loadDefaultConfig() *Config {
 			Password: "secret",
 			Database: "flashcard",
 		},
-		Port:             "8080",
-		AccessKeySecret:  "",
-		RefreshKeySecret: "",
+		MailerConfig: &MailerConfig{
+			Driver:         "log",
+			From:           "Flashcard <no-reply@flashcard.local>",
+			Port:           "587",
+			Dir:            "./storage/mail",
+			TimeoutSeconds: 10,
+		},
+		ThrottleConfig: &ThrottleConfig{
+			Driver:            "memory",
+			RedisAddr:         "localhost:6379",
+			AccountAttempts:   5,
+			IPAttempts:        20,
+			LockoutSeconds:    30,
+			MaxLockoutMinutes: 15,
+			WindowMinutes:     60,
+		},
+		Port:                         "8080",
+		AccessKeySecret:              "",
+		RefreshKeySecret:             "",
+		TrashRetentionDays:           30,
+		StorageDir:                   "./storage",
+		MaxUploadSizeMB:              512,
+		MaxUnpackedSizeMB:            1024,
+		AccountDeletionGraceDays:     14,
+		LibraryReportHideThreshold:   5,
+		CardRevisionRetentionDays:    90,
+		CardRevisionMaxPerCard:       50,
+		AccessTokenTTLMinutes:        60,
+		RefreshTokenTTLDays:          30,
+		SessionCacheTTLSeconds:       30,
+		ActionKeySecret:              "",
+		AppURL:                       "http://localhost:3000",
+		EmailVerificationTTLHours:    48,
+		PasswordResetTTLMinutes:      60,
+		PasswordMinLength:            8,
+		PasswordMinClasses:           2,
+		PublicURL:                    "http://localhost:8080",
+		TwoFactorKey:                 "",
+		TwoFactorIssuer:              "Flashcard",
+		TwoFactorChallengeTTLMinutes: 5,
+		AccessTokenMaxDays:           365,
 	}
 }
@@ -5,6 +5,52 @@ const (
 	DefaultLimit    = 10
 	DefaultPage     = 1
 	DefaultPageSize = 10
+	MaxBulkCards    = 10000
 )
 
 const UserContextKey = "user_context_key"
+
+// SessionContextKey holds the id of the session the request was authenticated with.
+const SessionContextKey = "session_context_key"
+
+// Scopes of personal access tokens, each route accepting tokens names the scopes that grant it.
+const (
+	ScopeDecksRead    = "decks:read"
+	ScopeDecksWrite   = "decks:write"
+	ScopeCardsRead    = "cards:read"
+	ScopeCardsWrite   = "cards:write"
+	ScopeStudy        = "study"
+	ScopeLibraryRead  = "library:read"
+	ScopeLibraryWrite = "library:write"
+	ScopeImports      = "imports"
+	ScopeExports      = "exports"
+	ScopeUserRead     = "user:read"
+)
+
+var Scopes = []string{
+	ScopeDecksRead, ScopeDecksWrite, ScopeCardsRead, ScopeCardsWrite, ScopeStudy,
+	ScopeLibraryRead, ScopeLibraryWrite, ScopeImports, ScopeExports, ScopeUserRead,
+}
+
+// AccessTokenPrefix starts personal access tokens, which tells them apart from access JWTs.
+const AccessTokenPrefix = "fcp_"
+
+const DeckPathSeparator = "::"
+
+// DeckFileSchema and DeckFileVersion identify the JSON format of deck exports and imports.
+const (
+	DeckFileSchema  = "flashcard-deck"
+	DeckFileVersion = 1
+)
+
+// AccountExportSchema and AccountExportVersion identify the manifest of account data exports.
+const (
+	AccountExportSchema  = "flashcard-account"
+	AccountExportVersion = 1
+)
+
+// Orders of the public deck library.
+const (
+	LibrarySortRecent  = "recent"
+	LibrarySortPopular = "popular"
+)
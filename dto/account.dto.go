@@ -0,0 +1,94 @@
+package dto
+
+import "time"
+
+// AccountExportManifest describes the files of an account data export, it is stored as manifest.json.
+type AccountExportManifest struct {
+	Schema     string              `json:"schema"`
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exportedAt"`
+	UserID     int32               `json:"userId"`
+	Files      []AccountExportFile `json:"files"`
+}
+
+type AccountExportFile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Count       int    `json:"count"`
+}
+
+type AccountExportResult struct {
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type AccountProfile struct {
+	ID                  int32      `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt"`
+}
+
+type AccountDeck struct {
+	ID          int32      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ParentID    *int32     `json:"parentId"`
+	Path        string     `json:"path"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	DeletedAt   *time.Time `json:"deletedAt"`
+}
+
+type AccountCard struct {
+	ID               int32      `json:"id"`
+	GUID             string     `json:"guid"`
+	DeckID           int32      `json:"deckId"`
+	Front            string     `json:"front"`
+	Back             string     `json:"back"`
+	Tags             []string   `json:"tags"`
+	TypeAnswer       bool       `json:"typeAnswer"`
+	EasinessFactor   float32    `json:"easinessFactor"`
+	RepetitionNumber int32      `json:"repetitionNumber"`
+	IntervalNumber   int32      `json:"intervalNumber"`
+	StudyTime        time.Time  `json:"studyTime"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	DeletedAt        *time.Time `json:"deletedAt"`
+}
+
+type AccountReview struct {
+	CardID           int32     `json:"cardId"`
+	Quality          int32     `json:"quality"`
+	EasinessFactor   float32   `json:"easinessFactor"`
+	RepetitionNumber int32     `json:"repetitionNumber"`
+	IntervalNumber   int32     `json:"intervalNumber"`
+	ReviewedAt       time.Time `json:"reviewedAt"`
+}
+
+type AccountCardProgress struct {
+	CardID           int32     `json:"cardId"`
+	EasinessFactor   float32   `json:"easinessFactor"`
+	RepetitionNumber int32     `json:"repetitionNumber"`
+	IntervalNumber   int32     `json:"intervalNumber"`
+	StudyTime        time.Time `json:"studyTime"`
+}
+
+type AccountMedia struct {
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Path        string    `json:"path"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	// Confirmation must repeat the email of the account.
+	Confirmation string `json:"confirmation"`
+}
+
+type DeleteAccountResponse struct {
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
@@ -0,0 +1,89 @@
+package dto
+
+import "time"
+
+type AdminGetUsersRequest struct {
+	// Query matches the name or the email.
+	Query    string
+	Role     string
+	Disabled *bool
+	Page     int
+	PageSize int
+}
+
+type AdminGetUsersResponse struct {
+	Pagination
+	Users []AdminUserItem `json:"users"`
+}
+
+type AdminGetUserResponse struct {
+	User AdminUserItem `json:"user"`
+}
+
+type AdminUserItem struct {
+	ID                  int32      `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	Role                string     `json:"role"`
+	EmailVerified       bool       `json:"emailVerified"`
+	HasPassword         bool       `json:"hasPassword"`
+	TwoFactorEnabled    bool       `json:"twoFactorEnabled"`
+	DisabledAt          *time.Time `json:"disabledAt"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+}
+
+type CountUsersRequest struct {
+	Disabled     bool
+	CreatedAfter *time.Time
+}
+
+type AdminUpdateUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// AdminGetStatsResponse counts what the application holds, decks and cards in the trash are left
+// out.
+type AdminGetStatsResponse struct {
+	Users         int64 `json:"users"`
+	DisabledUsers int64 `json:"disabledUsers"`
+	// NewUsers signed up in the last 7 days.
+	NewUsers int64 `json:"newUsers"`
+	Decks    int64 `json:"decks"`
+	Cards    int64 `json:"cards"`
+	Reviews  int64 `json:"reviews"`
+	// RecentReviews were made in the last 7 days.
+	RecentReviews  int64 `json:"recentReviews"`
+	PublishedDecks int64 `json:"publishedDecks"`
+	HiddenDecks    int64 `json:"hiddenDecks"`
+}
+
+type AdminGetLibraryRequest struct {
+	Query    string
+	Hidden   *bool
+	Page     int
+	PageSize int
+}
+
+type AdminGetLibraryResponse struct {
+	Pagination
+	Decks []AdminLibraryDeckItem `json:"decks"`
+}
+
+type AdminLibraryDeckItem struct {
+	LibraryDeckItem
+	AuthorID    int32 `json:"authorId"`
+	ReportCount int32 `json:"reportCount"`
+}
+
+type AdminGetDeckReportsResponse struct {
+	Reports []DeckReportItem `json:"reports"`
+}
+
+type DeckReportItem struct {
+	ID        int32     `json:"id"`
+	UserID    int32     `json:"userId"`
+	Reason    string    `json:"reason"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"createdAt"`
+}
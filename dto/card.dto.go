@@ -3,27 +3,44 @@ package dto
 import "time"
 
 type CreateCardRequest struct {
-	Front  string `json:"front"`
-	Back   string `json:"back"`
-	DeckID int32  `json:"deckId"`
-	UserID int32
+	Front      string   `json:"front"`
+	Back       string   `json:"back"`
+	DeckID     int32    `json:"deckId"`
+	Tags       []string `json:"tags"`
+	TypeAnswer bool     `json:"typeAnswer"`
+	UserID     int32
 }
 
 type UpdateCardRequest struct {
-	ID    int32  `json:"id"`
-	Front string `json:"front"`
-	Back  string `json:"back"`
+	ID int32 `json:"id"`
+	// Front, Back and TypeAnswer are left unchanged when omitted.
+	Front      *string `json:"front"`
+	Back       *string `json:"back"`
+	TypeAnswer *bool   `json:"typeAnswer"`
 }
 
 type GetCardsRequest struct {
 	ID          int32
+	IDs         []int32
 	DeckID      int32
+	DeckIDs     []int32
 	UserID      int32
 	Front       string
 	Back        string
 	Page        int
 	PageSize    int
 	StudyTimeTo *time.Time
+	// WithDeleted includes the cards in the trash.
+	WithDeleted bool
+	// ProgressUserID reads the scheduling state of the cards from the progress of this
+	// collaborator instead of the card itself.
+	ProgressUserID int32
+	// New keeps only the cards ReviewerID never reviewed when true, or already reviewed when false.
+	New        *bool
+	ReviewerID int32
+	// Limit and Offset bound GetAllCards.
+	Limit  int
+	Offset int
 }
 
 type GetCardsResponse struct {
@@ -32,14 +49,88 @@ type GetCardsResponse struct {
 }
 
 type CardItem struct {
-	ID            int32   `json:"id"`
-	Front         string  `json:"front"`
-	Back          string  `json:"back"`
-	DeckID        int32   `json:"deckId"`
-	EstimatedTime []int32 `json:"estimatedTime"`
+	ID            int32    `json:"id"`
+	Front         string   `json:"front"`
+	Back          string   `json:"back"`
+	DeckID        int32    `json:"deckId"`
+	Tags          []string `json:"tags"`
+	TypeAnswer    bool     `json:"typeAnswer"`
+	EstimatedTime []int32  `json:"estimatedTime"`
 }
 
 type StudyCardRequest struct {
 	CardId            int32 `json:"cardId"`
 	QualityOfResponse int32 `json:"qualityOfResponse"`
 }
+
+// CheckAnswerRequest compares a typed answer with the back of a card. Case and punctuation are
+// ignored and accents are not unless told otherwise.
+type CheckAnswerRequest struct {
+	CardID            int32  `json:"cardId"`
+	Answer            string `json:"answer"`
+	IgnoreCase        *bool  `json:"ignoreCase"`
+	IgnoreAccents     *bool  `json:"ignoreAccents"`
+	IgnorePunctuation *bool  `json:"ignorePunctuation"`
+}
+
+type CheckAnswerResponse struct {
+	CardID int32 `json:"cardId"`
+	// Expected is the accepted answer closest to the typed one.
+	Expected     string              `json:"expected"`
+	Alternatives []string            `json:"alternatives"`
+	Correct      bool                `json:"correct"`
+	Distance     int                 `json:"distance"`
+	Similarity   float64             `json:"similarity"`
+	Diff         []AnswerDiffSegment `json:"diff"`
+	// SuggestedQualityOfResponse is the grade to submit to the study endpoint.
+	SuggestedQualityOfResponse int32 `json:"suggestedQualityOfResponse"`
+}
+
+// AnswerDiffSegment is a run of characters that are equal in both answers, missing from the
+// typed answer or extra in it.
+type AnswerDiffSegment struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type BulkCardsRequest struct {
+	CardIDs         []int32     `json:"cardIds"`
+	Query           *CardsQuery `json:"query"`
+	TargetDeckID    int32       `json:"targetDeckId"`
+	ResetScheduling bool        `json:"resetScheduling"`
+}
+
+type CardsQuery struct {
+	DeckID int32  `json:"deckId"`
+	Front  string `json:"front"`
+	Back   string `json:"back"`
+}
+
+type BulkCardsResponse struct {
+	Count int `json:"count"`
+}
+
+type GetCardRevisionsResponse struct {
+	CardID         int32              `json:"cardId"`
+	ContentVersion int32              `json:"contentVersion"`
+	Revisions      []CardRevisionItem `json:"revisions"`
+}
+
+// CardRevisionItem is an edit of a card, with the content the card had before it.
+type CardRevisionItem struct {
+	ID        int32                `json:"id"`
+	Version   int32                `json:"version"`
+	UserID    int32                `json:"userId"`
+	UserName  string               `json:"userName"`
+	Front     string               `json:"front"`
+	Back      string               `json:"back"`
+	Tags      []string             `json:"tags"`
+	Changes   []CardRevisionChange `json:"changes"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+type CardRevisionChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
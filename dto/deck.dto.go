@@ -3,7 +3,10 @@ package dto
 type CreateDeckRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	ParentID    *int32 `json:"parentId"`
 	UserID      int32
+	// SourceDeckID links the deck to the deck of a published deck it is the subscribed copy of.
+	SourceDeckID *int32
 }
 
 type UpdateDeckRequest struct {
@@ -12,12 +15,18 @@ type UpdateDeckRequest struct {
 	Description string `json:"description"`
 }
 
+type MoveDeckRequest struct {
+	ID       int32  `json:"id"`
+	ParentID *int32 `json:"parentId"`
+}
+
 type GetDecksRequest struct {
 	ID       int32
 	Name     string
 	UserID   int32
 	Page     int
 	PageSize int
+	Tree     bool
 }
 
 type GetDecksResponse struct {
@@ -26,9 +35,14 @@ type GetDecksResponse struct {
 }
 
 type DeckItem struct {
-	ID          int32  `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	TotalCards  int32  `json:"totalCards"`
-	CardsLeft   int32  `json:"cardsLeft"`
+	ID          int32      `json:"id"`
+	Name        string     `json:"name"`
+	Path        string     `json:"path"`
+	Description string     `json:"description"`
+	ParentID    *int32     `json:"parentId"`
+	PresetID    *int32     `json:"presetId"`
+	TotalCards  int32      `json:"totalCards"`
+	CardsLeft   int32      `json:"cardsLeft"`
+	Role        string     `json:"role,omitempty"`
+	Children    []DeckItem `json:"children,omitempty"`
 }
@@ -0,0 +1,50 @@
+package dto
+
+import "time"
+
+type InviteDeckMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type UpdateDeckMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type GetDeckMembersResponse struct {
+	Members []DeckMemberItem `json:"members"`
+}
+
+type DeckMemberItem struct {
+	ID         int32      `json:"id"`
+	DeckID     int32      `json:"deckId"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	Accepted   bool       `json:"accepted"`
+	AcceptedAt *time.Time `json:"acceptedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type GetInvitationsResponse struct {
+	Invitations []InvitationItem `json:"invitations"`
+}
+
+type InvitationItem struct {
+	ID        int32     `json:"id"`
+	DeckID    int32     `json:"deckId"`
+	DeckName  string    `json:"deckName"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invitedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type GetSharedDecksResponse struct {
+	Decks []SharedDeckItem `json:"decks"`
+}
+
+// SharedDeckItem is a deck of another user the user is a collaborator on.
+type SharedDeckItem struct {
+	DeckItem
+	OwnerName  string `json:"ownerName"`
+	OwnerEmail string `json:"ownerEmail"`
+}
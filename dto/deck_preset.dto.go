@@ -0,0 +1,51 @@
+package dto
+
+import "time"
+
+// SaveDeckPresetRequest creates or updates a preset, LearningSteps are in minutes and intervals in days.
+// The omitted interval options default to plain SM-2.
+type SaveDeckPresetRequest struct {
+	Name             string   `json:"name"`
+	NewPerDay        int32    `json:"newPerDay"`
+	ReviewsPerDay    int32    `json:"reviewsPerDay"`
+	LearningSteps    []int32  `json:"learningSteps"`
+	StartingEase     float32  `json:"startingEase"`
+	MinimumEase      *float32 `json:"minimumEase"`
+	FirstInterval    *int32   `json:"firstInterval"`
+	SecondInterval   *int32   `json:"secondInterval"`
+	EasyBonus        *float32 `json:"easyBonus"`
+	HardMultiplier   *float32 `json:"hardMultiplier"`
+	IntervalModifier *float32 `json:"intervalModifier"`
+	MaxInterval      int32    `json:"maxInterval"`
+	DesiredRetention float32  `json:"desiredRetention"`
+}
+
+type GetDeckPresetsResponse struct {
+	Presets []DeckPresetItem `json:"presets"`
+}
+
+type DeckPresetItem struct {
+	ID               int32     `json:"id"`
+	Name             string    `json:"name"`
+	NewPerDay        int32     `json:"newPerDay"`
+	ReviewsPerDay    int32     `json:"reviewsPerDay"`
+	LearningSteps    []int32   `json:"learningSteps"`
+	StartingEase     float32   `json:"startingEase"`
+	MinimumEase      float32   `json:"minimumEase"`
+	FirstInterval    int32     `json:"firstInterval"`
+	SecondInterval   int32     `json:"secondInterval"`
+	EasyBonus        float32   `json:"easyBonus"`
+	HardMultiplier   float32   `json:"hardMultiplier"`
+	IntervalModifier float32   `json:"intervalModifier"`
+	MaxInterval      int32     `json:"maxInterval"`
+	DesiredRetention float32   `json:"desiredRetention"`
+	DeckIDs          []int32   `json:"deckIds"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// AssignDeckPresetRequest sets the preset of the decks, a null presetId unassigns it.
+type AssignDeckPresetRequest struct {
+	DeckIDs  []int32 `json:"deckIds"`
+	PresetID *int32  `json:"presetId"`
+}
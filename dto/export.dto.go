@@ -0,0 +1,40 @@
+package dto
+
+import "time"
+
+type ExportDeckRequest struct {
+	ID                int32
+	Format            string
+	IncludeScheduling bool
+	// ProgressUserID exports the scheduling state of this collaborator, see GetCardsRequest.
+	ProgressUserID int32
+}
+
+// DeckFile is the JSON format of deck exports, described in the README. Exports stream the
+// cards after the other fields, imports require schema and version to come before cards.
+type DeckFile struct {
+	Schema     string         `json:"schema"`
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exportedAt"`
+	Deck       string         `json:"deck"`
+	Cards      []DeckFileCard `json:"cards,omitempty"`
+}
+
+type DeckFileCard struct {
+	Front string   `json:"front"`
+	Back  string   `json:"back"`
+	Tags  []string `json:"tags"`
+	// TypeAnswer asks for the back to be typed when studying.
+	TypeAnswer bool `json:"typeAnswer,omitempty"`
+	// Deck is the path of the deck of the card relative to the parent of the exported deck,
+	// so the exported deck itself is the first level.
+	Deck       string              `json:"deck"`
+	Scheduling *DeckFileScheduling `json:"scheduling,omitempty"`
+}
+
+type DeckFileScheduling struct {
+	EasinessFactor   float32   `json:"easinessFactor"`
+	RepetitionNumber int32     `json:"repetitionNumber"`
+	IntervalNumber   int32     `json:"intervalNumber"`
+	StudyTime        time.Time `json:"studyTime"`
+}
@@ -0,0 +1,42 @@
+package dto
+
+type ImportSummary struct {
+	Decks        int           `json:"decks"`
+	Cards        int           `json:"cards"`
+	Reviews      int           `json:"reviews"`
+	Media        int           `json:"media"`
+	SkippedCount int           `json:"skippedCount"`
+	Skipped      []SkippedItem `json:"skipped"`
+}
+
+type SkippedItem struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type CSVPreviewResponse struct {
+	UploadID  string     `json:"uploadId"`
+	Encoding  string     `json:"encoding"`
+	Delimiter string     `json:"delimiter"`
+	Columns   int        `json:"columns"`
+	Rows      [][]string `json:"rows"`
+}
+
+type CSVImportRequest struct {
+	UploadID string `json:"uploadId"`
+	// Encoding and Delimiter override the detected values when set.
+	Encoding  string           `json:"encoding"`
+	Delimiter string           `json:"delimiter"`
+	HasHeader bool             `json:"hasHeader"`
+	DeckID    int32            `json:"deckId"`
+	Mapping   CSVColumnMapping `json:"mapping"`
+}
+
+// CSVColumnMapping holds the zero based indexes of the columns holding each card field.
+type CSVColumnMapping struct {
+	Front    *int `json:"front"`
+	Back     *int `json:"back"`
+	Tags     *int `json:"tags"`
+	DeckPath *int `json:"deckPath"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobItem struct {
+	ID         int32           `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Progress   int32           `json:"progress"`
+	Total      int32           `json:"total"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+}
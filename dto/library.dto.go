@@ -0,0 +1,90 @@
+package dto
+
+import "time"
+
+type PublishDeckRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Language    string   `json:"language"`
+	Tags        []string `json:"tags"`
+}
+
+type GetLibraryRequest struct {
+	Query    string
+	Language string
+	Tag      string
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+type GetLibraryResponse struct {
+	Pagination
+	Decks []LibraryDeckItem `json:"decks"`
+}
+
+type LibraryDeckItem struct {
+	ID              int32     `json:"id"`
+	DeckID          int32     `json:"deckId"`
+	Title           string    `json:"title"`
+	Description     string    `json:"description"`
+	Language        string    `json:"language"`
+	Tags            []string  `json:"tags"`
+	Author          string    `json:"author"`
+	CardCount       int32     `json:"cardCount"`
+	SubscriberCount int32     `json:"subscriberCount"`
+	ForkCount       int32     `json:"forkCount"`
+	Hidden          bool      `json:"hidden,omitempty"`
+	PublishedAt     time.Time `json:"publishedAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// LibraryCopyResponse is the result of subscribing to or forking a published deck.
+type LibraryCopyResponse struct {
+	DeckID int32 `json:"deckId"`
+	Decks  int   `json:"decks"`
+	Cards  int   `json:"cards"`
+}
+
+// SyncSubscriptionResponse is the result of a sync job, Conflicts counts the fields left alone
+// because they were edited both upstream and locally.
+type SyncSubscriptionResponse struct {
+	DeckID    int32 `json:"deckId"`
+	Decks     int   `json:"decks"`
+	Added     int   `json:"added"`
+	Updated   int   `json:"updated"`
+	Conflicts int   `json:"conflicts"`
+}
+
+type ReportDeckRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+type GetSubscriptionsResponse struct {
+	Subscriptions []SubscriptionItem `json:"subscriptions"`
+}
+
+// SubscriptionItem is a library deck the user is subscribed to, with the local copy of it.
+type SubscriptionItem struct {
+	Deck        LibraryDeckItem `json:"deck"`
+	LocalDeckID int32           `json:"localDeckId"`
+	SyncedAt    *time.Time      `json:"syncedAt"`
+}
+
+type GetCardConflictsResponse struct {
+	Conflicts []CardConflictItem `json:"conflicts"`
+}
+
+type CardConflictItem struct {
+	ID            int32     `json:"id"`
+	CardID        int32     `json:"cardId"`
+	Field         string    `json:"field"`
+	LocalValue    string    `json:"localValue"`
+	UpstreamValue string    `json:"upstreamValue"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type ResolveCardConflictRequest struct {
+	Keep string `json:"keep"`
+}
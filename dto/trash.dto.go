@@ -0,0 +1,37 @@
+package dto
+
+import "time"
+
+type GetTrashRequest struct {
+	UserID  int32
+	DeckIDs []int32
+	CardIDs []int32
+}
+
+type TrashItemsRequest struct {
+	DeckIDs []int32 `json:"deckIds"`
+	CardIDs []int32 `json:"cardIds"`
+}
+
+type GetTrashResponse struct {
+	Decks []TrashDeckItem `json:"decks"`
+	Cards []TrashCardItem `json:"cards"`
+}
+
+type TrashDeckItem struct {
+	ID         int32     `json:"id"`
+	Name       string    `json:"name"`
+	ParentID   *int32    `json:"parentId"`
+	TotalCards int32     `json:"totalCards"`
+	DeletedAt  time.Time `json:"deletedAt"`
+	PurgeAt    time.Time `json:"purgeAt"`
+}
+
+type TrashCardItem struct {
+	ID        int32     `json:"id"`
+	Front     string    `json:"front"`
+	Back      string    `json:"back"`
+	DeckID    int32     `json:"deckId"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "time"
+
 type GetUserRequest struct {
 	ID    int32
 	Email string
@@ -10,9 +12,15 @@ type GetUserResponse struct {
 }
 
 type UserItem struct {
-	ID    int32  `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID                  int32      `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"emailVerified"`
+	PendingEmail        *string    `json:"pendingEmail"`
+	HasPassword         bool       `json:"hasPassword"`
+	TwoFactorEnabled    bool       `json:"twoFactorEnabled"`
+	DeletionScheduledAt *time.Time `json:"deletionScheduledAt"`
+	Role                string     `json:"role"`
 }
 
 type CreateUserRequest struct {
@@ -21,6 +29,18 @@ type CreateUserRequest struct {
 	Password string `json:"password"`
 }
 
+// UpdateUserRequest changes the fields that are set, changing the email requires CurrentPassword.
+type UpdateUserRequest struct {
+	Name            *string `json:"name"`
+	Email           *string `json:"email"`
+	CurrentPassword string  `json:"currentPassword"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
 type CreateUserResponse struct {
 	ID int32 `json:"id"`
 }
@@ -30,6 +50,117 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// LoginResponse has the tokens of the new session, or when the user enabled two-factor
+// authentication the challenge token to send with the second factor to POST /login/2fa.
 type LoginResponse struct {
-	AccessToken string `json:"accessToken"`
+	AccessToken       string `json:"accessToken,omitempty"`
+	RefreshToken      string `json:"refreshToken,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"`
+}
+
+// LoginTwoFactorRequest completes a login with a TOTP code or a recovery code.
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type GetSessionsResponse struct {
+	Sessions []SessionItem `json:"sessions"`
+}
+
+type SessionItem struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"userAgent"`
+	IP        string `json:"ip"`
+	// Current is the session the request listing the sessions was made with.
+	Current    bool      `json:"current"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type ConfirmEmailVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+type RequestPasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type GetOIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+type GetUserIdentitiesResponse struct {
+	Identities []UserIdentityItem `json:"identities"`
+}
+
+type UserIdentityItem struct {
+	ID         int32     `json:"id"`
+	Provider   string    `json:"provider"`
+	Email      string    `json:"email"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type EnrollTwoFactorResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI authenticator apps enroll from, usually shown as a QR code.
+	URI string `json:"uri"`
+}
+
+type ActivateTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorRequest proves the second factor with a TOTP code or a recovery code, along with the
+// password of accounts that have one.
+type TwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type RecoveryCodesResponse struct {
+	// RecoveryCodes are only shown once.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays defaults to the longest lifetime allowed.
+	ExpiresInDays *int `json:"expiresInDays"`
+}
+
+type CreateAccessTokenResponse struct {
+	// Token is only shown once.
+	Token       string          `json:"token"`
+	AccessToken AccessTokenItem `json:"accessToken"`
+}
+
+type GetAccessTokensResponse struct {
+	AccessTokens []AccessTokenItem `json:"accessTokens"`
+}
+
+type AccessTokenItem struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+	CreatedAt  time.Time  `json:"createdAt"`
 }
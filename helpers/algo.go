@@ -1,11 +1,16 @@
 package helpers
 
-import "math"
+import (
+	"math"
+	"time"
+)
 
-func ExecuteSm2Algo(q int32, ef float32, n int32, i int32) (int32, float32, int32, int32) {
+// ExecuteSm2Algo applies an answer of quality q to the easiness factor ef, repetition number n and
+// interval i of a card with the SM-2 algorithm tuned by params.
+func ExecuteSm2Algo(q int32, ef float32, n int32, i int32, params SchedulerParams) (int32, float32, int32, int32) {
 	ef = ef + (0.1 - (5.0-float32(q))*(0.08+(5.0-float32(q))*0.02))
-	if ef < 1.3 {
-		ef = 1.3
+	if ef < params.MinimumEase {
+		ef = params.MinimumEase
 	}
 
 	if q < 3 {
@@ -14,16 +19,108 @@ func ExecuteSm2Algo(q int32, ef float32, n int32, i int32) (int32, float32, int3
 	} else {
 		n += 1
 		if n == 1 {
-			i = 1
+			i = params.FirstInterval
 		} else if n == 2 {
-			i = 6
+			i = params.SecondInterval
 		} else {
-			i = int32(math.Round(float64(i) * float64(ef)))
-			if i < 1 {
-				i = 1
+			interval := float64(i) * float64(ef)
+			if q == 3 && params.HardMultiplier > 0 {
+				interval = float64(i) * float64(params.HardMultiplier)
+			}
+			if q == 5 && params.EasyBonus > 0 {
+				interval *= float64(params.EasyBonus)
 			}
+			if params.IntervalModifier > 0 {
+				interval *= float64(params.IntervalModifier)
+			}
+			i = int32(math.Round(interval))
 		}
+		if i < 1 {
+			i = 1
+		}
+	}
+	if params.MaxInterval > 0 && i > params.MaxInterval {
+		i = params.MaxInterval
 	}
 
 	return q, ef, n, i
 }
+
+// SchedulerParams are the study options of a deck that drive the scheduling of its cards.
+type SchedulerParams struct {
+	// LearningSteps are the delays in minutes before a new or failed card is shown again, until it graduates.
+	LearningSteps []int32
+	StartingEase  float32
+	MinimumEase   float32
+	// FirstInterval and SecondInterval are the intervals in days after the first two successful reviews.
+	FirstInterval  int32
+	SecondInterval int32
+	// EasyBonus multiplies the interval grown by a perfect answer.
+	EasyBonus float32
+	// HardMultiplier grows the interval after a difficult answer instead of the ease, 0 grows it by the ease.
+	HardMultiplier float32
+	// IntervalModifier multiplies every interval grown from the previous one.
+	IntervalModifier float32
+	// MaxInterval caps the interval in days, 0 leaves it uncapped.
+	MaxInterval int32
+}
+
+// DefaultSchedulerParams schedule cards with plain SM-2.
+func DefaultSchedulerParams() SchedulerParams {
+	return SchedulerParams{
+		StartingEase:     2.5,
+		MinimumEase:      1.3,
+		FirstInterval:    1,
+		SecondInterval:   6,
+		EasyBonus:        1,
+		IntervalModifier: 1,
+	}
+}
+
+// CardSchedule is the scheduling state of a card.
+type CardSchedule struct {
+	EasinessFactor   float32
+	RepetitionNumber int32
+	IntervalNumber   int32
+	LearningStep     int32
+}
+
+// ScheduleCard returns the state of a card after an answer of quality q, and how long until it is due.
+// Cards that never graduated start from the starting ease. New and failed cards go through the learning
+// steps without changing their ease, then graduate to the SM-2 intervals.
+func ScheduleCard(q int32, state CardSchedule, params SchedulerParams) (CardSchedule, time.Duration) {
+	if state.RepetitionNumber == 0 && state.IntervalNumber == 0 {
+		state.EasinessFactor = params.StartingEase
+	}
+	if state.RepetitionNumber == 0 && len(params.LearningSteps) > 0 {
+		if q < 3 {
+			state.LearningStep = 0
+			return state, learningStepDelay(params, 0)
+		}
+		if int(state.LearningStep)+1 < len(params.LearningSteps) {
+			state.LearningStep++
+			return state, learningStepDelay(params, state.LearningStep)
+		}
+		state.LearningStep = 0
+	}
+
+	_, state.EasinessFactor, state.RepetitionNumber, state.IntervalNumber = ExecuteSm2Algo(q, state.EasinessFactor, state.RepetitionNumber, state.IntervalNumber, params)
+	if state.RepetitionNumber == 0 && len(params.LearningSteps) > 0 {
+		// a failed review goes back to the first learning step
+		return state, learningStepDelay(params, 0)
+	}
+	return state, 24 * time.Duration(state.IntervalNumber) * time.Hour
+}
+
+func learningStepDelay(params SchedulerParams, step int32) time.Duration {
+	return time.Duration(params.LearningSteps[step]) * time.Minute
+}
+
+// RetentionIntervalModifier converts a desired retention into the interval modifier that reaches it,
+// SM-2 intervals aim at a retention of 90%.
+func RetentionIntervalModifier(desiredRetention float32) float32 {
+	if desiredRetention <= 0 || desiredRetention >= 1 {
+		return 1
+	}
+	return float32(math.Log(float64(desiredRetention)) / math.Log(0.9))
+}
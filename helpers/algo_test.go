@@ -0,0 +1,310 @@
+package helpers
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func withParams(change func(params *SchedulerParams)) SchedulerParams {
+	params := DefaultSchedulerParams()
+	change(&params)
+	return params
+}
+
+func TestExecuteSm2Algo(t *testing.T) {
+	tests := []struct {
+		name   string
+		q      int32
+		ef     float32
+		n      int32
+		i      int32
+		params SchedulerParams
+		wantEf float32
+		wantN  int32
+		wantI  int32
+	}{
+		{
+			name:   "first review",
+			q:      4,
+			ef:     2.5,
+			params: DefaultSchedulerParams(),
+			wantEf: 2.5,
+			wantN:  1,
+			wantI:  1,
+		},
+		{
+			name:   "second review",
+			q:      4,
+			ef:     2.5,
+			n:      1,
+			i:      1,
+			params: DefaultSchedulerParams(),
+			wantEf: 2.5,
+			wantN:  2,
+			wantI:  6,
+		},
+		{
+			name:   "interval grows by the ease",
+			q:      4,
+			ef:     2.5,
+			n:      2,
+			i:      6,
+			params: DefaultSchedulerParams(),
+			wantEf: 2.5,
+			wantN:  3,
+			wantI:  15,
+		},
+		{
+			name:   "perfect answer raises the ease",
+			q:      5,
+			ef:     2.5,
+			n:      2,
+			i:      6,
+			params: DefaultSchedulerParams(),
+			wantEf: 2.6,
+			wantN:  3,
+			wantI:  16,
+		},
+		{
+			name:   "failure resets the repetitions",
+			q:      1,
+			ef:     2.5,
+			n:      5,
+			i:      40,
+			params: DefaultSchedulerParams(),
+			wantEf: 1.96,
+			wantN:  0,
+			wantI:  1,
+		},
+		{
+			name:   "ease stops at the default minimum",
+			q:      3,
+			ef:     1.3,
+			n:      3,
+			i:      10,
+			params: DefaultSchedulerParams(),
+			wantEf: 1.3,
+			wantN:  4,
+			wantI:  13,
+		},
+		{
+			name:   "ease stops at a lower minimum",
+			q:      3,
+			ef:     1.3,
+			n:      3,
+			i:      10,
+			params: withParams(func(p *SchedulerParams) { p.MinimumEase = 1.1 }),
+			wantEf: 1.16,
+			wantN:  4,
+			wantI:  12,
+		},
+		{
+			name:   "custom first interval",
+			q:      4,
+			ef:     2.5,
+			params: withParams(func(p *SchedulerParams) { p.FirstInterval = 2 }),
+			wantEf: 2.5,
+			wantN:  1,
+			wantI:  2,
+		},
+		{
+			name:   "custom second interval",
+			q:      4,
+			ef:     2.5,
+			n:      1,
+			i:      2,
+			params: withParams(func(p *SchedulerParams) { p.SecondInterval = 4 }),
+			wantEf: 2.5,
+			wantN:  2,
+			wantI:  4,
+		},
+		{
+			name:   "hard multiplier replaces the ease",
+			q:      3,
+			ef:     2.5,
+			n:      3,
+			i:      10,
+			params: withParams(func(p *SchedulerParams) { p.HardMultiplier = 1.2 }),
+			wantEf: 2.36,
+			wantN:  4,
+			wantI:  12,
+		},
+		{
+			name:   "hard multiplier leaves good answers alone",
+			q:      4,
+			ef:     2.5,
+			n:      3,
+			i:      10,
+			params: withParams(func(p *SchedulerParams) { p.HardMultiplier = 1.2 }),
+			wantEf: 2.5,
+			wantN:  4,
+			wantI:  25,
+		},
+		{
+			name:   "easy bonus",
+			q:      5,
+			ef:     2.5,
+			n:      3,
+			i:      10,
+			params: withParams(func(p *SchedulerParams) { p.EasyBonus = 1.3 }),
+			wantEf: 2.6,
+			wantN:  4,
+			wantI:  34,
+		},
+		{
+			name:   "interval modifier",
+			q:      4,
+			ef:     2.5,
+			n:      3,
+			i:      10,
+			params: withParams(func(p *SchedulerParams) { p.IntervalModifier = 0.8 }),
+			wantEf: 2.5,
+			wantN:  4,
+			wantI:  20,
+		},
+		{
+			name:   "interval modifier leaves the first intervals alone",
+			q:      4,
+			ef:     2.5,
+			n:      1,
+			i:      1,
+			params: withParams(func(p *SchedulerParams) { p.IntervalModifier = 0.8 }),
+			wantEf: 2.5,
+			wantN:  2,
+			wantI:  6,
+		},
+		{
+			name:   "maximum interval",
+			q:      4,
+			ef:     2.5,
+			n:      3,
+			i:      20,
+			params: withParams(func(p *SchedulerParams) { p.MaxInterval = 30 }),
+			wantEf: 2.5,
+			wantN:  4,
+			wantI:  30,
+		},
+		{
+			name:   "maximum interval below the second interval",
+			q:      4,
+			ef:     2.5,
+			n:      1,
+			i:      1,
+			params: withParams(func(p *SchedulerParams) { p.MaxInterval = 3 }),
+			wantEf: 2.5,
+			wantN:  2,
+			wantI:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ef, n, i := ExecuteSm2Algo(tt.q, tt.ef, tt.n, tt.i, tt.params)
+			if math.Abs(float64(ef-tt.wantEf)) > 1e-4 || n != tt.wantN || i != tt.wantI {
+				t.Errorf("ExecuteSm2Algo() = (%v, %v, %v), want (%v, %v, %v)", ef, n, i, tt.wantEf, tt.wantN, tt.wantI)
+			}
+		})
+	}
+}
+
+func TestScheduleCard(t *testing.T) {
+	learning := withParams(func(p *SchedulerParams) { p.LearningSteps = []int32{1, 10} })
+	tests := []struct {
+		name      string
+		q         int32
+		state     CardSchedule
+		params    SchedulerParams
+		want      CardSchedule
+		wantDelay time.Duration
+	}{
+		{
+			name:      "new card starts from the starting ease",
+			q:         4,
+			state:     CardSchedule{EasinessFactor: 2.5},
+			params:    withParams(func(p *SchedulerParams) { p.StartingEase = 2.0 }),
+			want:      CardSchedule{EasinessFactor: 2.0, RepetitionNumber: 1, IntervalNumber: 1},
+			wantDelay: 24 * time.Hour,
+		},
+		{
+			name:      "reviewed card keeps its ease",
+			q:         4,
+			state:     CardSchedule{EasinessFactor: 2.2, RepetitionNumber: 1, IntervalNumber: 1},
+			params:    withParams(func(p *SchedulerParams) { p.StartingEase = 2.0 }),
+			want:      CardSchedule{EasinessFactor: 2.2, RepetitionNumber: 2, IntervalNumber: 6},
+			wantDelay: 6 * 24 * time.Hour,
+		},
+		{
+			name:      "new card enters the next learning step",
+			q:         4,
+			state:     CardSchedule{EasinessFactor: 2.5},
+			params:    learning,
+			want:      CardSchedule{EasinessFactor: 2.5, LearningStep: 1},
+			wantDelay: 10 * time.Minute,
+		},
+		{
+			name:      "last learning step graduates",
+			q:         4,
+			state:     CardSchedule{EasinessFactor: 2.5, LearningStep: 1},
+			params:    learning,
+			want:      CardSchedule{EasinessFactor: 2.5, RepetitionNumber: 1, IntervalNumber: 1},
+			wantDelay: 24 * time.Hour,
+		},
+		{
+			name:      "failed learning step restarts the steps",
+			q:         1,
+			state:     CardSchedule{EasinessFactor: 2.5, LearningStep: 1},
+			params:    learning,
+			want:      CardSchedule{EasinessFactor: 2.5},
+			wantDelay: time.Minute,
+		},
+		{
+			name:      "failed review goes back to the first learning step",
+			q:         2,
+			state:     CardSchedule{EasinessFactor: 2.5, RepetitionNumber: 3, IntervalNumber: 10},
+			params:    learning,
+			want:      CardSchedule{EasinessFactor: 2.18, IntervalNumber: 1},
+			wantDelay: time.Minute,
+		},
+		{
+			name:      "interval is capped",
+			q:         5,
+			state:     CardSchedule{EasinessFactor: 2.5, RepetitionNumber: 4, IntervalNumber: 300},
+			params:    withParams(func(p *SchedulerParams) { p.MaxInterval = 365 }),
+			want:      CardSchedule{EasinessFactor: 2.6, RepetitionNumber: 5, IntervalNumber: 365},
+			wantDelay: 365 * 24 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, delay := ScheduleCard(tt.q, tt.state, tt.params)
+			if math.Abs(float64(got.EasinessFactor-tt.want.EasinessFactor)) > 1e-4 {
+				t.Errorf("ScheduleCard() ease = %v, want %v", got.EasinessFactor, tt.want.EasinessFactor)
+			}
+			got.EasinessFactor = tt.want.EasinessFactor
+			if got != tt.want {
+				t.Errorf("ScheduleCard() = %+v, want %+v", got, tt.want)
+			}
+			if delay != tt.wantDelay {
+				t.Errorf("ScheduleCard() delay = %v, want %v", delay, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetentionIntervalModifier(t *testing.T) {
+	tests := []struct {
+		retention float32
+		want      float32
+	}{
+		{retention: 0.9, want: 1},
+		{retention: 0.8, want: 2.1179},
+		{retention: 0.95, want: 0.4868},
+		{retention: 0, want: 1},
+		{retention: 1, want: 1},
+	}
+	for _, tt := range tests {
+		if got := RetentionIntervalModifier(tt.retention); math.Abs(float64(got-tt.want)) > 1e-3 {
+			t.Errorf("RetentionIntervalModifier(%v) = %v, want %v", tt.retention, got, tt.want)
+		}
+	}
+}
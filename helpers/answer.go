@@ -0,0 +1,199 @@
+package helpers
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	AnswerDiffEqual = "equal"
+	// AnswerDiffMissing is expected text the typed answer lacks.
+	AnswerDiffMissing = "missing"
+	// AnswerDiffExtra is typed text the expected answer does not have.
+	AnswerDiffExtra = "extra"
+)
+
+// AnswerAlternativeSeparator separates the accepted answers in the back of a card.
+const AnswerAlternativeSeparator = ";"
+
+// AnswerNormalization selects the differences ignored when comparing a typed answer.
+type AnswerNormalization struct {
+	IgnoreCase        bool
+	IgnoreAccents     bool
+	IgnorePunctuation bool
+}
+
+type AnswerDiffSegment struct {
+	Op   string
+	Text string
+}
+
+// AnswerCheck is the comparison of a typed answer with the closest accepted answer.
+type AnswerCheck struct {
+	Expected     string
+	Diff         []AnswerDiffSegment
+	Distance     int
+	Similarity   float64
+	Correct      bool
+	SuggestedQ   int32
+	Alternatives []string
+}
+
+type answerRune struct {
+	original rune
+	key      rune
+}
+
+// CheckAnswer compares the typed answer with every alternative of expected and keeps the closest.
+// The diff shows the original characters, while the comparison uses their normalized form.
+func CheckAnswer(typed string, expected string, normalization AnswerNormalization) AnswerCheck {
+	alternatives := SplitAnswerAlternatives(expected)
+	if len(alternatives) == 0 {
+		alternatives = []string{strings.TrimSpace(expected)}
+	}
+	typedRunes := normalizeAnswer(strings.TrimSpace(typed), normalization)
+
+	var best AnswerCheck
+	for index, alternative := range alternatives {
+		expectedRunes := normalizeAnswer(alternative, normalization)
+		distance, diff := diffAnswer(typedRunes, expectedRunes)
+		if index == 0 || distance < best.Distance {
+			best = AnswerCheck{Expected: alternative, Diff: diff, Distance: distance}
+			best.Similarity = 1
+			if length := max(len(typedRunes), len(expectedRunes)); length > 0 {
+				best.Similarity = 1 - float64(distance)/float64(length)
+			}
+		}
+	}
+	best.Correct = best.Distance == 0
+	best.SuggestedQ = SuggestAnswerQuality(best.Distance, best.Similarity, len(typedRunes) == 0)
+	best.Alternatives = alternatives
+	return best
+}
+
+// SplitAnswerAlternatives returns the accepted answers of the back of a card.
+func SplitAnswerAlternatives(expected string) []string {
+	var alternatives []string
+	for _, alternative := range strings.Split(expected, AnswerAlternativeSeparator) {
+		if alternative = strings.TrimSpace(alternative); alternative != "" {
+			alternatives = append(alternatives, alternative)
+		}
+	}
+	return alternatives
+}
+
+// SuggestAnswerQuality maps how close a typed answer is to the SM-2 quality of response.
+func SuggestAnswerQuality(distance int, similarity float64, blank bool) int32 {
+	switch {
+	case blank:
+		return 0
+	case distance == 0:
+		return 5
+	case similarity >= 0.9:
+		return 4
+	case similarity >= 0.75:
+		return 3
+	case similarity >= 0.5:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func normalizeAnswer(text string, normalization AnswerNormalization) []answerRune {
+	runes := make([]answerRune, 0, len(text))
+	for _, r := range text {
+		if normalization.IgnorePunctuation && unicode.IsPunct(r) {
+			continue
+		}
+		key := r
+		if normalization.IgnoreAccents {
+			// the base letter is the first rune of the canonical decomposition
+			for _, decomposed := range norm.NFD.String(string(r)) {
+				key = decomposed
+				break
+			}
+		}
+		if normalization.IgnoreCase {
+			key = unicode.ToLower(key)
+		}
+		runes = append(runes, answerRune{original: r, key: key})
+	}
+	return runes
+}
+
+// diffAnswer returns the edit distance between the typed and expected runes, and the character
+// level diff turning the typed answer into the expected one.
+func diffAnswer(typed []answerRune, expected []answerRune) (int, []AnswerDiffSegment) {
+	rows, columns := len(typed)+1, len(expected)+1
+	distances := make([]int, rows*columns)
+	for i := range rows {
+		distances[i*columns] = i
+	}
+	for j := range columns {
+		distances[j] = j
+	}
+	for i := 1; i < rows; i++ {
+		for j := 1; j < columns; j++ {
+			substitution := distances[(i-1)*columns+j-1]
+			if typed[i-1].key != expected[j-1].key {
+				substitution++
+			}
+			distances[i*columns+j] = min(substitution, distances[(i-1)*columns+j]+1, distances[i*columns+j-1]+1)
+		}
+	}
+
+	// walk back from the end, a substitution is both an extra typed rune and a missing one
+	var ops []string
+	var texts []rune
+	i, j := len(typed), len(expected)
+	for i > 0 || j > 0 {
+		current := distances[i*columns+j]
+		switch {
+		case i > 0 && j > 0 && typed[i-1].key == expected[j-1].key && current == distances[(i-1)*columns+j-1]:
+			ops, texts = append(ops, AnswerDiffEqual), append(texts, expected[j-1].original)
+			i, j = i-1, j-1
+		case j > 0 && current == distances[i*columns+j-1]+1:
+			ops, texts = append(ops, AnswerDiffMissing), append(texts, expected[j-1].original)
+			j--
+		case i > 0 && current == distances[(i-1)*columns+j]+1:
+			ops, texts = append(ops, AnswerDiffExtra), append(texts, typed[i-1].original)
+			i--
+		default:
+			ops, texts = append(ops, AnswerDiffMissing, AnswerDiffExtra), append(texts, expected[j-1].original, typed[i-1].original)
+			i, j = i-1, j-1
+		}
+	}
+
+	// the changes between two equal runs are grouped as the extra typed text then the missing text
+	var diff []AnswerDiffSegment
+	var extra, missing []rune
+	flush := func() {
+		if len(extra) > 0 {
+			diff = append(diff, AnswerDiffSegment{Op: AnswerDiffExtra, Text: string(extra)})
+		}
+		if len(missing) > 0 {
+			diff = append(diff, AnswerDiffSegment{Op: AnswerDiffMissing, Text: string(missing)})
+		}
+		extra, missing = nil, nil
+	}
+	for index := len(ops) - 1; index >= 0; index-- {
+		switch ops[index] {
+		case AnswerDiffExtra:
+			extra = append(extra, texts[index])
+		case AnswerDiffMissing:
+			missing = append(missing, texts[index])
+		default:
+			flush()
+			if last := len(diff) - 1; last >= 0 && diff[last].Op == AnswerDiffEqual {
+				diff[last].Text += string(texts[index])
+			} else {
+				diff = append(diff, AnswerDiffSegment{Op: AnswerDiffEqual, Text: string(texts[index])})
+			}
+		}
+	}
+	flush()
+	return distances[rows*columns-1], diff
+}
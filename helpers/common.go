@@ -2,11 +2,41 @@ package helpers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/mrgThang/flashcard-be/dto"
 )
 
+// HTTPError is an error that knows the status code it should be answered with.
+type HTTPError struct {
+	Code int
+	Err  error
+}
+
+func NewHTTPError(code int, err error) *HTTPError {
+	return &HTTPError{Code: code, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// WriteError writes err with the status code of the HTTPError it wraps, or 500 for any other error.
+func WriteError(w http.ResponseWriter, err error) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		WriteJSONError(w, httpErr.Code, httpErr.Err)
+		return
+	}
+	WriteJSONError(w, http.StatusInternalServerError, err)
+}
+
 func WriteJSONError(w http.ResponseWriter, code int, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -32,3 +62,37 @@ func WriteJSONResponse[T any](w http.ResponseWriter, code int, data T) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// WriteRawJSON writes data without the api envelope, for documents read by third-party clients.
+func WriteRawJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// SplitTags parses space separated tags, dropping duplicates.
+func SplitTags(tags string) []string {
+	fields := strings.Fields(tags)
+	result := make([]string, 0, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for _, tag := range fields {
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// JoinTags formats tags the way they are stored on cards, tags can not contain spaces.
+func JoinTags(tags []string) string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.Join(strings.Fields(tag), "_"); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	return strings.Join(SplitTags(strings.Join(normalized, " ")), " ")
+}
@@ -0,0 +1,102 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+)
+
+var delimiterCandidates = []rune{',', '\t', ';', '|'}
+
+// DetectEncoding guesses the encoding of a text file from its first bytes: a byte order mark wins,
+// valid UTF-8 is taken as is and anything else is assumed to be Windows-1252.
+func DetectEncoding(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE
+	}
+	// the sample may end in the middle of a multi byte character
+	for trim := 0; trim < utf8.UTFMax && trim < len(sample); trim++ {
+		if utf8.Valid(sample[:len(sample)-trim]) {
+			return EncodingUTF8
+		}
+	}
+	return EncodingWindows1252
+}
+
+// NewDecodedReader converts r from the named encoding to UTF-8, dropping a byte order mark.
+func NewDecodedReader(r io.Reader, name string) (io.Reader, error) {
+	var enc encoding.Encoding
+	switch strings.ToLower(name) {
+	case "", EncodingUTF8:
+		enc = unicode.UTF8BOM
+	case EncodingUTF16LE:
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case EncodingUTF16BE:
+		enc = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case EncodingWindows1252:
+		enc = charmap.Windows1252
+	default:
+		var err error
+		enc, err = htmlindex.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported encoding %q", name)
+		}
+	}
+	return transform.NewReader(r, enc.NewDecoder()), nil
+}
+
+// DetectDelimiter picks the candidate delimiter that splits the sample lines into the most
+// columns consistently, falling back to a comma.
+func DetectDelimiter(sample string) rune {
+	lines := strings.Split(strings.ReplaceAll(sample, "\r\n", "\n"), "\n")
+	if len(lines) > 1 {
+		// the last line of the sample is probably cut
+		lines = lines[:len(lines)-1]
+	}
+	best, bestScore := ',', 0
+	for _, candidate := range delimiterCandidates {
+		minCount, maxCount := -1, 0
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			count := strings.Count(line, string(candidate))
+			if minCount < 0 || count < minCount {
+				minCount = count
+			}
+			maxCount = max(maxCount, count)
+		}
+		if minCount <= 0 {
+			continue
+		}
+		// consistent column counts weigh more than many delimiters on a few lines
+		score := minCount * 10
+		if minCount == maxCount {
+			score += 5
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
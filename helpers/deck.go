@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"strings"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// DeckChildren groups decks by their parent id. Root decks are stored under key 0.
+func DeckChildren(decks []*models.DeckWithStats) map[int32][]*models.DeckWithStats {
+	children := make(map[int32][]*models.DeckWithStats, len(decks))
+	for _, deck := range decks {
+		var parentID int32
+		if deck.ParentID != nil {
+			parentID = *deck.ParentID
+		}
+		children[parentID] = append(children[parentID], deck)
+	}
+	return children
+}
+
+// DeckSubtreeIDs returns the id of rootID and of all of its descendants.
+func DeckSubtreeIDs(decks []*models.DeckWithStats, rootID int32) []int32 {
+	children := DeckChildren(decks)
+	ids := []int32{rootID}
+	// a corrupted parent chain may contain a cycle, every deck is only added once
+	visited := map[int32]bool{rootID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if visited[child.ID] {
+				continue
+			}
+			visited[child.ID] = true
+			ids = append(ids, child.ID)
+		}
+	}
+	return ids
+}
+
+// IsDeckInSubtree reports whether deckID is rootID or one of its descendants.
+func IsDeckInSubtree(decks []*models.DeckWithStats, rootID int32, deckID int32) bool {
+	for _, id := range DeckSubtreeIDs(decks, rootID) {
+		if id == deckID {
+			return true
+		}
+	}
+	return false
+}
+
+// RollUpDeckStats returns the total and due card counts of every deck including its descendants.
+func RollUpDeckStats(decks []*models.DeckWithStats) map[int32]models.DeckWithStats {
+	children := DeckChildren(decks)
+	stats := make(map[int32]models.DeckWithStats, len(decks))
+	var visit func(deck *models.DeckWithStats) models.DeckWithStats
+	visit = func(deck *models.DeckWithStats) models.DeckWithStats {
+		if rolled, ok := stats[deck.ID]; ok {
+			return rolled
+		}
+		rolled := *deck
+		// mark as visited before descending so a corrupted parent chain can not loop forever
+		stats[deck.ID] = rolled
+		for _, child := range children[deck.ID] {
+			childStats := visit(child)
+			rolled.TotalCards += childStats.TotalCards
+			rolled.CardsLeft += childStats.CardsLeft
+		}
+		stats[deck.ID] = rolled
+		return rolled
+	}
+	for _, deck := range decks {
+		visit(deck)
+	}
+	return stats
+}
+
+// DeckPath returns the full name of a deck, e.g. "Japanese::JLPT N5::Kanji".
+func DeckPath(decks []*models.DeckWithStats, deckID int32) string {
+	return deckPath(deckByID(decks), deckID)
+}
+
+// DeckPaths returns the full name of every deck, use it over DeckPath when many paths are needed.
+func DeckPaths(decks []*models.DeckWithStats) map[int32]string {
+	byID := deckByID(decks)
+	paths := make(map[int32]string, len(decks))
+	for _, deck := range decks {
+		paths[deck.ID] = deckPath(byID, deck.ID)
+	}
+	return paths
+}
+
+func deckByID(decks []*models.DeckWithStats) map[int32]*models.DeckWithStats {
+	byID := make(map[int32]*models.DeckWithStats, len(decks))
+	for _, deck := range decks {
+		byID[deck.ID] = deck
+	}
+	return byID
+}
+
+func deckPath(byID map[int32]*models.DeckWithStats, deckID int32) string {
+	var names []string
+	visited := map[int32]bool{}
+	for deck, ok := byID[deckID]; ok && !visited[deck.ID]; {
+		visited[deck.ID] = true
+		names = append([]string{deck.Name}, names...)
+		if deck.ParentID == nil {
+			break
+		}
+		deck, ok = byID[*deck.ParentID]
+	}
+	return strings.Join(names, constant.DeckPathSeparator)
+}
@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+func testDeck(id int32, parentID int32, name string) *models.DeckWithStats {
+	deck := &models.DeckWithStats{}
+	deck.ID = id
+	deck.Name = name
+	if parentID != 0 {
+		deck.ParentID = &parentID
+	}
+	return deck
+}
+
+func TestDeckSubtreeIDs(t *testing.T) {
+	decks := []*models.DeckWithStats{
+		testDeck(1, 0, "Japanese"),
+		testDeck(2, 1, "JLPT N5"),
+		testDeck(3, 2, "Kanji"),
+		testDeck(4, 0, "French"),
+	}
+	got := DeckSubtreeIDs(decks, 1)
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("DeckSubtreeIDs() = %v, want [1 2 3]", got)
+	}
+	if !IsDeckInSubtree(decks, 1, 3) {
+		t.Errorf("IsDeckInSubtree(1, 3) = false, want true")
+	}
+	if IsDeckInSubtree(decks, 2, 1) {
+		t.Errorf("IsDeckInSubtree(2, 1) = true, want false")
+	}
+}
+
+func TestDeckSubtreeIDsCycle(t *testing.T) {
+	// 1 and 2 are parents of each other, the walk must still end
+	decks := []*models.DeckWithStats{
+		testDeck(1, 2, "A"),
+		testDeck(2, 1, "B"),
+	}
+	got := DeckSubtreeIDs(decks, 1)
+	if len(got) != 2 {
+		t.Errorf("DeckSubtreeIDs() = %v, want 2 decks", got)
+	}
+	if path := DeckPath(decks, 1); path != "B::A" {
+		t.Errorf("DeckPath() = %q, want %q", path, "B::A")
+	}
+}
@@ -0,0 +1,64 @@
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes is the longest password bcrypt hashes, it ignores the bytes after it.
+const MaxPasswordBytes = 72
+
+// PasswordPolicy is what a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength int
+	// MinClasses is how many of lowercase letters, uppercase letters, digits and symbols it uses.
+	MinClasses int
+}
+
+// Validate returns why the password does not satisfy the policy, the password must not contain the
+// given personal values either, such as the name or the email of the user.
+func (p PasswordPolicy) Validate(password string, personal ...string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > MaxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes long", MaxPasswordBytes)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("password must use at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)
+	}
+
+	lowered := strings.ToLower(password)
+	for _, value := range personal {
+		// the part of an email before the @ is as guessable as the whole email
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			value = value[:at]
+		}
+		if value = strings.ToLower(strings.TrimSpace(value)); len(value) >= 3 && strings.Contains(lowered, value) {
+			return fmt.Errorf("password must not contain your name or email")
+		}
+	}
+	return nil
+}
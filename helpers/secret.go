@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// SecretKeySize is the size of the AES-256 keys secrets are encrypted with.
+const SecretKeySize = 32
+
+// ParseSecretKey decodes a base64 encryption key from the config.
+func ParseSecretKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("invalid secret key: %d bytes instead of %d", len(key), SecretKeySize)
+	}
+	return key, nil
+}
+
+// EncryptSecret encrypts the secret with AES-GCM for storing it. The associated data, such as the
+// id of the row, is authenticated but not stored: the secret only decrypts with the same one, so it
+// can not be copied to another row.
+func EncryptSecret(key []byte, secret string, associatedData []byte) (string, error) {
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(secret), associatedData)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret decrypts a secret encrypted by EncryptSecret.
+func DecryptSecret(key []byte, encrypted string, associatedData []byte) (string, error) {
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted secret")
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], associatedData)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+func newSecretAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the test vectors of RFC 6238.
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// the 8 digit codes of RFC 6238 end with the 6 digit ones
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TOTPStep(now)
+	code := func(step int64) string {
+		code, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(step), wantStep: step, wantOK: true},
+		{name: "previous step", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next step", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "with spaces", code: code(step)[:3] + " " + code(step)[3:], wantStep: step, wantOK: true},
+		{name: "too old", code: code(step - 2)},
+		{name: "replayed", code: code(step), lastStep: step},
+		{name: "wrong code", code: "000000"},
+		{name: "too short", code: "123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(rfc6238Secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = (%v, %v), want (%v, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	got := TOTPURI("Flashcard", "ada@example.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Flashcard:ada@example.com?algorithm=SHA1&digits=6&issuer=Flashcard&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("TOTPURI() = %s, want %s", got, want)
+	}
+}
+
+func TestRecoveryCode(t *testing.T) {
+	code := GenerateRecoveryCode()
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("GenerateRecoveryCode() = %q, want two groups of five", code)
+	}
+	if got := NormalizeRecoveryCode(" " + strings.ToUpper(code) + " "); got != strings.ReplaceAll(code, "-", "") {
+		t.Errorf("NormalizeRecoveryCode() = %q", got)
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, SecretKeySize)
+	encrypted, err := EncryptSecret(key, "JBSWY3DPEHPK3PXP", []byte("user:1"))
+	if err != nil {
+		t.Fatalf("EncryptSecret() error = %v", err)
+	}
+	if strings.Contains(encrypted, "JBSWY3DPEHPK3PXP") {
+		t.Fatal("EncryptSecret() stored the secret in clear")
+	}
+	decrypted, err := DecryptSecret(key, encrypted, []byte("user:1"))
+	if err != nil || decrypted != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("DecryptSecret() = (%q, %v)", decrypted, err)
+	}
+	if _, err := DecryptSecret(key, encrypted, []byte("user:2")); err == nil {
+		t.Error("DecryptSecret() with other associated data succeeded")
+	}
+	if _, err := DecryptSecret(bytes.Repeat([]byte{8}, SecretKeySize), encrypted, []byte("user:1")); err == nil {
+		t.Error("DecryptSecret() with another key succeeded")
+	}
+}
@@ -0,0 +1,274 @@
+// Package jwtkeys signs tokens with asymmetric keys loaded from files, and publishes their public
+// halves as a JSON Web Key Set so other services can verify the tokens.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mrgThang/flashcard-be/config"
+)
+
+// minRSABits is the smallest RSA key accepted, as required for RS256 by RFC 7518.
+const minRSABits = 2048
+
+// Key is a private key, with when it signs and until when tokens signed with it are accepted.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	// SignFrom is when the key starts signing, it signs until a key with a later SignFrom takes
+	// over. Zero signs from the start.
+	SignFrom time.Time
+	// RetireAt is when the tokens signed with the key stop being accepted, zero never.
+	RetireAt time.Time
+}
+
+// KeySet holds the signing keys. The key signing now is the one with the latest SignFrom reached,
+// and every key not retired verifies, so a new key is published ahead of the rotation and the
+// previous key keeps verifying the tokens it signed until they expire.
+type KeySet struct {
+	keys []*Key
+	now  func() time.Time
+}
+
+// JSONWebKeySet is the RFC 7517 document of the public keys.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and public key of Ed25519 keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// Load reads the keys of the config, the set is nil when there are none.
+func Load(cfgs []*config.SigningKeyConfig) (*KeySet, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	keys := make([]*Key, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		key, err := loadKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", cfg.File, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys...)
+}
+
+// NewKeySet returns the set of the keys, their ids must be unique.
+func NewKeySet(keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing key")
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate signing key id %q", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	return &KeySet{keys: keys, now: time.Now}, nil
+}
+
+func loadKey(cfg *config.SigningKeyConfig) (*Key, error) {
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	private, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewKey(cfg.ID, private)
+	if err != nil {
+		return nil, err
+	}
+	if key.SignFrom, err = parseTime(cfg.SignFrom); err != nil {
+		return nil, fmt.Errorf("invalid signFrom: %w", err)
+	}
+	if key.RetireAt, err = parseTime(cfg.RetireAt); err != nil {
+		return nil, fmt.Errorf("invalid retireAt: %w", err)
+	}
+	if !key.RetireAt.IsZero() && !key.RetireAt.After(key.SignFrom) {
+		return nil, fmt.Errorf("retireAt must be after signFrom")
+	}
+	return key, nil
+}
+
+// NewKey returns the key with the signing method of its type, its id defaults to its RFC 7638
+// thumbprint.
+func NewKey(id string, private crypto.Signer) (*Key, error) {
+	key := &Key{ID: id, Private: private}
+	switch public := private.Public().(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("rsa key of %d bits, at least %d are required", public.N.BitLen(), minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, only RSA and Ed25519 keys are", public)
+	}
+	if key.ID == "" {
+		key.ID = key.Thumbprint()
+	}
+	return key, nil
+}
+
+// ParsePrivateKey reads a PEM RSA key, PKCS #1 or PKCS #8, or a PKCS #8 Ed25519 key, as written by
+// `openssl genpkey`.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q, a private key is required", block.Type)
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Sign signs the claims with the key signing now, its id goes in the kid header.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := s.SigningKey()
+	if key == nil {
+		return "", fmt.Errorf("no signing key is active")
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// SigningKey returns the key signing now, nil when every key retired or starts later.
+func (s *KeySet) SigningKey() *Key {
+	now := s.now()
+	var current *Key
+	for _, key := range s.keys {
+		if key.SignFrom.After(now) || key.retired(now) {
+			continue
+		}
+		if current == nil || key.SignFrom.After(current.SignFrom) {
+			current = key
+		}
+	}
+	return current
+}
+
+// Keyfunc returns the public key of the kid of the token for jwt.Parse, as long as it did not
+// retire and the token uses its algorithm.
+func (s *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+	now := s.now()
+	index := slices.IndexFunc(s.keys, func(key *Key) bool { return key.ID == kid })
+	if index < 0 || s.keys[index].retired(now) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	key := s.keys[index]
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.Private.Public(), nil
+}
+
+// JWKS returns the public keys that did not retire, upcoming ones included.
+func (s *KeySet) JWKS() JSONWebKeySet {
+	now := s.now()
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range s.keys {
+		if !key.retired(now) {
+			keySet.Keys = append(keySet.Keys, key.JWK())
+		}
+	}
+	return keySet
+}
+
+func (k *Key) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// JWK returns the public key as a JSON Web Key.
+func (k *Key) JWK() JSONWebKey {
+	jwk := JSONWebKey{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	switch public := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the public key: the SHA-256 of its required
+// members in lexicographic order.
+func (k *Key) Thumbprint() string {
+	jwk := k.JWK()
+	var members any
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,136 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mrgThang/flashcard-be/config"
+)
+
+func writeKey(t *testing.T, der []byte, blockType string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	smallRSAKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	keySet, err := Load([]*config.SigningKeyConfig{
+		{ID: "ed", File: writeKey(t, edDER, "PRIVATE KEY"), RetireAt: "2025-07-01T02:00:00Z"},
+		{File: writeKey(t, x509.MarshalPKCS1PrivateKey(rsaKey), "RSA PRIVATE KEY"), SignFrom: "2025-07-01T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if keySet.keys[0].Method != jwt.SigningMethodEdDSA || keySet.keys[1].Method != jwt.SigningMethodRS256 {
+		t.Errorf("Load() methods = %v, %v", keySet.keys[0].Method.Alg(), keySet.keys[1].Method.Alg())
+	}
+	if keySet.keys[1].ID != keySet.keys[1].Thumbprint() {
+		t.Errorf("Load() id = %q, want the thumbprint", keySet.keys[1].ID)
+	}
+
+	if _, err := Load([]*config.SigningKeyConfig{{File: writeKey(t, x509.MarshalPKCS1PrivateKey(smallRSAKey), "RSA PRIVATE KEY")}}); err == nil {
+		t.Error("Load() of a 1024 bit key succeeded")
+	}
+	if _, err := Load([]*config.SigningKeyConfig{{File: writeKey(t, edDER, "PRIVATE KEY"), SignFrom: "2025-07-01T00:00:00Z", RetireAt: "2025-06-01T00:00:00Z"}}); err == nil {
+		t.Error("Load() of a key retiring before it signs succeeded")
+	}
+	if keySet, err := Load(nil); keySet != nil || err != nil {
+		t.Errorf("Load(nil) = (%v, %v), want no key set", keySet, err)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	_, oldPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	_, newPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	rotation := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	oldKey, _ := NewKey("old", oldPrivate)
+	oldKey.RetireAt = rotation.Add(2 * time.Hour)
+	newKey, _ := NewKey("new", newPrivate)
+	newKey.SignFrom = rotation
+	keySet, err := NewKeySet(oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := rotation.Add(-time.Hour)
+	keySet.now = func() time.Time { return now }
+
+	sign := func() string {
+		t.Helper()
+		token, err := keySet.Sign(jwt.RegisteredClaims{Subject: "1"})
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		return token
+	}
+	verify := func(token string) error {
+		_, err := jwt.Parse(token, keySet.Keyfunc, jwt.WithValidMethods([]string{"EdDSA"}))
+		return err
+	}
+
+	// the new key is published before it signs
+	beforeRotation := sign()
+	if kid := keySet.SigningKey().ID; kid != "old" {
+		t.Errorf("SigningKey() before the rotation = %q, want old", kid)
+	}
+	if got := len(keySet.JWKS().Keys); got != 2 {
+		t.Errorf("JWKS() before the rotation has %d keys, want 2", got)
+	}
+
+	now = rotation.Add(time.Hour)
+	afterRotation := sign()
+	if kid := keySet.SigningKey().ID; kid != "new" {
+		t.Errorf("SigningKey() after the rotation = %q, want new", kid)
+	}
+	if err := verify(beforeRotation); err != nil {
+		t.Errorf("token of the previous key was refused before it retired: %v", err)
+	}
+
+	now = rotation.Add(3 * time.Hour)
+	if err := verify(beforeRotation); err == nil {
+		t.Error("token of a retired key was accepted")
+	}
+	if err := verify(afterRotation); err != nil {
+		t.Errorf("token of the current key was refused: %v", err)
+	}
+	if jwks := keySet.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "new" {
+		t.Errorf("JWKS() after the retirement = %+v, want only the new key", jwks.Keys)
+	}
+
+	// a token signed with the secret of another algorithm is refused
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "1"}).SignedString([]byte("secret"))
+	if _, err := jwt.Parse(forged, keySet.Keyfunc); err == nil {
+		t.Error("token without a kid was accepted")
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// the example key of RFC 8037, appendix A.3
+	seed := []byte{
+		0x9d, 0x61, 0xb1, 0x9d, 0xef, 0xfd, 0x5a, 0x60, 0xba, 0x84, 0x4a, 0xf4, 0x92, 0xec, 0x2c, 0xc4,
+		0x44, 0x49, 0xc5, 0x69, 0x7b, 0x32, 0x69, 0x19, 0x70, 0x3b, 0xac, 0x03, 0x1c, 0xae, 0x7f, 0x60,
+	}
+	key, err := NewKey("", ed25519.NewKeyFromSeed(seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; key.ID != want {
+		t.Errorf("Thumbprint() = %s, want %s", key.ID, want)
+	}
+}
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/mrgThang/flashcard-be/logger"
+)
+
+// LogMailer writes every email to the log instead of sending it.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	logger.Info("[LogMailer] Email",
+		zap.String("from", m.from),
+		zap.String("to", message.To),
+		zap.String("subject", message.Subject),
+		zap.String("body", message.Body))
+	return nil
+}
@@ -0,0 +1,239 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrgThang/flashcard-be/config"
+)
+
+type testEmail struct {
+	Name      string
+	Email     string
+	Link      string
+	ExpiresIn string
+}
+
+func TestTemplatesRender(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+	data := testEmail{Name: "Lan", Email: "lan@example.com", Link: "https://app.example.com/verify-email?token=abc", ExpiresIn: "2 days"}
+	tests := []struct {
+		name    string
+		subject string
+	}{
+		{name: TemplateVerifyEmail, subject: "Verify your email"},
+		{name: TemplateResetPassword, subject: "Reset your password"},
+	}
+	for _, tt := range tests {
+		message, err := templates.Render(tt.name, data.Email, data)
+		if err != nil {
+			t.Fatalf("Render(%s) error = %v", tt.name, err)
+		}
+		if message.To != data.Email || message.Subject != tt.subject {
+			t.Errorf("Render(%s) = to %q subject %q, want %q %q", tt.name, message.To, message.Subject, data.Email, tt.subject)
+		}
+		for _, want := range []string{"Hi Lan,", data.Link, data.ExpiresIn} {
+			if !strings.Contains(message.Body, want) {
+				t.Errorf("Render(%s) body does not contain %q:\n%s", tt.name, want, message.Body)
+			}
+		}
+	}
+	if _, err := templates.Render("unknown", data.Email, data); err == nil {
+		t.Errorf("Render(unknown) error = nil, want an error")
+	}
+}
+
+func TestLoadTemplatesOverride(t *testing.T) {
+	dir := t.TempDir()
+	override := `{{define "subject"}}Welcome {{.Name}}{{end}}{{define "body"}}Open {{.Link}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, TemplateVerifyEmail+".tmpl"), []byte(override), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+	message, err := templates.Render(TemplateVerifyEmail, "lan@example.com", testEmail{Name: "Lan", Link: "https://x"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if message.Subject != "Welcome Lan" || message.Body != "Open https://x" {
+		t.Errorf("Render() = %q / %q, want the overriding template", message.Subject, message.Body)
+	}
+
+	// a template missing one of its parts is refused at startup rather than when mailing
+	if err := os.WriteFile(filepath.Join(dir, TemplateResetPassword+".tmpl"), []byte(`{{define "body"}}x{{end}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTemplates(dir); err == nil {
+		t.Errorf("LoadTemplates() error = nil, want an error for the missing subject")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFileMailer("Flashcard <no-reply@flashcard.local>", dir)
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+	sent := Message{To: "lan@example.com", Subject: "Đặt lại mật khẩu", Body: "Hi Lan,\n\nhttps://app.example.com/reset-password?token=abc\n"}
+	if err := m.Send(context.Background(), sent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got %v files, %v, want 1 .eml file", files, err)
+	}
+	file, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	message, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != sent.Subject {
+		t.Errorf("Subject = %q, %v, want %q", subject, err, sent.Subject)
+	}
+	if to := message.Header.Get("To"); to != "<lan@example.com>" {
+		t.Errorf("To = %q, want %q", to, "<lan@example.com>")
+	}
+	if _, err := message.Header.Date(); err != nil {
+		t.Errorf("Date got error %v", err)
+	}
+	body, err := io.ReadAll(message.Body)
+	if err != nil || string(body) != sent.Body {
+		t.Errorf("body = %q, %v, want %q", body, err, sent.Body)
+	}
+
+	if err := m.Send(context.Background(), Message{To: "not an address"}); err == nil {
+		t.Errorf("Send() to an invalid address error = nil, want an error")
+	}
+}
+
+// serveSMTP answers a single client with the minimum of the protocol and returns the data it sent.
+func serveSMTP(listener net.Listener) <-chan string {
+	data := make(chan string, 1)
+	go func() {
+		defer close(data)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 test ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.Fields(line + " ")[0])
+			switch command {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 test")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				lines, err := text.ReadDotLines()
+				if err != nil {
+					return
+				}
+				data <- strings.Join(lines, "\n")
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return data
+}
+
+func newTestSMTPMailer(t *testing.T, listener net.Listener, timeout int) *SMTPMailer {
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSMTPMailer(&config.MailerConfig{From: "no-reply@flashcard.local", Host: host, Port: port, TimeoutSeconds: timeout})
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	data := serveSMTP(listener)
+
+	m := newTestSMTPMailer(t, listener, 5)
+	if err := m.Send(context.Background(), Message{To: "lan@example.com", Subject: "Hello", Body: "Hi Lan"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := <-data
+	if !strings.Contains(got, "Subject: Hello") || !strings.HasSuffix(got, "Hi Lan") {
+		t.Errorf("server got %q, want the message", got)
+	}
+}
+
+func TestSMTPMailerTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// the server accepts the connection but never greets
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+	}()
+
+	m := newTestSMTPMailer(t, listener, 1)
+	start := time.Now()
+	if err := m.Send(context.Background(), Message{To: "lan@example.com", Subject: "Hello", Body: "Hi"}); err == nil {
+		t.Fatalf("Send() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Send() returned after %v, want about the 1s timeout", elapsed)
+	}
+
+	// a cancelled context stops the exchange before the timeout of the mailer
+	m = newTestSMTPMailer(t, listener, 60)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			bufio.NewReader(conn).ReadString('\n')
+		}
+	}()
+	start = time.Now()
+	if err := m.Send(ctx, Message{To: "lan@example.com", Subject: "Hello", Body: "Hi"}); err == nil {
+		t.Fatalf("Send() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send() returned after %v, want about the 200ms deadline of ctx", elapsed)
+	}
+}
@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplateResetPassword = "reset_password"
+)
+
+// defaultTemplates are the built-in email templates, each defines a "subject" and a "body".
+var defaultTemplates = map[string]string{
+	TemplateVerifyEmail: `{{define "subject"}}Verify your email{{end}}{{define "body"}}Hi {{.Name}},
+
+Please confirm that {{.Email}} is your email address by opening the link below:
+
+{{.Link}}
+
+The link expires in {{.ExpiresIn}}. If you did not sign up, you can ignore this email.
+{{end}}`,
+	TemplateResetPassword: `{{define "subject"}}Reset your password{{end}}{{define "body"}}Hi {{.Name}},
+
+Someone asked to reset the password of your account. Open the link below to choose a new password:
+
+{{.Link}}
+
+The link expires in {{.ExpiresIn}}. If you did not ask for it, you can ignore this email and your password stays the same.
+{{end}}`,
+}
+
+// Templates renders the emails, from the <name>.tmpl files of a directory when they exist or
+// from the built-in templates.
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+func LoadTemplates(dir string) (*Templates, error) {
+	templates := make(map[string]*template.Template, len(defaultTemplates))
+	for name, text := range defaultTemplates {
+		if dir != "" {
+			content, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+			if err == nil {
+				text = string(content)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+		parsed, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parse email template %s: %w", name, err)
+		}
+		for _, part := range []string{"subject", "body"} {
+			if parsed.Lookup(part) == nil {
+				return nil, fmt.Errorf("email template %s does not define %q", name, part)
+			}
+		}
+		templates[name] = parsed
+	}
+	return &Templates{templates: templates}, nil
+}
+
+// Render returns the message of the template addressed to the given recipient.
+func (t *Templates) Render(name string, to string, data any) (Message, error) {
+	parsed, ok := t.templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %s", name)
+	}
+	var subject, body bytes.Buffer
+	if err := parsed.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := parsed.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: strings.TrimSpace(subject.String()), Body: body.String()}, nil
+}
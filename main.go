@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 	"github.com/urfave/cli/v2"
 
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
 	"github.com/mrgThang/flashcard-be/logger"
 	"github.com/mrgThang/flashcard-be/middlewares"
+	"github.com/mrgThang/flashcard-be/models"
 	"github.com/mrgThang/flashcard-be/services"
 )
 
@@ -44,6 +50,49 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "export-anki",
+				Usage: "Export the cards of a user as an Anki .apkg",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "email",
+						Usage:    "Email of the user to export",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "deck-id",
+						Usage: "Export only this deck and its subdecks instead of the whole account",
+					},
+					&cli.StringFlag{
+						Name:     "out",
+						Aliases:  []string{"o"},
+						Usage:    "Path of the .apkg file to write",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runExportAnki(c.String("email"), int32(c.Int("deck-id")), c.String("out"))
+				},
+			},
+			{
+				Name:  "set-role",
+				Usage: "Set the role of a user, such as to make the first admin",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "email",
+						Usage:    "Email of the user",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "role",
+						Usage:    "One of user, moderator or admin",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runSetRole(c.String("email"), c.String("role"))
+				},
+			},
 		},
 	}
 
@@ -57,12 +106,19 @@ func runServer() error {
 		panic(err)
 	}
 	service := services.NewService()
+	service.FailInterruptedJobs(context.Background())
+	go service.RunTrashPurger(context.Background())
+	go service.RunStorageCleaner(context.Background())
+	go service.RunAccountDeleter(context.Background())
+	go service.RunSubscriptionSyncer(context.Background())
+	go service.RunRevisionPruner(context.Background())
+	go service.RunSessionPruner(context.Background())
 
 	r := chi.NewRouter()
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
@@ -72,22 +128,131 @@ func runServer() error {
 	v1 := chi.NewRouter()
 
 	// Deck routes
-	v1.Get("/decks", middlewares.AuthMiddleware(service, service.GetDecksHandler))
-	v1.Get("/decks/{id}", middlewares.AuthMiddleware(service, service.GetDetailDeckHandler))
-	v1.Post("/decks", middlewares.AuthMiddleware(service, service.CreateDeckHandler))
-	v1.Put("/decks", middlewares.AuthMiddleware(service, service.UpdateDeckHandler))
+	v1.Get("/decks", middlewares.AuthMiddleware(service, service.GetDecksHandler, constant.ScopeDecksRead))
+	v1.Get("/decks/{id}", middlewares.AuthMiddleware(service, service.GetDetailDeckHandler, constant.ScopeDecksRead))
+	v1.Post("/decks", middlewares.AuthMiddleware(service, service.CreateDeckHandler, constant.ScopeDecksWrite))
+	v1.Put("/decks", middlewares.AuthMiddleware(service, service.UpdateDeckHandler, constant.ScopeDecksWrite))
+	v1.Put("/decks/move", middlewares.AuthMiddleware(service, service.MoveDeckHandler, constant.ScopeDecksWrite))
+	v1.Delete("/decks/{id}", middlewares.AuthMiddleware(service, service.DeleteDeckHandler, constant.ScopeDecksWrite))
+	v1.Get("/decks/{id}/export", middlewares.AuthMiddleware(service, service.ExportDeckHandler, constant.ScopeExports))
+	v1.Get("/decks/shared", middlewares.AuthMiddleware(service, service.GetSharedDecksHandler, constant.ScopeDecksRead))
+	v1.Put("/decks/preset", middlewares.AuthMiddleware(service, service.AssignDeckPresetHandler, constant.ScopeDecksWrite))
+
+	// Preset routes
+	v1.Get("/presets", middlewares.AuthMiddleware(service, service.GetPresetsHandler, constant.ScopeDecksRead))
+	v1.Post("/presets", middlewares.AuthMiddleware(service, service.CreatePresetHandler, constant.ScopeDecksWrite))
+	v1.Put("/presets/{id}", middlewares.AuthMiddleware(service, service.UpdatePresetHandler, constant.ScopeDecksWrite))
+	v1.Delete("/presets/{id}", middlewares.AuthMiddleware(service, service.DeletePresetHandler, constant.ScopeDecksWrite))
+
+	// Deck sharing routes
+	v1.Get("/decks/{id}/members", middlewares.AuthMiddleware(service, service.GetDeckMembersHandler, constant.ScopeDecksRead))
+	v1.Post("/decks/{id}/members", middlewares.AuthMiddleware(service, service.InviteDeckMemberHandler, constant.ScopeDecksWrite))
+	v1.Put("/decks/{id}/members/{memberId}", middlewares.AuthMiddleware(service, service.UpdateDeckMemberHandler, constant.ScopeDecksWrite))
+	v1.Delete("/decks/{id}/members/{memberId}", middlewares.AuthMiddleware(service, service.DeleteDeckMemberHandler, constant.ScopeDecksWrite))
+	v1.Get("/invitations", middlewares.AuthMiddleware(service, service.GetInvitationsHandler, constant.ScopeDecksRead))
+	v1.Put("/invitations/{id}/accept", middlewares.AuthMiddleware(service, service.AcceptInvitationHandler, constant.ScopeDecksWrite))
+	v1.Delete("/invitations/{id}", middlewares.AuthMiddleware(service, service.DeclineInvitationHandler, constant.ScopeDecksWrite))
+
+	// Library routes
+	v1.Put("/decks/{id}/publish", middlewares.AuthMiddleware(service, service.PublishDeckHandler, constant.ScopeLibraryWrite))
+	v1.Delete("/decks/{id}/publish", middlewares.AuthMiddleware(service, service.UnpublishDeckHandler, constant.ScopeLibraryWrite))
+	v1.Get("/library", middlewares.AuthMiddleware(service, service.GetLibraryHandler, constant.ScopeLibraryRead))
+	v1.Get("/library/subscriptions", middlewares.AuthMiddleware(service, service.GetSubscriptionsHandler, constant.ScopeLibraryRead))
+	v1.Get("/library/{id}", middlewares.AuthMiddleware(service, service.GetLibraryDeckHandler, constant.ScopeLibraryRead))
+	v1.Post("/library/{id}/subscribe", middlewares.AuthMiddleware(service, service.SubscribeLibraryDeckHandler, constant.ScopeLibraryWrite))
+	v1.Delete("/library/{id}/subscribe", middlewares.AuthMiddleware(service, service.UnsubscribeLibraryDeckHandler, constant.ScopeLibraryWrite))
+	v1.Post("/library/{id}/sync", middlewares.AuthMiddleware(service, service.SyncLibraryDeckHandler, constant.ScopeLibraryWrite))
+	v1.Get("/library/{id}/conflicts", middlewares.AuthMiddleware(service, service.GetCardConflictsHandler, constant.ScopeLibraryRead))
+	v1.Put("/library/{id}/conflicts/{conflictId}", middlewares.AuthMiddleware(service, service.ResolveCardConflictHandler, constant.ScopeLibraryWrite))
+	v1.Post("/library/{id}/fork", middlewares.AuthMiddleware(service, service.ForkLibraryDeckHandler, constant.ScopeLibraryWrite))
+	v1.Post("/library/{id}/reports", middlewares.AuthMiddleware(service, service.ReportLibraryDeckHandler, constant.ScopeLibraryWrite))
 
 	// Card routes
-	v1.Get("/cards", middlewares.AuthMiddleware(service, service.GetCardsHandler))
-	v1.Post("/cards", middlewares.AuthMiddleware(service, service.CreateCardHandler))
-	v1.Put("/cards", middlewares.AuthMiddleware(service, service.UpdateCardHandler))
-	v1.Put("/cards/study", middlewares.AuthMiddleware(service, service.StudyCardHandler))
+	v1.Get("/cards", middlewares.AuthMiddleware(service, service.GetCardsHandler, constant.ScopeCardsRead))
+	v1.Post("/cards", middlewares.AuthMiddleware(service, service.CreateCardHandler, constant.ScopeCardsWrite))
+	v1.Put("/cards", middlewares.AuthMiddleware(service, service.UpdateCardHandler, constant.ScopeCardsWrite))
+	v1.Put("/cards/study", middlewares.AuthMiddleware(service, service.StudyCardHandler, constant.ScopeStudy))
+	v1.Post("/cards/check", middlewares.AuthMiddleware(service, service.CheckAnswerHandler, constant.ScopeStudy))
+	v1.Put("/cards/move", middlewares.AuthMiddleware(service, service.MoveCardsHandler, constant.ScopeCardsWrite))
+	v1.Post("/cards/copy", middlewares.AuthMiddleware(service, service.CopyCardsHandler, constant.ScopeCardsWrite))
+	v1.Delete("/cards/{id}", middlewares.AuthMiddleware(service, service.DeleteCardHandler, constant.ScopeCardsWrite))
+	v1.Get("/cards/{id}/revisions", middlewares.AuthMiddleware(service, service.GetCardRevisionsHandler, constant.ScopeCardsRead))
+	v1.Put("/cards/{id}/revisions/{revisionId}/revert", middlewares.AuthMiddleware(service, service.RevertCardRevisionHandler, constant.ScopeCardsWrite))
+
+	// Trash routes
+	v1.Get("/trash", middlewares.AuthMiddleware(service, service.GetTrashHandler, constant.ScopeDecksRead, constant.ScopeCardsRead))
+	v1.Put("/trash/restore", middlewares.AuthMiddleware(service, service.RestoreTrashHandler, constant.ScopeDecksWrite, constant.ScopeCardsWrite))
+	v1.Delete("/trash", middlewares.AuthMiddleware(service, service.PurgeTrashHandler, constant.ScopeDecksWrite, constant.ScopeCardsWrite))
+
+	// Import routes
+	v1.Post("/imports/anki", middlewares.AuthMiddleware(service, service.ImportAnkiHandler, constant.ScopeImports))
+	v1.Post("/imports/csv/preview", middlewares.AuthMiddleware(service, service.PreviewCSVHandler, constant.ScopeImports))
+	v1.Post("/imports/csv", middlewares.AuthMiddleware(service, service.ImportCSVHandler, constant.ScopeImports))
+	v1.Post("/imports/json", middlewares.AuthMiddleware(service, service.ImportJSONHandler, constant.ScopeImports))
+
+	// Export routes
+	v1.Get("/exports/anki", middlewares.AuthMiddleware(service, service.ExportAnkiHandler, constant.ScopeExports))
+
+	// Job routes
+	v1.Get("/jobs/{id}", middlewares.AuthMiddleware(service, service.GetJobHandler, constant.ScopeImports, constant.ScopeExports))
+
+	// Media routes
+	v1.Get("/media/{filename}", middlewares.AuthMiddleware(service, service.GetMediaHandler, constant.ScopeCardsRead))
 
 	// User routes
-	v1.Get("/users", middlewares.AuthMiddleware(service, service.GetUserHandler))
+	v1.Get("/users", middlewares.AuthMiddleware(service, service.GetUserHandler, constant.ScopeUserRead))
+	v1.Put("/users", middlewares.AuthMiddleware(service, service.UpdateUserHandler))
+	v1.Put("/users/password", middlewares.AuthMiddleware(service, service.ChangePasswordHandler))
+	v1.Post("/users/2fa", middlewares.AuthMiddleware(service, service.EnrollTwoFactorHandler))
+	v1.Post("/users/2fa/activate", middlewares.AuthMiddleware(service, service.ActivateTwoFactorHandler))
+	v1.Delete("/users/2fa", middlewares.AuthMiddleware(service, service.DisableTwoFactorHandler))
+	v1.Post("/users/2fa/recovery-codes", middlewares.AuthMiddleware(service, service.RegenerateRecoveryCodesHandler))
+	v1.Get("/users/identities", middlewares.AuthMiddleware(service, service.GetUserIdentitiesHandler))
+	v1.Delete("/users/identities/{id}", middlewares.AuthMiddleware(service, service.DeleteUserIdentityHandler))
+
+	// Account routes
+	v1.Post("/account/exports", middlewares.AuthMiddleware(service, service.ExportAccountHandler))
+	v1.Get("/account/exports/{id}", middlewares.AuthMiddleware(service, service.DownloadAccountExportHandler))
+	v1.Post("/account/deletion", middlewares.AuthMiddleware(service, service.DeleteAccountHandler))
+	v1.Delete("/account/deletion", middlewares.AuthMiddleware(service, service.CancelAccountDeletionHandler))
 
 	v1.Post("/signup", service.SignupHandler)
 	v1.Post("/login", service.LoginHandler)
+	v1.Post("/login/2fa", service.LoginTwoFactorHandler)
+	v1.Post("/token/refresh", service.RefreshTokenHandler)
+	v1.Get("/auth/providers", service.GetOIDCProvidersHandler)
+	v1.Get("/auth/{provider}/login", service.OIDCLoginHandler)
+	v1.Get("/auth/{provider}/callback", service.OIDCCallbackHandler)
+	v1.Post("/logout", middlewares.AuthMiddleware(service, service.LogoutHandler))
+	v1.Post("/logout/all", middlewares.AuthMiddleware(service, service.LogoutAllHandler))
+	v1.Get("/tokens", middlewares.AuthMiddleware(service, service.GetAccessTokensHandler))
+	v1.Post("/tokens", middlewares.AuthMiddleware(service, service.CreateAccessTokenHandler))
+	v1.Delete("/tokens/{id}", middlewares.AuthMiddleware(service, service.DeleteAccessTokenHandler))
+	v1.Get("/sessions", middlewares.AuthMiddleware(service, service.GetSessionsHandler))
+	v1.Delete("/sessions/{id}", middlewares.AuthMiddleware(service, service.DeleteSessionHandler))
+	v1.Post("/email/verification", middlewares.AuthMiddleware(service, service.RequestEmailVerificationHandler))
+	v1.Post("/email/verification/confirm", service.ConfirmEmailVerificationHandler)
+	v1.Post("/password/reset", service.RequestPasswordResetHandler)
+	v1.Post("/password/reset/confirm", service.ConfirmPasswordResetHandler)
+
+	// Admin routes
+	admin := chi.NewRouter()
+	admin.Get("/users", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminGetUsersHandler, models.UserRoleAdmin)))
+	admin.Get("/users/{id}", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminGetUserHandler, models.UserRoleAdmin)))
+	admin.Put("/users/{id}/role", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminUpdateUserRoleHandler, models.UserRoleAdmin)))
+	admin.Put("/users/{id}/disable", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminDisableUserHandler, models.UserRoleAdmin)))
+	admin.Delete("/users/{id}/disable", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminEnableUserHandler, models.UserRoleAdmin)))
+	admin.Post("/users/{id}/password-reset", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminResetUserPasswordHandler, models.UserRoleAdmin)))
+	admin.Get("/stats", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminGetStatsHandler, models.UserRoleAdmin)))
+	admin.Get("/library", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminGetLibraryHandler, models.UserRoleAdmin, models.UserRoleModerator)))
+	admin.Get("/library/{id}/reports", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminGetDeckReportsHandler, models.UserRoleAdmin, models.UserRoleModerator)))
+	admin.Put("/library/{id}/hide", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminHideLibraryDeckHandler, models.UserRoleAdmin, models.UserRoleModerator)))
+	admin.Delete("/library/{id}/hide", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminUnhideLibraryDeckHandler, models.UserRoleAdmin, models.UserRoleModerator)))
+	admin.Delete("/library/{id}", middlewares.AuthMiddleware(service, middlewares.RoleMiddleware(service.AdminDeleteLibraryDeckHandler, models.UserRoleAdmin, models.UserRoleModerator)))
+	v1.Mount("/admin", admin)
+
+	// public keys of the access tokens, outside of v1 where verifiers look for them
+	r.Get("/.well-known/jwks.json", service.JWKSHandler)
 
 	// create prefix v1 for all routes
 	r.Mount("/v1", v1)
@@ -100,3 +265,47 @@ func runMigrate(migrationsDir string) {
 	fmt.Println("Running migrations...")
 	services.RunMigrations(migrationsDir)
 }
+
+func runExportAnki(email string, deckID int32, out string) error {
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+	service := services.NewService()
+	ctx := context.Background()
+
+	user, err := service.UserRepository.GetUser(ctx, dto.GetUserRequest{Email: email})
+	if err != nil {
+		return fmt.Errorf("find user %s: %w", email, err)
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := service.ExportAnki(ctx, *user, deckID, file); err != nil {
+		return err
+	}
+	fmt.Println(fmt.Sprintf("Exported to %s", out))
+	return nil
+}
+
+func runSetRole(email string, role string) error {
+	if !slices.Contains(models.UserRoles, role) {
+		return fmt.Errorf("role must be one of %s", strings.Join(models.UserRoles, ", "))
+	}
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+	service := services.NewService()
+	ctx := context.Background()
+
+	user, err := service.UserRepository.GetUser(ctx, dto.GetUserRequest{Email: email})
+	if err != nil {
+		return fmt.Errorf("find user %s: %w", email, err)
+	}
+	if err := service.UserRepository.UpdateRole(ctx, user.ID, role); err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+	fmt.Printf("%s is now %s\n", email, role)
+	return nil
+}
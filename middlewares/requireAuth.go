@@ -2,23 +2,26 @@ package middlewares
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/mrgThang/flashcard-be/constant"
 	"github.com/mrgThang/flashcard-be/dto"
 	"github.com/mrgThang/flashcard-be/helpers"
 	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
 	"github.com/mrgThang/flashcard-be/services"
 )
 
-func AuthMiddleware(s *services.Service, next http.HandlerFunc) http.HandlerFunc {
+// AuthMiddleware authenticates the request with an access JWT or a personal access token. Personal
+// access tokens are only accepted on routes given scopes, and must hold one of them.
+func AuthMiddleware(s *services.Service, next http.HandlerFunc, scopes ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
 		parts := strings.Split(tokenString, " ")
@@ -28,25 +31,18 @@ func AuthMiddleware(s *services.Service, next http.HandlerFunc) http.HandlerFunc
 		}
 		tokenString = parts[1]
 
-		claims := &jwt.RegisteredClaims{}
-		_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
-			}
+		if strings.HasPrefix(tokenString, constant.AccessTokenPrefix) {
+			accessTokenAuth(s, next, scopes, tokenString, w, r)
+			return
+		}
 
-			return []byte(s.Config.AccessKeySecret), nil
-		})
+		claims, err := s.ParseAccessToken(tokenString)
 		if err != nil {
 			logger.Error("[AuthMiddleware] Failed to parse token", zap.Error(err))
 			helpers.WriteJSONError(w, http.StatusUnauthorized, err)
 			return
 		}
 
-		if time.Now().After(claims.ExpiresAt.Time) {
-			helpers.WriteJSONResponse(w, http.StatusUnauthorized, fmt.Errorf("token expired"))
-			return
-		}
-
 		userId, err := strconv.ParseInt(claims.Subject, 10, 32)
 		if err != nil {
 			logger.Error("[AuthMiddleware] Failed to get user id from sub", zap.Error(err))
@@ -54,15 +50,69 @@ func AuthMiddleware(s *services.Service, next http.HandlerFunc) http.HandlerFunc
 			return
 		}
 
-		user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: int32(userId)})
-		if err != nil {
-			logger.Error("[AuthMiddleware] Failed to get user from sub", zap.Error(err))
-			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		if claims.ID == "" {
+			helpers.WriteJSONError(w, http.StatusUnauthorized, fmt.Errorf("token has no session"))
+			return
+		}
+		if err := s.CheckSession(r.Context(), claims.ID, int32(userId)); err != nil {
+			logger.Error("[AuthMiddleware] Check session got error", zap.String("sessionId", claims.ID), zap.Error(err))
+			helpers.WriteError(w, err)
+			return
+		}
+
+		user, ok := loadUser(s, int32(userId), w, r)
+		if !ok {
+			return
 		}
 
 		ctx := context.WithValue(r.Context(), constant.UserContextKey, *user)
+		ctx = context.WithValue(ctx, constant.SessionContextKey, claims.ID)
 		r = r.WithContext(ctx)
 
 		next(w, r)
 	}
 }
+
+// accessTokenAuth authenticates a request made with a personal access token. Such requests have no
+// session, the routes managing the account are never given scopes.
+func accessTokenAuth(s *services.Service, next http.HandlerFunc, scopes []string, tokenString string, w http.ResponseWriter, r *http.Request) {
+	token, err := s.AuthenticateAccessToken(r, tokenString)
+	if err != nil {
+		logger.Error("[AuthMiddleware] Authenticate access token got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if len(scopes) == 0 {
+		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("this endpoint can not be used with an access token"))
+		return
+	}
+	if !services.HasAnyScope(token, scopes...) {
+		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("access token is missing scope %s", strings.Join(scopes, " or ")))
+		return
+	}
+
+	user, ok := loadUser(s, token.UserID, w, r)
+	if !ok {
+		return
+	}
+	next(w, r.WithContext(context.WithValue(r.Context(), constant.UserContextKey, *user)))
+}
+
+func loadUser(s *services.Service, userID int32, w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: userID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the account was deleted after the token was issued
+			helpers.WriteJSONError(w, http.StatusUnauthorized, fmt.Errorf("user not found"))
+			return nil, false
+		}
+		logger.Error("[AuthMiddleware] Failed to get user", zap.Int32("userId", userID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if user.DisabledAt != nil {
+		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("account is disabled"))
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// RoleMiddleware lets the request through when the user has one of the roles. It runs inside
+// AuthMiddleware, which puts the user in the context.
+func RoleMiddleware(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+		if !ok {
+			logger.Error("[RoleMiddleware] Can not get user from context")
+			helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+			return
+		}
+		if !slices.Contains(roles, user.Role) {
+			helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+			return
+		}
+		next(w, r)
+	}
+}
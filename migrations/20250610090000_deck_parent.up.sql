@@ -0,0 +1,3 @@
+ALTER TABLE decks
+    ADD COLUMN parent_id INT DEFAULT NULL,
+    ADD INDEX idx_decks_parent_id (parent_id);
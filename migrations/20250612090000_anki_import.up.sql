@@ -0,0 +1,43 @@
+ALTER TABLE cards
+    MODIFY COLUMN front TEXT NOT NULL,
+    MODIFY COLUMN back TEXT NOT NULL,
+    ADD COLUMN tags VARCHAR(1000) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS media (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_media_user_id_filename (user_id, filename)
+);
+
+CREATE TABLE IF NOT EXISTS review_logs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    card_id INT NOT NULL,
+    user_id INT NOT NULL,
+    quality INT NOT NULL,
+    easiness_factor FLOAT NOT NULL,
+    repetition_number INT NOT NULL,
+    interval_number INT NOT NULL,
+    reviewed_at DATETIME NOT NULL,
+    INDEX idx_review_logs_card_id (card_id),
+    INDEX idx_review_logs_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    progress INT NOT NULL DEFAULT 0,
+    total INT NOT NULL DEFAULT 0,
+    result MEDIUMTEXT,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    finished_at DATETIME DEFAULT NULL,
+    INDEX idx_jobs_user_id (user_id)
+);
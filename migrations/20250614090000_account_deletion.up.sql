@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_at DATETIME DEFAULT NULL,
+    ADD INDEX idx_users_deletion_scheduled_at (deletion_scheduled_at);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS deck_members (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    deck_id INT NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    user_id INT DEFAULT NULL,
+    role VARCHAR(20) NOT NULL,
+    invited_by INT NOT NULL,
+    accepted_at DATETIME DEFAULT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_deck_members_deck_id_email (deck_id, email),
+    INDEX idx_deck_members_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS card_progresses (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    card_id INT NOT NULL,
+    user_id INT NOT NULL,
+    easiness_factor FLOAT NOT NULL DEFAULT 2.5,
+    repetition_number INT NOT NULL DEFAULT 0,
+    interval_number INT NOT NULL DEFAULT 0,
+    study_time DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_card_progresses_card_id_user_id (card_id, user_id),
+    INDEX idx_card_progresses_user_id (user_id)
+);
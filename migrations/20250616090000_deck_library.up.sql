@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS published_decks (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    deck_id INT NOT NULL,
+    user_id INT NOT NULL,
+    title VARCHAR(100) NOT NULL,
+    description VARCHAR(1000) NOT NULL DEFAULT '',
+    language VARCHAR(20) NOT NULL DEFAULT '',
+    tags VARCHAR(1000) NOT NULL DEFAULT '',
+    card_count INT NOT NULL DEFAULT 0,
+    subscriber_count INT NOT NULL DEFAULT 0,
+    fork_count INT NOT NULL DEFAULT 0,
+    report_count INT NOT NULL DEFAULT 0,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    published_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_published_decks_deck_id (deck_id),
+    INDEX idx_published_decks_user_id (user_id),
+    INDEX idx_published_decks_language (language)
+);
+
+CREATE TABLE IF NOT EXISTS deck_subscriptions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    published_deck_id INT NOT NULL,
+    user_id INT NOT NULL,
+    deck_id INT NOT NULL,
+    synced_at DATETIME DEFAULT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_deck_subscriptions_published_deck_id_user_id (published_deck_id, user_id),
+    INDEX idx_deck_subscriptions_user_id (user_id),
+    INDEX idx_deck_subscriptions_deck_id (deck_id)
+);
+
+CREATE TABLE IF NOT EXISTS deck_reports (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    published_deck_id INT NOT NULL,
+    user_id INT NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    details TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_deck_reports_published_deck_id_user_id (published_deck_id, user_id),
+    INDEX idx_deck_reports_user_id (user_id)
+);
+
+ALTER TABLE cards
+    ADD COLUMN source_card_id INT DEFAULT NULL,
+    ADD INDEX idx_cards_source_card_id (source_card_id);
+
+ALTER TABLE decks
+    ADD COLUMN source_deck_id INT DEFAULT NULL,
+    ADD INDEX idx_decks_source_deck_id (source_deck_id);
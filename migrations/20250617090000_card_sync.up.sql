@@ -0,0 +1,40 @@
+ALTER TABLE cards
+    ADD COLUMN guid VARCHAR(36) NOT NULL DEFAULT '',
+    ADD COLUMN content_version INT NOT NULL DEFAULT 1;
+
+UPDATE cards SET guid = UUID() WHERE guid = '';
+
+ALTER TABLE cards ADD UNIQUE INDEX idx_cards_guid (guid);
+
+CREATE TABLE IF NOT EXISTS card_upstreams (
+    card_id INT PRIMARY KEY,
+    source_guid VARCHAR(36) NOT NULL,
+    version INT NOT NULL DEFAULT 0,
+    front TEXT NOT NULL,
+    back TEXT NOT NULL,
+    tags VARCHAR(1000) NOT NULL DEFAULT '',
+    INDEX idx_card_upstreams_source_guid (source_guid)
+);
+
+-- subscribed copies used to point to the id of their source card
+INSERT INTO card_upstreams (card_id, source_guid, version, front, back, tags)
+SELECT copies.id, sources.guid, sources.content_version, sources.front, sources.back, sources.tags
+FROM cards copies
+JOIN cards sources ON sources.id = copies.source_card_id;
+
+ALTER TABLE cards
+    DROP INDEX idx_cards_source_card_id,
+    DROP COLUMN source_card_id;
+
+CREATE TABLE IF NOT EXISTS card_conflicts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    subscription_id INT NOT NULL,
+    card_id INT NOT NULL,
+    field VARCHAR(20) NOT NULL,
+    local_value TEXT NOT NULL,
+    upstream_value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE INDEX idx_card_conflicts_card_id_field (card_id, field),
+    INDEX idx_card_conflicts_subscription_id (subscription_id)
+);
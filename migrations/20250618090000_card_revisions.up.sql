@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS card_revisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    card_id INT NOT NULL,
+    user_id INT NOT NULL,
+    version INT NOT NULL,
+    front TEXT NOT NULL,
+    back TEXT NOT NULL,
+    tags VARCHAR(1000) NOT NULL DEFAULT '',
+    diff MEDIUMTEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_card_revisions_card_id (card_id),
+    INDEX idx_card_revisions_created_at (created_at)
+);
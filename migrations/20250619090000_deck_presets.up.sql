@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS deck_presets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    new_per_day INT NOT NULL DEFAULT 20,
+    reviews_per_day INT NOT NULL DEFAULT 200,
+    learning_steps VARCHAR(200) NOT NULL DEFAULT '1 10',
+    starting_ease FLOAT NOT NULL DEFAULT 2.5,
+    max_interval INT NOT NULL DEFAULT 36500,
+    desired_retention FLOAT NOT NULL DEFAULT 0.9,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_deck_presets_user_id (user_id)
+);
+
+ALTER TABLE decks
+    ADD COLUMN preset_id INT DEFAULT NULL,
+    ADD INDEX idx_decks_preset_id (preset_id);
+
+ALTER TABLE cards ADD COLUMN learning_step INT NOT NULL DEFAULT 0;
+
+ALTER TABLE card_progresses ADD COLUMN learning_step INT NOT NULL DEFAULT 0;
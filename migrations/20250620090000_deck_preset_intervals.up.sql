@@ -0,0 +1,7 @@
+ALTER TABLE deck_presets
+    ADD COLUMN minimum_ease FLOAT NOT NULL DEFAULT 1.3,
+    ADD COLUMN first_interval INT NOT NULL DEFAULT 1,
+    ADD COLUMN second_interval INT NOT NULL DEFAULT 6,
+    ADD COLUMN easy_bonus FLOAT NOT NULL DEFAULT 1,
+    ADD COLUMN hard_multiplier FLOAT NOT NULL DEFAULT 0,
+    ADD COLUMN interval_modifier FLOAT NOT NULL DEFAULT 1;
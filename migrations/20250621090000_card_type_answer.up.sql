@@ -0,0 +1 @@
+ALTER TABLE cards ADD COLUMN type_answer BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_user_tokens_user_id (user_id),
+    INDEX idx_user_tokens_expires_at (expires_at)
+);
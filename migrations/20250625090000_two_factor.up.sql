@@ -0,0 +1,13 @@
+ALTER TABLE users
+    ADD COLUMN two_factor_secret VARCHAR(255) DEFAULT NULL,
+    ADD COLUMN two_factor_enabled_at DATETIME DEFAULT NULL,
+    ADD COLUMN two_factor_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_recovery_codes_user_id (user_id)
+);
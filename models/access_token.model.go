@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AccessToken is a personal access token scripts authenticate with, only its hash is stored.
+type AccessToken struct {
+	ID        int32  `gorm:"primaryKey"`
+	UserID    int32  `gorm:"not null;index"`
+	Name      string `gorm:"size:100;not null"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex"`
+	// Hint is the start of the token, to recognize it in the list.
+	Hint string `gorm:"size:16;not null"`
+	// Scopes are space separated.
+	Scopes     string     `gorm:"size:255;not null"`
+	ExpiresAt  *time.Time `gorm:"type:datetime"`
+	LastUsedAt *time.Time `gorm:"type:datetime"`
+	LastUsedIP string     `gorm:"size:45"`
+	CreatedAt  time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+}
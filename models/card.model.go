@@ -8,8 +8,9 @@ import (
 
 type Card struct {
 	ID               int32          `gorm:"primaryKey"`
-	Front            string         `gorm:"size:255;not null"`
-	Back             string         `gorm:"size:255;not null"`
+	Front            string         `gorm:"type:text;not null"`
+	Back             string         `gorm:"type:text;not null"`
+	Tags             string         `gorm:"size:1000;not null;default:''"`
 	DeckID           int32          `gorm:"not null;index"`
 	UserID           int32          `gorm:"not null;index"`
 	CreatedAt        time.Time      `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
@@ -19,4 +20,12 @@ type Card struct {
 	StudyTime        time.Time      `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
 	RepetitionNumber int32          `gorm:"not null;default:0"`
 	IntervalNumber   int32          `gorm:"not null;default:0"`
+	// TypeAnswer asks for the back to be typed when studying, instead of only revealing it.
+	TypeAnswer bool `gorm:"not null;default:false"`
+	// LearningStep is the learning step a new or failed card is at.
+	LearningStep int32 `gorm:"not null;default:0"`
+	// GUID identifies the card across copies, subscribed copies are matched to their source by it.
+	GUID string `gorm:"size:36;not null;uniqueIndex"`
+	// ContentVersion is incremented every time the front, back or tags of the card change.
+	ContentVersion int32 `gorm:"not null;default:1"`
 }
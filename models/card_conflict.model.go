@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	CardFieldFront = "front"
+	CardFieldBack  = "back"
+	CardFieldTags  = "tags"
+
+	CardConflictKeepLocal    = "local"
+	CardConflictKeepUpstream = "upstream"
+)
+
+// CardConflict is a field of a subscribed copy that was changed both upstream and locally.
+type CardConflict struct {
+	ID             int32     `gorm:"primaryKey"`
+	SubscriptionID int32     `gorm:"not null;index"`
+	CardID         int32     `gorm:"not null;uniqueIndex:idx_card_conflicts_card_id_field"`
+	Field          string    `gorm:"size:20;not null;uniqueIndex:idx_card_conflicts_card_id_field"`
+	LocalValue     string    `gorm:"type:text;not null"`
+	UpstreamValue  string    `gorm:"type:text;not null"`
+	CreatedAt      time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt      time.Time `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
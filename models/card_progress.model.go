@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// CardProgress is the scheduling state of a card for a collaborator of its deck,
+// the owner of the card keeps using the scheduling fields of the card itself.
+type CardProgress struct {
+	ID               int32     `gorm:"primaryKey"`
+	CardID           int32     `gorm:"not null;uniqueIndex:idx_card_progresses_card_id_user_id"`
+	UserID           int32     `gorm:"not null;uniqueIndex:idx_card_progresses_card_id_user_id;index"`
+	EasinessFactor   float32   `gorm:"not null;default:2.5"`
+	RepetitionNumber int32     `gorm:"not null;default:0"`
+	IntervalNumber   int32     `gorm:"not null;default:0"`
+	LearningStep     int32     `gorm:"not null;default:0"`
+	StudyTime        time.Time `gorm:"type:datetime;not null"`
+	CreatedAt        time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CardRevision is the content a card had before one of its edits, with the user who made the edit.
+type CardRevision struct {
+	ID     int32 `gorm:"primaryKey"`
+	CardID int32 `gorm:"not null;index"`
+	UserID int32 `gorm:"not null"`
+	// Version is the content version of the card before the edit.
+	Version int32  `gorm:"not null"`
+	Front   string `gorm:"type:text;not null"`
+	Back    string `gorm:"type:text;not null"`
+	Tags    string `gorm:"size:1000;not null;default:''"`
+	// Diff is the JSON list of the fields the edit changed, with their old and new values.
+	Diff      string    `gorm:"type:mediumtext;not null"`
+	CreatedAt time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP;index"`
+}
+
+type CardRevisionWithUser struct {
+	CardRevision
+	UserName string `gorm:"column:user_name"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// CardUpstream is the content of the published card a subscribed copy was last synced to. Sync
+// compares it with both sides to tell the fields changed upstream from the ones edited locally.
+type CardUpstream struct {
+	CardID     int32  `gorm:"primaryKey;autoIncrement:false"`
+	SourceGUID string `gorm:"size:36;not null;index"`
+	Version    int32  `gorm:"not null;default:0"`
+	Front      string `gorm:"type:text;not null"`
+	Back       string `gorm:"type:text;not null"`
+	Tags       string `gorm:"size:1000;not null;default:''"`
+}
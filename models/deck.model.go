@@ -11,9 +11,14 @@ type Deck struct {
 	Name        string         `gorm:"size:100;not null"`
 	Description string         `gorm:"size:255"`
 	UserID      int32          `gorm:"not null;index"`
+	ParentID    *int32         `gorm:"index"`
 	CreatedAt   time.Time      `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
 	UpdatedAt   time.Time      `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
 	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	// SourceDeckID is the deck of a published deck this deck is the subscribed copy of.
+	SourceDeckID *int32 `gorm:"index"`
+	// PresetID is the preset with the study options of the deck and of its subdecks without one.
+	PresetID *int32 `gorm:"index"`
 }
 
 type DeckWithStats struct {
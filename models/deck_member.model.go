@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles of a user on a deck, ordered from the least to the most privileged.
+// The owner of a deck is the user of the deck and has no DeckMember row.
+const (
+	DeckRoleViewer = "viewer"
+	DeckRoleEditor = "editor"
+	DeckRoleOwner  = "owner"
+)
+
+// DeckMember gives a collaborator a role on a deck and its subdecks. It starts as an invitation
+// to an email and is linked to the user that accepts it.
+type DeckMember struct {
+	ID         int32      `gorm:"primaryKey"`
+	DeckID     int32      `gorm:"not null;uniqueIndex:idx_deck_members_deck_id_email"`
+	Email      string     `gorm:"size:100;not null;uniqueIndex:idx_deck_members_deck_id_email"`
+	UserID     *int32     `gorm:"index"`
+	Role       string     `gorm:"size:20;not null"`
+	InvitedBy  int32      `gorm:"not null"`
+	AcceptedAt *time.Time `gorm:"type:datetime"`
+	CreatedAt  time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt  time.Time  `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
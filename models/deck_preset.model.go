@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// DeckPreset is a named set of study options of a user, shared by the decks that reference it.
+// Subdecks without a preset of their own use the preset of their closest ancestor.
+type DeckPreset struct {
+	ID            int32  `gorm:"primaryKey"`
+	UserID        int32  `gorm:"not null;index"`
+	Name          string `gorm:"size:100;not null"`
+	NewPerDay     int32  `gorm:"not null;default:20"`
+	ReviewsPerDay int32  `gorm:"not null;default:200"`
+	// LearningSteps are space separated delays in minutes before a new or failed card is shown again.
+	LearningSteps string  `gorm:"size:200;not null;default:'1 10'"`
+	StartingEase  float32 `gorm:"not null;default:2.5"`
+	MinimumEase   float32 `gorm:"not null;default:1.3"`
+	// FirstInterval and SecondInterval are the intervals in days after the first two successful reviews.
+	FirstInterval  int32   `gorm:"not null;default:1"`
+	SecondInterval int32   `gorm:"not null;default:6"`
+	EasyBonus      float32 `gorm:"not null;default:1"`
+	// HardMultiplier grows the interval after a difficult answer, 0 grows it by the ease like other answers.
+	HardMultiplier   float32 `gorm:"not null;default:0"`
+	IntervalModifier float32 `gorm:"not null;default:1"`
+	// MaxInterval is the longest interval in days.
+	MaxInterval      int32     `gorm:"not null;default:36500"`
+	DesiredRetention float32   `gorm:"not null;default:0.9"`
+	CreatedAt        time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
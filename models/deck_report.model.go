@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	DeckReportReasonSpam      = "spam"
+	DeckReportReasonOffensive = "offensive"
+	DeckReportReasonCopyright = "copyright"
+	DeckReportReasonOther     = "other"
+)
+
+// DeckReport is an abuse report on a published deck, a user reports a deck once.
+type DeckReport struct {
+	ID              int32     `gorm:"primaryKey"`
+	PublishedDeckID int32     `gorm:"not null;uniqueIndex:idx_deck_reports_published_deck_id_user_id"`
+	UserID          int32     `gorm:"not null;uniqueIndex:idx_deck_reports_published_deck_id_user_id;index"`
+	Reason          string    `gorm:"size:20;not null"`
+	Details         string    `gorm:"type:text"`
+	CreatedAt       time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+}
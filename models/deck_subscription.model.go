@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// DeckSubscription links a published deck to the copy of a subscriber, which receives the
+// content updates of the published deck.
+type DeckSubscription struct {
+	ID              int32      `gorm:"primaryKey"`
+	PublishedDeckID int32      `gorm:"not null;uniqueIndex:idx_deck_subscriptions_published_deck_id_user_id"`
+	UserID          int32      `gorm:"not null;uniqueIndex:idx_deck_subscriptions_published_deck_id_user_id;index"`
+	DeckID          int32      `gorm:"not null;index"`
+	SyncedAt        *time.Time `gorm:"type:datetime"`
+	CreatedAt       time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time  `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+type Job struct {
+	ID         int32      `gorm:"primaryKey"`
+	UserID     int32      `gorm:"not null;index"`
+	Type       string     `gorm:"size:50;not null"`
+	Status     string     `gorm:"size:20;not null"`
+	Progress   int32      `gorm:"not null;default:0"`
+	Total      int32      `gorm:"not null;default:0"`
+	Result     string     `gorm:"type:mediumtext"`
+	Error      string     `gorm:"type:text"`
+	CreatedAt  time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt  time.Time  `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+	FinishedAt *time.Time `gorm:"type:datetime"`
+}
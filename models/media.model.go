@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+type Media struct {
+	ID          int32     `gorm:"primaryKey"`
+	UserID      int32     `gorm:"not null;uniqueIndex:idx_media_user_id_filename"`
+	Filename    string    `gorm:"size:255;not null;uniqueIndex:idx_media_user_id_filename"`
+	ContentType string    `gorm:"size:100;not null"`
+	Size        int64     `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// PublishedDeck lists a deck and its subdecks in the public library.
+type PublishedDeck struct {
+	ID              int32  `gorm:"primaryKey"`
+	DeckID          int32  `gorm:"not null;uniqueIndex"`
+	UserID          int32  `gorm:"not null;index"`
+	Title           string `gorm:"size:100;not null"`
+	Description     string `gorm:"size:1000;not null;default:''"`
+	Language        string `gorm:"size:20;not null;default:'';index"`
+	Tags            string `gorm:"size:1000;not null;default:''"`
+	CardCount       int32  `gorm:"not null;default:0"`
+	SubscriberCount int32  `gorm:"not null;default:0"`
+	ForkCount       int32  `gorm:"not null;default:0"`
+	ReportCount     int32  `gorm:"not null;default:0"`
+	// Hidden removes the deck from the library after too many abuse reports.
+	Hidden      bool      `gorm:"not null;default:false"`
+	PublishedAt time.Time `gorm:"type:datetime;not null"`
+	CreatedAt   time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
+
+// PublishedDeckWithAuthor is a published deck with the name of its author.
+type PublishedDeckWithAuthor struct {
+	PublishedDeck
+	AuthorName string `gorm:"column:author_name"`
+}
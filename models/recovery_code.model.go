@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single-use code signing in instead of a TOTP code, only its hash is stored.
+type RecoveryCode struct {
+	ID        int32      `gorm:"primaryKey"`
+	UserID    int32      `gorm:"not null;index"`
+	CodeHash  string     `gorm:"size:64;not null"`
+	UsedAt    *time.Time `gorm:"type:datetime"`
+	CreatedAt time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+type ReviewLog struct {
+	ID               int64     `gorm:"primaryKey"`
+	CardID           int32     `gorm:"not null;index"`
+	UserID           int32     `gorm:"not null;index"`
+	Quality          int32     `gorm:"not null"`
+	EasinessFactor   float32   `gorm:"not null"`
+	RepetitionNumber int32     `gorm:"not null"`
+	IntervalNumber   int32     `gorm:"not null"`
+	ReviewedAt       time.Time `gorm:"type:datetime;not null"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device. Its refresh token is rotated on every use, the
+// refresh tokens of a session form a family that is revoked as a whole when an old one is replayed.
+type Session struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	UserID int32  `gorm:"not null;index"`
+	// RefreshTokenHash is the SHA-256 of the current refresh token, Generation counts its rotations.
+	RefreshTokenHash string     `gorm:"size:64;not null"`
+	Generation       int32      `gorm:"not null;default:0"`
+	UserAgent        string     `gorm:"size:255;not null;default:''"`
+	IP               string     `gorm:"size:45;not null;default:''"`
+	LastSeenAt       time.Time  `gorm:"type:datetime;not null"`
+	ExpiresAt        time.Time  `gorm:"type:datetime;not null;index"`
+	RevokedAt        *time.Time `gorm:"type:datetime"`
+	CreatedAt        time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+	UpdatedAt        time.Time  `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
+}
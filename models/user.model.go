@@ -6,12 +6,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// Roles of users, moderators moderate the library and admins manage the users on top of it.
+const (
+	UserRoleUser      = "user"
+	UserRoleModerator = "moderator"
+	UserRoleAdmin     = "admin"
+)
+
+var UserRoles = []string{UserRoleUser, UserRoleModerator, UserRoleAdmin}
+
 type User struct {
-	ID        int32          `gorm:"primaryKey"`
-	Name      string         `gorm:"size:100;not null"`
-	Email     string         `gorm:"size:100;uniqueIndex;not null"`
-	Password  string         `gorm:"not null"`
+	ID    int32  `gorm:"primaryKey"`
+	Name  string `gorm:"size:100;not null"`
+	Email string `gorm:"size:100;uniqueIndex;not null"`
+	// Password is the bcrypt hash of the password, nil for accounts that only sign in through an
+	// external provider.
+	Password  *string        `gorm:"size:255"`
 	CreatedAt time.Time      `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
 	UpdatedAt time.Time      `gorm:"DEFAULT_GENERATED on update CURRENT_TIMESTAMP;type:datetime;default:CURRENT_TIMESTAMP"`
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	// EmailVerifiedAt is when the user confirmed owning Email, nil while it is unverified.
+	EmailVerifiedAt *time.Time `gorm:"type:datetime"`
+	// PendingEmail is the email the user asked to change to, it only replaces Email once verified.
+	PendingEmail *string `gorm:"size:100"`
+	// TwoFactorSecret is the TOTP secret encrypted with the two-factor key of the config, set from
+	// the enrollment on but only required at sign-in once TwoFactorEnabledAt is set.
+	TwoFactorSecret    *string    `gorm:"size:255"`
+	TwoFactorEnabledAt *time.Time `gorm:"type:datetime"`
+	// TwoFactorLastStep is the TOTP time step of the last code used, which can not be used again.
+	TwoFactorLastStep int64 `gorm:"not null;default:0"`
+	// DeletionScheduledAt is when the account and all of its data are permanently deleted.
+	DeletionScheduledAt *time.Time `gorm:"type:datetime;index"`
+	Role                string     `gorm:"size:20;not null;default:'user';index"`
+	// DisabledAt is when an admin disabled the account, it can not sign in nor use its tokens until
+	// enabled again.
+	DisabledAt *time.Time `gorm:"type:datetime"`
 }
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to their account at an external sign-in provider.
+type UserIdentity struct {
+	ID       int32  `gorm:"primaryKey"`
+	UserID   int32  `gorm:"not null;index"`
+	Provider string `gorm:"size:50;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject  string `gorm:"size:255;not null;uniqueIndex:idx_user_identities_provider_subject"`
+	// Email is the email the provider had for the user at the last sign-in.
+	Email      string    `gorm:"size:100"`
+	LastUsedAt time.Time `gorm:"type:datetime;not null"`
+	CreatedAt  time.Time `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Purposes of user tokens.
+const (
+	UserTokenVerifyEmail   = "verify_email"
+	UserTokenResetPassword = "reset_password"
+)
+
+// UserToken is a single-use token mailed to a user, the signed token sent carries its ID.
+type UserToken struct {
+	ID      string `gorm:"primaryKey;size:36"`
+	UserID  int32  `gorm:"not null;index"`
+	Purpose string `gorm:"size:32;not null"`
+	// Email is the address the token was sent to, a verification only applies while it is the
+	// email of the user.
+	Email     string     `gorm:"size:100;not null"`
+	ExpiresAt time.Time  `gorm:"type:datetime;not null;index"`
+	UsedAt    *time.Time `gorm:"type:datetime"`
+	CreatedAt time.Time  `gorm:"DEFAULT_GENERATED;type:datetime;default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,111 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mrgThang/flashcard-be/config"
+)
+
+const (
+	gitHubAuthURL  = "https://github.com/login/oauth/authorize"
+	gitHubTokenURL = "https://github.com/login/oauth/access_token"
+	gitHubAPIURL   = "https://api.github.com"
+)
+
+// GitHubProvider signs users in with GitHub, which has no ID tokens: the identity is read from its
+// API with the access token.
+type GitHubProvider struct {
+	cfg      *config.OIDCProviderConfig
+	client   *http.Client
+	authURL  string
+	tokenURL string
+	apiURL   string
+}
+
+type gitHubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+type gitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func NewGitHubProvider(cfg *config.OIDCProviderConfig, client *http.Client) *GitHubProvider {
+	provider := &GitHubProvider{
+		cfg:      cfg,
+		client:   client,
+		authURL:  gitHubAuthURL,
+		tokenURL: gitHubTokenURL,
+		apiURL:   gitHubAPIURL,
+	}
+	if cfg.AuthURL != "" {
+		provider.authURL = cfg.AuthURL
+	}
+	if cfg.TokenURL != "" {
+		provider.tokenURL = cfg.TokenURL
+	}
+	if cfg.APIURL != "" {
+		provider.apiURL = strings.TrimSuffix(cfg.APIURL, "/")
+	}
+	return provider
+}
+
+func (p *GitHubProvider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	authURL, err := url.Parse(p.authURL)
+	if err != nil {
+		return "", err
+	}
+	query := authURL.Query()
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", req.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"read:user", "user:email"}, p.cfg.Scopes...), " "))
+	query.Set("state", req.State)
+	query.Set("code_challenge", CodeChallenge(req.CodeVerifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error) {
+	token, err := exchangeCode(ctx, p.client, p.tokenURL, p.cfg, code, req)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access_token")
+	}
+	header := http.Header{"Authorization": {"Bearer " + token.AccessToken}}
+
+	var user gitHubUser
+	if err := getJSON(ctx, p.client, p.apiURL+"/user", header, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("github user has no id")
+	}
+	var emails []gitHubEmail
+	if err := getJSON(ctx, p.client, p.apiURL+"/user/emails", header, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email, identity.EmailVerified = email.Email, email.Verified
+			break
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,249 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mrgThang/flashcard-be/config"
+	"github.com/mrgThang/flashcard-be/oidc"
+	"github.com/mrgThang/flashcard-be/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/v1/auth/fake/callback"
+
+func newProvider(t *testing.T, server *oidctest.Server) *oidc.OIDCProvider {
+	t.Helper()
+	provider, err := oidc.New(&config.OIDCProviderConfig{
+		Name:         "fake",
+		Type:         oidc.TypeOIDC,
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return provider.(*oidc.OIDCProvider)
+}
+
+func newAuthRequest() oidc.AuthRequest {
+	return oidc.AuthRequest{
+		RedirectURL:  redirectURL,
+		State:        oidc.RandomString(),
+		Nonce:        oidc.RandomString(),
+		CodeVerifier: oidc.RandomString(),
+	}
+}
+
+// signIn runs the authorization code flow against the fake provider.
+func signIn(t *testing.T, server *oidctest.Server, provider oidc.Provider, req oidc.AuthRequest) (*oidc.Identity, error) {
+	t.Helper()
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	code, state, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if state != req.State {
+		t.Fatalf("Authorize() state = %q, want %q", state, req.State)
+	}
+	return provider.Exchange(context.Background(), code, req)
+}
+
+func TestOIDCProviderSignIn(t *testing.T) {
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+	server.SetIdentity(oidctest.Identity{Subject: "42", Email: "ada@example.com", EmailVerified: true, Name: "Ada"})
+	provider := newProvider(t, server)
+
+	identity, err := signIn(t, server, provider, newAuthRequest())
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := oidc.Identity{Subject: "42", Email: "ada@example.com", EmailVerified: true, Name: "Ada"}
+	if *identity != want {
+		t.Errorf("Exchange() = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCProviderKeyRotation(t *testing.T) {
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+	provider := newProvider(t, server)
+
+	if _, err := signIn(t, server, provider, newAuthRequest()); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	// the new key is unknown to the cached key set, which has to be fetched again
+	server.RotateKey()
+	if _, err := signIn(t, server, provider, newAuthRequest()); err != nil {
+		t.Fatalf("Exchange() after rotation error = %v", err)
+	}
+}
+
+func TestOIDCProviderRejectsCodeVerifier(t *testing.T) {
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+	provider := newProvider(t, server)
+
+	req := newAuthRequest()
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	code, _, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	req.CodeVerifier = oidc.RandomString()
+	if _, err := provider.Exchange(context.Background(), code, req); err == nil {
+		t.Error("Exchange() with another code verifier succeeded")
+	}
+}
+
+func TestOIDCProviderVerifyIDToken(t *testing.T) {
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+	provider := newProvider(t, server)
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   server.Issuer(),
+			"sub":   "42",
+			"aud":   "client",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	tests := []struct {
+		name    string
+		change  func(claims jwt.MapClaims)
+		nonce   string
+		wantErr bool
+	}{
+		{name: "valid", change: func(jwt.MapClaims) {}, nonce: "nonce"},
+		{name: "email verified as a string", change: func(c jwt.MapClaims) { c["email_verified"] = "true" }, nonce: "nonce"},
+		{name: "other nonce", change: func(jwt.MapClaims) {}, nonce: "other", wantErr: true},
+		{name: "other issuer", change: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, nonce: "nonce", wantErr: true},
+		{name: "other audience", change: func(c jwt.MapClaims) { c["aud"] = "other-client" }, nonce: "nonce", wantErr: true},
+		{name: "expired", change: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }, nonce: "nonce", wantErr: true},
+		{name: "no expiry", change: func(c jwt.MapClaims) { delete(c, "exp") }, nonce: "nonce", wantErr: true},
+		{name: "no subject", change: func(c jwt.MapClaims) { delete(c, "sub") }, nonce: "nonce", wantErr: true},
+		{
+			name:    "several audiences without authorized party",
+			change:  func(c jwt.MapClaims) { c["aud"] = []string{"client", "other-client"} },
+			nonce:   "nonce",
+			wantErr: true,
+		},
+		{
+			name: "several audiences issued to the client",
+			change: func(c jwt.MapClaims) {
+				c["aud"] = []string{"client", "other-client"}
+				c["azp"] = "client"
+			},
+			nonce: "nonce",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(claims)
+			_, err := provider.VerifyIDToken(context.Background(), server.SignIDToken(claims), tt.nonce)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyIDToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.VerifyIDToken(context.Background(), token, "nonce"); err == nil {
+			t.Error("VerifyIDToken() accepted an unsigned token")
+		}
+	})
+}
+
+func TestOIDCProviderDiscoveryIssuerMismatch(t *testing.T) {
+	server := oidctest.NewServer("client", "secret")
+	defer server.Close()
+	provider, err := oidc.New(&config.OIDCProviderConfig{
+		Name:     "fake",
+		Issuer:   server.Issuer() + "/other",
+		ClientID: "client",
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := provider.AuthCodeURL(context.Background(), newAuthRequest()); err == nil {
+		t.Error("AuthCodeURL() trusted a discovery document of another issuer")
+	}
+}
+
+func TestGitHubProviderSignIn(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" || r.FormValue("client_secret") != "secret" {
+			w.Write([]byte(`{"error":"bad_verification_code"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"token","token_type":"bearer"}`))
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id":7,"login":"ada","name":""}`))
+	})
+	mux.HandleFunc("GET /user/emails", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"email":"old@example.com","primary":false,"verified":true},{"email":"ada@example.com","primary":true,"verified":true}]`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider, err := oidc.New(&config.OIDCProviderConfig{
+		Name:         "github",
+		Type:         oidc.TypeGitHub,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthURL:      server.URL + "/login/oauth/authorize",
+		TokenURL:     server.URL + "/login/oauth/access_token",
+		APIURL:       server.URL,
+	}, server.Client())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := newAuthRequest()
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	if !strings.Contains(authURL, "state="+req.State) {
+		t.Errorf("AuthCodeURL() = %q, want the state", authURL)
+	}
+	identity, err := provider.Exchange(context.Background(), "code", req)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := oidc.Identity{Subject: "7", Email: "ada@example.com", EmailVerified: true, Name: "ada"}
+	if *identity != want {
+		t.Errorf("Exchange() = %+v, want %+v", *identity, want)
+	}
+	if _, err := provider.Exchange(context.Background(), "other", req); err == nil {
+		t.Error("Exchange() with a wrong code succeeded")
+	}
+}
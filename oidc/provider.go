@@ -0,0 +1,165 @@
+// Package oidc signs users in with external providers, OpenID Connect issuers found through
+// discovery and GitHub, through the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mrgThang/flashcard-be/config"
+)
+
+const (
+	TypeOIDC   = "oidc"
+	TypeGitHub = "github"
+)
+
+// maxResponseBytes bounds the responses read from a provider.
+const maxResponseBytes = 1 << 20
+
+// Identity is the user a provider signed in.
+type Identity struct {
+	// Subject identifies the user at the provider, it never changes.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// AuthRequest is what ties the redirect to a provider with the callback it comes back to.
+type AuthRequest struct {
+	RedirectURL  string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+type Provider interface {
+	// AuthCodeURL returns the page of the provider the user signs in on.
+	AuthCodeURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange redeems the code the provider redirected back with for the identity of the user.
+	Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error)
+}
+
+// New returns the provider of the config, requests to the provider go through client.
+func New(cfg *config.OIDCProviderConfig, client *http.Client) (Provider, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("oidc provider name is required")
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("oidc provider %s: client id is required", cfg.Name)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	switch cfg.Type {
+	case TypeOIDC, "":
+		if cfg.Issuer == "" {
+			return nil, fmt.Errorf("oidc provider %s: issuer is required", cfg.Name)
+		}
+		return NewOIDCProvider(cfg, client), nil
+	case TypeGitHub:
+		return NewGitHubProvider(cfg, client), nil
+	default:
+		return nil, fmt.Errorf("oidc provider %s: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// RandomString returns a random URL-safe string, to use as state, nonce or code verifier.
+func RandomString() string {
+	buffer := make([]byte, 32)
+	// crypto/rand never fails on supported platforms
+	_, _ = rand.Read(buffer)
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems the authorization code at the token endpoint.
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, cfg *config.OIDCProviderConfig, code string, req AuthRequest) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {req.RedirectURL},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code_verifier": {req.CodeVerifier},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	status, err := doJSON(client, request, &token)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token request: %s %s", token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("token request: status %d", status)
+	}
+	return &token, nil
+}
+
+// doJSON sends the request and decodes the JSON response into v, whatever its status.
+func doJSON(client *http.Client, request *http.Request, v any) (int, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseBytes))
+	if err != nil {
+		return response.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return response.StatusCode, fmt.Errorf("status %d: %w", response.StatusCode, err)
+	}
+	return response.StatusCode, nil
+}
+
+// getJSON fetches the URL and decodes its JSON body, failing on any status but 200.
+func getJSON(ctx context.Context, client *http.Client, rawURL string, header http.Header, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Accept", "application/json")
+	status, err := doJSON(client, request, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("get %s: status %d", rawURL, status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type AccessTokenRepository interface {
+	CreateAccessToken(ctx context.Context, token *models.AccessToken, dbs ...*gorm.DB) error
+	GetAccessTokenByHash(ctx context.Context, tokenHash string, dbs ...*gorm.DB) (*models.AccessToken, error)
+	GetAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.AccessToken, error)
+	CountAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) (int64, error)
+	TouchAccessToken(ctx context.Context, id int32, ip string, lastUsedAt time.Time, dbs ...*gorm.DB) error
+	DeleteAccessToken(ctx context.Context, userID int32, id int32, dbs ...*gorm.DB) (bool, error)
+	DeleteAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type accessTokenRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewAccessTokenRepository(db *gorm.DB) AccessTokenRepository {
+	return &accessTokenRepositoryImpl{db}
+}
+
+func (r *accessTokenRepositoryImpl) CreateAccessToken(ctx context.Context, token *models.AccessToken, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(token).Error
+}
+
+func (r *accessTokenRepositoryImpl) GetAccessTokenByHash(ctx context.Context, tokenHash string, dbs ...*gorm.DB) (*models.AccessToken, error) {
+	database := getDb(r.DB, dbs...)
+	var token models.AccessToken
+	err := database.WithContext(ctx).Model(&models.AccessToken{}).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *accessTokenRepositoryImpl) GetAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.AccessToken, error) {
+	database := getDb(r.DB, dbs...)
+	var tokens []*models.AccessToken
+	err := database.WithContext(ctx).Model(&models.AccessToken{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *accessTokenRepositoryImpl) CountAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	var count int64
+	err := database.WithContext(ctx).Model(&models.AccessToken{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *accessTokenRepositoryImpl) TouchAccessToken(ctx context.Context, id int32, ip string, lastUsedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.AccessToken{}).Where("id = ?", id).Updates(map[string]any{
+		"last_used_at": lastUsedAt,
+		"last_used_ip": ip,
+	}).Error
+}
+
+// DeleteAccessToken revokes the token of the user, it reports false when the user has no such token.
+func (r *accessTokenRepositoryImpl) DeleteAccessToken(ctx context.Context, userID int32, id int32, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.AccessToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *accessTokenRepositoryImpl) DeleteAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.AccessToken{}).Error
+}
@@ -2,12 +2,15 @@ package repositories
 
 import (
 	"context"
+	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
 	"github.com/mrgThang/flashcard-be/constant"
 	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
 	"github.com/mrgThang/flashcard-be/logger"
 	"github.com/mrgThang/flashcard-be/models"
 )
@@ -15,8 +18,23 @@ import (
 type CardRepository interface {
 	CreateCard(ctx context.Context, req dto.CreateCardRequest, db ...*gorm.DB) error
 	GetCards(ctx context.Context, req dto.GetCardsRequest, db ...*gorm.DB) ([]*models.Card, int64, error)
+	GetAllCards(ctx context.Context, req dto.GetCardsRequest, db ...*gorm.DB) ([]*models.Card, error)
+	StreamCards(ctx context.Context, req dto.GetCardsRequest, batchSize int, fn func(cards []*models.Card) error, db ...*gorm.DB) error
+	CreateCards(ctx context.Context, cards []*models.Card, db ...*gorm.DB) error
+	CountCards(ctx context.Context, req dto.GetCardsRequest, db ...*gorm.DB) (int64, error)
+	MoveCards(ctx context.Context, ids []int32, deckID int32, db ...*gorm.DB) error
 	GetDetailCard(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.Card, error)
 	UpdateFullCard(cardToUpdate *models.Card, dbs ...*gorm.DB) error
+	DeleteCard(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	DeleteCardsByDecks(ctx context.Context, deckIDs []int32, deletedAt time.Time, dbs ...*gorm.DB) error
+	GetDeletedCards(ctx context.Context, req dto.GetTrashRequest, dbs ...*gorm.DB) ([]*models.Card, error)
+	RestoreCards(ctx context.Context, ids []int32, dbs ...*gorm.DB) error
+	RestoreCardsByDecks(ctx context.Context, deckIDs []int32, deletedAt time.Time, dbs ...*gorm.DB) error
+	PurgeCards(ctx context.Context, ids []int32, dbs ...*gorm.DB) error
+	PurgeCardsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) error
+	GetCardIDsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]int32, error)
+	GetCardIDsDeletedBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]int32, error)
+	PurgeCardsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
 }
 
 type cardRepositoryImpl struct {
@@ -30,10 +48,13 @@ func NewCardRepository(db *gorm.DB) CardRepository {
 func (r *cardRepositoryImpl) CreateCard(ctx context.Context, req dto.CreateCardRequest, dbs ...*gorm.DB) error {
 	database := getDb(r.DB, dbs...)
 	card := models.Card{
-		UserID: req.UserID,
-		Front:  req.Front,
-		Back:   req.Back,
-		DeckID: req.DeckID,
+		UserID:     req.UserID,
+		Front:      req.Front,
+		Back:       req.Back,
+		DeckID:     req.DeckID,
+		Tags:       helpers.JoinTags(req.Tags),
+		GUID:       uuid.NewString(),
+		TypeAnswer: req.TypeAnswer,
 	}
 	return database.WithContext(ctx).Create(&card).Error
 }
@@ -46,25 +67,7 @@ func (r *cardRepositoryImpl) UpdateFullCard(cardToUpdate *models.Card, dbs ...*g
 func (r *cardRepositoryImpl) GetCards(ctx context.Context, req dto.GetCardsRequest, dbs ...*gorm.DB) ([]*models.Card, int64, error) {
 	database := getDb(r.DB, dbs...)
 	var cards []*models.Card
-	query := database.WithContext(ctx).Model(&models.Card{})
-	if req.ID != 0 {
-		query = query.Where("id = ?", req.ID)
-	}
-	if req.DeckID != 0 {
-		query = query.Where("deck_id = ?", req.DeckID)
-	}
-	if req.UserID != 0 {
-		query = query.Where("user_id = ?", req.UserID)
-	}
-	if req.Front != "" {
-		query = query.Where("front LIKE ?", "%"+req.Front+"%")
-	}
-	if req.Back != "" {
-		query = query.Where("back LIKE ?", "%"+req.Back+"%")
-	}
-	if req.StudyTimeTo != nil {
-		query = query.Where("study_time <= ?", req.StudyTimeTo)
-	}
+	query := filterCards(database.WithContext(ctx).Model(&models.Card{}), req)
 
 	offset := constant.DefaultOffset
 	if req.Page > 0 {
@@ -81,7 +84,7 @@ func (r *cardRepositoryImpl) GetCards(ctx context.Context, req dto.GetCardsReque
 		return nil, 0, err
 	}
 
-	query = query.Offset(offset).Limit(limit)
+	query = selectCards(query, req).Offset(offset).Limit(limit)
 	err = query.Find(&cards).Error
 	if err != nil {
 		return nil, 0, err
@@ -89,6 +92,127 @@ func (r *cardRepositoryImpl) GetCards(ctx context.Context, req dto.GetCardsReque
 	return cards, totalItems, nil
 }
 
+// GetAllCards returns every card matching the filters without pagination, or the req.Limit cards
+// after the first req.Offset ones when a limit is set.
+func (r *cardRepositoryImpl) GetAllCards(ctx context.Context, req dto.GetCardsRequest, dbs ...*gorm.DB) ([]*models.Card, error) {
+	database := getDb(r.DB, dbs...)
+	var cards []*models.Card
+	query := selectCards(filterCards(database.WithContext(ctx).Model(&models.Card{}), req), req)
+	if req.Limit > 0 {
+		query = query.Offset(req.Offset).Limit(req.Limit)
+	}
+	err := query.Order("cards.id").Find(&cards).Error
+	if err != nil {
+		logger.Error("[GetAllCards] got error", zap.Error(err))
+		return nil, err
+	}
+	return cards, nil
+}
+
+// StreamCards calls fn with the matching cards in batches ordered by id. Batches are read with
+// a cursor on the id instead of an offset, so the cost of a batch does not grow with its position.
+func (r *cardRepositoryImpl) StreamCards(ctx context.Context, req dto.GetCardsRequest, batchSize int, fn func(cards []*models.Card) error, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	var cards []*models.Card
+	query := selectCards(filterCards(database.WithContext(ctx).Model(&models.Card{}), req), req)
+	err := query.FindInBatches(&cards, batchSize, func(tx *gorm.DB, batch int) error {
+		return fn(cards)
+	}).Error
+	if err != nil {
+		logger.Error("[StreamCards] got error", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// CountCards returns the number of cards matching the filters.
+func (r *cardRepositoryImpl) CountCards(ctx context.Context, req dto.GetCardsRequest, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	var count int64
+	err := filterCards(database.WithContext(ctx).Model(&models.Card{}), req).Count(&count).Error
+	return count, err
+}
+
+// progressStudyTime is the due time of a card for a collaborator, a card they never studied is due
+// since it was created.
+const progressStudyTime = "COALESCE(card_progresses.study_time, cards.created_at)"
+
+func filterCards(query *gorm.DB, req dto.GetCardsRequest) *gorm.DB {
+	if req.WithDeleted {
+		query = query.Unscoped()
+	}
+	if req.ProgressUserID != 0 {
+		query = query.Joins("LEFT JOIN card_progresses ON card_progresses.card_id = cards.id AND card_progresses.user_id = ?", req.ProgressUserID)
+	}
+	if req.ID != 0 {
+		query = query.Where("cards.id = ?", req.ID)
+	}
+	if len(req.IDs) > 0 {
+		query = query.Where("cards.id IN ?", req.IDs)
+	}
+	if len(req.DeckIDs) > 0 {
+		query = query.Where("cards.deck_id IN ?", req.DeckIDs)
+	} else if req.DeckID != 0 {
+		query = query.Where("cards.deck_id = ?", req.DeckID)
+	}
+	if req.UserID != 0 {
+		query = query.Where("cards.user_id = ?", req.UserID)
+	}
+	if req.Front != "" {
+		query = query.Where("cards.front LIKE ?", "%"+req.Front+"%")
+	}
+	if req.Back != "" {
+		query = query.Where("cards.back LIKE ?", "%"+req.Back+"%")
+	}
+	if req.New != nil {
+		reviews := "SELECT 1 FROM review_logs WHERE review_logs.card_id = cards.id AND review_logs.user_id = ?"
+		if *req.New {
+			query = query.Where("NOT EXISTS ("+reviews+")", req.ReviewerID)
+		} else {
+			query = query.Where("EXISTS ("+reviews+")", req.ReviewerID)
+		}
+	}
+	if req.StudyTimeTo != nil {
+		if req.ProgressUserID != 0 {
+			query = query.Where(progressStudyTime+" <= ?", req.StudyTimeTo)
+		} else {
+			query = query.Where("cards.study_time <= ?", req.StudyTimeTo)
+		}
+	}
+	return query
+}
+
+// selectCards replaces the scheduling state of the cards with the one of req.ProgressUserID.
+// It is applied after counting, as a count ignores the selected columns.
+func selectCards(query *gorm.DB, req dto.GetCardsRequest) *gorm.DB {
+	if req.ProgressUserID == 0 {
+		return query
+	}
+	return query.Select(`cards.id, cards.front, cards.back, cards.tags, cards.deck_id, cards.user_id, cards.guid, cards.content_version, cards.type_answer,
+		cards.created_at, cards.updated_at, cards.deleted_at,
+		COALESCE(card_progresses.easiness_factor, 2.5) AS easiness_factor,
+		` + progressStudyTime + ` AS study_time,
+		COALESCE(card_progresses.repetition_number, 0) AS repetition_number,
+		COALESCE(card_progresses.interval_number, 0) AS interval_number,
+		COALESCE(card_progresses.learning_step, 0) AS learning_step`)
+}
+
+// CreateCards inserts the cards, giving a new GUID to the ones without one.
+func (r *cardRepositoryImpl) CreateCards(ctx context.Context, cards []*models.Card, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	for _, card := range cards {
+		if card.GUID == "" {
+			card.GUID = uuid.NewString()
+		}
+	}
+	return database.WithContext(ctx).CreateInBatches(cards, 500).Error
+}
+
+func (r *cardRepositoryImpl) MoveCards(ctx context.Context, ids []int32, deckID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Card{}).Where("id IN ?", ids).Update("deck_id", deckID).Error
+}
+
 func (r *cardRepositoryImpl) GetDetailCard(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.Card, error) {
 	database := getDb(r.DB, dbs...)
 	var card models.Card
@@ -99,3 +223,77 @@ func (r *cardRepositoryImpl) GetDetailCard(ctx context.Context, id int32, dbs ..
 	}
 	return &card, nil
 }
+
+func (r *cardRepositoryImpl) DeleteCard(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("id = ?", id).Delete(&models.Card{}).Error
+}
+
+// DeleteCardsByDecks soft deletes the cards of the decks with the same timestamp as the decks,
+// so that restoring a deck only brings back the cards that were deleted together with it.
+func (r *cardRepositoryImpl) DeleteCardsByDecks(ctx context.Context, deckIDs []int32, deletedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Card{}).Where("deck_id IN ?", deckIDs).Update("deleted_at", deletedAt).Error
+}
+
+func (r *cardRepositoryImpl) GetDeletedCards(ctx context.Context, req dto.GetTrashRequest, dbs ...*gorm.DB) ([]*models.Card, error) {
+	database := getDb(r.DB, dbs...)
+	var cards []*models.Card
+	query := database.WithContext(ctx).Unscoped().Model(&models.Card{}).Where("deleted_at IS NOT NULL")
+	if req.UserID != 0 {
+		query = query.Where("user_id = ?", req.UserID)
+	}
+	if len(req.CardIDs) > 0 {
+		query = query.Where("id IN ?", req.CardIDs)
+	}
+	err := query.Order("deleted_at DESC").Find(&cards).Error
+	if err != nil {
+		logger.Error("[GetDeletedCards] got error", zap.Error(err))
+		return nil, err
+	}
+	return cards, nil
+}
+
+func (r *cardRepositoryImpl) RestoreCards(ctx context.Context, ids []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Model(&models.Card{}).Where("id IN ?", ids).Update("deleted_at", nil).Error
+}
+
+func (r *cardRepositoryImpl) RestoreCardsByDecks(ctx context.Context, deckIDs []int32, deletedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Model(&models.Card{}).
+		Where("deck_id IN ? AND deleted_at = ?", deckIDs, deletedAt).
+		Update("deleted_at", nil).Error
+}
+
+func (r *cardRepositoryImpl) PurgeCards(ctx context.Context, ids []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Where("id IN ? AND deleted_at IS NOT NULL", ids).Delete(&models.Card{}).Error
+}
+
+func (r *cardRepositoryImpl) PurgeCardsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Where("deck_id IN ?", deckIDs).Delete(&models.Card{}).Error
+}
+
+// GetCardIDsByDecks returns the ids of every card of the decks, including the ones in the trash.
+func (r *cardRepositoryImpl) GetCardIDsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]int32, error) {
+	database := getDb(r.DB, dbs...)
+	var ids []int32
+	err := database.WithContext(ctx).Unscoped().Model(&models.Card{}).Where("deck_id IN ?", deckIDs).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// GetCardIDsDeletedBefore returns the ids of the cards of every user that went to the trash before the time.
+func (r *cardRepositoryImpl) GetCardIDsDeletedBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]int32, error) {
+	database := getDb(r.DB, dbs...)
+	var ids []int32
+	err := database.WithContext(ctx).Unscoped().Model(&models.Card{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PurgeCardsByUser permanently deletes every card of the user, including the ones in the trash.
+func (r *cardRepositoryImpl) PurgeCardsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&models.Card{}).Error
+}
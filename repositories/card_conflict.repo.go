@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type CardConflictRepository interface {
+	SaveConflict(ctx context.Context, conflict *models.CardConflict, dbs ...*gorm.DB) error
+	GetConflict(ctx context.Context, id int32, subscriptionID int32, dbs ...*gorm.DB) (*models.CardConflict, error)
+	GetConflictsBySubscription(ctx context.Context, subscriptionID int32, dbs ...*gorm.DB) ([]*models.CardConflict, error)
+	DeleteConflict(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	DeleteConflictsByCard(ctx context.Context, cardID int32, dbs ...*gorm.DB) error
+	DeleteConflictsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error
+	DeleteConflictsBySubscription(ctx context.Context, subscriptionID int32, dbs ...*gorm.DB) error
+	DeleteConflictsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error
+	DeleteConflictsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	DeleteConflictsByAuthor(ctx context.Context, authorID int32, dbs ...*gorm.DB) error
+}
+
+type cardConflictRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewCardConflictRepository(db *gorm.DB) CardConflictRepository {
+	return &cardConflictRepositoryImpl{db}
+}
+
+// SaveConflict inserts the conflict on the field of the card or overwrites the existing one.
+func (r *cardConflictRepositoryImpl) SaveConflict(ctx context.Context, conflict *models.CardConflict, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"subscription_id", "local_value", "upstream_value", "updated_at"}),
+	}).Create(conflict).Error
+}
+
+func (r *cardConflictRepositoryImpl) GetConflict(ctx context.Context, id int32, subscriptionID int32, dbs ...*gorm.DB) (*models.CardConflict, error) {
+	database := getDb(r.DB, dbs...)
+	var conflict models.CardConflict
+	err := database.WithContext(ctx).Model(&models.CardConflict{}).
+		Where("id = ? AND subscription_id = ?", id, subscriptionID).
+		First(&conflict).Error
+	if err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+func (r *cardConflictRepositoryImpl) GetConflictsBySubscription(ctx context.Context, subscriptionID int32, dbs ...*gorm.DB) ([]*models.CardConflict, error) {
+	database := getDb(r.DB, dbs...)
+	var conflicts []*models.CardConflict
+	err := database.WithContext(ctx).Model(&models.CardConflict{}).
+		Where("subscription_id = ?", subscriptionID).
+		Order("card_id, field").
+		Find(&conflicts).Error
+	return conflicts, err
+}
+
+func (r *cardConflictRepositoryImpl) DeleteConflict(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("id = ?", id).Delete(&models.CardConflict{}).Error
+}
+
+func (r *cardConflictRepositoryImpl) DeleteConflictsByCard(ctx context.Context, cardID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("card_id = ?", cardID).Delete(&models.CardConflict{}).Error
+}
+
+func (r *cardConflictRepositoryImpl) DeleteConflictsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("card_id IN ?", cardIDs).Delete(&models.CardConflict{}).Error
+}
+
+func (r *cardConflictRepositoryImpl) DeleteConflictsBySubscription(ctx context.Context, subscriptionID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("subscription_id = ?", subscriptionID).Delete(&models.CardConflict{}).Error
+}
+
+func (r *cardConflictRepositoryImpl) DeleteConflictsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	subscriptions := database.Model(&models.DeckSubscription{}).Select("id").Where("published_deck_id = ?", publishedDeckID)
+	return database.WithContext(ctx).Where("subscription_id IN (?)", subscriptions).Delete(&models.CardConflict{}).Error
+}
+
+// DeleteConflictsByUser removes the conflicts of the subscriptions of the user.
+func (r *cardConflictRepositoryImpl) DeleteConflictsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	subscriptions := database.Model(&models.DeckSubscription{}).Select("id").Where("user_id = ?", userID)
+	return database.WithContext(ctx).Where("subscription_id IN (?)", subscriptions).Delete(&models.CardConflict{}).Error
+}
+
+// DeleteConflictsByAuthor removes the conflicts of the subscriptions to the published decks of the author.
+func (r *cardConflictRepositoryImpl) DeleteConflictsByAuthor(ctx context.Context, authorID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	publishedDecks := database.Model(&models.PublishedDeck{}).Select("id").Where("user_id = ?", authorID)
+	subscriptions := database.Model(&models.DeckSubscription{}).Select("id").Where("published_deck_id IN (?)", publishedDecks)
+	return database.WithContext(ctx).Where("subscription_id IN (?)", subscriptions).Delete(&models.CardConflict{}).Error
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type CardProgressRepository interface {
+	GetProgress(ctx context.Context, cardID int32, userID int32, dbs ...*gorm.DB) (*models.CardProgress, error)
+	SaveProgress(ctx context.Context, progress *models.CardProgress, dbs ...*gorm.DB) error
+	GetProgressByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.CardProgress, error)
+	DeleteProgressByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	DeleteProgressByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error
+	DeleteProgressByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error
+}
+
+type cardProgressRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewCardProgressRepository(db *gorm.DB) CardProgressRepository {
+	return &cardProgressRepositoryImpl{db}
+}
+
+func (r *cardProgressRepositoryImpl) GetProgress(ctx context.Context, cardID int32, userID int32, dbs ...*gorm.DB) (*models.CardProgress, error) {
+	database := getDb(r.DB, dbs...)
+	var progress models.CardProgress
+	err := database.WithContext(ctx).Model(&models.CardProgress{}).Where("card_id = ? AND user_id = ?", cardID, userID).First(&progress).Error
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// SaveProgress inserts the progress of the user on the card or overwrites the existing one.
+func (r *cardProgressRepositoryImpl) SaveProgress(ctx context.Context, progress *models.CardProgress, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"easiness_factor", "repetition_number", "interval_number", "study_time", "updated_at"}),
+	}).Create(progress).Error
+}
+
+func (r *cardProgressRepositoryImpl) GetProgressByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.CardProgress, error) {
+	database := getDb(r.DB, dbs...)
+	var progresses []*models.CardProgress
+	err := database.WithContext(ctx).Model(&models.CardProgress{}).Where("user_id = ?", userID).Order("id").Find(&progresses).Error
+	return progresses, err
+}
+
+func (r *cardProgressRepositoryImpl) DeleteProgressByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.CardProgress{}).Error
+}
+
+// DeleteProgressByCardOwner removes the progress of every collaborator on the cards of the owner.
+func (r *cardProgressRepositoryImpl) DeleteProgressByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	cards := database.Unscoped().Model(&models.Card{}).Select("id").Where("user_id = ?", ownerID)
+	return database.WithContext(ctx).Where("card_id IN (?)", cards).Delete(&models.CardProgress{}).Error
+}
+
+// DeleteProgressByCards removes the progress of every user on the cards.
+func (r *cardProgressRepositoryImpl) DeleteProgressByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("card_id IN ?", cardIDs).Delete(&models.CardProgress{}).Error
+}
@@ -0,0 +1,95 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type CardRevisionRepository interface {
+	CreateRevision(ctx context.Context, revision *models.CardRevision, dbs ...*gorm.DB) error
+	GetRevision(ctx context.Context, id int32, cardID int32, dbs ...*gorm.DB) (*models.CardRevision, error)
+	GetRevisionsByCard(ctx context.Context, cardID int32, dbs ...*gorm.DB) ([]*models.CardRevisionWithUser, error)
+	PruneRevisionsByCard(ctx context.Context, cardID int32, keep int, dbs ...*gorm.DB) error
+	DeleteRevisionsBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) (int64, error)
+	DeleteRevisionsByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error
+	DeleteRevisionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	DeleteRevisionsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error
+}
+
+type cardRevisionRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewCardRevisionRepository(db *gorm.DB) CardRevisionRepository {
+	return &cardRevisionRepositoryImpl{db}
+}
+
+func (r *cardRevisionRepositoryImpl) CreateRevision(ctx context.Context, revision *models.CardRevision, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(revision).Error
+}
+
+func (r *cardRevisionRepositoryImpl) GetRevision(ctx context.Context, id int32, cardID int32, dbs ...*gorm.DB) (*models.CardRevision, error) {
+	database := getDb(r.DB, dbs...)
+	var revision models.CardRevision
+	err := database.WithContext(ctx).Model(&models.CardRevision{}).Where("id = ? AND card_id = ?", id, cardID).First(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetRevisionsByCard returns the revisions of the card, newest first, with the name of their author.
+func (r *cardRevisionRepositoryImpl) GetRevisionsByCard(ctx context.Context, cardID int32, dbs ...*gorm.DB) ([]*models.CardRevisionWithUser, error) {
+	database := getDb(r.DB, dbs...)
+	var revisions []*models.CardRevisionWithUser
+	err := database.WithContext(ctx).Model(&models.CardRevision{}).
+		Select("card_revisions.*, COALESCE(users.name, '') AS user_name").
+		Joins("LEFT JOIN users ON users.id = card_revisions.user_id").
+		Where("card_revisions.card_id = ?", cardID).
+		Order("card_revisions.id DESC").
+		Find(&revisions).Error
+	return revisions, err
+}
+
+// PruneRevisionsByCard deletes the revisions of the card beyond the keep newest ones.
+func (r *cardRevisionRepositoryImpl) PruneRevisionsByCard(ctx context.Context, cardID int32, keep int, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	var ids []int32
+	err := database.WithContext(ctx).Model(&models.CardRevision{}).
+		Where("card_id = ?", cardID).
+		Order("id DESC").
+		Offset(keep).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return database.WithContext(ctx).Where("id IN ?", ids).Delete(&models.CardRevision{}).Error
+}
+
+func (r *cardRevisionRepositoryImpl) DeleteRevisionsBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Where("created_at < ?", before).Delete(&models.CardRevision{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *cardRevisionRepositoryImpl) DeleteRevisionsByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	cards := database.Unscoped().Model(&models.Card{}).Select("id").Where("user_id = ?", ownerID)
+	return database.WithContext(ctx).Where("card_id IN (?)", cards).Delete(&models.CardRevision{}).Error
+}
+
+// DeleteRevisionsByUser removes the revisions of the edits the user made, on the cards of other owners too.
+func (r *cardRevisionRepositoryImpl) DeleteRevisionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.CardRevision{}).Error
+}
+
+func (r *cardRevisionRepositoryImpl) DeleteRevisionsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("card_id IN ?", cardIDs).Delete(&models.CardRevision{}).Error
+}
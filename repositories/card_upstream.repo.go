@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type CardUpstreamRepository interface {
+	CreateUpstreams(ctx context.Context, upstreams []*models.CardUpstream, dbs ...*gorm.DB) error
+	SaveUpstream(ctx context.Context, upstream *models.CardUpstream, dbs ...*gorm.DB) error
+	GetUpstream(ctx context.Context, cardID int32, dbs ...*gorm.DB) (*models.CardUpstream, error)
+	GetUpstreamsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.CardUpstream, error)
+	DeleteUpstreamsByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error
+	DeleteUpstreamsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error
+}
+
+type cardUpstreamRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewCardUpstreamRepository(db *gorm.DB) CardUpstreamRepository {
+	return &cardUpstreamRepositoryImpl{db}
+}
+
+func (r *cardUpstreamRepositoryImpl) CreateUpstreams(ctx context.Context, upstreams []*models.CardUpstream, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).CreateInBatches(upstreams, 500).Error
+}
+
+// SaveUpstream inserts the upstream content of the card or overwrites the existing one.
+func (r *cardUpstreamRepositoryImpl) SaveUpstream(ctx context.Context, upstream *models.CardUpstream, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"source_guid", "version", "front", "back", "tags"}),
+	}).Create(upstream).Error
+}
+
+func (r *cardUpstreamRepositoryImpl) GetUpstream(ctx context.Context, cardID int32, dbs ...*gorm.DB) (*models.CardUpstream, error) {
+	database := getDb(r.DB, dbs...)
+	var upstream models.CardUpstream
+	err := database.WithContext(ctx).Model(&models.CardUpstream{}).Where("card_id = ?", cardID).First(&upstream).Error
+	if err != nil {
+		return nil, err
+	}
+	return &upstream, nil
+}
+
+// GetUpstreamsByDecks returns the upstream content of the cards of the decks, including the cards in the trash.
+func (r *cardUpstreamRepositoryImpl) GetUpstreamsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.CardUpstream, error) {
+	database := getDb(r.DB, dbs...)
+	var upstreams []*models.CardUpstream
+	err := database.WithContext(ctx).Model(&models.CardUpstream{}).
+		Joins("JOIN cards ON cards.id = card_upstreams.card_id").
+		Where("cards.deck_id IN ?", deckIDs).
+		Find(&upstreams).Error
+	return upstreams, err
+}
+
+func (r *cardUpstreamRepositoryImpl) DeleteUpstreamsByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	cards := database.Unscoped().Model(&models.Card{}).Select("id").Where("user_id = ?", ownerID)
+	return database.WithContext(ctx).Where("card_id IN (?)", cards).Delete(&models.CardUpstream{}).Error
+}
+
+func (r *cardUpstreamRepositoryImpl) DeleteUpstreamsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("card_id IN ?", cardIDs).Delete(&models.CardUpstream{}).Error
+}
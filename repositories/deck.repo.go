@@ -3,9 +3,11 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/mrgThang/flashcard-be/constant"
 	"github.com/mrgThang/flashcard-be/dto"
@@ -14,10 +16,22 @@ import (
 )
 
 type DeckRepository interface {
-	CreateDeck(ctx context.Context, req dto.CreateDeckRequest, db ...*gorm.DB) error
+	CreateDeck(ctx context.Context, req dto.CreateDeckRequest, db ...*gorm.DB) (*models.Deck, error)
 	UpdateDeck(ctx context.Context, req dto.UpdateDeckRequest, db ...*gorm.DB) error
 	GetDecksWithPagination(ctx context.Context, req dto.GetDecksRequest, db ...*gorm.DB) ([]*models.DeckWithStats, int64, error)
 	GetDetailDeck(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.DeckWithStats, error)
+	GetDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckWithStats, error)
+	LockDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckWithStats, error)
+	MoveDeck(ctx context.Context, req dto.MoveDeckRequest, dbs ...*gorm.DB) error
+	SetDecksPreset(ctx context.Context, ids []int32, presetID *int32, dbs ...*gorm.DB) error
+	ClearPreset(ctx context.Context, presetID int32, dbs ...*gorm.DB) error
+	DeleteDecks(ctx context.Context, ids []int32, deletedAt time.Time, dbs ...*gorm.DB) error
+	GetDeletedDecks(ctx context.Context, req dto.GetTrashRequest, dbs ...*gorm.DB) ([]*models.DeckWithStats, error)
+	RestoreDecks(ctx context.Context, ids []int32, dbs ...*gorm.DB) error
+	PurgeDecks(ctx context.Context, ids []int32, dbs ...*gorm.DB) error
+	GetDeckIDsDeletedBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]int32, error)
+	PurgeDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	CountDecks(ctx context.Context, dbs ...*gorm.DB) (int64, error)
 }
 
 type deckRepositoryImpl struct {
@@ -28,14 +42,20 @@ func NewDeckRepository(db *gorm.DB) DeckRepository {
 	return &deckRepositoryImpl{db}
 }
 
-func (r *deckRepositoryImpl) CreateDeck(ctx context.Context, req dto.CreateDeckRequest, dbs ...*gorm.DB) error {
+func (r *deckRepositoryImpl) CreateDeck(ctx context.Context, req dto.CreateDeckRequest, dbs ...*gorm.DB) (*models.Deck, error) {
 	database := getDb(r.DB, dbs...)
 	deck := models.Deck{
-		Name:        req.Name,
-		Description: req.Description,
-		UserID:      req.UserID,
+		Name:         req.Name,
+		Description:  req.Description,
+		ParentID:     req.ParentID,
+		UserID:       req.UserID,
+		SourceDeckID: req.SourceDeckID,
 	}
-	return database.WithContext(ctx).Create(&deck).Error
+	err := database.WithContext(ctx).Create(&deck).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deck, nil
 }
 
 func (r *deckRepositoryImpl) UpdateDeck(ctx context.Context, req dto.UpdateDeckRequest, dbs ...*gorm.DB) error {
@@ -50,6 +70,11 @@ func (r *deckRepositoryImpl) UpdateDeck(ctx context.Context, req dto.UpdateDeckR
 	return database.WithContext(ctx).Model(&models.Deck{}).Where("id = ?", req.ID).Updates(updates).Error
 }
 
+func (r *deckRepositoryImpl) MoveDeck(ctx context.Context, req dto.MoveDeckRequest, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Deck{}).Where("id = ?", req.ID).Update("parent_id", req.ParentID).Error
+}
+
 func (r *deckRepositoryImpl) GetDecksWithPagination(ctx context.Context, req dto.GetDecksRequest, dbs ...*gorm.DB) ([]*models.DeckWithStats, int64, error) {
 	database := getDb(r.DB, dbs...)
 	var decks []*models.DeckWithStats
@@ -77,7 +102,7 @@ func (r *deckRepositoryImpl) GetDecksWithPagination(ctx context.Context, req dto
 	if req.UserID != 0 {
 		query = query.Where("decks.user_id = ?", req.UserID)
 	}
-	query = query.Joins("left join cards on decks.id = cards.deck_id")
+	query = query.Joins("left join cards on decks.id = cards.deck_id AND cards.deleted_at IS NULL")
 	query = query.Group("decks.id")
 	offset := constant.DefaultOffset
 	if req.Page > 0 {
@@ -105,7 +130,7 @@ func (r *deckRepositoryImpl) GetDetailDeck(ctx context.Context, id int32, dbs ..
 		COUNT(cards.id) as total_cards, 
 		SUM(CASE WHEN cards.study_time < NOW() THEN 1 ELSE 0 END) as cards_left
 	`)
-	query = query.Joins("left join cards on decks.id = cards.deck_id")
+	query = query.Joins("left join cards on decks.id = cards.deck_id AND cards.deleted_at IS NULL")
 	query = query.Group("decks.id")
 
 	err := query.Where("decks.id = ?", id).First(&deck).Error
@@ -115,3 +140,109 @@ func (r *deckRepositoryImpl) GetDetailDeck(ctx context.Context, id int32, dbs ..
 	}
 	return &deck, nil
 }
+
+// GetDecksByUser returns every deck of the user with the stats of its own cards only,
+// callers roll the stats up the hierarchy with helpers.RollUpDeckStats.
+func (r *deckRepositoryImpl) GetDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckWithStats, error) {
+	database := getDb(r.DB, dbs...)
+	var decks []*models.DeckWithStats
+	query := database.WithContext(ctx).Model(&models.Deck{})
+	query = query.Select("decks.*, COUNT(cards.id) as total_cards, SUM(CASE WHEN cards.study_time < NOW() THEN 1 ELSE 0 END) as cards_left")
+	query = query.Joins("left join cards on decks.id = cards.deck_id AND cards.deleted_at IS NULL")
+	query = query.Where("decks.user_id = ?", userID)
+	query = query.Group("decks.id")
+	err := query.Find(&decks).Error
+	if err != nil {
+		logger.Error(fmt.Sprintf("[GetDecksByUser] Error fetching decks of user %d", userID), zap.Error(err))
+		return nil, err
+	}
+	return decks, nil
+}
+
+// LockDecksByUser returns every deck of the user without stats and locks their rows until the
+// transaction ends, so changes to the hierarchy of one user are applied one after another.
+func (r *deckRepositoryImpl) LockDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckWithStats, error) {
+	database := getDb(r.DB, dbs...)
+	var decks []*models.DeckWithStats
+	err := database.WithContext(ctx).Model(&models.Deck{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		Find(&decks).Error
+	if err != nil {
+		logger.Error(fmt.Sprintf("[LockDecksByUser] Error locking decks of user %d", userID), zap.Error(err))
+		return nil, err
+	}
+	return decks, nil
+}
+
+// DeleteDecks soft deletes the decks with a shared timestamp, see CardRepository.DeleteCardsByDecks.
+func (r *deckRepositoryImpl) DeleteDecks(ctx context.Context, ids []int32, deletedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Deck{}).Where("id IN ?", ids).Update("deleted_at", deletedAt).Error
+}
+
+// GetDeletedDecks returns the decks in the trash, the stats count the cards that were deleted together with each deck.
+func (r *deckRepositoryImpl) GetDeletedDecks(ctx context.Context, req dto.GetTrashRequest, dbs ...*gorm.DB) ([]*models.DeckWithStats, error) {
+	database := getDb(r.DB, dbs...)
+	var decks []*models.DeckWithStats
+	query := database.WithContext(ctx).Unscoped().Model(&models.Deck{})
+	query = query.Select("decks.*, COUNT(cards.id) as total_cards, 0 as cards_left")
+	query = query.Joins("left join cards on decks.id = cards.deck_id AND cards.deleted_at = decks.deleted_at")
+	query = query.Where("decks.deleted_at IS NOT NULL")
+	if req.UserID != 0 {
+		query = query.Where("decks.user_id = ?", req.UserID)
+	}
+	if len(req.DeckIDs) > 0 {
+		query = query.Where("decks.id IN ?", req.DeckIDs)
+	}
+	query = query.Group("decks.id").Order("decks.deleted_at DESC")
+	err := query.Find(&decks).Error
+	if err != nil {
+		logger.Error("[GetDeletedDecks] got error", zap.Error(err))
+		return nil, err
+	}
+	return decks, nil
+}
+
+func (r *deckRepositoryImpl) SetDecksPreset(ctx context.Context, ids []int32, presetID *int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Deck{}).Where("id IN ?", ids).Update("preset_id", presetID).Error
+}
+
+// ClearPreset unassigns the preset from every deck using it, including the ones in the trash.
+func (r *deckRepositoryImpl) ClearPreset(ctx context.Context, presetID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Model(&models.Deck{}).Where("preset_id = ?", presetID).Update("preset_id", nil).Error
+}
+
+func (r *deckRepositoryImpl) RestoreDecks(ctx context.Context, ids []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Model(&models.Deck{}).Where("id IN ?", ids).Update("deleted_at", nil).Error
+}
+
+func (r *deckRepositoryImpl) PurgeDecks(ctx context.Context, ids []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Where("id IN ? AND deleted_at IS NOT NULL", ids).Delete(&models.Deck{}).Error
+}
+
+// GetDeckIDsDeletedBefore returns the ids of the decks of every user that went to the trash before the time.
+func (r *deckRepositoryImpl) GetDeckIDsDeletedBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]int32, error) {
+	database := getDb(r.DB, dbs...)
+	var ids []int32
+	err := database.WithContext(ctx).Unscoped().Model(&models.Deck{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PurgeDecksByUser permanently deletes every deck of the user, including the ones in the trash.
+func (r *deckRepositoryImpl) PurgeDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&models.Deck{}).Error
+}
+
+// CountDecks counts the decks of every user, the ones in the trash are left out.
+func (r *deckRepositoryImpl) CountDecks(ctx context.Context, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	var count int64
+	err := database.WithContext(ctx).Model(&models.Deck{}).Count(&count).Error
+	return count, err
+}
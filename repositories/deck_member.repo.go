@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type DeckMemberRepository interface {
+	CreateMember(ctx context.Context, member *models.DeckMember, dbs ...*gorm.DB) error
+	GetMember(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.DeckMember, error)
+	GetMembersByDeck(ctx context.Context, deckID int32, dbs ...*gorm.DB) ([]*models.DeckMember, error)
+	GetMembersByDecks(ctx context.Context, deckIDs []int32, userID int32, dbs ...*gorm.DB) ([]*models.DeckMember, error)
+	GetAcceptedMembersByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckMember, error)
+	GetInvitationsByEmail(ctx context.Context, email string, dbs ...*gorm.DB) ([]*models.DeckMember, error)
+	UpdateMember(ctx context.Context, member *models.DeckMember, dbs ...*gorm.DB) error
+	DeleteMember(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	DeleteMembersByUser(ctx context.Context, userID int32, email string, dbs ...*gorm.DB) error
+	DeleteMembersByDeckOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error
+	DeleteMembersByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) error
+}
+
+type deckMemberRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewDeckMemberRepository(db *gorm.DB) DeckMemberRepository {
+	return &deckMemberRepositoryImpl{db}
+}
+
+func (r *deckMemberRepositoryImpl) CreateMember(ctx context.Context, member *models.DeckMember, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(member).Error
+}
+
+func (r *deckMemberRepositoryImpl) GetMember(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.DeckMember, error) {
+	database := getDb(r.DB, dbs...)
+	var member models.DeckMember
+	err := database.WithContext(ctx).Model(&models.DeckMember{}).Where("id = ?", id).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *deckMemberRepositoryImpl) GetMembersByDeck(ctx context.Context, deckID int32, dbs ...*gorm.DB) ([]*models.DeckMember, error) {
+	database := getDb(r.DB, dbs...)
+	var members []*models.DeckMember
+	err := database.WithContext(ctx).Model(&models.DeckMember{}).Where("deck_id = ?", deckID).Order("id").Find(&members).Error
+	return members, err
+}
+
+// GetMembersByDecks returns the accepted memberships of the user on any of the decks.
+func (r *deckMemberRepositoryImpl) GetMembersByDecks(ctx context.Context, deckIDs []int32, userID int32, dbs ...*gorm.DB) ([]*models.DeckMember, error) {
+	database := getDb(r.DB, dbs...)
+	var members []*models.DeckMember
+	err := database.WithContext(ctx).Model(&models.DeckMember{}).
+		Where("deck_id IN ? AND user_id = ? AND accepted_at IS NOT NULL", deckIDs, userID).
+		Find(&members).Error
+	return members, err
+}
+
+func (r *deckMemberRepositoryImpl) GetAcceptedMembersByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckMember, error) {
+	database := getDb(r.DB, dbs...)
+	var members []*models.DeckMember
+	err := database.WithContext(ctx).Model(&models.DeckMember{}).
+		Where("user_id = ? AND accepted_at IS NOT NULL", userID).
+		Order("id").Find(&members).Error
+	return members, err
+}
+
+// GetInvitationsByEmail returns the invitations sent to the email that are not accepted yet.
+func (r *deckMemberRepositoryImpl) GetInvitationsByEmail(ctx context.Context, email string, dbs ...*gorm.DB) ([]*models.DeckMember, error) {
+	database := getDb(r.DB, dbs...)
+	var members []*models.DeckMember
+	err := database.WithContext(ctx).Model(&models.DeckMember{}).
+		Where("email = ? AND accepted_at IS NULL", email).
+		Order("id").Find(&members).Error
+	return members, err
+}
+
+func (r *deckMemberRepositoryImpl) UpdateMember(ctx context.Context, member *models.DeckMember, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Save(member).Error
+}
+
+func (r *deckMemberRepositoryImpl) DeleteMember(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("id = ?", id).Delete(&models.DeckMember{}).Error
+}
+
+// DeleteMembersByUser removes the memberships of the user, and the invitations to the email unless it is empty.
+func (r *deckMemberRepositoryImpl) DeleteMembersByUser(ctx context.Context, userID int32, email string, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	if email == "" {
+		return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.DeckMember{}).Error
+	}
+	return database.WithContext(ctx).Where("user_id = ? OR email = ?", userID, email).Delete(&models.DeckMember{}).Error
+}
+
+// DeleteMembersByDeckOwner removes every membership on the decks of the owner, including the decks in the trash.
+func (r *deckMemberRepositoryImpl) DeleteMembersByDeckOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	decks := database.Unscoped().Model(&models.Deck{}).Select("id").Where("user_id = ?", ownerID)
+	return database.WithContext(ctx).Where("deck_id IN (?)", decks).Delete(&models.DeckMember{}).Error
+}
+
+func (r *deckMemberRepositoryImpl) DeleteMembersByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("deck_id IN ?", deckIDs).Delete(&models.DeckMember{}).Error
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type DeckPresetRepository interface {
+	CreatePreset(ctx context.Context, preset *models.DeckPreset, dbs ...*gorm.DB) error
+	GetPreset(ctx context.Context, id int32, userID int32, dbs ...*gorm.DB) (*models.DeckPreset, error)
+	GetPresetsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckPreset, error)
+	UpdatePreset(ctx context.Context, preset *models.DeckPreset, dbs ...*gorm.DB) error
+	DeletePreset(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	DeletePresetsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type deckPresetRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewDeckPresetRepository(db *gorm.DB) DeckPresetRepository {
+	return &deckPresetRepositoryImpl{db}
+}
+
+func (r *deckPresetRepositoryImpl) CreatePreset(ctx context.Context, preset *models.DeckPreset, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(preset).Error
+}
+
+func (r *deckPresetRepositoryImpl) GetPreset(ctx context.Context, id int32, userID int32, dbs ...*gorm.DB) (*models.DeckPreset, error) {
+	database := getDb(r.DB, dbs...)
+	var preset models.DeckPreset
+	err := database.WithContext(ctx).Model(&models.DeckPreset{}).Where("id = ? AND user_id = ?", id, userID).First(&preset).Error
+	if err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+func (r *deckPresetRepositoryImpl) GetPresetsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckPreset, error) {
+	database := getDb(r.DB, dbs...)
+	var presets []*models.DeckPreset
+	err := database.WithContext(ctx).Model(&models.DeckPreset{}).Where("user_id = ?", userID).Order("name, id").Find(&presets).Error
+	return presets, err
+}
+
+func (r *deckPresetRepositoryImpl) UpdatePreset(ctx context.Context, preset *models.DeckPreset, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Save(preset).Error
+}
+
+func (r *deckPresetRepositoryImpl) DeletePreset(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("id = ?", id).Delete(&models.DeckPreset{}).Error
+}
+
+func (r *deckPresetRepositoryImpl) DeletePresetsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.DeckPreset{}).Error
+}
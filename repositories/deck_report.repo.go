@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type DeckReportRepository interface {
+	CreateReport(ctx context.Context, report *models.DeckReport, dbs ...*gorm.DB) error
+	HasReported(ctx context.Context, publishedDeckID int32, userID int32, dbs ...*gorm.DB) (bool, error)
+	GetReportsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) ([]*models.DeckReport, error)
+	DeleteReportsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error
+	DeleteReportsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	DeleteReportsByAuthor(ctx context.Context, authorID int32, dbs ...*gorm.DB) error
+}
+
+type deckReportRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewDeckReportRepository(db *gorm.DB) DeckReportRepository {
+	return &deckReportRepositoryImpl{db}
+}
+
+func (r *deckReportRepositoryImpl) CreateReport(ctx context.Context, report *models.DeckReport, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(report).Error
+}
+
+func (r *deckReportRepositoryImpl) HasReported(ctx context.Context, publishedDeckID int32, userID int32, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	var count int64
+	err := database.WithContext(ctx).Model(&models.DeckReport{}).
+		Where("published_deck_id = ? AND user_id = ?", publishedDeckID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *deckReportRepositoryImpl) GetReportsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) ([]*models.DeckReport, error) {
+	database := getDb(r.DB, dbs...)
+	var reports []*models.DeckReport
+	err := database.WithContext(ctx).Model(&models.DeckReport{}).
+		Where("published_deck_id = ?", publishedDeckID).
+		Order("created_at DESC").
+		Find(&reports).Error
+	return reports, err
+}
+
+func (r *deckReportRepositoryImpl) DeleteReportsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("published_deck_id = ?", publishedDeckID).Delete(&models.DeckReport{}).Error
+}
+
+func (r *deckReportRepositoryImpl) DeleteReportsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.DeckReport{}).Error
+}
+
+// DeleteReportsByAuthor removes the reports on the published decks of the author.
+func (r *deckReportRepositoryImpl) DeleteReportsByAuthor(ctx context.Context, authorID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	publishedDecks := database.Model(&models.PublishedDeck{}).Select("id").Where("user_id = ?", authorID)
+	return database.WithContext(ctx).Where("published_deck_id IN (?)", publishedDecks).Delete(&models.DeckReport{}).Error
+}
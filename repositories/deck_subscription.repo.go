@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type DeckSubscriptionRepository interface {
+	CreateSubscription(ctx context.Context, subscription *models.DeckSubscription, dbs ...*gorm.DB) error
+	GetSubscription(ctx context.Context, publishedDeckID int32, userID int32, dbs ...*gorm.DB) (*models.DeckSubscription, error)
+	GetSubscriptionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckSubscription, error)
+	GetSubscriptionsSyncedBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]*models.DeckSubscription, error)
+	GetSubscriptionsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.DeckSubscription, error)
+	UpdateSubscription(ctx context.Context, subscription *models.DeckSubscription, dbs ...*gorm.DB) error
+	DeleteSubscription(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	DeleteSubscriptionsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error
+	DeleteSubscriptionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	DeleteSubscriptionsByAuthor(ctx context.Context, authorID int32, dbs ...*gorm.DB) error
+}
+
+type deckSubscriptionRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewDeckSubscriptionRepository(db *gorm.DB) DeckSubscriptionRepository {
+	return &deckSubscriptionRepositoryImpl{db}
+}
+
+func (r *deckSubscriptionRepositoryImpl) CreateSubscription(ctx context.Context, subscription *models.DeckSubscription, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(subscription).Error
+}
+
+func (r *deckSubscriptionRepositoryImpl) GetSubscription(ctx context.Context, publishedDeckID int32, userID int32, dbs ...*gorm.DB) (*models.DeckSubscription, error) {
+	database := getDb(r.DB, dbs...)
+	var subscription models.DeckSubscription
+	err := database.WithContext(ctx).Model(&models.DeckSubscription{}).
+		Where("published_deck_id = ? AND user_id = ?", publishedDeckID, userID).
+		First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (r *deckSubscriptionRepositoryImpl) GetSubscriptionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.DeckSubscription, error) {
+	database := getDb(r.DB, dbs...)
+	var subscriptions []*models.DeckSubscription
+	err := database.WithContext(ctx).Model(&models.DeckSubscription{}).Where("user_id = ?", userID).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// GetSubscriptionsSyncedBefore returns the subscriptions that were not synced since before.
+func (r *deckSubscriptionRepositoryImpl) GetSubscriptionsSyncedBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]*models.DeckSubscription, error) {
+	database := getDb(r.DB, dbs...)
+	var subscriptions []*models.DeckSubscription
+	err := database.WithContext(ctx).Model(&models.DeckSubscription{}).
+		Where("synced_at IS NULL OR synced_at < ?", before).
+		Order("id").
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// GetSubscriptionsByDecks returns the subscriptions updating the decks, which are copies of published decks.
+func (r *deckSubscriptionRepositoryImpl) GetSubscriptionsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.DeckSubscription, error) {
+	database := getDb(r.DB, dbs...)
+	var subscriptions []*models.DeckSubscription
+	err := database.WithContext(ctx).Model(&models.DeckSubscription{}).Where("deck_id IN ?", deckIDs).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *deckSubscriptionRepositoryImpl) UpdateSubscription(ctx context.Context, subscription *models.DeckSubscription, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Save(subscription).Error
+}
+
+func (r *deckSubscriptionRepositoryImpl) DeleteSubscription(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("id = ?", id).Delete(&models.DeckSubscription{}).Error
+}
+
+func (r *deckSubscriptionRepositoryImpl) DeleteSubscriptionsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("published_deck_id = ?", publishedDeckID).Delete(&models.DeckSubscription{}).Error
+}
+
+func (r *deckSubscriptionRepositoryImpl) DeleteSubscriptionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.DeckSubscription{}).Error
+}
+
+// DeleteSubscriptionsByAuthor removes the subscriptions to the published decks of the author.
+func (r *deckSubscriptionRepositoryImpl) DeleteSubscriptionsByAuthor(ctx context.Context, authorID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	publishedDecks := database.Model(&models.PublishedDeck{}).Select("id").Where("user_id = ?", authorID)
+	return database.WithContext(ctx).Where("published_deck_id IN (?)", publishedDecks).Delete(&models.DeckSubscription{}).Error
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type JobRepository interface {
+	CreateJob(ctx context.Context, job *models.Job, dbs ...*gorm.DB) error
+	UpdateJob(ctx context.Context, job *models.Job, dbs ...*gorm.DB) error
+	GetJob(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.Job, error)
+	FailUnfinishedJobs(ctx context.Context, message string, dbs ...*gorm.DB) error
+	DeleteJobsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type jobRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepositoryImpl{db}
+}
+
+func (r *jobRepositoryImpl) CreateJob(ctx context.Context, job *models.Job, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(job).Error
+}
+
+func (r *jobRepositoryImpl) UpdateJob(ctx context.Context, job *models.Job, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Save(job).Error
+}
+
+func (r *jobRepositoryImpl) GetJob(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.Job, error) {
+	database := getDb(r.DB, dbs...)
+	var job models.Job
+	err := database.WithContext(ctx).Model(&models.Job{}).Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FailUnfinishedJobs marks the jobs that were still running when the server stopped as failed.
+func (r *jobRepositoryImpl) FailUnfinishedJobs(ctx context.Context, message string, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Job{}).
+		Where("status IN ?", []string{models.JobStatusPending, models.JobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.JobStatusFailed,
+			"error":       message,
+			"finished_at": time.Now(),
+		}).Error
+}
+
+func (r *jobRepositoryImpl) DeleteJobsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.Job{}).Error
+}
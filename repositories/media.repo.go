@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type MediaRepository interface {
+	SaveMedia(ctx context.Context, media *models.Media, dbs ...*gorm.DB) error
+	GetMedia(ctx context.Context, userID int32, filename string, dbs ...*gorm.DB) (*models.Media, error)
+	GetMediaByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.Media, error)
+	DeleteMediaByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type mediaRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewMediaRepository(db *gorm.DB) MediaRepository {
+	return &mediaRepositoryImpl{db}
+}
+
+// SaveMedia creates the media or replaces the metadata of the user's media with the same file name.
+func (r *mediaRepositoryImpl) SaveMedia(ctx context.Context, media *models.Media, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"content_type", "size"}),
+	}).Create(media).Error
+}
+
+func (r *mediaRepositoryImpl) GetMedia(ctx context.Context, userID int32, filename string, dbs ...*gorm.DB) (*models.Media, error) {
+	database := getDb(r.DB, dbs...)
+	var media models.Media
+	err := database.WithContext(ctx).Model(&models.Media{}).Where("user_id = ? AND filename = ?", userID, filename).First(&media).Error
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+func (r *mediaRepositoryImpl) GetMediaByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.Media, error) {
+	database := getDb(r.DB, dbs...)
+	var media []*models.Media
+	err := database.WithContext(ctx).Model(&models.Media{}).Where("user_id = ?", userID).Order("filename").Find(&media).Error
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *mediaRepositoryImpl) DeleteMediaByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.Media{}).Error
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// Counters of PublishedDeck that IncrementCounter can change.
+const (
+	PublishedDeckSubscriberCount = "subscriber_count"
+	PublishedDeckForkCount       = "fork_count"
+	PublishedDeckReportCount     = "report_count"
+)
+
+type PublishedDeckRepository interface {
+	SavePublishedDeck(ctx context.Context, publishedDeck *models.PublishedDeck, dbs ...*gorm.DB) error
+	GetPublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.PublishedDeckWithAuthor, error)
+	GetPublishedDeckByDeck(ctx context.Context, deckID int32, dbs ...*gorm.DB) (*models.PublishedDeck, error)
+	GetPublishedDecksByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.PublishedDeck, error)
+	SearchPublishedDecks(ctx context.Context, req dto.GetLibraryRequest, dbs ...*gorm.DB) ([]*models.PublishedDeckWithAuthor, int64, error)
+	IncrementCounter(ctx context.Context, id int32, counter string, delta int, dbs ...*gorm.DB) error
+	HidePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	UnhidePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	SearchModeratedDecks(ctx context.Context, req dto.AdminGetLibraryRequest, dbs ...*gorm.DB) ([]*models.PublishedDeckWithAuthor, int64, error)
+	CountPublishedDecks(ctx context.Context, hidden *bool, dbs ...*gorm.DB) (int64, error)
+	DeletePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error
+	DeletePublishedDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type publishedDeckRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewPublishedDeckRepository(db *gorm.DB) PublishedDeckRepository {
+	return &publishedDeckRepositoryImpl{db}
+}
+
+func (r *publishedDeckRepositoryImpl) SavePublishedDeck(ctx context.Context, publishedDeck *models.PublishedDeck, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Save(publishedDeck).Error
+}
+
+// visiblePublishedDecks selects the published decks with the name of their author, leaving out
+// the decks that are in the trash of their author.
+func visiblePublishedDecks(query *gorm.DB) *gorm.DB {
+	return query.Model(&models.PublishedDeck{}).
+		Select("published_decks.*, users.name AS author_name").
+		Joins("JOIN decks ON decks.id = published_decks.deck_id AND decks.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = published_decks.user_id")
+}
+
+func (r *publishedDeckRepositoryImpl) GetPublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) (*models.PublishedDeckWithAuthor, error) {
+	database := getDb(r.DB, dbs...)
+	var publishedDeck models.PublishedDeckWithAuthor
+	err := visiblePublishedDecks(database.WithContext(ctx)).Where("published_decks.id = ?", id).First(&publishedDeck).Error
+	if err != nil {
+		return nil, err
+	}
+	return &publishedDeck, nil
+}
+
+func (r *publishedDeckRepositoryImpl) GetPublishedDeckByDeck(ctx context.Context, deckID int32, dbs ...*gorm.DB) (*models.PublishedDeck, error) {
+	database := getDb(r.DB, dbs...)
+	var publishedDeck models.PublishedDeck
+	err := database.WithContext(ctx).Model(&models.PublishedDeck{}).Where("deck_id = ?", deckID).First(&publishedDeck).Error
+	if err != nil {
+		return nil, err
+	}
+	return &publishedDeck, nil
+}
+
+func (r *publishedDeckRepositoryImpl) GetPublishedDecksByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.PublishedDeck, error) {
+	database := getDb(r.DB, dbs...)
+	var publishedDecks []*models.PublishedDeck
+	err := database.WithContext(ctx).Model(&models.PublishedDeck{}).Where("deck_id IN ?", deckIDs).Order("id").Find(&publishedDecks).Error
+	return publishedDecks, err
+}
+
+// SearchPublishedDecks returns a page of the library, hidden decks are left out.
+func (r *publishedDeckRepositoryImpl) SearchPublishedDecks(ctx context.Context, req dto.GetLibraryRequest, dbs ...*gorm.DB) ([]*models.PublishedDeckWithAuthor, int64, error) {
+	database := getDb(r.DB, dbs...)
+	query := visiblePublishedDecks(database.WithContext(ctx)).Where("published_decks.hidden = ?", false)
+	if req.Query != "" {
+		query = query.Where("(published_decks.title LIKE ? OR published_decks.description LIKE ?)", "%"+req.Query+"%", "%"+req.Query+"%")
+	}
+	if req.Language != "" {
+		query = query.Where("published_decks.language = ?", req.Language)
+	}
+	if req.Tag != "" {
+		query = query.Where("CONCAT(' ', published_decks.tags, ' ') LIKE ?", "% "+req.Tag+" %")
+	}
+
+	var totalItems int64
+	if err := query.Count(&totalItems).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := constant.DefaultOffset
+	if req.Page > 0 {
+		offset = (req.Page - 1) * req.PageSize
+	}
+	limit := constant.DefaultLimit
+	if req.PageSize > 0 {
+		limit = req.PageSize
+	}
+	if req.Sort == constant.LibrarySortPopular {
+		query = query.Order("published_decks.subscriber_count + published_decks.fork_count DESC")
+	}
+	query = query.Order("published_decks.published_at DESC").Order("published_decks.id DESC")
+
+	var publishedDecks []*models.PublishedDeckWithAuthor
+	err := query.Offset(offset).Limit(limit).Find(&publishedDecks).Error
+	if err != nil {
+		logger.Error("[SearchPublishedDecks] got error", zap.Error(err))
+		return nil, 0, err
+	}
+	return publishedDecks, totalItems, nil
+}
+
+func (r *publishedDeckRepositoryImpl) IncrementCounter(ctx context.Context, id int32, counter string, delta int, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.PublishedDeck{}).Where("id = ?", id).
+		UpdateColumn(counter, gorm.Expr("GREATEST("+counter+" + ?, 0)", delta)).Error
+}
+
+func (r *publishedDeckRepositoryImpl) HidePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.PublishedDeck{}).Where("id = ?", id).Update("hidden", true).Error
+}
+
+// UnhidePublishedDeck lists the deck in the library again, its report count starts over so the next
+// report does not hide it right away.
+func (r *publishedDeckRepositoryImpl) UnhidePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.PublishedDeck{}).Where("id = ?", id).Updates(map[string]any{
+		"hidden":       false,
+		"report_count": 0,
+	}).Error
+}
+
+// SearchModeratedDecks returns a page of the library for the moderators, hidden decks included and
+// the most reported first.
+func (r *publishedDeckRepositoryImpl) SearchModeratedDecks(ctx context.Context, req dto.AdminGetLibraryRequest, dbs ...*gorm.DB) ([]*models.PublishedDeckWithAuthor, int64, error) {
+	database := getDb(r.DB, dbs...)
+	query := visiblePublishedDecks(database.WithContext(ctx))
+	if req.Query != "" {
+		query = query.Where("(published_decks.title LIKE ? OR published_decks.description LIKE ?)", "%"+req.Query+"%", "%"+req.Query+"%")
+	}
+	if req.Hidden != nil {
+		query = query.Where("published_decks.hidden = ?", *req.Hidden)
+	}
+
+	var totalItems int64
+	if err := query.Count(&totalItems).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := constant.DefaultOffset
+	if req.Page > 0 {
+		offset = (req.Page - 1) * req.PageSize
+	}
+	limit := constant.DefaultLimit
+	if req.PageSize > 0 {
+		limit = req.PageSize
+	}
+	var publishedDecks []*models.PublishedDeckWithAuthor
+	err := query.Order("published_decks.report_count DESC").Order("published_decks.published_at DESC").Order("published_decks.id DESC").
+		Offset(offset).Limit(limit).Find(&publishedDecks).Error
+	return publishedDecks, totalItems, err
+}
+
+func (r *publishedDeckRepositoryImpl) CountPublishedDecks(ctx context.Context, hidden *bool, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	query := database.WithContext(ctx).Model(&models.PublishedDeck{})
+	if hidden != nil {
+		query = query.Where("hidden = ?", *hidden)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+func (r *publishedDeckRepositoryImpl) DeletePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("id = ?", id).Delete(&models.PublishedDeck{}).Error
+}
+
+func (r *publishedDeckRepositoryImpl) DeletePublishedDecksByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.PublishedDeck{}).Error
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type RecoveryCodeRepository interface {
+	CreateCodes(ctx context.Context, codes []*models.RecoveryCode, dbs ...*gorm.DB) error
+	UseCode(ctx context.Context, userID int32, codeHash string, usedAt time.Time, dbs ...*gorm.DB) (bool, error)
+	CountUnusedCodes(ctx context.Context, userID int32, dbs ...*gorm.DB) (int64, error)
+	DeleteCodesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type recoveryCodeRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) RecoveryCodeRepository {
+	return &recoveryCodeRepositoryImpl{db}
+}
+
+func (r *recoveryCodeRepositoryImpl) CreateCodes(ctx context.Context, codes []*models.RecoveryCode, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(codes).Error
+}
+
+// UseCode marks the unused code of the user with the hash used, it reports false when there is none.
+func (r *recoveryCodeRepositoryImpl) UseCode(ctx context.Context, userID int32, codeHash string, usedAt time.Time, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Limit(1).
+		Update("used_at", usedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *recoveryCodeRepositoryImpl) CountUnusedCodes(ctx context.Context, userID int32, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	var count int64
+	err := database.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *recoveryCodeRepositoryImpl) DeleteCodesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
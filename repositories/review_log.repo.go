@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type ReviewLogRepository interface {
+	CreateReviewLogs(ctx context.Context, reviewLogs []*models.ReviewLog, dbs ...*gorm.DB) error
+	GetReviewLogsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) ([]*models.ReviewLog, error)
+	StreamReviewLogsByUser(ctx context.Context, userID int32, batchSize int, fn func(reviewLogs []*models.ReviewLog) error, dbs ...*gorm.DB) error
+	CountStudiedSince(ctx context.Context, userID int32, deckIDs []int32, since time.Time, dbs ...*gorm.DB) (int64, int64, error)
+	DeleteReviewLogsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+	DeleteReviewLogsByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error
+	DeleteReviewLogsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error
+	CountReviews(ctx context.Context, since *time.Time, dbs ...*gorm.DB) (int64, error)
+}
+
+type reviewLogRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewReviewLogRepository(db *gorm.DB) ReviewLogRepository {
+	return &reviewLogRepositoryImpl{db}
+}
+
+func (r *reviewLogRepositoryImpl) CreateReviewLogs(ctx context.Context, reviewLogs []*models.ReviewLog, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).CreateInBatches(reviewLogs, 500).Error
+}
+
+func (r *reviewLogRepositoryImpl) GetReviewLogsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) ([]*models.ReviewLog, error) {
+	database := getDb(r.DB, dbs...)
+	var reviewLogs []*models.ReviewLog
+	err := database.WithContext(ctx).Model(&models.ReviewLog{}).Where("card_id IN ?", cardIDs).Order("reviewed_at").Find(&reviewLogs).Error
+	if err != nil {
+		return nil, err
+	}
+	return reviewLogs, nil
+}
+
+// StreamReviewLogsByUser calls fn with the review logs of the user in batches ordered by id.
+func (r *reviewLogRepositoryImpl) StreamReviewLogsByUser(ctx context.Context, userID int32, batchSize int, fn func(reviewLogs []*models.ReviewLog) error, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	var reviewLogs []*models.ReviewLog
+	return database.WithContext(ctx).Model(&models.ReviewLog{}).Where("user_id = ?", userID).
+		FindInBatches(&reviewLogs, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(reviewLogs)
+		}).Error
+}
+
+// CountStudiedSince returns how many cards of the decks the user studied for the first time since
+// the given time, and how many other cards of the decks they reviewed since then.
+func (r *reviewLogRepositoryImpl) CountStudiedSince(ctx context.Context, userID int32, deckIDs []int32, since time.Time, dbs ...*gorm.DB) (int64, int64, error) {
+	database := getDb(r.DB, dbs...)
+	studied := database.Model(&models.ReviewLog{}).
+		Select("review_logs.card_id, MIN(review_logs.reviewed_at) AS first_reviewed_at").
+		Joins("JOIN cards ON cards.id = review_logs.card_id").
+		Where("review_logs.user_id = ? AND cards.deck_id IN ?", userID, deckIDs).
+		Group("review_logs.card_id").
+		Having("MAX(review_logs.reviewed_at) >= ?", since)
+	var counts struct {
+		Studied int64
+		New     int64
+	}
+	err := database.WithContext(ctx).Table("(?) AS studied", studied).
+		Select("COUNT(*) AS studied, COALESCE(SUM(first_reviewed_at >= ?), 0) AS new", since).
+		Scan(&counts).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return counts.New, counts.Studied - counts.New, nil
+}
+
+func (r *reviewLogRepositoryImpl) DeleteReviewLogsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.ReviewLog{}).Error
+}
+
+// DeleteReviewLogsByCardOwner removes the review history of every collaborator on the cards of the owner.
+func (r *reviewLogRepositoryImpl) DeleteReviewLogsByCardOwner(ctx context.Context, ownerID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	cards := database.Unscoped().Model(&models.Card{}).Select("id").Where("user_id = ?", ownerID)
+	return database.WithContext(ctx).Where("card_id IN (?)", cards).Delete(&models.ReviewLog{}).Error
+}
+
+// DeleteReviewLogsByCards removes the review history of every user on the cards.
+func (r *reviewLogRepositoryImpl) DeleteReviewLogsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("card_id IN ?", cardIDs).Delete(&models.ReviewLog{}).Error
+}
+
+// CountReviews counts the reviews of every user, only the ones since the time when it is set.
+func (r *reviewLogRepositoryImpl) CountReviews(ctx context.Context, since *time.Time, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	query := database.WithContext(ctx).Model(&models.ReviewLog{})
+	if since != nil {
+		query = query.Where("reviewed_at >= ?", *since)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session, dbs ...*gorm.DB) error
+	GetSession(ctx context.Context, id string, dbs ...*gorm.DB) (*models.Session, error)
+	GetActiveSessionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.Session, error)
+	TouchSession(ctx context.Context, id string, lastSeenAt time.Time, dbs ...*gorm.DB) error
+	RotateSession(ctx context.Context, session *models.Session, previousGeneration int32, dbs ...*gorm.DB) (bool, error)
+	RevokeSession(ctx context.Context, id string, revokedAt time.Time, dbs ...*gorm.DB) error
+	RevokeSessionsByUser(ctx context.Context, userID int32, exceptID string, revokedAt time.Time, dbs ...*gorm.DB) error
+	DeleteSessionsBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) (int64, error)
+	DeleteSessionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type sessionRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepositoryImpl{db}
+}
+
+func (r *sessionRepositoryImpl) CreateSession(ctx context.Context, session *models.Session, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(session).Error
+}
+
+func (r *sessionRepositoryImpl) GetSession(ctx context.Context, id string, dbs ...*gorm.DB) (*models.Session, error) {
+	database := getDb(r.DB, dbs...)
+	var session models.Session
+	err := database.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSessionsByUser returns the sessions of the user that are neither revoked nor expired,
+// the most recently seen first.
+func (r *sessionRepositoryImpl) GetActiveSessionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.Session, error) {
+	database := getDb(r.DB, dbs...)
+	var sessions []*models.Session
+	err := database.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *sessionRepositoryImpl) TouchSession(ctx context.Context, id string, lastSeenAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", lastSeenAt).Error
+}
+
+// RotateSession saves the new refresh token of the session if it is still at previousGeneration and
+// not revoked. It reports false when a concurrent rotation or a revocation got there first.
+func (r *sessionRepositoryImpl) RotateSession(ctx context.Context, session *models.Session, previousGeneration int32, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND generation = ? AND revoked_at IS NULL", session.ID, previousGeneration).
+		Updates(map[string]any{
+			"refresh_token_hash": session.RefreshTokenHash,
+			"generation":         session.Generation,
+			"user_agent":         session.UserAgent,
+			"ip":                 session.IP,
+			"last_seen_at":       session.LastSeenAt,
+			"expires_at":         session.ExpiresAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *sessionRepositoryImpl) RevokeSession(ctx context.Context, id string, revokedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", revokedAt).Error
+}
+
+// RevokeSessionsByUser revokes every session of the user but exceptID, which can be empty.
+func (r *sessionRepositoryImpl) RevokeSessionsByUser(ctx context.Context, userID int32, exceptID string, revokedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", revokedAt).Error
+}
+
+// DeleteSessionsBefore deletes the sessions that expired before the given time.
+func (r *sessionRepositoryImpl) DeleteSessionsBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *sessionRepositoryImpl) DeleteSessionsByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.Session{}).Error
+}
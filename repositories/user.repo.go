@@ -2,16 +2,33 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"gorm.io/gorm"
 
+	"github.com/mrgThang/flashcard-be/constant"
 	"github.com/mrgThang/flashcard-be/dto"
 	"github.com/mrgThang/flashcard-be/models"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, req dto.CreateUserRequest, db ...*gorm.DB) error
+	InsertUser(ctx context.Context, user *models.User, db ...*gorm.DB) error
 	GetUser(ctx context.Context, req dto.GetUserRequest, db ...*gorm.DB) (*models.User, error)
+	SetEmailVerified(ctx context.Context, userID int32, email string, at *time.Time, db ...*gorm.DB) (bool, error)
+	ConfirmPendingEmail(ctx context.Context, userID int32, email string, at *time.Time, db ...*gorm.DB) (bool, error)
+	UpdatePassword(ctx context.Context, userID int32, password string, db ...*gorm.DB) error
+	ClearPassword(ctx context.Context, userID int32, db ...*gorm.DB) error
+	UpdateProfile(ctx context.Context, user *models.User, db ...*gorm.DB) error
+	UpdateTwoFactor(ctx context.Context, userID int32, secret *string, enabledAt *time.Time, db ...*gorm.DB) error
+	UseTwoFactorStep(ctx context.Context, userID int32, step int64, db ...*gorm.DB) (bool, error)
+	ScheduleDeletion(ctx context.Context, userID int32, at *time.Time, db ...*gorm.DB) error
+	GetUsersScheduledForDeletion(ctx context.Context, before time.Time, db ...*gorm.DB) ([]*models.User, error)
+	PurgeUser(ctx context.Context, userID int32, db ...*gorm.DB) error
+	SearchUsers(ctx context.Context, req dto.AdminGetUsersRequest, db ...*gorm.DB) ([]*models.User, int64, error)
+	UpdateRole(ctx context.Context, userID int32, role string, db ...*gorm.DB) error
+	SetDisabled(ctx context.Context, userID int32, at *time.Time, db ...*gorm.DB) error
+	CountUsers(ctx context.Context, req dto.CountUsersRequest, db ...*gorm.DB) (int64, error)
 }
 
 type userRepositoryImpl struct {
@@ -27,11 +44,17 @@ func (r *userRepositoryImpl) CreateUser(ctx context.Context, req dto.CreateUserR
 	user := models.User{
 		Name:     req.Name,
 		Email:    req.Email,
-		Password: req.Password,
+		Password: &req.Password,
 	}
 	return database.WithContext(ctx).Create(&user).Error
 }
 
+// InsertUser creates the user as it is and sets its ID, such as an account without password.
+func (r *userRepositoryImpl) InsertUser(ctx context.Context, user *models.User, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(user).Error
+}
+
 func (r *userRepositoryImpl) GetUser(ctx context.Context, req dto.GetUserRequest, dbs ...*gorm.DB) (*models.User, error) {
 	database := getDb(r.DB, dbs...)
 	var user models.User
@@ -48,3 +71,151 @@ func (r *userRepositoryImpl) GetUser(ctx context.Context, req dto.GetUserRequest
 	}
 	return &user, nil
 }
+
+// SetEmailVerified sets when the user verified their email, as long as it is still the given email.
+// It reports false when the email of the user changed.
+func (r *userRepositoryImpl) SetEmailVerified(ctx context.Context, userID int32, email string, at *time.Time, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Model(&models.User{}).Where("id = ? AND email = ?", userID, email).Update("email_verified_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ConfirmPendingEmail makes the pending email of the user their verified email, as long as it is
+// still the given email. It reports false when the user asked for another email since.
+func (r *userRepositoryImpl) ConfirmPendingEmail(ctx context.Context, userID int32, email string, at *time.Time, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Model(&models.User{}).Where("id = ? AND pending_email = ?", userID, email).Updates(map[string]any{
+		"email":             email,
+		"pending_email":     nil,
+		"email_verified_at": at,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdatePassword replaces the password hash of the user.
+func (r *userRepositoryImpl) UpdatePassword(ctx context.Context, userID int32, password string, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("password", password).Error
+}
+
+// ClearPassword removes the password of the user, who can then only sign in through a provider.
+func (r *userRepositoryImpl) ClearPassword(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("password", nil).Error
+}
+
+// UpdateProfile saves the name, the email, the email verification and the pending email of the user.
+func (r *userRepositoryImpl) UpdateProfile(ctx context.Context, user *models.User, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+		"name":              user.Name,
+		"email":             user.Email,
+		"email_verified_at": user.EmailVerifiedAt,
+		"pending_email":     user.PendingEmail,
+	}).Error
+}
+
+// UpdateTwoFactor saves the encrypted TOTP secret of the user and when two-factor authentication
+// was enabled, nil for both disables it.
+func (r *userRepositoryImpl) UpdateTwoFactor(ctx context.Context, userID int32, secret *string, enabledAt *time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"two_factor_secret":     secret,
+		"two_factor_enabled_at": enabledAt,
+		"two_factor_last_step":  0,
+	}).Error
+}
+
+// UseTwoFactorStep records the TOTP time step of a code, it reports false when a code of that step
+// or a later one was already used.
+func (r *userRepositoryImpl) UseTwoFactorStep(ctx context.Context, userID int32, step int64, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND two_factor_last_step < ?", userID, step).
+		Update("two_factor_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ScheduleDeletion sets the time the account of the user is deleted at, nil cancels the deletion.
+func (r *userRepositoryImpl) ScheduleDeletion(ctx context.Context, userID int32, at *time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", at).Error
+}
+
+func (r *userRepositoryImpl) GetUsersScheduledForDeletion(ctx context.Context, before time.Time, dbs ...*gorm.DB) ([]*models.User, error) {
+	database := getDb(r.DB, dbs...)
+	var users []*models.User
+	err := database.WithContext(ctx).Model(&models.User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", before).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *userRepositoryImpl) PurgeUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Unscoped().Where("id = ?", userID).Delete(&models.User{}).Error
+}
+
+// SearchUsers returns a page of the users for the admin API, newest first.
+func (r *userRepositoryImpl) SearchUsers(ctx context.Context, req dto.AdminGetUsersRequest, dbs ...*gorm.DB) ([]*models.User, int64, error) {
+	database := getDb(r.DB, dbs...)
+	query := database.WithContext(ctx).Model(&models.User{})
+	if req.Query != "" {
+		query = query.Where("(name LIKE ? OR email LIKE ?)", "%"+req.Query+"%", "%"+req.Query+"%")
+	}
+	if req.Role != "" {
+		query = query.Where("role = ?", req.Role)
+	}
+	if req.Disabled != nil {
+		if *req.Disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+
+	var totalItems int64
+	if err := query.Count(&totalItems).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := constant.DefaultOffset
+	if req.Page > 0 {
+		offset = (req.Page - 1) * req.PageSize
+	}
+	limit := constant.DefaultLimit
+	if req.PageSize > 0 {
+		limit = req.PageSize
+	}
+	var users []*models.User
+	err := query.Order("created_at DESC").Order("id DESC").Offset(offset).Limit(limit).Find(&users).Error
+	return users, totalItems, err
+}
+
+func (r *userRepositoryImpl) UpdateRole(ctx context.Context, userID int32, role string, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("role", role).Error
+}
+
+// SetDisabled disables the account at the time, or enables it again when at is nil.
+func (r *userRepositoryImpl) SetDisabled(ctx context.Context, userID int32, at *time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("disabled_at", at).Error
+}
+
+func (r *userRepositoryImpl) CountUsers(ctx context.Context, req dto.CountUsersRequest, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	query := database.WithContext(ctx).Model(&models.User{})
+	if req.Disabled {
+		query = query.Where("disabled_at IS NOT NULL")
+	}
+	if req.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *req.CreatedAfter)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type UserIdentityRepository interface {
+	CreateIdentity(ctx context.Context, identity *models.UserIdentity, dbs ...*gorm.DB) error
+	GetIdentity(ctx context.Context, provider string, subject string, dbs ...*gorm.DB) (*models.UserIdentity, error)
+	GetIdentitiesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.UserIdentity, error)
+	TouchIdentity(ctx context.Context, id int32, email string, lastUsedAt time.Time, dbs ...*gorm.DB) error
+	DeleteIdentity(ctx context.Context, userID int32, id int32, dbs ...*gorm.DB) (bool, error)
+	DeleteIdentitiesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type userIdentityRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewUserIdentityRepository(db *gorm.DB) UserIdentityRepository {
+	return &userIdentityRepositoryImpl{db}
+}
+
+func (r *userIdentityRepositoryImpl) CreateIdentity(ctx context.Context, identity *models.UserIdentity, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(identity).Error
+}
+
+func (r *userIdentityRepositoryImpl) GetIdentity(ctx context.Context, provider string, subject string, dbs ...*gorm.DB) (*models.UserIdentity, error) {
+	database := getDb(r.DB, dbs...)
+	var identity models.UserIdentity
+	err := database.WithContext(ctx).Model(&models.UserIdentity{}).
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *userIdentityRepositoryImpl) GetIdentitiesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) ([]*models.UserIdentity, error) {
+	database := getDb(r.DB, dbs...)
+	var identities []*models.UserIdentity
+	err := database.WithContext(ctx).Model(&models.UserIdentity{}).
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&identities).Error
+	return identities, err
+}
+
+// TouchIdentity records a sign-in with the identity and the email the provider has for it.
+func (r *userIdentityRepositoryImpl) TouchIdentity(ctx context.Context, id int32, email string, lastUsedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.UserIdentity{}).Where("id = ?", id).Updates(map[string]any{
+		"email":        email,
+		"last_used_at": lastUsedAt,
+	}).Error
+}
+
+// DeleteIdentity unlinks the identity of the user, it reports false when the user has no such identity.
+func (r *userIdentityRepositoryImpl) DeleteIdentity(ctx context.Context, userID int32, id int32, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.UserIdentity{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *userIdentityRepositoryImpl) DeleteIdentitiesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error
+}
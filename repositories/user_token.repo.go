@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type UserTokenRepository interface {
+	CreateToken(ctx context.Context, token *models.UserToken, dbs ...*gorm.DB) error
+	GetToken(ctx context.Context, id string, dbs ...*gorm.DB) (*models.UserToken, error)
+	UseToken(ctx context.Context, id string, usedAt time.Time, dbs ...*gorm.DB) (bool, error)
+	UseTokensByUser(ctx context.Context, userID int32, purpose string, usedAt time.Time, dbs ...*gorm.DB) error
+	DeleteTokensBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) (int64, error)
+	DeleteTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error
+}
+
+type userTokenRepositoryImpl struct {
+	*gorm.DB
+}
+
+func NewUserTokenRepository(db *gorm.DB) UserTokenRepository {
+	return &userTokenRepositoryImpl{db}
+}
+
+func (r *userTokenRepositoryImpl) CreateToken(ctx context.Context, token *models.UserToken, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Create(token).Error
+}
+
+func (r *userTokenRepositoryImpl) GetToken(ctx context.Context, id string, dbs ...*gorm.DB) (*models.UserToken, error) {
+	database := getDb(r.DB, dbs...)
+	var token models.UserToken
+	err := database.WithContext(ctx).Model(&models.UserToken{}).Where("id = ?", id).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseToken marks the token used, it reports false when it already was.
+func (r *userTokenRepositoryImpl) UseToken(ctx context.Context, id string, usedAt time.Time, dbs ...*gorm.DB) (bool, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Model(&models.UserToken{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", usedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// UseTokensByUser marks every unused token of the user for the purpose used.
+func (r *userTokenRepositoryImpl) UseTokensByUser(ctx context.Context, userID int32, purpose string, usedAt time.Time, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", usedAt).Error
+}
+
+// DeleteTokensBefore deletes the tokens that expired before the given time.
+func (r *userTokenRepositoryImpl) DeleteTokensBefore(ctx context.Context, before time.Time, dbs ...*gorm.DB) (int64, error) {
+	database := getDb(r.DB, dbs...)
+	result := database.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.UserToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *userTokenRepositoryImpl) DeleteTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	database := getDb(r.DB, dbs...)
+	return database.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.UserToken{}).Error
+}
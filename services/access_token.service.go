@@ -0,0 +1,249 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	maxAccessTokensPerUser   = 50
+	maxAccessTokenNameLength = 100
+	// accessTokenTouchInterval is how stale the last use of a token gets before it is written again,
+	// so a script calling in a loop does not write on every request.
+	accessTokenTouchInterval = time.Minute
+	accessTokenHintLength    = 12
+)
+
+var errInvalidAccessToken = helpers.NewHTTPError(http.StatusUnauthorized, fmt.Errorf("invalid or expired access token"))
+
+// CreateAccessTokenHandler creates a personal access token, the token is only returned by this call.
+func (s *Service) CreateAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[CreateAccessTokenHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	var req dto.CreateAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[CreateAccessTokenHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("name is required"))
+		return
+	}
+	if utf8.RuneCountInString(req.Name) > maxAccessTokenNameLength {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("name must be at most %d characters", maxAccessTokenNameLength))
+		return
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	expiresAt, err := s.accessTokenExpiry(req.ExpiresInDays)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := s.AccessTokenRepository.CountAccessTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[CreateAccessTokenHandler] AccessTokenRepository.CountAccessTokensByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if count >= maxAccessTokensPerUser {
+		helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("at most %d access tokens are allowed, delete one first", maxAccessTokensPerUser))
+		return
+	}
+
+	tokenString, err := generateAccessToken()
+	if err != nil {
+		logger.Error("[CreateAccessTokenHandler] Generate token got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	token := &models.AccessToken{
+		UserID:    user.ID,
+		Name:      req.Name,
+		TokenHash: hashToken(tokenString),
+		Hint:      tokenString[:accessTokenHintLength],
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.AccessTokenRepository.CreateAccessToken(r.Context(), token); err != nil {
+		logger.Error("[CreateAccessTokenHandler] AccessTokenRepository.CreateAccessToken got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, dto.CreateAccessTokenResponse{
+		Token:       tokenString,
+		AccessToken: toAccessTokenItem(token),
+	})
+}
+
+func (s *Service) GetAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetAccessTokensHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	tokens, err := s.AccessTokenRepository.GetAccessTokensByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetAccessTokensHandler] AccessTokenRepository.GetAccessTokensByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.AccessTokenItem, len(tokens))
+	for index, token := range tokens {
+		items[index] = toAccessTokenItem(token)
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetAccessTokensResponse{AccessTokens: items})
+}
+
+// DeleteAccessTokenHandler revokes a personal access token, it stops working right away.
+func (s *Service) DeleteAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteAccessTokenHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	deleted, err := s.AccessTokenRepository.DeleteAccessToken(r.Context(), user.ID, id)
+	if err != nil {
+		logger.Error("[DeleteAccessTokenHandler] AccessTokenRepository.DeleteAccessToken got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !deleted {
+		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("access token not found"))
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// AuthenticateAccessToken returns the personal access token the request was made with, and records
+// its use.
+func (s *Service) AuthenticateAccessToken(r *http.Request, tokenString string) (*models.AccessToken, error) {
+	ctx := r.Context()
+	token, err := s.AccessTokenRepository.GetAccessTokenByHash(ctx, hashToken(tokenString))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidAccessToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, errInvalidAccessToken
+	}
+
+	ip := clientIP(r)
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= accessTokenTouchInterval || token.LastUsedIP != ip {
+		// the request does not depend on it, a failure is only logged
+		if err := s.AccessTokenRepository.TouchAccessToken(ctx, token.ID, ip, now); err != nil {
+			logger.Error("[AuthenticateAccessToken] AccessTokenRepository.TouchAccessToken got error", zap.Int32("tokenId", token.ID), zap.Error(err))
+		}
+	}
+	return token, nil
+}
+
+// HasAnyScope reports whether the token holds one of the scopes.
+func HasAnyScope(token *models.AccessToken, scopes ...string) bool {
+	granted := strings.Fields(token.Scopes)
+	for _, scope := range scopes {
+		if slices.Contains(granted, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) accessTokenExpiry(expiresInDays *int) (*time.Time, error) {
+	maxDays := s.Config.AccessTokenMaxDays
+	days := maxDays
+	if expiresInDays != nil {
+		days = *expiresInDays
+		if days <= 0 {
+			return nil, fmt.Errorf("expiresInDays must be positive")
+		}
+		if maxDays > 0 && days > maxDays {
+			return nil, fmt.Errorf("expiresInDays must be at most %d", maxDays)
+		}
+	}
+	if days == 0 {
+		return nil, nil
+	}
+	expiresAt := time.Now().AddDate(0, 0, days)
+	return &expiresAt, nil
+}
+
+// normalizeScopes checks the requested scopes and removes the duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("scopes is required, available scopes are %s", strings.Join(constant.Scopes, ", "))
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(constant.Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, available scopes are %s", scope, strings.Join(constant.Scopes, ", "))
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+func generateAccessToken() (string, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return constant.AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+func toAccessTokenItem(token *models.AccessToken) dto.AccessTokenItem {
+	return dto.AccessTokenItem{
+		ID:         token.ID,
+		Name:       token.Name,
+		Hint:       token.Hint,
+		Scopes:     strings.Fields(token.Scopes),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		LastUsedIP: token.LastUsedIP,
+		CreatedAt:  token.CreatedAt,
+	}
+}
@@ -0,0 +1,593 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+	"github.com/mrgThang/flashcard-be/repositories"
+)
+
+const (
+	jobTypeAccountExport = "account_export"
+
+	accountExportMaxAge     = 7 * 24 * time.Hour
+	accountDeletionInterval = time.Hour
+)
+
+func (s *Service) ExportAccountHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ExportAccountHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	job, err := s.startJob(r.Context(), user.ID, jobTypeAccountExport, func(ctx context.Context, progress *jobProgress) (any, error) {
+		return s.exportAccount(ctx, user, progress)
+	})
+	if err != nil {
+		logger.Error("[ExportAccountHandler] Start job got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusAccepted, s.parseJobItem(job))
+}
+
+func (s *Service) DownloadAccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[DownloadAccountExportHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DownloadAccountExportHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	job, err := s.getUserJob(r, user, id)
+	if err != nil {
+		logger.Error("[DownloadAccountExportHandler] Get job got error", zap.Int32("jobId", id), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if job.Type != jobTypeAccountExport {
+		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("account export not found"))
+		return
+	}
+	if job.Status != models.JobStatusSucceeded {
+		helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("account export is %s", job.Status))
+		return
+	}
+	var result dto.AccountExportResult
+	if err := json.Unmarshal([]byte(job.Result), &result); err != nil {
+		logger.Error("[DownloadAccountExportHandler] Unmarshal job result got error", zap.Int32("jobId", id), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(s.accountExportDir(user.ID), filepath.Base(result.Filename)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			helpers.WriteJSONError(w, http.StatusGone, fmt.Errorf("account export has expired"))
+			return
+		}
+		logger.Error("[DownloadAccountExportHandler] Open export got error", zap.Int32("jobId", id), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": fmt.Sprintf("flashcards-account-%s.zip", job.CreatedAt.Format("2006-01-02")),
+	}))
+	http.ServeContent(w, r, "", job.CreatedAt, file)
+}
+
+func (s *Service) accountExportsRoot() string {
+	return filepath.Join(s.Config.StorageDir, "exports")
+}
+
+func (s *Service) accountExportDir(userID int32) string {
+	return filepath.Join(s.accountExportsRoot(), strconv.Itoa(int(userID)))
+}
+
+// exportAccount writes every piece of data of the user to a zip in the exports directory:
+// manifest.json, profile.json, decks.json, cards.json, reviews.json, progress.json, media.json and the media files.
+func (s *Service) exportAccount(ctx context.Context, user models.User, progress *jobProgress) (*dto.AccountExportResult, error) {
+	media, err := s.MediaRepository.GetMediaByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	progress.SetTotal(len(media) + 5)
+
+	dir := s.accountExportDir(user.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, "export-*.zip.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	manifest := dto.AccountExportManifest{
+		Schema:     constant.AccountExportSchema,
+		Version:    constant.AccountExportVersion,
+		ExportedAt: time.Now().UTC(),
+		UserID:     user.ID,
+	}
+	addFile := func(name string, description string, count int) {
+		manifest.Files = append(manifest.Files, dto.AccountExportFile{Name: name, Description: description, Count: count})
+	}
+
+	err = writeZipJSON(archive, "profile.json", dto.AccountProfile{
+		ID:                  user.ID,
+		Name:                user.Name,
+		Email:               user.Email,
+		CreatedAt:           user.CreatedAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	addFile("profile.json", "Account profile", 1)
+	progress.Advance(1)
+
+	decks, err := s.exportAccountDecks(ctx, archive, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	addFile("decks.json", "Decks including the ones in the trash, parentId links subdecks", decks)
+	progress.Advance(1)
+
+	cards, err := s.exportAccountCards(ctx, archive, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	addFile("cards.json", "Cards including the ones in the trash, with their scheduling state", cards)
+	progress.Advance(1)
+
+	reviews, err := s.exportAccountReviews(ctx, archive, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	addFile("reviews.json", "Review history of the cards", reviews)
+	progress.Advance(1)
+
+	cardProgresses, err := s.CardProgressRepository.GetProgressByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	progressItems := make([]dto.AccountCardProgress, len(cardProgresses))
+	for index, cardProgress := range cardProgresses {
+		progressItems[index] = dto.AccountCardProgress{
+			CardID:           cardProgress.CardID,
+			EasinessFactor:   cardProgress.EasinessFactor,
+			RepetitionNumber: cardProgress.RepetitionNumber,
+			IntervalNumber:   cardProgress.IntervalNumber,
+			StudyTime:        cardProgress.StudyTime,
+		}
+	}
+	if err := writeZipJSON(archive, "progress.json", progressItems); err != nil {
+		return nil, err
+	}
+	addFile("progress.json", "Scheduling state of the cards of decks shared with the account", len(progressItems))
+	progress.Advance(1)
+
+	mediaItems := make([]dto.AccountMedia, 0, len(media))
+	for _, item := range media {
+		entryName := path.Join("media", item.Filename)
+		if err := copyToZip(archive, entryName, s.mediaPath(user.ID, item.Filename)); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			logger.Error("[exportAccount] Media file is missing", zap.Int32("userId", user.ID), zap.String("filename", item.Filename))
+			entryName = ""
+		}
+		mediaItems = append(mediaItems, dto.AccountMedia{
+			Filename:    item.Filename,
+			ContentType: item.ContentType,
+			Size:        item.Size,
+			Path:        entryName,
+			CreatedAt:   item.CreatedAt,
+		})
+		progress.Advance(1)
+	}
+	if err := writeZipJSON(archive, "media.json", mediaItems); err != nil {
+		return nil, err
+	}
+	addFile("media.json", "Images and sounds used by cards, stored in the media folder", len(mediaItems))
+
+	if err := writeZipJSON(archive, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	filename := filepath.Base(file.Name())
+	filename = filename[:len(filename)-len(".tmp")]
+	if err := os.Rename(file.Name(), filepath.Join(dir, filename)); err != nil {
+		return nil, err
+	}
+	return &dto.AccountExportResult{
+		Filename:  filename,
+		Size:      info.Size(),
+		ExpiresAt: time.Now().Add(accountExportMaxAge),
+	}, nil
+}
+
+func (s *Service) exportAccountDecks(ctx context.Context, archive *zip.Writer, userID int32) (int, error) {
+	userDecks, err := s.DeckRepository.GetDecksByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	deletedDecks, err := s.DeckRepository.GetDeletedDecks(ctx, dto.GetTrashRequest{UserID: userID})
+	if err != nil {
+		return 0, err
+	}
+	allDecks := append(userDecks, deletedDecks...)
+
+	paths := helpers.DeckPaths(allDecks)
+	items := make([]dto.AccountDeck, 0, len(allDecks))
+	for _, deck := range allDecks {
+		item := dto.AccountDeck{
+			ID:          deck.ID,
+			Name:        deck.Name,
+			Description: deck.Description,
+			ParentID:    deck.ParentID,
+			Path:        paths[deck.ID],
+			CreatedAt:   deck.CreatedAt,
+		}
+		if deck.DeletedAt.Valid {
+			item.DeletedAt = &deck.DeletedAt.Time
+		}
+		items = append(items, item)
+	}
+	return len(items), writeZipJSON(archive, "decks.json", items)
+}
+
+func (s *Service) exportAccountCards(ctx context.Context, archive *zip.Writer, userID int32) (int, error) {
+	entry, err := archive.Create("cards.json")
+	if err != nil {
+		return 0, err
+	}
+	cards, err := newJSONArrayWriter(entry)
+	if err != nil {
+		return 0, err
+	}
+	err = s.CardRepository.StreamCards(ctx, dto.GetCardsRequest{UserID: userID, WithDeleted: true}, exportBatchSize, func(batch []*models.Card) error {
+		for _, card := range batch {
+			item := dto.AccountCard{
+				ID:               card.ID,
+				GUID:             card.GUID,
+				DeckID:           card.DeckID,
+				Front:            card.Front,
+				Back:             card.Back,
+				Tags:             helpers.SplitTags(card.Tags),
+				TypeAnswer:       card.TypeAnswer,
+				EasinessFactor:   card.EasinessFactor,
+				RepetitionNumber: card.RepetitionNumber,
+				IntervalNumber:   card.IntervalNumber,
+				StudyTime:        card.StudyTime,
+				CreatedAt:        card.CreatedAt,
+				UpdatedAt:        card.UpdatedAt,
+			}
+			if card.DeletedAt.Valid {
+				item.DeletedAt = &card.DeletedAt.Time
+			}
+			if err := cards.Write(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return cards.count, cards.Close()
+}
+
+func (s *Service) exportAccountReviews(ctx context.Context, archive *zip.Writer, userID int32) (int, error) {
+	entry, err := archive.Create("reviews.json")
+	if err != nil {
+		return 0, err
+	}
+	reviews, err := newJSONArrayWriter(entry)
+	if err != nil {
+		return 0, err
+	}
+	err = s.ReviewLogRepository.StreamReviewLogsByUser(ctx, userID, exportBatchSize, func(batch []*models.ReviewLog) error {
+		for _, reviewLog := range batch {
+			err := reviews.Write(dto.AccountReview{
+				CardID:           reviewLog.CardID,
+				Quality:          reviewLog.Quality,
+				EasinessFactor:   reviewLog.EasinessFactor,
+				RepetitionNumber: reviewLog.RepetitionNumber,
+				IntervalNumber:   reviewLog.IntervalNumber,
+				ReviewedAt:       reviewLog.ReviewedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reviews.count, reviews.Close()
+}
+
+func writeZipJSON(archive *zip.Writer, name string, value any) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func copyToZip(archive *zip.Writer, name string, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+func (s *Service) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseDeleteAccountRequest(r)
+	if err != nil {
+		logger.Error("[DeleteAccountHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteAccountHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	if user.Password != nil && !checkUserPassword(&user, req.Password) {
+		logger.Error("[DeleteAccountHandler] Invalid password", zap.Int32("userId", user.ID))
+		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("password is incorrect"))
+		return
+	}
+	if req.Confirmation != user.Email {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("confirmation must be the email of the account"))
+		return
+	}
+	if user.DeletionScheduledAt != nil {
+		helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("account deletion is already scheduled"))
+		return
+	}
+
+	scheduledAt := time.Now().Add(time.Duration(s.Config.AccountDeletionGraceDays) * 24 * time.Hour)
+	if err := s.UserRepository.ScheduleDeletion(r.Context(), user.ID, &scheduledAt); err != nil {
+		logger.Error("[DeleteAccountHandler] UserRepository.ScheduleDeletion got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[DeleteAccountHandler] Account deletion scheduled", zap.Int32("userId", user.ID), zap.Time("scheduledAt", scheduledAt))
+	helpers.WriteJSONResponse(w, http.StatusAccepted, dto.DeleteAccountResponse{DeletionScheduledAt: scheduledAt})
+}
+
+func (s *Service) parseDeleteAccountRequest(r *http.Request) (*dto.DeleteAccountRequest, error) {
+	var req dto.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseDeleteAccountRequest] Failed to decode request", zap.Error(err))
+		return nil, err
+	}
+	if req.Confirmation == "" {
+		return nil, fmt.Errorf("confirmation is required")
+	}
+	return &req, nil
+}
+
+func (s *Service) CancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[CancelAccountDeletionHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	if user.DeletionScheduledAt == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("account deletion is not scheduled"))
+		return
+	}
+
+	if err := s.UserRepository.ScheduleDeletion(r.Context(), user.ID, nil); err != nil {
+		logger.Error("[CancelAccountDeletionHandler] UserRepository.ScheduleDeletion got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// RunAccountDeleter permanently deletes the accounts whose grace period is over, until ctx is cancelled.
+func (s *Service) RunAccountDeleter(ctx context.Context) {
+	ticker := time.NewTicker(accountDeletionInterval)
+	defer ticker.Stop()
+	for {
+		s.deleteScheduledAccounts(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) deleteScheduledAccounts(ctx context.Context) {
+	users, err := s.UserRepository.GetUsersScheduledForDeletion(ctx, time.Now())
+	if err != nil {
+		logger.Error("[deleteScheduledAccounts] UserRepository.GetUsersScheduledForDeletion got error", zap.Error(err))
+		return
+	}
+	for _, user := range users {
+		if err := s.deleteAccount(ctx, *user); err != nil {
+			logger.Error("[deleteScheduledAccounts] Delete account got error", zap.Int32("userId", user.ID), zap.Error(err))
+			continue
+		}
+		logger.Info("[deleteScheduledAccounts] Account deleted", zap.Int32("userId", user.ID))
+	}
+}
+
+// deleteAccount permanently deletes the user with every row and file tied to it.
+func (s *Service) deleteAccount(ctx context.Context, user models.User) error {
+	userID := user.ID
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.ReviewLogRepository.DeleteReviewLogsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		// the collaborators of the decks of the user lose them, and the user leaves the decks of others
+		if err := s.ReviewLogRepository.DeleteReviewLogsByCardOwner(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.CardProgressRepository.DeleteProgressByCardOwner(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.CardProgressRepository.DeleteProgressByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckMemberRepository.DeleteMembersByDeckOwner(ctx, userID, tx); err != nil {
+			return err
+		}
+		// the invitations to an unverified email may be meant for someone else
+		invitedEmail := ""
+		if user.EmailVerifiedAt != nil {
+			invitedEmail = user.Email
+		}
+		if err := s.DeckMemberRepository.DeleteMembersByUser(ctx, userID, invitedEmail, tx); err != nil {
+			return err
+		}
+		// the published decks of the user leave the library, the copies of the subscribers stay
+		if err := s.CardConflictRepository.DeleteConflictsByAuthor(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckSubscriptionRepository.DeleteSubscriptionsByAuthor(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckReportRepository.DeleteReportsByAuthor(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.PublishedDeckRepository.DeletePublishedDecksByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		subscriptions, err := s.DeckSubscriptionRepository.GetSubscriptionsByUser(ctx, userID, tx)
+		if err != nil {
+			return err
+		}
+		for _, subscription := range subscriptions {
+			if err := s.PublishedDeckRepository.IncrementCounter(ctx, subscription.PublishedDeckID, repositories.PublishedDeckSubscriberCount, -1, tx); err != nil {
+				return err
+			}
+		}
+		if err := s.CardConflictRepository.DeleteConflictsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.CardUpstreamRepository.DeleteUpstreamsByCardOwner(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckSubscriptionRepository.DeleteSubscriptionsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckReportRepository.DeleteReportsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.CardRevisionRepository.DeleteRevisionsByCardOwner(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.CardRevisionRepository.DeleteRevisionsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.CardRepository.PurgeCardsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckRepository.PurgeDecksByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckPresetRepository.DeletePresetsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.MediaRepository.DeleteMediaByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.JobRepository.DeleteJobsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.SessionRepository.DeleteSessionsByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.UserTokenRepository.DeleteTokensByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.UserIdentityRepository.DeleteIdentitiesByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.RecoveryCodeRepository.DeleteCodesByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		if err := s.AccessTokenRepository.DeleteAccessTokensByUser(ctx, userID, tx); err != nil {
+			return err
+		}
+		return s.UserRepository.PurgeUser(ctx, userID, tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{
+		s.mediaDir(userID),
+		s.uploadDir(userID),
+		s.accountExportDir(userID),
+	} {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Error("[deleteAccount] Remove user files got error", zap.Int32("userId", userID), zap.String("dir", dir), zap.Error(err))
+		}
+	}
+	return nil
+}
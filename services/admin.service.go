@@ -0,0 +1,280 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// adminStatsRecentDays is the period the recent counts of the stats cover.
+const adminStatsRecentDays = 7
+
+var errAccountDisabled = helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("account is disabled"))
+
+// AdminGetUsersHandler lists the users, filtered by `q` on the name or email, `role` and `disabled`.
+func (s *Service) AdminGetUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := dto.AdminGetUsersRequest{Query: strings.TrimSpace(q.Get("q")), Role: q.Get("role")}
+	var err error
+	if req.Role != "" && !slices.Contains(models.UserRoles, req.Role) {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("role must be one of %s", strings.Join(models.UserRoles, ", ")))
+		return
+	}
+	if req.Disabled, err = parseOptionalBool(q, "disabled"); err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Page, req.PageSize, err = parsePage(q); err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	users, totalItems, err := s.UserRepository.SearchUsers(r.Context(), req)
+	if err != nil {
+		logger.Error("[AdminGetUsersHandler] UserRepository.SearchUsers got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.AdminUserItem, len(users))
+	for index, user := range users {
+		items[index] = toAdminUserItem(user)
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetUsersResponse{
+		Pagination: dto.Pagination{
+			Page:       req.Page,
+			PageSize:   req.PageSize,
+			TotalItems: totalItems,
+		},
+		Users: items,
+	})
+}
+
+func (s *Service) AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getAdminTargetUser(r)
+	if err != nil {
+		logger.Error("[AdminGetUserHandler] Get user got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetUserResponse{User: toAdminUserItem(user)})
+}
+
+// AdminUpdateUserRoleHandler changes the role of a user. Admins can not change their own role, so
+// there is always an admin left.
+func (s *Service) AdminUpdateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminUpdateUserRoleHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	var req dto.AdminUpdateUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[AdminUpdateUserRoleHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !slices.Contains(models.UserRoles, req.Role) {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("role must be one of %s", strings.Join(models.UserRoles, ", ")))
+		return
+	}
+	user, err := s.getAdminTargetUser(r)
+	if err != nil {
+		logger.Error("[AdminUpdateUserRoleHandler] Get user got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if user.ID == admin.ID {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("can not change your own role"))
+		return
+	}
+
+	if err := s.UserRepository.UpdateRole(r.Context(), user.ID, req.Role); err != nil {
+		logger.Error("[AdminUpdateUserRoleHandler] UserRepository.UpdateRole got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminUpdateUserRoleHandler] Role changed", zap.Int32("adminId", admin.ID), zap.Int32("userId", user.ID), zap.String("role", req.Role))
+	user.Role = req.Role
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetUserResponse{User: toAdminUserItem(user)})
+}
+
+// AdminDisableUserHandler disables an account and logs out its sessions. It can not sign in, and
+// its access tokens stop working, until it is enabled again.
+func (s *Service) AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminDisableUserHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	user, err := s.getAdminTargetUser(r)
+	if err != nil {
+		logger.Error("[AdminDisableUserHandler] Get user got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if user.ID == admin.ID {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("can not disable your own account"))
+		return
+	}
+	if user.DisabledAt != nil {
+		helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetUserResponse{User: toAdminUserItem(user)})
+		return
+	}
+
+	now := time.Now()
+	if err := s.UserRepository.SetDisabled(r.Context(), user.ID, &now); err != nil {
+		logger.Error("[AdminDisableUserHandler] UserRepository.SetDisabled got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.revokeUserSessions(r.Context(), user.ID, ""); err != nil {
+		logger.Error("[AdminDisableUserHandler] Revoke sessions got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminDisableUserHandler] User disabled", zap.Int32("adminId", admin.ID), zap.Int32("userId", user.ID))
+	user.DisabledAt = &now
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetUserResponse{User: toAdminUserItem(user)})
+}
+
+func (s *Service) AdminEnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminEnableUserHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	user, err := s.getAdminTargetUser(r)
+	if err != nil {
+		logger.Error("[AdminEnableUserHandler] Get user got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	if err := s.UserRepository.SetDisabled(r.Context(), user.ID, nil); err != nil {
+		logger.Error("[AdminEnableUserHandler] UserRepository.SetDisabled got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminEnableUserHandler] User enabled", zap.Int32("adminId", admin.ID), zap.Int32("userId", user.ID))
+	user.DisabledAt = nil
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetUserResponse{User: toAdminUserItem(user)})
+}
+
+// AdminResetUserPasswordHandler forces a password reset: the password stops working, every session
+// is logged out, the personal access tokens are revoked and a reset link is mailed to the user.
+// Signing in with a provider still works.
+func (s *Service) AdminResetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminResetUserPasswordHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	user, err := s.getAdminTargetUser(r)
+	if err != nil {
+		logger.Error("[AdminResetUserPasswordHandler] Get user got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	if err := s.UserRepository.ClearPassword(r.Context(), user.ID); err != nil {
+		logger.Error("[AdminResetUserPasswordHandler] UserRepository.ClearPassword got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.revokeUserAccess(r.Context(), user.ID, ""); err != nil {
+		logger.Error("[AdminResetUserPasswordHandler] Revoke access got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminResetUserPasswordHandler] Password reset forced", zap.Int32("adminId", admin.ID), zap.Int32("userId", user.ID))
+	if err := s.sendPasswordReset(r.Context(), user); err != nil {
+		// the user can still ask for another link from the login page
+		logger.Error("[AdminResetUserPasswordHandler] Send password reset email got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("password was reset but the email could not be sent: %w", err))
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+func (s *Service) AdminGetStatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	since := time.Now().AddDate(0, 0, -adminStatsRecentDays)
+	hidden := true
+	var response dto.AdminGetStatsResponse
+	counts := []struct {
+		target *int64
+		count  func() (int64, error)
+	}{
+		{&response.Users, func() (int64, error) { return s.UserRepository.CountUsers(ctx, dto.CountUsersRequest{}) }},
+		{&response.DisabledUsers, func() (int64, error) {
+			return s.UserRepository.CountUsers(ctx, dto.CountUsersRequest{Disabled: true})
+		}},
+		{&response.NewUsers, func() (int64, error) {
+			return s.UserRepository.CountUsers(ctx, dto.CountUsersRequest{CreatedAfter: &since})
+		}},
+		{&response.Decks, func() (int64, error) { return s.DeckRepository.CountDecks(ctx) }},
+		{&response.Cards, func() (int64, error) { return s.CardRepository.CountCards(ctx, dto.GetCardsRequest{}) }},
+		{&response.Reviews, func() (int64, error) { return s.ReviewLogRepository.CountReviews(ctx, nil) }},
+		{&response.RecentReviews, func() (int64, error) { return s.ReviewLogRepository.CountReviews(ctx, &since) }},
+		{&response.PublishedDecks, func() (int64, error) { return s.PublishedDeckRepository.CountPublishedDecks(ctx, nil) }},
+		{&response.HiddenDecks, func() (int64, error) { return s.PublishedDeckRepository.CountPublishedDecks(ctx, &hidden) }},
+	}
+	for _, count := range counts {
+		value, err := count.count()
+		if err != nil {
+			logger.Error("[AdminGetStatsHandler] Count got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		*count.target = value
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+// getAdminTargetUser returns the user of the id url parameter.
+func (s *Service) getAdminTargetUser(r *http.Request) (*models.User, error) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		return nil, helpers.NewHTTPError(http.StatusBadRequest, err)
+	}
+	user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: id})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("user not found"))
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func toAdminUserItem(user *models.User) dto.AdminUserItem {
+	return dto.AdminUserItem{
+		ID:                  user.ID,
+		Name:                user.Name,
+		Email:               user.Email,
+		Role:                user.Role,
+		EmailVerified:       user.EmailVerifiedAt != nil,
+		HasPassword:         user.Password != nil,
+		TwoFactorEnabled:    user.TwoFactorEnabledAt != nil,
+		DisabledAt:          user.DisabledAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		CreatedAt:           user.CreatedAt,
+	}
+}
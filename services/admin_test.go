@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/mailer"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+type testMailer struct {
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, message mailer.Message) error {
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+// TestAdminResetUserPassword checks a forced reset leaves the user no way in but the mailed link:
+// the password, the sessions and the personal access tokens all stop working.
+func TestAdminResetUserPassword(t *testing.T) {
+	s, store := newTestService(t)
+	templates, err := mailer.LoadTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := &testMailer{}
+	s.Mailer, s.MailTemplates = mail, templates
+	s.Config.AppURL = "https://app.example.com"
+	s.Config.PasswordResetTTLMinutes = 60
+
+	password := "password hash"
+	store.users = []*models.User{{ID: 2, Name: "Lan", Email: "lan@example.com", Password: &password}}
+	store.sessions = []*models.Session{{ID: "session", UserID: 2}}
+	store.accessTokens = []*models.AccessToken{{ID: 1, UserID: 2}, {ID: 2, UserID: 1}}
+
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", "2")
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/users/2/password-reset", nil)
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, routeContext)
+	ctx = context.WithValue(ctx, constant.UserContextKey, models.User{ID: 1, Role: models.UserRoleAdmin})
+	w := httptest.NewRecorder()
+	s.AdminResetUserPasswordHandler(w, r.WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("AdminResetUserPasswordHandler() status = %d, body %s", w.Code, w.Body)
+	}
+
+	if store.users[0].Password != nil {
+		t.Errorf("password was not cleared")
+	}
+	if store.sessions[0].RevokedAt == nil {
+		t.Errorf("session was not revoked")
+	}
+	if len(store.accessTokens) != 1 || store.accessTokens[0].UserID != 1 {
+		t.Errorf("access tokens left = %v, want only the one of another user", store.accessTokens)
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "lan@example.com" || !strings.Contains(mail.sent[0].Body, "/reset-password?token=") {
+		t.Errorf("sent = %+v, want a reset link mailed to the user", mail.sent)
+	}
+}
@@ -0,0 +1,520 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrgThang/flashcard-be/anki"
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	jobTypeAnkiImport = "anki_import"
+
+	ankiDefaultDeckName = "Default"
+	minEasinessFactor   = 1.3
+	ankiStartingFactor  = 2.5
+)
+
+func (s *Service) ImportAnkiHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ImportAnkiHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	path, err := s.saveUpload(w, r, user.ID, ".apkg")
+	if err != nil {
+		logger.Error("[ImportAnkiHandler] Save upload got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := s.startJob(r.Context(), user.ID, jobTypeAnkiImport, func(ctx context.Context, progress *jobProgress) (any, error) {
+		defer os.Remove(path)
+		return s.importAnkiPackage(ctx, user.ID, path, progress)
+	})
+	if err != nil {
+		os.Remove(path)
+		logger.Error("[ImportAnkiHandler] Start job got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusAccepted, s.parseJobItem(job))
+}
+
+// importAnkiPackage maps the decks, cards, scheduling state, review history and media
+// of an .apkg into the user's account.
+func (s *Service) importAnkiPackage(ctx context.Context, userID int32, path string, progress *jobProgress) (*dto.ImportSummary, error) {
+	pkg, err := anki.Open(path, s.Config.MaxUnpackedSizeMB<<20)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+	collection := pkg.Collection
+
+	summary := &dto.ImportSummary{Skipped: []dto.SkippedItem{}}
+	progress.SetTotal(len(pkg.Media) + len(collection.Cards))
+
+	for filename := range pkg.Media {
+		if err := s.importAnkiMedia(ctx, userID, pkg, filename); err != nil {
+			skip(summary, "media", filename, err.Error())
+		} else {
+			summary.Media++
+		}
+		progress.Advance(1)
+	}
+
+	decks, err := s.newDeckPathResolver(ctx, userID)
+	if err != nil {
+		return summary, err
+	}
+	for start := 0; start < len(collection.Cards); start += importBatchSize {
+		end := min(start+importBatchSize, len(collection.Cards))
+		if err := s.importAnkiCards(ctx, userID, collection, collection.Cards[start:end], decks, summary); err != nil {
+			return summary, err
+		}
+		progress.Advance(end - start)
+	}
+	summary.Decks = decks.created
+	return summary, nil
+}
+
+func (s *Service) importAnkiMedia(ctx context.Context, userID int32, pkg *anki.Package, filename string) error {
+	content, err := pkg.OpenMedia(filename)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	return s.storeMedia(ctx, userID, filename, content)
+}
+
+func (s *Service) importAnkiCards(ctx context.Context, userID int32, collection *anki.Collection, ankiCards []*anki.Card, decks *deckPathResolver, summary *dto.ImportSummary) error {
+	cards := make([]*models.Card, 0, len(ankiCards))
+	sources := make([]*anki.Card, 0, len(ankiCards))
+	for _, ankiCard := range ankiCards {
+		card, err := s.parseAnkiCard(ctx, userID, collection, ankiCard, decks)
+		if err != nil {
+			skip(summary, "card", strconv.FormatInt(ankiCard.ID, 10), err.Error())
+			continue
+		}
+		cards = append(cards, card)
+		sources = append(sources, ankiCard)
+	}
+	if len(cards) == 0 {
+		return nil
+	}
+	if err := s.CardRepository.CreateCards(ctx, cards); err != nil {
+		return err
+	}
+	summary.Cards += len(cards)
+
+	var reviewLogs []*models.ReviewLog
+	for index, card := range cards {
+		reviewLogs = append(reviewLogs, parseAnkiRevlog(card, collection.Revlog[sources[index].ID])...)
+	}
+	if len(reviewLogs) == 0 {
+		return nil
+	}
+	if err := s.ReviewLogRepository.CreateReviewLogs(ctx, reviewLogs); err != nil {
+		return err
+	}
+	summary.Reviews += len(reviewLogs)
+	return nil
+}
+
+func (s *Service) parseAnkiCard(ctx context.Context, userID int32, collection *anki.Collection, ankiCard *anki.Card, decks *deckPathResolver) (*models.Card, error) {
+	note, ok := collection.Notes[ankiCard.NoteID]
+	if !ok {
+		return nil, fmt.Errorf("note %d not found", ankiCard.NoteID)
+	}
+	model, ok := collection.Models[note.ModelID]
+	if !ok {
+		return nil, fmt.Errorf("note type %d not found", note.ModelID)
+	}
+
+	// cards in a filtered deck are imported into the deck they came from
+	ankiDeckID := ankiCard.DeckID
+	if ankiCard.OriginalDeckID != 0 {
+		ankiDeckID = ankiCard.OriginalDeckID
+	}
+	deckName := ankiDefaultDeckName
+	if ankiDeck, ok := collection.Decks[ankiDeckID]; ok && ankiDeck.Name != "" {
+		deckName = ankiDeck.Name
+	}
+
+	front, back, err := anki.Render(model, note, ankiCard.Ord, deckName)
+	if err != nil {
+		return nil, err
+	}
+	if anki.StripHTML(front) == "" && !anki.ContainsMedia(front) {
+		return nil, fmt.Errorf("card has an empty front")
+	}
+
+	deckID, err := decks.resolve(ctx, deckName)
+	if err != nil {
+		return nil, fmt.Errorf("resolve deck %q: %w", deckName, err)
+	}
+
+	card := &models.Card{
+		Front:  front,
+		Back:   back,
+		Tags:   helpers.JoinTags(note.Tags),
+		DeckID: deckID,
+		UserID: userID,
+	}
+	parseAnkiScheduling(collection, ankiCard, collection.Revlog[ankiCard.ID], card)
+	return card, nil
+}
+
+// parseAnkiScheduling converts the Anki scheduling state of a card into SM-2 terms:
+// the ease factor is stored in permille, review due dates are days since the collection
+// was created and learning due dates are epoch seconds.
+func parseAnkiScheduling(collection *anki.Collection, ankiCard *anki.Card, revlogs []*anki.Revlog, card *models.Card) {
+	card.EasinessFactor = ankiStartingFactor
+	card.StudyTime = time.Now()
+	if ankiCard.Type == anki.CardTypeNew {
+		return
+	}
+
+	if ankiCard.Factor > 0 {
+		card.EasinessFactor = max(float32(ankiCard.Factor)/1000, minEasinessFactor)
+	}
+	if ankiCard.Interval > 0 {
+		card.IntervalNumber = int32(ankiCard.Interval)
+	}
+
+	switch {
+	case ankiCard.Queue == anki.QueueLearning || ankiCard.Due > 1_000_000_000:
+		card.StudyTime = time.Unix(ankiCard.Due, 0)
+	default:
+		card.StudyTime = collection.Created.AddDate(0, 0, int(ankiCard.Due))
+	}
+
+	// SM-2 only grows the interval from the third successful repetition on,
+	// so graduated cards keep growing instead of restarting at one day
+	var streak int32
+	for _, revlog := range revlogs {
+		if revlog.Ease == 0 || revlog.Type == anki.RevlogTypeManual {
+			continue
+		}
+		if revlog.Ease == 1 {
+			streak = 0
+		} else {
+			streak++
+		}
+	}
+	switch ankiCard.Type {
+	case anki.CardTypeReview:
+		card.RepetitionNumber = max(streak, 2)
+	case anki.CardTypeLearning:
+		if streak > 0 || ankiCard.Interval > 0 {
+			card.RepetitionNumber = 1
+		}
+	}
+}
+
+func parseAnkiRevlog(card *models.Card, revlogs []*anki.Revlog) []*models.ReviewLog {
+	reviewLogs := make([]*models.ReviewLog, 0, len(revlogs))
+	var repetitionNumber int32
+	for _, revlog := range revlogs {
+		if revlog.Ease == 0 || revlog.Type == anki.RevlogTypeManual {
+			continue
+		}
+		quality := ankiEaseToQuality(revlog.Ease)
+		if quality < 3 {
+			repetitionNumber = 0
+		} else {
+			repetitionNumber++
+		}
+		easinessFactor := card.EasinessFactor
+		if revlog.Factor > 0 {
+			easinessFactor = max(float32(revlog.Factor)/1000, minEasinessFactor)
+		}
+		reviewLogs = append(reviewLogs, &models.ReviewLog{
+			CardID:           card.ID,
+			UserID:           card.UserID,
+			Quality:          quality,
+			EasinessFactor:   easinessFactor,
+			RepetitionNumber: repetitionNumber,
+			IntervalNumber:   int32(max(revlog.Interval, 0)),
+			ReviewedAt:       revlog.ReviewedAt(),
+		})
+	}
+	return reviewLogs
+}
+
+// ankiEaseToQuality maps the Anki answer buttons (again, hard, good, easy) to SM-2 qualities.
+func ankiEaseToQuality(ease int) int32 {
+	switch ease {
+	case 1:
+		return 1
+	case 2:
+		return 3
+	case 3:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func (s *Service) ExportAnkiHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ExportAnkiHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	var deckID int32
+	if deckIDStr := r.URL.Query().Get("deckId"); deckIDStr != "" {
+		id, err := strconv.Atoi(deckIDStr)
+		if err != nil || id <= 0 {
+			logger.Error("[ExportAnkiHandler] Invalid deckId", zap.String("deckId", deckIDStr))
+			helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid deckId"))
+			return
+		}
+		deckID = int32(id)
+	}
+
+	// the package is built in a temporary file first so that errors can still be answered as json
+	file, err := os.CreateTemp("", "export-*.apkg")
+	if err != nil {
+		logger.Error("[ExportAnkiHandler] Create temp file got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	filename, err := s.ExportAnki(r.Context(), user, deckID, file)
+	if err != nil {
+		logger.Error("[ExportAnkiHandler] ExportAnki got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		logger.Error("[ExportAnkiHandler] Seek temp file got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		logger.Error("[ExportAnkiHandler] Write package got error", zap.Error(err))
+	}
+}
+
+// ExportAnki writes the cards of a deck and its subdecks, or of the whole account when deckID is 0,
+// with their scheduling state, tags, review history and media as an .apkg to out.
+// It returns a file name for the package.
+func (s *Service) ExportAnki(ctx context.Context, user models.User, deckID int32, out io.Writer) (string, error) {
+	userDecks, err := s.DeckRepository.GetDecksByUser(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	filename := "flashcards.apkg"
+	getCardsReq := dto.GetCardsRequest{UserID: user.ID}
+	exportedDecks := userDecks
+	if deckID != 0 {
+		// the package carries the review history and media of the owner
+		if _, err := s.authorizeDeck(ctx, user, deckID, models.DeckRoleOwner); err != nil {
+			return "", err
+		}
+		getCardsReq.DeckIDs = helpers.DeckSubtreeIDs(userDecks, deckID)
+		exportedDecks = slices.DeleteFunc(slices.Clone(userDecks), func(deck *models.DeckWithStats) bool {
+			return !slices.Contains(getCardsReq.DeckIDs, deck.ID)
+		})
+		filename = helpers.DeckPath(userDecks, deckID) + ".apkg"
+	}
+
+	cards, err := s.CardRepository.GetAllCards(ctx, getCardsReq)
+	if err != nil {
+		return "", err
+	}
+	reviewLogs, err := s.getReviewLogsByCards(ctx, cards)
+	if err != nil {
+		return "", err
+	}
+
+	created := user.CreatedAt.UTC().Truncate(24 * time.Hour)
+	collection := s.parseAnkiCollection(created, userDecks, exportedDecks, cards, reviewLogs)
+
+	var media []anki.MediaFile
+	seen := map[string]bool{}
+	for _, card := range cards {
+		for _, name := range append(anki.MediaReferences(card.Front), anki.MediaReferences(card.Back)...) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if _, err := s.MediaRepository.GetMedia(ctx, user.ID, name); err != nil {
+				continue
+			}
+			path := s.mediaPath(user.ID, name)
+			media = append(media, anki.MediaFile{
+				Name: name,
+				Open: func() (io.ReadCloser, error) { return os.Open(path) },
+			})
+		}
+	}
+
+	return filename, anki.Write(out, collection, media)
+}
+
+func (s *Service) getReviewLogsByCards(ctx context.Context, cards []*models.Card) (map[int32][]*models.ReviewLog, error) {
+	reviewLogs := make(map[int32][]*models.ReviewLog, len(cards))
+	for start := 0; start < len(cards); start += importBatchSize {
+		end := min(start+importBatchSize, len(cards))
+		ids := make([]int32, 0, end-start)
+		for _, card := range cards[start:end] {
+			ids = append(ids, card.ID)
+		}
+		logs, err := s.ReviewLogRepository.GetReviewLogsByCards(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			reviewLogs[log.CardID] = append(reviewLogs[log.CardID], log)
+		}
+	}
+	return reviewLogs, nil
+}
+
+// parseAnkiCollection maps cards to notes of the Basic note type, the reverse of parseAnkiScheduling
+// and parseAnkiRevlog, so that an exported package imports back into the same state.
+func (s *Service) parseAnkiCollection(created time.Time, userDecks []*models.DeckWithStats, exportedDecks []*models.DeckWithStats, cards []*models.Card, reviewLogs map[int32][]*models.ReviewLog) *anki.Collection {
+	// Anki ids are epoch milliseconds, they only have to be unique within the package
+	idBase := time.Now().UnixMilli()
+	model := anki.BasicModel(idBase)
+	collection := &anki.Collection{
+		Created: created,
+		Models:  map[int64]*anki.Model{model.ID: model},
+		Decks:   make(map[int64]*anki.Deck, len(exportedDecks)),
+		Notes:   make(map[int64]*anki.Note, len(cards)),
+		Revlog:  map[int64][]*anki.Revlog{},
+	}
+	deckIDs := make(map[int32]int64, len(exportedDecks))
+	paths := helpers.DeckPaths(userDecks)
+	for _, deck := range exportedDecks {
+		ankiDeckID := idBase + int64(deck.ID)
+		deckIDs[deck.ID] = ankiDeckID
+		collection.Decks[ankiDeckID] = &anki.Deck{ID: ankiDeckID, Name: paths[deck.ID]}
+	}
+
+	revlogIDs := map[int64]bool{}
+	for index, card := range cards {
+		id := idBase + int64(index) + 1
+		collection.Notes[id] = &anki.Note{
+			ID:      id,
+			GUID:    ankiGUID(card),
+			ModelID: model.ID,
+			Tags:    helpers.SplitTags(card.Tags),
+			Fields:  []string{card.Front, card.Back},
+		}
+		ankiCard := &anki.Card{
+			ID:     id,
+			NoteID: id,
+			DeckID: deckIDs[card.DeckID],
+		}
+		logs := reviewLogs[card.ID]
+		parseAnkiCardScheduling(created, card, logs, index, ankiCard)
+		collection.Cards = append(collection.Cards, ankiCard)
+
+		var lastInterval int64
+		for _, log := range logs {
+			revlogID := log.ReviewedAt.UnixMilli()
+			for revlogIDs[revlogID] {
+				revlogID++
+			}
+			revlogIDs[revlogID] = true
+			revlogType := anki.RevlogTypeReview
+			if lastInterval == 0 {
+				revlogType = anki.RevlogTypeLearn
+			}
+			collection.Revlog[id] = append(collection.Revlog[id], &anki.Revlog{
+				ID:           revlogID,
+				CardID:       id,
+				Ease:         qualityToAnkiEase(log.Quality),
+				Interval:     int64(log.IntervalNumber),
+				LastInterval: lastInterval,
+				Factor:       int64(math.Round(float64(log.EasinessFactor) * 1000)),
+				Type:         revlogType,
+			})
+			lastInterval = int64(log.IntervalNumber)
+		}
+	}
+	return collection
+}
+
+// parseAnkiCardScheduling stores the SM-2 state of a card in Anki terms: cards that passed twice
+// are review cards, cards that passed once are learning cards and failed cards are relearning.
+func parseAnkiCardScheduling(created time.Time, card *models.Card, reviewLogs []*models.ReviewLog, position int, ankiCard *anki.Card) {
+	ankiCard.Reps = int64(len(reviewLogs))
+	for _, log := range reviewLogs {
+		if log.Quality < 3 {
+			ankiCard.Lapses++
+		}
+	}
+	if card.RepetitionNumber == 0 && card.IntervalNumber == 0 {
+		ankiCard.Type = anki.CardTypeNew
+		ankiCard.Queue = anki.QueueNew
+		ankiCard.Due = int64(position) + 1
+		return
+	}
+
+	ankiCard.Interval = int64(card.IntervalNumber)
+	ankiCard.Factor = int64(math.Round(float64(card.EasinessFactor) * 1000))
+	ankiCard.Due = max(int64(card.StudyTime.Sub(created)/(24*time.Hour)), 0)
+	switch {
+	case card.RepetitionNumber >= 2:
+		ankiCard.Type = anki.CardTypeReview
+		ankiCard.Queue = anki.QueueReview
+	case card.RepetitionNumber == 1:
+		ankiCard.Type = anki.CardTypeLearning
+		ankiCard.Queue = anki.QueueDayLearn
+		ankiCard.Left = 1001
+	default:
+		ankiCard.Type = anki.CardTypeRelearning
+		ankiCard.Queue = anki.QueueDayLearn
+		ankiCard.Left = 1001
+	}
+}
+
+// ankiGUID derives a stable note guid from the card so that re-exports update the same Anki notes.
+func ankiGUID(card *models.Card) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("flashcard-be:%d:%d", card.UserID, card.ID)))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:10]
+}
+
+func qualityToAnkiEase(quality int32) int {
+	switch {
+	case quality < 3:
+		return 1
+	case quality == 3:
+		return 2
+	case quality == 4:
+		return 3
+	default:
+		return 4
+	}
+}
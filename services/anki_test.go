@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrgThang/flashcard-be/anki"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// TestAnkiRoundTrip exports cards as an .apkg and imports the package back the way
+// importAnkiPackage does, the content, scheduling and review history must survive.
+func TestAnkiRoundTrip(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	parentID := int32(1)
+	userDecks := []*models.DeckWithStats{
+		{Deck: models.Deck{ID: 1, Name: "Japanese"}},
+		{Deck: models.Deck{ID: 2, Name: "JLPT N5", ParentID: &parentID}},
+	}
+	reviewedAt := time.Date(2024, 3, 1, 9, 30, 0, 123_000_000, time.UTC)
+	cards := []*models.Card{
+		{
+			ID: 10, DeckID: 1, UserID: 7,
+			Front: `猫 <img src="cat.png">`, Back: "cat", Tags: "animal jlpt-n5",
+			EasinessFactor: 2.5,
+		},
+		{
+			ID: 11, DeckID: 2, UserID: 7,
+			Front: "犬", Back: "dog", Tags: "animal",
+			EasinessFactor: 2.36, RepetitionNumber: 3, IntervalNumber: 15,
+			StudyTime: created.AddDate(0, 0, 80).Add(10 * time.Hour),
+		},
+		{
+			ID: 12, DeckID: 2, UserID: 7,
+			Front: "鳥", Back: "bird",
+			EasinessFactor: 2.5, RepetitionNumber: 1, IntervalNumber: 1,
+			StudyTime: created.AddDate(0, 0, 70),
+		},
+	}
+	reviewLogs := map[int32][]*models.ReviewLog{
+		11: {
+			{CardID: 11, Quality: 4, EasinessFactor: 2.5, RepetitionNumber: 1, IntervalNumber: 1, ReviewedAt: reviewedAt},
+			{CardID: 11, Quality: 1, EasinessFactor: 2.3, RepetitionNumber: 0, IntervalNumber: 1, ReviewedAt: reviewedAt.Add(24 * time.Hour)},
+			{CardID: 11, Quality: 5, EasinessFactor: 2.4, RepetitionNumber: 1, IntervalNumber: 1, ReviewedAt: reviewedAt.Add(48 * time.Hour)},
+			{CardID: 11, Quality: 4, EasinessFactor: 2.4, RepetitionNumber: 2, IntervalNumber: 6, ReviewedAt: reviewedAt.Add(72 * time.Hour)},
+			{CardID: 11, Quality: 4, EasinessFactor: 2.36, RepetitionNumber: 3, IntervalNumber: 15, ReviewedAt: reviewedAt.Add(144 * time.Hour)},
+		},
+		12: {
+			{CardID: 12, Quality: 4, EasinessFactor: 2.5, RepetitionNumber: 1, IntervalNumber: 1, ReviewedAt: reviewedAt.Add(time.Hour)},
+		},
+	}
+	mediaContent := []byte("\x89PNG not really")
+
+	s := &Service{}
+	collection := s.parseAnkiCollection(created, userDecks, userDecks, cards, reviewLogs)
+	var buffer bytes.Buffer
+	media := []anki.MediaFile{{
+		Name: "cat.png",
+		Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(mediaContent)), nil },
+	}}
+	if err := anki.Write(&buffer, collection, media); err != nil {
+		t.Fatalf("anki.Write() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "export.apkg")
+	if err := os.WriteFile(path, buffer.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, err := anki.Open(path, 1<<20)
+	if err != nil {
+		t.Fatalf("anki.Open() error = %v", err)
+	}
+	defer pkg.Close()
+
+	content, err := pkg.OpenMedia("cat.png")
+	if err != nil {
+		t.Fatalf("OpenMedia() error = %v", err)
+	}
+	got, err := io.ReadAll(content)
+	content.Close()
+	if err != nil || !bytes.Equal(got, mediaContent) {
+		t.Errorf("media content = %q, %v, want %q", got, err, mediaContent)
+	}
+
+	imported := pkg.Collection
+	if !imported.Created.Equal(created) {
+		t.Errorf("Created = %v, want %v", imported.Created, created)
+	}
+	if len(imported.Cards) != len(cards) {
+		t.Fatalf("got %d cards, want %d", len(imported.Cards), len(cards))
+	}
+	for index, ankiCard := range imported.Cards {
+		want := cards[index]
+		note := imported.Notes[ankiCard.NoteID]
+		model := imported.Models[note.ModelID]
+		deck := imported.Decks[ankiCard.DeckID]
+		if deck == nil || deck.Name != helpers.DeckPath(userDecks, want.DeckID) {
+			t.Errorf("card %d: deck = %v, want %q", want.ID, deck, helpers.DeckPath(userDecks, want.DeckID))
+			continue
+		}
+		front, back, err := anki.Render(model, note, ankiCard.Ord, deck.Name)
+		if err != nil {
+			t.Fatalf("card %d: Render() error = %v", want.ID, err)
+		}
+		if front != want.Front || back != want.Back {
+			t.Errorf("card %d: content = %q / %q, want %q / %q", want.ID, front, back, want.Front, want.Back)
+		}
+		if tags := helpers.JoinTags(note.Tags); tags != want.Tags {
+			t.Errorf("card %d: tags = %q, want %q", want.ID, tags, want.Tags)
+		}
+
+		card := &models.Card{ID: want.ID, UserID: want.UserID}
+		revlogs := imported.Revlog[ankiCard.ID]
+		parseAnkiScheduling(imported, ankiCard, revlogs, card)
+		if card.RepetitionNumber != want.RepetitionNumber || card.IntervalNumber != want.IntervalNumber {
+			t.Errorf("card %d: repetition, interval = %d, %d, want %d, %d", want.ID,
+				card.RepetitionNumber, card.IntervalNumber, want.RepetitionNumber, want.IntervalNumber)
+		}
+		if math.Abs(float64(card.EasinessFactor-want.EasinessFactor)) > 1e-3 {
+			t.Errorf("card %d: easiness factor = %v, want %v", want.ID, card.EasinessFactor, want.EasinessFactor)
+		}
+		// due dates are stored as days since the collection was created
+		if want.RepetitionNumber > 0 && !card.StudyTime.Equal(want.StudyTime.Truncate(24*time.Hour)) {
+			t.Errorf("card %d: study time = %v, want the day of %v", want.ID, card.StudyTime, want.StudyTime)
+		}
+
+		logs := parseAnkiRevlog(card, revlogs)
+		wantLogs := reviewLogs[want.ID]
+		if len(logs) != len(wantLogs) {
+			t.Errorf("card %d: got %d review logs, want %d", want.ID, len(logs), len(wantLogs))
+			continue
+		}
+		for i, log := range logs {
+			wantLog := wantLogs[i]
+			if log.Quality != wantLog.Quality || log.RepetitionNumber != wantLog.RepetitionNumber ||
+				log.IntervalNumber != wantLog.IntervalNumber || !log.ReviewedAt.Equal(wantLog.ReviewedAt) ||
+				math.Abs(float64(log.EasinessFactor-wantLog.EasinessFactor)) > 1e-3 {
+				t.Errorf("card %d: review log %d = %+v, want %+v", want.ID, i, log, wantLog)
+			}
+		}
+	}
+}
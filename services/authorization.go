@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// deckRoleRanks orders the roles, a role grants everything the lower roles do.
+var deckRoleRanks = map[string]int{
+	models.DeckRoleViewer: 1,
+	models.DeckRoleEditor: 2,
+	models.DeckRoleOwner:  3,
+}
+
+// deckRoleActions names what a role is needed for in permission errors.
+var deckRoleActions = map[string]string{
+	models.DeckRoleViewer: "view",
+	models.DeckRoleEditor: "edit",
+	models.DeckRoleOwner:  "manage",
+}
+
+// deckAccess is what authorizeDeck found out about a deck for a user.
+type deckAccess struct {
+	Deck *models.DeckWithStats
+	Role string
+	// OwnerDecks are all the decks of the owner of Deck, to resolve subtrees and paths.
+	OwnerDecks []*models.DeckWithStats
+}
+
+func (a *deckAccess) IsOwner() bool {
+	return a.Role == models.DeckRoleOwner
+}
+
+// authorizeDeck checks that the user has at least minimumRole on the deck. The owner of a deck has
+// every role, a collaborator has the highest role of their memberships on the deck and its ancestors.
+// The errors are helpers.HTTPError, 404 when the deck does not exist and 403 when the role is too low.
+func (s *Service) authorizeDeck(ctx context.Context, user models.User, deckID int32, minimumRole string, dbs ...*gorm.DB) (*deckAccess, error) {
+	deck, err := s.DeckRepository.GetDetailDeck(ctx, deckID, dbs...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("deck not found"))
+		}
+		return nil, err
+	}
+	ownerDecks, err := s.DeckRepository.GetDecksByUser(ctx, deck.UserID, dbs...)
+	if err != nil {
+		return nil, err
+	}
+	access := &deckAccess{Deck: deck, OwnerDecks: ownerDecks}
+	if deck.UserID == user.ID {
+		access.Role = models.DeckRoleOwner
+	} else {
+		members, err := s.DeckMemberRepository.GetMembersByDecks(ctx, deckAncestorIDs(ownerDecks, deckID), user.ID, dbs...)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if deckRoleRanks[member.Role] > deckRoleRanks[access.Role] {
+				access.Role = member.Role
+			}
+		}
+	}
+	if access.Role == "" {
+		// decks that are not shared with the user are hidden
+		return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("deck not found"))
+	}
+	if deckRoleRanks[access.Role] < deckRoleRanks[minimumRole] {
+		return nil, helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not have permission to %s this deck", deckRoleActions[minimumRole]))
+	}
+	return access, nil
+}
+
+// authorizeCard checks that the user has at least minimumRole on the deck of the card and
+// returns the card with the role the user has on it.
+func (s *Service) authorizeCard(ctx context.Context, user models.User, cardID int32, minimumRole string, dbs ...*gorm.DB) (*models.Card, string, error) {
+	card, err := s.CardRepository.GetDetailCard(ctx, cardID, dbs...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("card not found"))
+		}
+		return nil, "", err
+	}
+	// cards belong to the owner of their deck
+	if card.UserID == user.ID {
+		return card, models.DeckRoleOwner, nil
+	}
+	access, err := s.authorizeDeck(ctx, user, card.DeckID, minimumRole, dbs...)
+	if err != nil {
+		var httpErr *helpers.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Code == http.StatusNotFound {
+			return nil, "", helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("card not found"))
+		}
+		if errors.As(err, &httpErr) && httpErr.Code == http.StatusForbidden {
+			return nil, "", helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not have permission to %s this card", deckRoleActions[minimumRole]))
+		}
+		return nil, "", err
+	}
+	return card, access.Role, nil
+}
+
+// deckAncestorIDs returns the id of the deck followed by the ids of its ancestors.
+func deckAncestorIDs(decks []*models.DeckWithStats, deckID int32) []int32 {
+	parents := make(map[int32]*int32, len(decks))
+	for _, deck := range decks {
+		parents[deck.ID] = deck.ParentID
+	}
+	ids := []int32{deckID}
+	visited := map[int32]bool{deckID: true}
+	for parentID := parents[deckID]; parentID != nil && !visited[*parentID]; parentID = parents[*parentID] {
+		visited[*parentID] = true
+		ids = append(ids, *parentID)
+	}
+	return ids
+}
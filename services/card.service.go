@@ -1,13 +1,18 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/mrgThang/flashcard-be/constant"
 	"github.com/mrgThang/flashcard-be/dto"
@@ -16,6 +21,12 @@ import (
 	"github.com/mrgThang/flashcard-be/models"
 )
 
+// defaultEasinessFactor is the easiness factor of a card that was never studied.
+const defaultEasinessFactor = 2.5
+
+// maxTypedAnswerLength bounds the typed answers compared with the back of a card.
+const maxTypedAnswerLength = 1000
+
 func (s *Service) GetCardsHandler(w http.ResponseWriter, r *http.Request) {
 	req, err := s.parseGetCardsRequest(r)
 	if err != nil {
@@ -32,14 +43,53 @@ func (s *Service) GetCardsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	req.UserID = user.ID
-	cards, totalItems, err := s.CardRepository.GetCards(r.Context(), *req)
+	ownerID := user.ID
+	var ownerDecks []*models.DeckWithStats
+	if req.DeckID != 0 {
+		access, err := s.authorizeDeck(r.Context(), user, req.DeckID, models.DeckRoleViewer)
+		if err != nil {
+			logger.Error("[GetCardsHandler] Authorize deck got error", zap.Int32("deckId", req.DeckID), zap.Int32("userId", user.ID), zap.Error(err))
+			helpers.WriteError(w, err)
+			return
+		}
+		// studying or browsing a parent deck includes the cards of all of its descendants
+		req.DeckIDs = helpers.DeckSubtreeIDs(access.OwnerDecks, req.DeckID)
+		if !access.IsOwner() {
+			// collaborators study shared cards on their own schedule
+			req.UserID = 0
+			req.ProgressUserID = user.ID
+		}
+		ownerID = access.Deck.UserID
+		ownerDecks = access.OwnerDecks
+	} else {
+		ownerDecks, err = s.DeckRepository.GetDecksByUser(r.Context(), user.ID)
+		if err != nil {
+			logger.Error("[GetCardsHandler] DeckRepository.GetDecksByUser got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	deckPresets, err := s.getDeckPresets(r.Context(), ownerID, ownerDecks)
+	if err != nil {
+		logger.Error("[GetCardsHandler] Get deck presets got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var cards []*models.Card
+	var totalItems int64
+	if preset := deckPresets[req.DeckID]; preset != nil && req.StudyTimeTo != nil {
+		cards, totalItems, err = s.getStudyCards(r.Context(), *req, user.ID, preset)
+	} else {
+		cards, totalItems, err = s.CardRepository.GetCards(r.Context(), *req)
+	}
 	if err != nil {
 		logger.Error("[GetCardsHandler] CardRepository.GetCards", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	response := s.parseGetCardsResponse(cards, dto.Pagination{
+	response := s.parseGetCardsResponse(cards, deckPresets, dto.Pagination{
 		Page:       req.Page,
 		PageSize:   req.PageSize,
 		TotalItems: totalItems,
@@ -98,23 +148,82 @@ func (s *Service) parseGetCardsRequest(r *http.Request) (*dto.GetCardsRequest, e
 	return &req, nil
 }
 
-func (s *Service) parseGetCardsResponse(cards []*models.Card, pagination dto.Pagination) dto.GetCardsResponse {
+// getStudyCards returns the due cards of a deck within the daily limits of its preset, the reviews
+// first and then the new cards. The cards the user studied since midnight count against the limits.
+func (s *Service) getStudyCards(ctx context.Context, req dto.GetCardsRequest, userID int32, preset *models.DeckPreset) ([]*models.Card, int64, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	newStudied, reviewsStudied, err := s.ReviewLogRepository.CountStudiedSince(ctx, userID, req.DeckIDs, midnight)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	isNew := false
+	reviewsReq := req
+	reviewsReq.New, reviewsReq.ReviewerID = &isNew, userID
+	dueReviews, err := s.CardRepository.CountCards(ctx, reviewsReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	isNew = true
+	newReq := req
+	newReq.New, newReq.ReviewerID = &isNew, userID
+	dueNew, err := s.CardRepository.CountCards(ctx, newReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	reviewsLeft := min(dueReviews, max(int64(preset.ReviewsPerDay)-reviewsStudied, 0))
+	newLeft := min(dueNew, max(int64(preset.NewPerDay)-newStudied, 0))
+
+	offset := int64(constant.DefaultOffset)
+	if req.Page > 0 {
+		offset = int64((req.Page - 1) * req.PageSize)
+	}
+	limit := int64(constant.DefaultLimit)
+	if req.PageSize > 0 {
+		limit = int64(req.PageSize)
+	}
+
+	var cards []*models.Card
+	if offset < reviewsLeft {
+		reviewsReq.Offset = int(offset)
+		reviewsReq.Limit = int(min(limit, reviewsLeft-offset))
+		cards, err = s.CardRepository.GetAllCards(ctx, reviewsReq)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	newOffset := max(offset-reviewsLeft, 0)
+	if newLimit := min(limit-int64(len(cards)), newLeft-newOffset); newLimit > 0 {
+		newReq.Offset = int(newOffset)
+		newReq.Limit = int(newLimit)
+		newCards, err := s.CardRepository.GetAllCards(ctx, newReq)
+		if err != nil {
+			return nil, 0, err
+		}
+		cards = append(cards, newCards...)
+	}
+	return cards, reviewsLeft + newLeft, nil
+}
+
+func (s *Service) parseGetCardsResponse(cards []*models.Card, deckPresets map[int32]*models.DeckPreset, pagination dto.Pagination) dto.GetCardsResponse {
 	cardItems := make([]dto.CardItem, len(cards))
 	for index, card := range cards {
-		ef := card.EasinessFactor
-		n := card.RepetitionNumber
-		i := card.IntervalNumber
-		_, _, _, first := helpers.ExecuteSm2Algo(1, ef, n, i)
-		_, _, _, second := helpers.ExecuteSm2Algo(2, ef, n, i)
-		_, _, _, third := helpers.ExecuteSm2Algo(3, ef, n, i)
-		_, _, _, fourth := helpers.ExecuteSm2Algo(4, ef, n, i)
-		estimatedTime := []int32{first, second, third, fourth}
+		params := presetSchedulerParams(deckPresets[card.DeckID])
+		state := cardSchedule(card)
+		estimatedTime := make([]int32, 0, 4)
+		for q := int32(1); q <= 4; q++ {
+			_, delay := helpers.ScheduleCard(q, state, params)
+			estimatedTime = append(estimatedTime, int32(delay/(24*time.Hour)))
+		}
 
 		cardItems[index] = dto.CardItem{
 			ID:            card.ID,
 			Front:         card.Front,
 			Back:          card.Back,
 			DeckID:        card.DeckID,
+			Tags:          helpers.SplitTags(card.Tags),
+			TypeAnswer:    card.TypeAnswer,
 			EstimatedTime: estimatedTime,
 		}
 	}
@@ -139,24 +248,15 @@ func (s *Service) CreateCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := s.DeckRepository.GetDetailDeck(r.Context(), req.DeckID)
+	access, err := s.authorizeDeck(r.Context(), user, req.DeckID, models.DeckRoleEditor)
 	if err != nil {
-		logger.Error("[CreateCardHandler] DeckRepository.GetDetailDeck", zap.Error(err))
-		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
-		return
-	}
-	if deck == nil {
-		logger.Error("[CreateCardHandler] Deck not found", zap.Int32("deckId", req.DeckID))
-		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck not found"))
-		return
-	}
-	if deck.UserID != user.ID {
-		logger.Error("[CreateCardHandler] User does not have permission to create card in this deck", zap.Int32("deckId", req.DeckID), zap.Int32("userId", req.UserID))
-		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("user does not have permission to create card in this deck"))
+		logger.Error("[CreateCardHandler] Authorize deck got error", zap.Int32("deckId", req.DeckID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
 		return
 	}
 
-	req.UserID = user.ID
+	// cards belong to the owner of their deck, whoever created them
+	req.UserID = access.Deck.UserID
 	err = s.CardRepository.CreateCard(r.Context(), *req)
 	if err != nil {
 		logger.Error("[CreateCardHandler] CardRepository.CreateCard", zap.Error(err))
@@ -203,29 +303,32 @@ func (s *Service) UpdateCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	card, err := s.CardRepository.GetDetailCard(r.Context(), req.ID)
+	card, _, err := s.authorizeCard(r.Context(), user, req.ID, models.DeckRoleEditor)
 	if err != nil {
-		logger.Error("[UpdateCardHandler] CardRepository.GetDetailCard", zap.Error(err))
-		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		logger.Error("[UpdateCardHandler] Authorize card got error", zap.Int32("cardId", req.ID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
 		return
 	}
-	if card == nil {
-		logger.Error("[UpdateCardHandler] Card not found", zap.Int32("cardId", req.ID))
-		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("card not found"))
-		return
-	}
-	if card.UserID != user.ID {
-		logger.Error("[UpdateCardHandler] User does not have permission to update this card", zap.Int32("cardId", req.ID), zap.Int32("userId", user.ID))
-		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("user does not have permission to update this card"))
-		return
-	}
-
-	card.Front = req.Front
-	card.Back = req.Back
 
-	err = s.CardRepository.UpdateFullCard(card)
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if req.TypeAnswer != nil && *req.TypeAnswer != card.TypeAnswer {
+			card.TypeAnswer = *req.TypeAnswer
+			if err := s.CardRepository.UpdateFullCard(card, tx); err != nil {
+				return err
+			}
+		}
+		front, back := card.Front, card.Back
+		if req.Front != nil {
+			front = *req.Front
+		}
+		if req.Back != nil {
+			back = *req.Back
+		}
+		_, err := s.updateCardContent(r.Context(), tx, card, user.ID, front, back, card.Tags)
+		return err
+	})
 	if err != nil {
-		logger.Error("[UpdateCardHandler] CardRepository.UpdateFullCard", zap.Error(err))
+		logger.Error("[UpdateCardHandler] Update card content got error", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -242,9 +345,28 @@ func (s *Service) parseUpdateCardRequest(r *http.Request) (*dto.UpdateCardReques
 		logger.Error("[parseUpdateCardRequest] ID is required")
 		return nil, fmt.Errorf("id is required")
 	}
+	if req.Front != nil && *req.Front == "" {
+		logger.Error("[parseUpdateCardRequest] Front is empty")
+		return nil, fmt.Errorf("front can not be empty")
+	}
+	if req.Back != nil && *req.Back == "" {
+		logger.Error("[parseUpdateCardRequest] Back is empty")
+		return nil, fmt.Errorf("back can not be empty")
+	}
 	return &req, nil
 }
 
+// setCardContent changes the front, back and tags of the card, and bumps its content version
+// when one of them differs. It reports whether the card changed.
+func (s *Service) setCardContent(card *models.Card, front string, back string, tags string) bool {
+	if card.Front == front && card.Back == back && card.Tags == tags {
+		return false
+	}
+	card.Front, card.Back, card.Tags = front, back, tags
+	card.ContentVersion++
+	return true
+}
+
 func (s *Service) StudyCardHandler(w http.ResponseWriter, r *http.Request) {
 	req, err := s.parseStudyCardRequest(r)
 	if err != nil {
@@ -260,28 +382,61 @@ func (s *Service) StudyCardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	card, err := s.CardRepository.GetDetailCard(r.Context(), req.CardId)
+	card, role, err := s.authorizeCard(r.Context(), user, req.CardId, models.DeckRoleViewer)
 	if err != nil {
-		logger.Error("[StudyCardHandler] CardRepository.GetDetailCard", zap.Error(err))
-		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		logger.Error("[StudyCardHandler] Authorize card got error", zap.Int32("cardId", req.CardId), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
 		return
 	}
-	if card == nil {
-		logger.Error("[StudyCardHandler] Card not found", zap.Int32("cardId", req.CardId))
-		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("card not found"))
-		return
+
+	var progress *models.CardProgress
+	if role != models.DeckRoleOwner {
+		// collaborators keep their own scheduling state, the one of the card is the owner's
+		progress, err = s.getCardProgress(r, card.ID, user.ID)
+		if err != nil {
+			logger.Error("[StudyCardHandler] Get card progress got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		card.EasinessFactor = progress.EasinessFactor
+		card.RepetitionNumber = progress.RepetitionNumber
+		card.IntervalNumber = progress.IntervalNumber
+		card.LearningStep = progress.LearningStep
 	}
-	if card.UserID != user.ID {
-		logger.Error("[StudyCardHandler] User does not have permission to study this card", zap.Int32("cardId", req.CardId), zap.Int32("userId", user.ID))
-		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("user does not have permission to study this card"))
+
+	params, err := s.getCardSchedulerParams(r.Context(), card)
+	if err != nil {
+		logger.Error("[StudyCardHandler] Get scheduler params got error", zap.Int32("cardId", card.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
-
-	s.updateCardWithSm2Algorithm(card, req.QualityOfResponse)
-
-	err = s.CardRepository.UpdateFullCard(card)
+	s.scheduleCard(card, req.QualityOfResponse, params)
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if progress != nil {
+			progress.EasinessFactor = card.EasinessFactor
+			progress.RepetitionNumber = card.RepetitionNumber
+			progress.IntervalNumber = card.IntervalNumber
+			progress.LearningStep = card.LearningStep
+			progress.StudyTime = card.StudyTime
+			if err := s.CardProgressRepository.SaveProgress(r.Context(), progress, tx); err != nil {
+				return err
+			}
+		} else if err := s.CardRepository.UpdateFullCard(card, tx); err != nil {
+			return err
+		}
+		return s.ReviewLogRepository.CreateReviewLogs(r.Context(), []*models.ReviewLog{{
+			CardID:           card.ID,
+			UserID:           user.ID,
+			Quality:          req.QualityOfResponse,
+			EasinessFactor:   card.EasinessFactor,
+			RepetitionNumber: card.RepetitionNumber,
+			IntervalNumber:   card.IntervalNumber,
+			ReviewedAt:       time.Now(),
+		}}, tx)
+	})
 	if err != nil {
-		logger.Error("[StudyCardHandler] CardRepository.UpdateFullCard got error", zap.Error(err))
+		logger.Error("[StudyCardHandler] Save study result got error", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
@@ -292,6 +447,91 @@ func (s *Service) StudyCardHandler(w http.ResponseWriter, r *http.Request) {
 	helpers.WriteJSONResponse(w, http.StatusOK, response)
 }
 
+// CheckAnswerHandler compares the answer typed for a card with its back, and suggests the quality
+// of response to study the card with.
+func (s *Service) CheckAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseCheckAnswerRequest(r)
+	if err != nil {
+		logger.Error("[CheckAnswerHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[CheckAnswerHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	card, _, err := s.authorizeCard(r.Context(), user, req.CardID, models.DeckRoleViewer)
+	if err != nil {
+		logger.Error("[CheckAnswerHandler] Authorize card got error", zap.Int32("cardId", req.CardID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if !card.TypeAnswer {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("card does not ask for a typed answer"))
+		return
+	}
+
+	check := helpers.CheckAnswer(req.Answer, card.Back, helpers.AnswerNormalization{
+		IgnoreCase:        *req.IgnoreCase,
+		IgnoreAccents:     *req.IgnoreAccents,
+		IgnorePunctuation: *req.IgnorePunctuation,
+	})
+	diff := make([]dto.AnswerDiffSegment, len(check.Diff))
+	for index, segment := range check.Diff {
+		diff[index] = dto.AnswerDiffSegment{Op: segment.Op, Text: segment.Text}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.CheckAnswerResponse{
+		CardID:                     card.ID,
+		Expected:                   check.Expected,
+		Alternatives:               check.Alternatives,
+		Correct:                    check.Correct,
+		Distance:                   check.Distance,
+		Similarity:                 check.Similarity,
+		Diff:                       diff,
+		SuggestedQualityOfResponse: check.SuggestedQ,
+	})
+}
+
+func (s *Service) parseCheckAnswerRequest(r *http.Request) (*dto.CheckAnswerRequest, error) {
+	var req dto.CheckAnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseCheckAnswerRequest] Failed to decode request", zap.Error(err))
+		return nil, err
+	}
+	if req.CardID == 0 {
+		logger.Error("[parseCheckAnswerRequest] CardID is required")
+		return nil, fmt.Errorf("cardId is required")
+	}
+	if utf8.RuneCountInString(req.Answer) > maxTypedAnswerLength {
+		return nil, fmt.Errorf("answer must be at most %d characters", maxTypedAnswerLength)
+	}
+	ignore, keep := true, false
+	if req.IgnoreCase == nil {
+		req.IgnoreCase = &ignore
+	}
+	if req.IgnoreAccents == nil {
+		req.IgnoreAccents = &keep
+	}
+	if req.IgnorePunctuation == nil {
+		req.IgnorePunctuation = &ignore
+	}
+	return &req, nil
+}
+
+// getCardProgress returns the progress of the user on the card, a card the user never studied
+// starts from the defaults of a new card.
+func (s *Service) getCardProgress(r *http.Request, cardID int32, userID int32) (*models.CardProgress, error) {
+	progress, err := s.CardProgressRepository.GetProgress(r.Context(), cardID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.CardProgress{CardID: cardID, UserID: userID, EasinessFactor: defaultEasinessFactor}, nil
+	}
+	return progress, err
+}
+
 func (s *Service) parseStudyCardRequest(r *http.Request) (*dto.StudyCardRequest, error) {
 	var req dto.StudyCardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -309,16 +549,256 @@ func (s *Service) parseStudyCardRequest(r *http.Request) (*dto.StudyCardRequest,
 	return &req, nil
 }
 
-func (s *Service) updateCardWithSm2Algorithm(card *models.Card, qualityOfResponse int32) {
-	q := qualityOfResponse
-	ef := card.EasinessFactor
-	n := card.RepetitionNumber
-	i := card.IntervalNumber
+// getCardSchedulerParams returns the scheduler parameters of the preset of the deck of the card.
+func (s *Service) getCardSchedulerParams(ctx context.Context, card *models.Card) (helpers.SchedulerParams, error) {
+	ownerDecks, err := s.DeckRepository.GetDecksByUser(ctx, card.UserID)
+	if err != nil {
+		return helpers.SchedulerParams{}, err
+	}
+	deckPresets, err := s.getDeckPresets(ctx, card.UserID, ownerDecks)
+	if err != nil {
+		return helpers.SchedulerParams{}, err
+	}
+	return presetSchedulerParams(deckPresets[card.DeckID]), nil
+}
+
+func (s *Service) scheduleCard(card *models.Card, qualityOfResponse int32, params helpers.SchedulerParams) {
+	state, delay := helpers.ScheduleCard(qualityOfResponse, cardSchedule(card), params)
+
+	card.EasinessFactor = state.EasinessFactor
+	card.StudyTime = time.Now().Add(delay)
+	card.RepetitionNumber = state.RepetitionNumber
+	card.IntervalNumber = state.IntervalNumber
+	card.LearningStep = state.LearningStep
+}
+
+func cardSchedule(card *models.Card) helpers.CardSchedule {
+	return helpers.CardSchedule{
+		EasinessFactor:   card.EasinessFactor,
+		RepetitionNumber: card.RepetitionNumber,
+		IntervalNumber:   card.IntervalNumber,
+		LearningStep:     card.LearningStep,
+	}
+}
+
+func (s *Service) DeleteCardHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[DeleteCardHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteCardHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	if _, _, err := s.authorizeCard(r.Context(), user, id, models.DeckRoleEditor); err != nil {
+		logger.Error("[DeleteCardHandler] Authorize card got error", zap.Int32("cardId", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	err = s.CardRepository.DeleteCard(r.Context(), id)
+	if err != nil {
+		logger.Error("[DeleteCardHandler] CardRepository.DeleteCard", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+func (s *Service) MoveCardsHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseBulkCardsRequest(r)
+	if err != nil {
+		logger.Error("[MoveCardsHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
 
-	q, ef, n, i = helpers.ExecuteSm2Algo(q, ef, n, i)
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[MoveCardsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
 
-	card.EasinessFactor = ef
-	card.StudyTime = time.Now().Add(24 * time.Duration(i) * time.Hour)
-	card.RepetitionNumber = n
-	card.IntervalNumber = i
+	var count int
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		cards, target, err := s.getBulkCards(r, tx, user, *req, models.DeckRoleEditor)
+		if err != nil {
+			return err
+		}
+		ids := make([]int32, len(cards))
+		for index, card := range cards {
+			if card.UserID != target.Deck.UserID {
+				return helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("card %d can not be moved to a deck of another owner, copy it instead", card.ID))
+			}
+			ids[index] = card.ID
+		}
+		count = len(ids)
+		if count == 0 {
+			return nil
+		}
+		return s.CardRepository.MoveCards(r.Context(), ids, req.TargetDeckID, tx)
+	})
+	if err != nil {
+		logger.Error("[MoveCardsHandler] Move cards got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.BulkCardsResponse{Count: count})
+}
+
+func (s *Service) CopyCardsHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseBulkCardsRequest(r)
+	if err != nil {
+		logger.Error("[CopyCardsHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[CopyCardsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	var count int
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		cards, target, err := s.getBulkCards(r, tx, user, *req, models.DeckRoleViewer)
+		if err != nil {
+			return err
+		}
+		copies := make([]*models.Card, len(cards))
+		for index, card := range cards {
+			// the scheduling state of a card is its owner's, it is not carried over to another user
+			resetScheduling := req.ResetScheduling || card.UserID != target.Deck.UserID
+			copies[index] = s.copyCard(card, req.TargetDeckID, target.Deck.UserID, resetScheduling)
+		}
+		count = len(copies)
+		if count == 0 {
+			return nil
+		}
+		return s.CardRepository.CreateCards(r.Context(), copies, tx)
+	})
+	if err != nil {
+		logger.Error("[CopyCardsHandler] Copy cards got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, dto.BulkCardsResponse{Count: count})
+}
+
+// copyCard returns a new card with the content of card in the deck, the scheduling state is
+// left to the database defaults when resetScheduling is set.
+func (s *Service) copyCard(card *models.Card, deckID int32, userID int32, resetScheduling bool) *models.Card {
+	cardCopy := &models.Card{
+		Front:      card.Front,
+		Back:       card.Back,
+		Tags:       card.Tags,
+		DeckID:     deckID,
+		UserID:     userID,
+		TypeAnswer: card.TypeAnswer,
+	}
+	if !resetScheduling {
+		cardCopy.EasinessFactor = card.EasinessFactor
+		cardCopy.StudyTime = card.StudyTime
+		cardCopy.RepetitionNumber = card.RepetitionNumber
+		cardCopy.IntervalNumber = card.IntervalNumber
+		cardCopy.LearningStep = card.LearningStep
+	}
+	return cardCopy
+}
+
+// getBulkCards checks that the user can edit the target deck and returns the selected cards,
+// either by id or by search query, failing if the user does not have sourceRole on any of them.
+func (s *Service) getBulkCards(r *http.Request, tx *gorm.DB, user models.User, req dto.BulkCardsRequest, sourceRole string) ([]*models.Card, *deckAccess, error) {
+	target, err := s.authorizeDeck(r.Context(), user, req.TargetDeckID, models.DeckRoleEditor, tx)
+	if err != nil {
+		var httpErr *helpers.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Code == http.StatusNotFound {
+			return nil, nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("target deck not found"))
+		}
+		if errors.As(err, &httpErr) && httpErr.Code == http.StatusForbidden {
+			return nil, nil, helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not have permission to add cards to the target deck"))
+		}
+		return nil, nil, err
+	}
+
+	var cards []*models.Card
+	if len(req.CardIDs) > 0 {
+		cards, err = s.CardRepository.GetAllCards(r.Context(), dto.GetCardsRequest{IDs: req.CardIDs}, tx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(cards) != len(req.CardIDs) {
+			return nil, nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("some cards are not found"))
+		}
+		authorizedDecks := map[int32]bool{}
+		for _, card := range cards {
+			if card.UserID == user.ID || authorizedDecks[card.DeckID] {
+				continue
+			}
+			if _, err := s.authorizeDeck(r.Context(), user, card.DeckID, sourceRole, tx); err != nil {
+				return nil, nil, helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not have permission to access card %d", card.ID))
+			}
+			authorizedDecks[card.DeckID] = true
+		}
+	} else {
+		getCardsReq := dto.GetCardsRequest{
+			UserID: user.ID,
+			Front:  req.Query.Front,
+			Back:   req.Query.Back,
+			// one more than allowed is enough to tell the query matches too many cards
+			Limit: constant.MaxBulkCards + 1,
+		}
+		if req.Query.DeckID != 0 {
+			access, err := s.authorizeDeck(r.Context(), user, req.Query.DeckID, sourceRole, tx)
+			if err != nil {
+				return nil, nil, err
+			}
+			getCardsReq.UserID = access.Deck.UserID
+			getCardsReq.DeckIDs = helpers.DeckSubtreeIDs(access.OwnerDecks, req.Query.DeckID)
+		}
+		cards, err = s.CardRepository.GetAllCards(r.Context(), getCardsReq, tx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(cards) > constant.MaxBulkCards {
+		return nil, nil, helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("can not process more than %d cards at once", constant.MaxBulkCards))
+	}
+	return cards, target, nil
+}
+
+func (s *Service) parseBulkCardsRequest(r *http.Request) (*dto.BulkCardsRequest, error) {
+	var req dto.BulkCardsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseBulkCardsRequest] Failed to decode request", zap.Error(err))
+		return nil, err
+	}
+	if req.TargetDeckID == 0 {
+		logger.Error("[parseBulkCardsRequest] TargetDeckID is required")
+		return nil, fmt.Errorf("targetDeckId is required")
+	}
+	if len(req.CardIDs) == 0 && req.Query == nil {
+		logger.Error("[parseBulkCardsRequest] CardIDs or Query is required")
+		return nil, fmt.Errorf("cardIds or query is required")
+	}
+	if len(req.CardIDs) > 0 && req.Query != nil {
+		logger.Error("[parseBulkCardsRequest] CardIDs and Query are exclusive")
+		return nil, fmt.Errorf("only one of cardIds and query can be given")
+	}
+	slices.Sort(req.CardIDs)
+	req.CardIDs = slices.Compact(req.CardIDs)
+	if len(req.CardIDs) > constant.MaxBulkCards {
+		logger.Error("[parseBulkCardsRequest] Too many cards", zap.Int("count", len(req.CardIDs)))
+		return nil, fmt.Errorf("can not process more than %d cards at once", constant.MaxBulkCards)
+	}
+	return &req, nil
 }
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const revisionPruneInterval = time.Hour
+
+// updateCardContent saves the new content of the card and records the content it replaces as a
+// revision made by userID. It reports whether the content changed.
+func (s *Service) updateCardContent(ctx context.Context, tx *gorm.DB, card *models.Card, userID int32, front string, back string, tags string) (bool, error) {
+	previous := *card
+	if !s.setCardContent(card, front, back, tags) {
+		return false, nil
+	}
+	if err := s.CardRepository.UpdateFullCard(card, tx); err != nil {
+		return false, err
+	}
+
+	var changes []dto.CardRevisionChange
+	for _, field := range []struct {
+		name string
+		from string
+		to   string
+	}{
+		{models.CardFieldFront, previous.Front, card.Front},
+		{models.CardFieldBack, previous.Back, card.Back},
+		{models.CardFieldTags, previous.Tags, card.Tags},
+	} {
+		if field.from != field.to {
+			changes = append(changes, dto.CardRevisionChange{Field: field.name, From: field.from, To: field.to})
+		}
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return false, err
+	}
+	err = s.CardRevisionRepository.CreateRevision(ctx, &models.CardRevision{
+		CardID:  card.ID,
+		UserID:  userID,
+		Version: previous.ContentVersion,
+		Front:   previous.Front,
+		Back:    previous.Back,
+		Tags:    previous.Tags,
+		Diff:    string(diff),
+	}, tx)
+	if err != nil {
+		return false, err
+	}
+	if s.Config.CardRevisionMaxPerCard > 0 {
+		if err := s.CardRevisionRepository.PruneRevisionsByCard(ctx, card.ID, s.Config.CardRevisionMaxPerCard, tx); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (s *Service) GetCardRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	cardID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[GetCardRevisionsHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetCardRevisionsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	card, _, err := s.authorizeCard(r.Context(), user, cardID, models.DeckRoleViewer)
+	if err != nil {
+		logger.Error("[GetCardRevisionsHandler] Authorize card got error", zap.Int32("cardId", cardID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	revisions, err := s.CardRevisionRepository.GetRevisionsByCard(r.Context(), card.ID)
+	if err != nil {
+		logger.Error("[GetCardRevisionsHandler] CardRevisionRepository.GetRevisionsByCard got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]dto.CardRevisionItem, len(revisions))
+	for index, revision := range revisions {
+		var changes []dto.CardRevisionChange
+		if err := json.Unmarshal([]byte(revision.Diff), &changes); err != nil {
+			logger.Error("[GetCardRevisionsHandler] Unmarshal revision diff got error", zap.Int32("revisionId", revision.ID), zap.Error(err))
+		}
+		items[index] = dto.CardRevisionItem{
+			ID:        revision.ID,
+			Version:   revision.Version,
+			UserID:    revision.UserID,
+			UserName:  revision.UserName,
+			Front:     revision.Front,
+			Back:      revision.Back,
+			Tags:      helpers.SplitTags(revision.Tags),
+			Changes:   changes,
+			CreatedAt: revision.CreatedAt,
+		}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetCardRevisionsResponse{
+		CardID:         card.ID,
+		ContentVersion: card.ContentVersion,
+		Revisions:      items,
+	})
+}
+
+// RevertCardRevisionHandler gives the card back the content it had before the revision, the revert
+// is itself recorded as a new revision.
+func (s *Service) RevertCardRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	cardID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[RevertCardRevisionHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	revisionID, err := parseURLID(r, "revisionId")
+	if err != nil {
+		logger.Error("[RevertCardRevisionHandler] Invalid revisionId", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[RevertCardRevisionHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	card, _, err := s.authorizeCard(r.Context(), user, cardID, models.DeckRoleEditor)
+	if err != nil {
+		logger.Error("[RevertCardRevisionHandler] Authorize card got error", zap.Int32("cardId", cardID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		revision, err := s.CardRevisionRepository.GetRevision(r.Context(), revisionID, card.ID, tx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("revision not found"))
+			}
+			return err
+		}
+		_, err = s.updateCardContent(r.Context(), tx, card, user.ID, revision.Front, revision.Back, revision.Tags)
+		return err
+	})
+	if err != nil {
+		logger.Error("[RevertCardRevisionHandler] Revert card got error", zap.Int32("cardId", cardID), zap.Int32("revisionId", revisionID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// RunRevisionPruner deletes the card revisions older than the retention window, until ctx is cancelled.
+func (s *Service) RunRevisionPruner(ctx context.Context) {
+	if s.Config.CardRevisionRetentionDays <= 0 {
+		logger.Info("[RunRevisionPruner] Card revision retention is disabled")
+		return
+	}
+	ticker := time.NewTicker(revisionPruneInterval)
+	defer ticker.Stop()
+	for {
+		s.pruneExpiredRevisions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) pruneExpiredRevisions(ctx context.Context) {
+	before := time.Now().Add(-time.Duration(s.Config.CardRevisionRetentionDays) * 24 * time.Hour)
+	pruned, err := s.CardRevisionRepository.DeleteRevisionsBefore(ctx, before)
+	if err != nil {
+		logger.Error("[pruneExpiredRevisions] CardRevisionRepository.DeleteRevisionsBefore got error", zap.Error(err))
+		return
+	}
+	if pruned > 0 {
+		logger.Info("[pruneExpiredRevisions] Pruned expired card revisions", zap.Int64("revisions", pruned))
+	}
+}
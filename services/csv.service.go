@@ -0,0 +1,425 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	jobTypeCSVImport = "csv_import"
+
+	csvSampleSize  = 64 << 10
+	csvPreviewRows = 10
+)
+
+func (s *Service) PreviewCSVHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[PreviewCSVHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	path, err := s.saveUpload(w, r, user.ID, "")
+	if err != nil {
+		logger.Error("[PreviewCSVHandler] Save upload got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	encoding, delimiter, err := detectCSVFormat(path)
+	if err != nil {
+		os.Remove(path)
+		logger.Error("[PreviewCSVHandler] Detect format got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rows, err := readCSVPreview(path, encoding, delimiter)
+	if err != nil {
+		os.Remove(path)
+		logger.Error("[PreviewCSVHandler] Read preview got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.CSVPreviewResponse{
+		UploadID:  filepath.Base(path),
+		Encoding:  encoding,
+		Delimiter: string(delimiter),
+		Columns:   columns,
+		Rows:      rows,
+	})
+}
+
+func (s *Service) ImportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseCSVImportRequest(r)
+	if err != nil {
+		logger.Error("[ImportCSVHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ImportCSVHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	path, err := s.getUpload(user.ID, req.UploadID)
+	if err != nil {
+		logger.Error("[ImportCSVHandler] Get upload got error", zap.String("uploadId", req.UploadID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	if req.DeckID != 0 {
+		// imported cards and subdecks belong to the importing user, so only the owner can import into a deck
+		if _, err := s.authorizeDeck(r.Context(), user, req.DeckID, models.DeckRoleOwner); err != nil {
+			logger.Error("[ImportCSVHandler] Authorize deck got error", zap.Int32("deckId", req.DeckID), zap.Int32("userId", user.ID), zap.Error(err))
+			helpers.WriteError(w, err)
+			return
+		}
+	}
+
+	if req.Encoding == "" || req.Delimiter == "" {
+		encoding, delimiter, err := detectCSVFormat(path)
+		if err != nil {
+			logger.Error("[ImportCSVHandler] Detect format got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if req.Encoding == "" {
+			req.Encoding = encoding
+		}
+		if req.Delimiter == "" {
+			req.Delimiter = string(delimiter)
+		}
+	}
+	if _, err := helpers.NewDecodedReader(strings.NewReader(""), req.Encoding); err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := s.startJob(r.Context(), user.ID, jobTypeCSVImport, func(ctx context.Context, progress *jobProgress) (any, error) {
+		defer os.Remove(path)
+		return s.importCSV(ctx, user.ID, path, *req, progress)
+	})
+	if err != nil {
+		logger.Error("[ImportCSVHandler] Start job got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusAccepted, s.parseJobItem(job))
+}
+
+func (s *Service) parseCSVImportRequest(r *http.Request) (*dto.CSVImportRequest, error) {
+	var req dto.CSVImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseCSVImportRequest] Failed to decode request", zap.Error(err))
+		return nil, err
+	}
+	if req.UploadID == "" {
+		return nil, fmt.Errorf("uploadId is required")
+	}
+	if req.Mapping.Front == nil {
+		return nil, fmt.Errorf("mapping.front is required")
+	}
+	if req.Mapping.Back == nil {
+		return nil, fmt.Errorf("mapping.back is required")
+	}
+	for name, column := range map[string]*int{
+		"front":    req.Mapping.Front,
+		"back":     req.Mapping.Back,
+		"tags":     req.Mapping.Tags,
+		"deckPath": req.Mapping.DeckPath,
+	} {
+		if column != nil && *column < 0 {
+			return nil, fmt.Errorf("mapping.%s must not be negative", name)
+		}
+	}
+	if req.DeckID == 0 && req.Mapping.DeckPath == nil {
+		return nil, fmt.Errorf("deckId or mapping.deckPath is required")
+	}
+	if req.Delimiter != "" {
+		delimiter, size := utf8.DecodeRuneInString(req.Delimiter)
+		if size != len(req.Delimiter) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+			return nil, fmt.Errorf("delimiter must be a single character other than a quote or a line break")
+		}
+	}
+	return &req, nil
+}
+
+// detectCSVFormat guesses the encoding and the delimiter of a csv file from its beginning.
+func detectCSVFormat(path string) (string, rune, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	sample := make([]byte, csvSampleSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", 0, err
+	}
+	sample = sample[:n]
+
+	encoding := helpers.DetectEncoding(sample)
+	decoded, err := helpers.NewDecodedReader(bytes.NewReader(sample), encoding)
+	if err != nil {
+		return "", 0, err
+	}
+	text, err := io.ReadAll(decoded)
+	if err != nil {
+		return "", 0, err
+	}
+	return encoding, helpers.DetectDelimiter(string(text)), nil
+}
+
+func readCSVPreview(path string, encoding string, delimiter rune) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader, err := newCSVReader(file, encoding, delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for len(rows) < csvPreviewRows {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if len(rows) == 0 {
+				return nil, fmt.Errorf("file is not a valid csv: %w", err)
+			}
+			break
+		}
+		rows = append(rows, record)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	return rows, nil
+}
+
+func newCSVReader(source io.Reader, encoding string, delimiter rune) (*csv.Reader, error) {
+	decoded, err := helpers.NewDecodedReader(source, encoding)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(decoded)
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	return reader, nil
+}
+
+// countingReader counts the bytes read through it, the import reports its progress in bytes
+// since the number of rows is not known before the end of the file.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// importCSV streams the rows of the file into cards, one batch at a time. Rows that can not
+// be imported are reported in the summary instead of failing the import.
+func (s *Service) importCSV(ctx context.Context, userID int32, path string, req dto.CSVImportRequest, progress *jobProgress) (*dto.ImportSummary, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	progress.SetTotal(int(info.Size()))
+
+	source := &countingReader{reader: file}
+	delimiter, _ := utf8.DecodeRuneInString(req.Delimiter)
+	reader, err := newCSVReader(source, req.Encoding, delimiter)
+	if err != nil {
+		return nil, err
+	}
+	reader.ReuseRecord = true
+
+	decks, err := s.newDeckPathResolver(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	summary := &dto.ImportSummary{Skipped: []dto.SkippedItem{}}
+	batch := make([]*models.Card, 0, importBatchSize)
+	var reported int64
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := s.CardRepository.CreateCards(ctx, batch); err != nil {
+				return err
+			}
+			summary.Cards += len(batch)
+			batch = batch[:0]
+		}
+		progress.Advance(int(source.count - reported))
+		reported = source.count
+		return nil
+	}
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			skip(summary, "row", strconv.Itoa(parseErr.StartLine), parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return summary, err
+		}
+		if first && req.HasHeader {
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		card, err := s.parseCSVCard(ctx, userID, record, req, decks)
+		if err != nil {
+			skip(summary, "row", strconv.Itoa(line), err.Error())
+			continue
+		}
+		batch = append(batch, card)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return summary, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return summary, err
+	}
+	summary.Decks = decks.created
+	return summary, nil
+}
+
+func (s *Service) parseCSVCard(ctx context.Context, userID int32, record []string, req dto.CSVImportRequest, decks *deckPathResolver) (*models.Card, error) {
+	column := func(index *int) (string, error) {
+		if index == nil {
+			return "", nil
+		}
+		if *index >= len(record) {
+			return "", fmt.Errorf("row has %d columns, column %d is missing", len(record), *index+1)
+		}
+		return strings.TrimSpace(record[*index]), nil
+	}
+
+	front, err := column(req.Mapping.Front)
+	if err != nil {
+		return nil, err
+	}
+	if front == "" {
+		return nil, fmt.Errorf("front is empty")
+	}
+	back, err := column(req.Mapping.Back)
+	if err != nil {
+		return nil, err
+	}
+	if back == "" {
+		return nil, fmt.Errorf("back is empty")
+	}
+	tags, err := column(req.Mapping.Tags)
+	if err != nil {
+		return nil, err
+	}
+	deckPath, err := column(req.Mapping.DeckPath)
+	if err != nil {
+		return nil, err
+	}
+
+	deckID := req.DeckID
+	if deckPath != "" {
+		deckID, err = decks.resolve(ctx, deckPath)
+		if err != nil {
+			return nil, fmt.Errorf("resolve deck %q: %w", deckPath, err)
+		}
+	}
+	if deckID == 0 {
+		return nil, fmt.Errorf("deck path is empty")
+	}
+
+	return &models.Card{
+		Front: front,
+		Back:  back,
+		// spreadsheets often separate tags with commas
+		Tags:   helpers.JoinTags(strings.Fields(strings.ReplaceAll(tags, ",", " "))),
+		DeckID: deckID,
+		UserID: userID,
+	}, nil
+}
+
+// csvDeckWriter writes exported cards with the columns front, back, tags and deck, which the csv
+// import maps back with {"front": 0, "back": 1, "tags": 2, "deckPath": 3}.
+type csvDeckWriter struct {
+	writer            *csv.Writer
+	includeScheduling bool
+}
+
+func newCSVDeckWriter(out io.Writer, includeScheduling bool) (*csvDeckWriter, error) {
+	c := &csvDeckWriter{writer: csv.NewWriter(out), includeScheduling: includeScheduling}
+	header := []string{"front", "back", "tags", "deck"}
+	if includeScheduling {
+		header = append(header, "easinessFactor", "repetitionNumber", "intervalNumber", "studyTime")
+	}
+	return c, c.writer.Write(header)
+}
+
+func (c *csvDeckWriter) WriteCard(card *models.Card, deckPath string) error {
+	record := []string{card.Front, card.Back, card.Tags, deckPath}
+	if c.includeScheduling {
+		record = append(record,
+			strconv.FormatFloat(float64(card.EasinessFactor), 'f', -1, 32),
+			strconv.Itoa(int(card.RepetitionNumber)),
+			strconv.Itoa(int(card.IntervalNumber)),
+			card.StudyTime.UTC().Format(time.RFC3339),
+		)
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvDeckWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
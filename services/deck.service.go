@@ -1,13 +1,16 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"github.com/mrgThang/flashcard-be/constant"
 	"github.com/mrgThang/flashcard-be/dto"
@@ -32,6 +35,17 @@ func (s *Service) GetDecksHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	req.UserID = user.ID
+	userDecks, err := s.DeckRepository.GetDecksByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetDecksHandler] DeckRepository.GetDecksByUser", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if req.Tree {
+		helpers.WriteJSONResponse(w, http.StatusOK, s.parseGetDecksTreeResponse(userDecks))
+		return
+	}
+
 	decks, totalItems, err := s.DeckRepository.GetDecksWithPagination(r.Context(), *req)
 	if err != nil {
 		logger.Error("[GetDecksHandler] DeckRepository.GetDecks", zap.Error(err))
@@ -39,7 +53,7 @@ func (s *Service) GetDecksHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := s.parseGetDecksResponse(decks, dto.Pagination{
+	response := s.parseGetDecksResponse(decks, userDecks, dto.Pagination{
 		Page:       req.Page,
 		PageSize:   req.PageSize,
 		TotalItems: totalItems,
@@ -77,19 +91,22 @@ func (s *Service) parseGetDecksRequest(r *http.Request) (*dto.GetDecksRequest, e
 	} else {
 		req.PageSize = constant.DefaultPageSize
 	}
+	if treeStr := q.Get("tree"); treeStr != "" {
+		tree, err := strconv.ParseBool(treeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tree")
+		}
+		req.Tree = tree
+	}
 	return &req, nil
 }
 
-func (s *Service) parseGetDecksResponse(decks []*models.DeckWithStats, pagination dto.Pagination) dto.GetDecksResponse {
+func (s *Service) parseGetDecksResponse(decks []*models.DeckWithStats, userDecks []*models.DeckWithStats, pagination dto.Pagination) dto.GetDecksResponse {
+	stats := helpers.RollUpDeckStats(userDecks)
+	paths := helpers.DeckPaths(userDecks)
 	deckItems := make([]dto.DeckItem, len(decks))
 	for i, deck := range decks {
-		deckItems[i] = dto.DeckItem{
-			ID:          deck.ID,
-			Name:        deck.Name,
-			Description: deck.Description,
-			TotalCards:  deck.TotalCards,
-			CardsLeft:   deck.CardsLeft,
-		}
+		deckItems[i] = s.parseDeckItem(deck, stats, paths)
 	}
 	return dto.GetDecksResponse{
 		Pagination: pagination,
@@ -97,6 +114,74 @@ func (s *Service) parseGetDecksResponse(decks []*models.DeckWithStats, paginatio
 	}
 }
 
+func (s *Service) parseGetDecksTreeResponse(userDecks []*models.DeckWithStats) dto.GetDecksResponse {
+	stats := helpers.RollUpDeckStats(userDecks)
+	children := helpers.DeckChildren(userDecks)
+	roots := s.parseDeckTree(0, children, stats, helpers.DeckPaths(userDecks), map[int32]bool{})
+	return dto.GetDecksResponse{
+		Pagination: dto.Pagination{
+			Page:       constant.DefaultPage,
+			PageSize:   len(roots),
+			TotalItems: int64(len(roots)),
+		},
+		Decks: roots,
+	}
+}
+
+func (s *Service) parseDeckTree(parentID int32, children map[int32][]*models.DeckWithStats, stats map[int32]models.DeckWithStats, paths map[int32]string, visited map[int32]bool) []dto.DeckItem {
+	deckItems := make([]dto.DeckItem, 0, len(children[parentID]))
+	for _, deck := range children[parentID] {
+		if visited[deck.ID] {
+			continue
+		}
+		visited[deck.ID] = true
+		item := s.parseDeckItem(deck, stats, paths)
+		item.Children = s.parseDeckTree(deck.ID, children, stats, paths, visited)
+		deckItems = append(deckItems, item)
+	}
+	return deckItems
+}
+
+// parseDeckItem builds the response of a deck with card counts rolled up over its subtree.
+func (s *Service) parseDeckItem(deck *models.DeckWithStats, stats map[int32]models.DeckWithStats, paths map[int32]string) dto.DeckItem {
+	item := dto.DeckItem{
+		ID:          deck.ID,
+		Name:        deck.Name,
+		Path:        paths[deck.ID],
+		Description: deck.Description,
+		ParentID:    deck.ParentID,
+		PresetID:    deck.PresetID,
+		TotalCards:  deck.TotalCards,
+		CardsLeft:   deck.CardsLeft,
+	}
+	if rolled, ok := stats[deck.ID]; ok {
+		item.TotalCards = rolled.TotalCards
+		item.CardsLeft = rolled.CardsLeft
+	}
+	return item
+}
+
+// parseSharedDeckItem builds the response of a deck the user has access to. The cards left of a
+// collaborator are counted from their own progress instead of the one of the owner.
+func (s *Service) parseSharedDeckItem(ctx context.Context, user models.User, access *deckAccess) (dto.DeckItem, error) {
+	item := s.parseDeckItem(access.Deck, helpers.RollUpDeckStats(access.OwnerDecks), map[int32]string{access.Deck.ID: helpers.DeckPath(access.OwnerDecks, access.Deck.ID)})
+	item.Role = access.Role
+	if access.IsOwner() {
+		return item, nil
+	}
+	now := time.Now()
+	cardsLeft, err := s.CardRepository.CountCards(ctx, dto.GetCardsRequest{
+		DeckIDs:        helpers.DeckSubtreeIDs(access.OwnerDecks, access.Deck.ID),
+		StudyTimeTo:    &now,
+		ProgressUserID: user.ID,
+	})
+	if err != nil {
+		return item, err
+	}
+	item.CardsLeft = int32(cardsLeft)
+	return item, nil
+}
+
 func (s *Service) CreateDeckHandler(w http.ResponseWriter, r *http.Request) {
 	req, err := s.parseCreateDeckRequest(r)
 	if err != nil {
@@ -112,8 +197,22 @@ func (s *Service) CreateDeckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.ParentID != nil && *req.ParentID == 0 {
+		req.ParentID = nil
+	}
 	req.UserID = user.ID
-	err = s.DeckRepository.CreateDeck(r.Context(), *req)
+	if req.ParentID != nil {
+		parent, err := s.authorizeDeck(r.Context(), user, *req.ParentID, models.DeckRoleEditor)
+		if err != nil {
+			logger.Error("[CreateDeckHandler] Authorize parent deck got error", zap.Int32("parentId", *req.ParentID), zap.Int32("userId", user.ID), zap.Error(err))
+			helpers.WriteError(w, err)
+			return
+		}
+		// a subdeck created by a collaborator belongs to the owner of the shared deck
+		req.UserID = parent.Deck.UserID
+	}
+
+	_, err = s.DeckRepository.CreateDeck(r.Context(), *req)
 	if err != nil {
 		logger.Error("[CreateDeckHandler] DeckRepository.CreateDeck got error", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
@@ -150,20 +249,9 @@ func (s *Service) UpdateDeckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := s.DeckRepository.GetDetailDeck(r.Context(), req.ID)
-	if err != nil {
-		logger.Error("[UpdateDeckHandler] DeckRepository.GetDetailDeck got error", zap.Error(err))
-		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
-		return
-	}
-	if deck == nil {
-		logger.Error("[UpdateDeckHandler] Deck not found", zap.Int32("deckId", req.ID))
-		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck not found"))
-		return
-	}
-	if deck.UserID != user.ID {
-		logger.Error("[UpdateDeckHandler] User does not have permission to update this deck", zap.Int32("deckId", req.ID), zap.Int32("userId", user.ID))
-		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("user does not have permission to update this deck"))
+	if _, err := s.authorizeDeck(r.Context(), user, req.ID, models.DeckRoleEditor); err != nil {
+		logger.Error("[UpdateDeckHandler] Authorize deck got error", zap.Int32("deckId", req.ID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
 		return
 	}
 
@@ -215,29 +303,125 @@ func (s *Service) GetDetailDeckHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := s.DeckRepository.GetDetailDeck(r.Context(), int32(id))
+	access, err := s.authorizeDeck(r.Context(), user, int32(id), models.DeckRoleViewer)
 	if err != nil {
-		logger.Error("[GetDetailDeckHandler] DeckRepository.GetDetailDeck got error", zap.Error(err))
+		logger.Error("[GetDetailDeckHandler] Authorize deck got error", zap.Int("deckId", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	response, err := s.parseSharedDeckItem(r.Context(), user, access)
+	if err != nil {
+		logger.Error("[GetDetailDeckHandler] Count cards left got error", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
-	if deck == nil {
-		logger.Error("[GetDetailDeckHandler] Deck not found", zap.Int("deckId", id))
-		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck not found"))
+	helpers.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+func (s *Service) MoveDeckHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseMoveDeckRequest(r)
+	if err != nil {
+		logger.Error("[MoveDeckHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[MoveDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
 		return
 	}
-	if deck.UserID != user.ID {
-		logger.Error("[GetDetailDeckHandler] User does not have permission to view this deck", zap.Int("deckId", id), zap.Int32("userId", user.ID))
-		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("user does not have permission to view this deck"))
+
+	access, err := s.authorizeDeck(r.Context(), user, req.ID, models.DeckRoleOwner)
+	if err != nil {
+		logger.Error("[MoveDeckHandler] Authorize deck got error", zap.Int32("deckId", req.ID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
 		return
 	}
+	// the check runs on locked rows, otherwise two moves in opposite directions could both pass it
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		userDecks, err := s.DeckRepository.LockDecksByUser(r.Context(), access.Deck.UserID, tx)
+		if err != nil {
+			return err
+		}
+		if req.ParentID != nil {
+			owned := false
+			for _, deck := range userDecks {
+				if deck.ID == *req.ParentID {
+					owned = true
+					break
+				}
+			}
+			if !owned {
+				return helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not have permission to move deck into this parent"))
+			}
+			if helpers.IsDeckInSubtree(userDecks, req.ID, *req.ParentID) {
+				return helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("can not move a deck into itself or one of its descendants"))
+			}
+		}
+		return s.DeckRepository.MoveDeck(r.Context(), *req, tx)
+	})
+	if err != nil {
+		logger.Error("[MoveDeckHandler] Move deck got error", zap.Int32("deckId", req.ID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
 
-	response := dto.DeckItem{
-		ID:          deck.ID,
-		Name:        deck.Name,
-		Description: deck.Description,
-		TotalCards:  deck.TotalCards,
-		CardsLeft:   deck.CardsLeft,
+func (s *Service) parseMoveDeckRequest(r *http.Request) (*dto.MoveDeckRequest, error) {
+	var req dto.MoveDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseMoveDeckRequest] Decode json from req got error", zap.Error(err))
+		return nil, err
 	}
-	helpers.WriteJSONResponse(w, http.StatusOK, response)
+	if req.ID == 0 {
+		logger.Error("[parseMoveDeckRequest] ID is required")
+		return nil, fmt.Errorf("ID is required")
+	}
+	if req.ParentID != nil && *req.ParentID == 0 {
+		req.ParentID = nil
+	}
+	return &req, nil
+}
+
+func (s *Service) DeleteDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[DeleteDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	access, err := s.authorizeDeck(r.Context(), user, id, models.DeckRoleOwner)
+	if err != nil {
+		logger.Error("[DeleteDeckHandler] Authorize deck got error", zap.Int32("deckId", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	deckIDs := helpers.DeckSubtreeIDs(access.OwnerDecks, id)
+
+	// the whole subtree and its cards share one timestamp so they can be restored together
+	deletedAt := time.Now().Truncate(time.Second)
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.DeckRepository.DeleteDecks(r.Context(), deckIDs, deletedAt, tx); err != nil {
+			return err
+		}
+		return s.CardRepository.DeleteCardsByDecks(r.Context(), deckIDs, deletedAt, tx)
+	})
+	if err != nil {
+		logger.Error("[DeleteDeckHandler] Delete deck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
 }
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// errEmailNotVerified refuses invitations to users who did not prove owning the email they were sent to.
+var errEmailNotVerified = helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("email must be verified to see invitations"))
+
+func (s *Service) GetSharedDecksHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetSharedDecksHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	members, err := s.DeckMemberRepository.GetAcceptedMembersByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetSharedDecksHandler] DeckMemberRepository.GetAcceptedMembersByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	decks := make([]dto.SharedDeckItem, 0, len(members))
+	owners := map[int32]*models.User{}
+	for _, member := range members {
+		access, err := s.authorizeDeck(r.Context(), user, member.DeckID, models.DeckRoleViewer)
+		if err != nil {
+			var httpErr *helpers.HTTPError
+			if errors.As(err, &httpErr) {
+				// the deck is in the trash of its owner
+				continue
+			}
+			logger.Error("[GetSharedDecksHandler] Authorize deck got error", zap.Int32("deckId", member.DeckID), zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		item, err := s.parseSharedDeckItem(r.Context(), user, access)
+		if err != nil {
+			logger.Error("[GetSharedDecksHandler] Count cards left got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		owner, ok := owners[access.Deck.UserID]
+		if !ok {
+			owner, err = s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: access.Deck.UserID})
+			if err != nil {
+				logger.Error("[GetSharedDecksHandler] UserRepository.GetUser got error", zap.Int32("userId", access.Deck.UserID), zap.Error(err))
+				helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+			owners[access.Deck.UserID] = owner
+		}
+		decks = append(decks, dto.SharedDeckItem{DeckItem: item, OwnerName: owner.Name, OwnerEmail: owner.Email})
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetSharedDecksResponse{Decks: decks})
+}
+
+func (s *Service) GetDeckMembersHandler(w http.ResponseWriter, r *http.Request) {
+	deckID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[GetDeckMembersHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetDeckMembersHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	if _, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner); err != nil {
+		logger.Error("[GetDeckMembersHandler] Authorize deck got error", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	members, err := s.DeckMemberRepository.GetMembersByDeck(r.Context(), deckID)
+	if err != nil {
+		logger.Error("[GetDeckMembersHandler] DeckMemberRepository.GetMembersByDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.DeckMemberItem, len(members))
+	for index, member := range members {
+		items[index] = s.parseDeckMemberItem(member)
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetDeckMembersResponse{Members: items})
+}
+
+func (s *Service) parseDeckMemberItem(member *models.DeckMember) dto.DeckMemberItem {
+	return dto.DeckMemberItem{
+		ID:         member.ID,
+		DeckID:     member.DeckID,
+		Email:      member.Email,
+		Role:       member.Role,
+		Accepted:   member.AcceptedAt != nil,
+		AcceptedAt: member.AcceptedAt,
+		CreatedAt:  member.CreatedAt,
+	}
+}
+
+func (s *Service) InviteDeckMemberHandler(w http.ResponseWriter, r *http.Request) {
+	deckID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[InviteDeckMemberHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := s.parseInviteDeckMemberRequest(r)
+	if err != nil {
+		logger.Error("[InviteDeckMemberHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[InviteDeckMemberHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	if _, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner); err != nil {
+		logger.Error("[InviteDeckMemberHandler] Authorize deck got error", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if strings.EqualFold(req.Email, user.Email) {
+		logger.Error("[InviteDeckMemberHandler] Owner can not invite themself", zap.Int32("deckId", deckID))
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("the owner of a deck can not be invited to it"))
+		return
+	}
+
+	members, err := s.DeckMemberRepository.GetMembersByDeck(r.Context(), deckID)
+	if err != nil {
+		logger.Error("[InviteDeckMemberHandler] DeckMemberRepository.GetMembersByDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, member := range members {
+		if strings.EqualFold(member.Email, req.Email) {
+			logger.Error("[InviteDeckMemberHandler] Email is already invited", zap.Int32("deckId", deckID), zap.Int32("memberId", member.ID))
+			helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("%s is already invited to this deck", req.Email))
+			return
+		}
+	}
+
+	member := &models.DeckMember{
+		DeckID:    deckID,
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: user.ID,
+	}
+	if err := s.DeckMemberRepository.CreateMember(r.Context(), member); err != nil {
+		logger.Error("[InviteDeckMemberHandler] DeckMemberRepository.CreateMember got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, s.parseDeckMemberItem(member))
+}
+
+func (s *Service) parseInviteDeckMemberRequest(r *http.Request) (*dto.InviteDeckMemberRequest, error) {
+	var req dto.InviteDeckMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseInviteDeckMemberRequest] Decode json from req got error", zap.Error(err))
+		return nil, err
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		return nil, fmt.Errorf("email is required")
+	}
+	if err := validateDeckMemberRole(req.Role); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// validateDeckMemberRole accepts the roles that can be given to a collaborator, a deck has a single owner.
+func validateDeckMemberRole(role string) error {
+	if role != models.DeckRoleEditor && role != models.DeckRoleViewer {
+		return fmt.Errorf("role must be one of %s or %s", models.DeckRoleEditor, models.DeckRoleViewer)
+	}
+	return nil
+}
+
+func (s *Service) UpdateDeckMemberHandler(w http.ResponseWriter, r *http.Request) {
+	deckID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[UpdateDeckMemberHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	memberID, err := parseURLID(r, "memberId")
+	if err != nil {
+		logger.Error("[UpdateDeckMemberHandler] Invalid memberId", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req dto.UpdateDeckMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[UpdateDeckMemberHandler] Decode json from req got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateDeckMemberRole(req.Role); err != nil {
+		logger.Error("[UpdateDeckMemberHandler] Invalid role", zap.String("role", req.Role))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[UpdateDeckMemberHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	if _, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner); err != nil {
+		logger.Error("[UpdateDeckMemberHandler] Authorize deck got error", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	member, err := s.getDeckMember(r, deckID, memberID)
+	if err != nil {
+		logger.Error("[UpdateDeckMemberHandler] Get member got error", zap.Int32("memberId", memberID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	member.Role = req.Role
+	if err := s.DeckMemberRepository.UpdateMember(r.Context(), member); err != nil {
+		logger.Error("[UpdateDeckMemberHandler] DeckMemberRepository.UpdateMember got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseDeckMemberItem(member))
+}
+
+// DeleteDeckMemberHandler removes a collaborator, either by the owner of the deck or by the collaborator leaving it.
+func (s *Service) DeleteDeckMemberHandler(w http.ResponseWriter, r *http.Request) {
+	deckID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[DeleteDeckMemberHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	memberID, err := parseURLID(r, "memberId")
+	if err != nil {
+		logger.Error("[DeleteDeckMemberHandler] Invalid memberId", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteDeckMemberHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	member, err := s.getDeckMember(r, deckID, memberID)
+	if err != nil {
+		logger.Error("[DeleteDeckMemberHandler] Get member got error", zap.Int32("memberId", memberID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	leaving := member.UserID != nil && *member.UserID == user.ID
+	if !leaving {
+		if _, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner); err != nil {
+			logger.Error("[DeleteDeckMemberHandler] Authorize deck got error", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+			helpers.WriteError(w, err)
+			return
+		}
+	}
+
+	if err := s.DeckMemberRepository.DeleteMember(r.Context(), member.ID); err != nil {
+		logger.Error("[DeleteDeckMemberHandler] DeckMemberRepository.DeleteMember got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// getDeckMember returns the membership with the id, failing with 404 if it is not on the deck.
+func (s *Service) getDeckMember(r *http.Request, deckID int32, memberID int32) (*models.DeckMember, error) {
+	member, err := s.DeckMemberRepository.GetMember(r.Context(), memberID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("member not found"))
+		}
+		return nil, err
+	}
+	if member.DeckID != deckID {
+		return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("member not found"))
+	}
+	return member, nil
+}
+
+func (s *Service) GetInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetInvitationsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	if user.EmailVerifiedAt == nil {
+		helpers.WriteError(w, errEmailNotVerified)
+		return
+	}
+
+	invitations, err := s.DeckMemberRepository.GetInvitationsByEmail(r.Context(), user.Email)
+	if err != nil {
+		logger.Error("[GetInvitationsHandler] DeckMemberRepository.GetInvitationsByEmail got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := make([]dto.InvitationItem, 0, len(invitations))
+	for _, invitation := range invitations {
+		deck, err := s.DeckRepository.GetDetailDeck(r.Context(), invitation.DeckID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.Error("[GetInvitationsHandler] DeckRepository.GetDetailDeck got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		item := dto.InvitationItem{
+			ID:        invitation.ID,
+			DeckID:    invitation.DeckID,
+			DeckName:  deck.Name,
+			Role:      invitation.Role,
+			CreatedAt: invitation.CreatedAt,
+		}
+		if inviter, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: invitation.InvitedBy}); err == nil {
+			item.InvitedBy = inviter.Email
+		}
+		items = append(items, item)
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetInvitationsResponse{Invitations: items})
+}
+
+func (s *Service) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[AcceptInvitationHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AcceptInvitationHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	invitation, err := s.getInvitation(r, user, id)
+	if err != nil {
+		logger.Error("[AcceptInvitationHandler] Get invitation got error", zap.Int32("invitationId", id), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if _, err := s.DeckRepository.GetDetailDeck(r.Context(), invitation.DeckID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck not found"))
+			return
+		}
+		logger.Error("[AcceptInvitationHandler] DeckRepository.GetDetailDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	invitation.UserID = &user.ID
+	invitation.AcceptedAt = &now
+	if err := s.DeckMemberRepository.UpdateMember(r.Context(), invitation); err != nil {
+		logger.Error("[AcceptInvitationHandler] DeckMemberRepository.UpdateMember got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseDeckMemberItem(invitation))
+}
+
+func (s *Service) DeclineInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[DeclineInvitationHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeclineInvitationHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	invitation, err := s.getInvitation(r, user, id)
+	if err != nil {
+		logger.Error("[DeclineInvitationHandler] Get invitation got error", zap.Int32("invitationId", id), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if err := s.DeckMemberRepository.DeleteMember(r.Context(), invitation.ID); err != nil {
+		logger.Error("[DeclineInvitationHandler] DeckMemberRepository.DeleteMember got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// getInvitation returns a pending invitation sent to the email of the user, which must be verified
+// since anyone can sign up with the email of an invitee.
+func (s *Service) getInvitation(r *http.Request, user models.User, id int32) (*models.DeckMember, error) {
+	invitation, err := s.DeckMemberRepository.GetMember(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("invitation not found"))
+		}
+		return nil, err
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, errEmailNotVerified
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) || invitation.AcceptedAt != nil {
+		return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("invitation not found"))
+	}
+	return invitation, nil
+}
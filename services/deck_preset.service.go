@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	minMinimumEase      = 1.0
+	minDesiredRetention = 0.7
+	maxDesiredRetention = 0.99
+)
+
+func (s *Service) GetPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetPresetsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	presets, err := s.DeckPresetRepository.GetPresetsByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetPresetsHandler] DeckPresetRepository.GetPresetsByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	decks, err := s.DeckRepository.GetDecksByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetPresetsHandler] DeckRepository.GetDecksByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	deckIDs := map[int32][]int32{}
+	for _, deck := range decks {
+		if deck.PresetID != nil {
+			deckIDs[*deck.PresetID] = append(deckIDs[*deck.PresetID], deck.ID)
+		}
+	}
+	items := make([]dto.DeckPresetItem, len(presets))
+	for index, preset := range presets {
+		items[index] = s.parseDeckPresetItem(preset, deckIDs[preset.ID])
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetDeckPresetsResponse{Presets: items})
+}
+
+func (s *Service) CreatePresetHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseSaveDeckPresetRequest(r)
+	if err != nil {
+		logger.Error("[CreatePresetHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[CreatePresetHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	preset := &models.DeckPreset{UserID: user.ID}
+	setDeckPresetOptions(preset, req)
+	if err := s.DeckPresetRepository.CreatePreset(r.Context(), preset); err != nil {
+		logger.Error("[CreatePresetHandler] DeckPresetRepository.CreatePreset got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, s.parseDeckPresetItem(preset, nil))
+}
+
+func (s *Service) UpdatePresetHandler(w http.ResponseWriter, r *http.Request) {
+	presetID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[UpdatePresetHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := s.parseSaveDeckPresetRequest(r)
+	if err != nil {
+		logger.Error("[UpdatePresetHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[UpdatePresetHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	preset, err := s.getDeckPreset(r.Context(), presetID, user.ID)
+	if err != nil {
+		logger.Error("[UpdatePresetHandler] Get preset got error", zap.Int32("presetId", presetID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	setDeckPresetOptions(preset, req)
+	if err := s.DeckPresetRepository.UpdatePreset(r.Context(), preset); err != nil {
+		logger.Error("[UpdatePresetHandler] DeckPresetRepository.UpdatePreset got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// DeletePresetHandler deletes the preset, the decks using it go back to the preset of their
+// ancestors or to the default options.
+func (s *Service) DeletePresetHandler(w http.ResponseWriter, r *http.Request) {
+	presetID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[DeletePresetHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeletePresetHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		preset, err := s.getDeckPreset(r.Context(), presetID, user.ID, tx)
+		if err != nil {
+			return err
+		}
+		if err := s.DeckRepository.ClearPreset(r.Context(), preset.ID, tx); err != nil {
+			return err
+		}
+		return s.DeckPresetRepository.DeletePreset(r.Context(), preset.ID, tx)
+	})
+	if err != nil {
+		logger.Error("[DeletePresetHandler] Delete preset got error", zap.Int32("presetId", presetID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// AssignDeckPresetHandler sets the preset of decks of the user, their subdecks without a preset of
+// their own follow it.
+func (s *Service) AssignDeckPresetHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.AssignDeckPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[AssignDeckPresetHandler] Failed to decode request", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.DeckIDs) == 0 {
+		logger.Error("[AssignDeckPresetHandler] DeckIDs is required")
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("deckIds is required"))
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AssignDeckPresetHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, deckID := range req.DeckIDs {
+			if _, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner, tx); err != nil {
+				return err
+			}
+		}
+		if req.PresetID != nil {
+			if _, err := s.getDeckPreset(r.Context(), *req.PresetID, user.ID, tx); err != nil {
+				return err
+			}
+		}
+		return s.DeckRepository.SetDecksPreset(r.Context(), req.DeckIDs, req.PresetID, tx)
+	})
+	if err != nil {
+		logger.Error("[AssignDeckPresetHandler] Assign preset got error", zap.Int32s("deckIds", req.DeckIDs), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+func (s *Service) getDeckPreset(ctx context.Context, id int32, userID int32, dbs ...*gorm.DB) (*models.DeckPreset, error) {
+	preset, err := s.DeckPresetRepository.GetPreset(ctx, id, userID, dbs...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("preset not found"))
+		}
+		return nil, err
+	}
+	return preset, nil
+}
+
+func (s *Service) parseSaveDeckPresetRequest(r *http.Request) (*dto.SaveDeckPresetRequest, error) {
+	var req dto.SaveDeckPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseSaveDeckPresetRequest] Failed to decode request", zap.Error(err))
+		return nil, err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(req.Name) > 100 {
+		return nil, fmt.Errorf("name must be at most 100 characters")
+	}
+	if req.NewPerDay < 0 || req.ReviewsPerDay < 0 {
+		return nil, fmt.Errorf("newPerDay and reviewsPerDay must not be negative")
+	}
+	for _, step := range req.LearningSteps {
+		if step <= 0 {
+			return nil, fmt.Errorf("learningSteps must be positive")
+		}
+	}
+	if len(formatLearningSteps(req.LearningSteps)) > 200 {
+		return nil, fmt.Errorf("too many learningSteps")
+	}
+	defaults := helpers.DefaultSchedulerParams()
+	if req.MinimumEase == nil {
+		req.MinimumEase = &defaults.MinimumEase
+	}
+	if req.FirstInterval == nil {
+		req.FirstInterval = &defaults.FirstInterval
+	}
+	if req.SecondInterval == nil {
+		req.SecondInterval = &defaults.SecondInterval
+	}
+	if req.EasyBonus == nil {
+		req.EasyBonus = &defaults.EasyBonus
+	}
+	if req.HardMultiplier == nil {
+		req.HardMultiplier = &defaults.HardMultiplier
+	}
+	if req.IntervalModifier == nil {
+		req.IntervalModifier = &defaults.IntervalModifier
+	}
+	if *req.MinimumEase < minMinimumEase {
+		return nil, fmt.Errorf("minimumEase must be at least %.1f", minMinimumEase)
+	}
+	if req.StartingEase < *req.MinimumEase {
+		return nil, fmt.Errorf("startingEase must be at least minimumEase")
+	}
+	if *req.FirstInterval < 1 || *req.SecondInterval < *req.FirstInterval {
+		return nil, fmt.Errorf("firstInterval must be at least 1 and secondInterval at least firstInterval")
+	}
+	if *req.EasyBonus < 1 {
+		return nil, fmt.Errorf("easyBonus must be at least 1")
+	}
+	if *req.HardMultiplier < 0 {
+		return nil, fmt.Errorf("hardMultiplier must not be negative")
+	}
+	if *req.IntervalModifier <= 0 {
+		return nil, fmt.Errorf("intervalModifier must be positive")
+	}
+	if req.MaxInterval < 1 {
+		return nil, fmt.Errorf("maxInterval must be at least 1")
+	}
+	if req.DesiredRetention < minDesiredRetention || req.DesiredRetention > maxDesiredRetention {
+		return nil, fmt.Errorf("desiredRetention must be between %.2f and %.2f", minDesiredRetention, maxDesiredRetention)
+	}
+	return &req, nil
+}
+
+func setDeckPresetOptions(preset *models.DeckPreset, req *dto.SaveDeckPresetRequest) {
+	preset.Name = req.Name
+	preset.NewPerDay = req.NewPerDay
+	preset.ReviewsPerDay = req.ReviewsPerDay
+	preset.LearningSteps = formatLearningSteps(req.LearningSteps)
+	preset.StartingEase = req.StartingEase
+	preset.MinimumEase = *req.MinimumEase
+	preset.FirstInterval = *req.FirstInterval
+	preset.SecondInterval = *req.SecondInterval
+	preset.EasyBonus = *req.EasyBonus
+	preset.HardMultiplier = *req.HardMultiplier
+	preset.IntervalModifier = *req.IntervalModifier
+	preset.MaxInterval = req.MaxInterval
+	preset.DesiredRetention = req.DesiredRetention
+}
+
+func (s *Service) parseDeckPresetItem(preset *models.DeckPreset, deckIDs []int32) dto.DeckPresetItem {
+	if deckIDs == nil {
+		deckIDs = []int32{}
+	}
+	return dto.DeckPresetItem{
+		ID:               preset.ID,
+		Name:             preset.Name,
+		NewPerDay:        preset.NewPerDay,
+		ReviewsPerDay:    preset.ReviewsPerDay,
+		LearningSteps:    parseLearningSteps(preset.LearningSteps),
+		StartingEase:     preset.StartingEase,
+		MinimumEase:      preset.MinimumEase,
+		FirstInterval:    preset.FirstInterval,
+		SecondInterval:   preset.SecondInterval,
+		EasyBonus:        preset.EasyBonus,
+		HardMultiplier:   preset.HardMultiplier,
+		IntervalModifier: preset.IntervalModifier,
+		MaxInterval:      preset.MaxInterval,
+		DesiredRetention: preset.DesiredRetention,
+		DeckIDs:          deckIDs,
+		CreatedAt:        preset.CreatedAt,
+		UpdatedAt:        preset.UpdatedAt,
+	}
+}
+
+func formatLearningSteps(steps []int32) string {
+	fields := make([]string, len(steps))
+	for index, step := range steps {
+		fields[index] = strconv.Itoa(int(step))
+	}
+	return strings.Join(fields, " ")
+}
+
+// parseLearningSteps reads the learning steps stored by formatLearningSteps, skipping invalid ones.
+func parseLearningSteps(value string) []int32 {
+	steps := []int32{}
+	for _, field := range strings.Fields(value) {
+		step, err := strconv.Atoi(field)
+		if err != nil || step <= 0 {
+			continue
+		}
+		steps = append(steps, int32(step))
+	}
+	return steps
+}
+
+// getDeckPresets returns the preset each deck of the owner studies with, which is its own or the
+// one of its closest ancestor. Decks without one are left out.
+func (s *Service) getDeckPresets(ctx context.Context, ownerID int32, ownerDecks []*models.DeckWithStats, dbs ...*gorm.DB) (map[int32]*models.DeckPreset, error) {
+	presets, err := s.DeckPresetRepository.GetPresetsByUser(ctx, ownerID, dbs...)
+	if err != nil {
+		return nil, err
+	}
+	presetsByID := make(map[int32]*models.DeckPreset, len(presets))
+	for _, preset := range presets {
+		presetsByID[preset.ID] = preset
+	}
+	decksByID := make(map[int32]*models.DeckWithStats, len(ownerDecks))
+	for _, deck := range ownerDecks {
+		decksByID[deck.ID] = deck
+	}
+
+	deckPresets := map[int32]*models.DeckPreset{}
+	if len(presets) == 0 {
+		return deckPresets, nil
+	}
+	for _, deck := range ownerDecks {
+		for _, id := range deckAncestorIDs(ownerDecks, deck.ID) {
+			if ancestor, ok := decksByID[id]; ok && ancestor.PresetID != nil {
+				if preset, ok := presetsByID[*ancestor.PresetID]; ok {
+					deckPresets[deck.ID] = preset
+				}
+				break
+			}
+		}
+	}
+	return deckPresets, nil
+}
+
+// presetSchedulerParams returns the scheduler parameters of a preset, a nil preset schedules with plain SM-2.
+func presetSchedulerParams(preset *models.DeckPreset) helpers.SchedulerParams {
+	params := helpers.DefaultSchedulerParams()
+	if preset == nil {
+		return params
+	}
+	params.LearningSteps = parseLearningSteps(preset.LearningSteps)
+	params.StartingEase = preset.StartingEase
+	params.MinimumEase = preset.MinimumEase
+	params.FirstInterval = preset.FirstInterval
+	params.SecondInterval = preset.SecondInterval
+	params.EasyBonus = preset.EasyBonus
+	params.HardMultiplier = preset.HardMultiplier
+	params.MaxInterval = preset.MaxInterval
+	// the desired retention scales the intervals on top of the interval modifier
+	params.IntervalModifier = preset.IntervalModifier * helpers.RetentionIntervalModifier(preset.DesiredRetention)
+	return params
+}
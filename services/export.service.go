@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	exportFormatCSV      = "csv"
+	exportFormatJSON     = "json"
+	exportFormatMarkdown = "md"
+
+	exportBatchSize = 500
+)
+
+var exportContentTypes = map[string]string{
+	exportFormatCSV:      "text/csv; charset=utf-8",
+	exportFormatJSON:     "application/json",
+	exportFormatMarkdown: "text/markdown; charset=utf-8",
+}
+
+// deckWriter writes the cards of an exported deck in one of the export formats.
+type deckWriter interface {
+	WriteCard(card *models.Card, deckPath string) error
+	// Flush is called after every batch of cards and at the end of the export.
+	Flush() error
+}
+
+func (s *Service) ExportDeckHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseExportDeckRequest(r)
+	if err != nil {
+		logger.Error("[ExportDeckHandler] Invalid request parameters", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ExportDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	access, err := s.authorizeDeck(r.Context(), user, req.ID, models.DeckRoleViewer)
+	if err != nil {
+		logger.Error("[ExportDeckHandler] Authorize deck got error", zap.Int32("deckId", req.ID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	userDecks := access.OwnerDecks
+	if !access.IsOwner() {
+		// collaborators export their own scheduling state
+		req.ProgressUserID = user.ID
+	}
+
+	// the response is streamed, errors from here on can only be logged
+	filename := helpers.DeckPath(userDecks, req.ID) + "." + req.Format
+	w.Header().Set("Content-Type", exportContentTypes[req.Format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	if err := s.exportDeck(r.Context(), w, userDecks, *req); err != nil {
+		logger.Error("[ExportDeckHandler] Export deck got error", zap.Int32("deckId", req.ID), zap.Error(err))
+	}
+}
+
+func (s *Service) parseExportDeckRequest(r *http.Request) (*dto.ExportDeckRequest, error) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	req := dto.ExportDeckRequest{ID: id, Format: exportFormatCSV}
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := exportContentTypes[format]; !ok {
+			return nil, fmt.Errorf("format must be one of csv, json or md")
+		}
+		req.Format = format
+	}
+	if includeScheduling := r.URL.Query().Get("includeScheduling"); includeScheduling != "" {
+		req.IncludeScheduling, err = strconv.ParseBool(includeScheduling)
+		if err != nil {
+			return nil, fmt.Errorf("invalid includeScheduling")
+		}
+	}
+	return &req, nil
+}
+
+// exportDeck streams the cards of the deck and its subdecks to out, deck by deck in path order.
+func (s *Service) exportDeck(ctx context.Context, out io.Writer, userDecks []*models.DeckWithStats, req dto.ExportDeckRequest) error {
+	buffered := bufio.NewWriter(out)
+	rootPath := helpers.DeckPath(userDecks, req.ID)
+	// paths in the export start at the exported deck
+	parentPrefix := ""
+	if index := strings.LastIndex(rootPath, constant.DeckPathSeparator); index >= 0 {
+		parentPrefix = rootPath[:index+len(constant.DeckPathSeparator)]
+	}
+
+	paths := map[int32]string{}
+	userPaths := helpers.DeckPaths(userDecks)
+	deckIDs := helpers.DeckSubtreeIDs(userDecks, req.ID)
+	for _, id := range deckIDs {
+		paths[id] = strings.TrimPrefix(userPaths[id], parentPrefix)
+	}
+	slices.SortStableFunc(deckIDs, func(a, b int32) int { return strings.Compare(paths[a], paths[b]) })
+
+	var writer deckWriter
+	var err error
+	switch req.Format {
+	case exportFormatJSON:
+		writer, err = newJSONDeckWriter(buffered, paths[req.ID], req.IncludeScheduling)
+	case exportFormatMarkdown:
+		writer = newMarkdownDeckWriter(buffered, req.IncludeScheduling)
+	default:
+		writer, err = newCSVDeckWriter(buffered, req.IncludeScheduling)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, deckID := range deckIDs {
+		getCardsReq := dto.GetCardsRequest{DeckID: deckID, ProgressUserID: req.ProgressUserID}
+		err := s.CardRepository.StreamCards(ctx, getCardsReq, exportBatchSize, func(cards []*models.Card) error {
+			for _, card := range cards {
+				if err := writer.WriteCard(card, paths[deckID]); err != nil {
+					return err
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			return buffered.Flush()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if closer, ok := writer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// markdownDeckWriter writes a heading per deck followed by the question and answer of its cards.
+type markdownDeckWriter struct {
+	out               *bufio.Writer
+	includeScheduling bool
+	deckPath          string
+	err               error
+}
+
+func newMarkdownDeckWriter(out *bufio.Writer, includeScheduling bool) *markdownDeckWriter {
+	return &markdownDeckWriter{out: out, includeScheduling: includeScheduling}
+}
+
+func (m *markdownDeckWriter) WriteCard(card *models.Card, deckPath string) error {
+	if deckPath != m.deckPath {
+		m.deckPath = deckPath
+		m.printf("# %s\n\n", deckPath)
+	}
+	m.printf("**Q:** %s\n\n**A:** %s\n\n", card.Front, card.Back)
+	if tags := helpers.SplitTags(card.Tags); len(tags) > 0 {
+		m.printf("Tags: `%s`\n\n", strings.Join(tags, "` `"))
+	}
+	if m.includeScheduling {
+		m.printf("_Due %s, interval %d days, ease %.2f, repetitions %d_\n\n",
+			card.StudyTime.UTC().Format(time.RFC3339), card.IntervalNumber, card.EasinessFactor, card.RepetitionNumber)
+	}
+	m.printf("---\n\n")
+	return m.err
+}
+
+func (m *markdownDeckWriter) Flush() error {
+	return m.err
+}
+
+func (m *markdownDeckWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.out, format, args...)
+	}
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+)
+
+const (
+	importBatchSize      = 500
+	maxReportedSkips     = 1000
+	uploadFormFieldName  = "file"
+	uploadMaxAge         = 24 * time.Hour
+	storageCleanInterval = time.Hour
+)
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}(\.[a-z0-9]+)?$`)
+
+// saveUpload streams the multipart file field of the request into the uploads directory of the user
+// and returns the path of the stored file. An empty extension accepts any file.
+func (s *Service) saveUpload(w http.ResponseWriter, r *http.Request, userID int32, extension string) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.Config.MaxUploadSizeMB<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", fmt.Errorf("request must be multipart/form-data")
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("%s is required", uploadFormFieldName)
+		}
+		if err != nil {
+			return "", err
+		}
+		if part.FormName() != uploadFormFieldName {
+			part.Close()
+			continue
+		}
+		if extension != "" && !strings.EqualFold(filepath.Ext(part.FileName()), extension) {
+			part.Close()
+			return "", fmt.Errorf("%s must be a %s file", uploadFormFieldName, extension)
+		}
+		path, err := s.newUploadPath(userID, extension)
+		if err != nil {
+			return "", err
+		}
+		err = writeFile(path, part)
+		part.Close()
+		if err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+func (s *Service) newUploadPath(userID int32, extension string) (string, error) {
+	dir := s.uploadDir(userID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, hex.EncodeToString(random)+extension), nil
+}
+
+func (s *Service) uploadsRoot() string {
+	return filepath.Join(s.Config.StorageDir, "uploads")
+}
+
+func (s *Service) uploadDir(userID int32) string {
+	return filepath.Join(s.uploadsRoot(), strconv.Itoa(int(userID)))
+}
+
+// getUpload returns the path of a file the user uploaded earlier, uploads are referred to
+// by the name they were stored with.
+func (s *Service) getUpload(userID int32, uploadID string) (string, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return "", helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid uploadId"))
+	}
+	path := filepath.Join(s.uploadDir(userID), uploadID)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("upload not found"))
+		}
+		return "", err
+	}
+	// keep the upload from being cleaned up while it is used
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// RunStorageCleaner removes uploads that were never imported and expired account exports,
+// until ctx is cancelled.
+func (s *Service) RunStorageCleaner(ctx context.Context) {
+	ticker := time.NewTicker(storageCleanInterval)
+	defer ticker.Stop()
+	for {
+		s.removeStaleFiles(s.uploadsRoot(), uploadMaxAge)
+		s.removeStaleFiles(s.accountExportsRoot(), accountExportMaxAge)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) removeStaleFiles(root string, maxAge time.Duration) {
+	before := time.Now().Add(-maxAge)
+	removed := 0
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(before) {
+			return nil
+		}
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("[removeStaleFiles] Walk storage got error", zap.String("root", root), zap.Error(err))
+	}
+	if removed > 0 {
+		logger.Info("[removeStaleFiles] Removed stale files", zap.String("root", root), zap.Int("count", removed))
+	}
+}
+
+func writeFile(path string, content io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// skip records an item the import could not take, only the first items are kept in the summary.
+func skip(summary *dto.ImportSummary, itemType string, id string, reason string) {
+	summary.SkippedCount++
+	if len(summary.Skipped) < maxReportedSkips {
+		summary.Skipped = append(summary.Skipped, dto.SkippedItem{Type: itemType, ID: id, Reason: reason})
+	}
+}
+
+// deckPathResolver finds the decks of a user by their full path, e.g. "Japanese::JLPT N5",
+// and creates the missing levels.
+type deckPathResolver struct {
+	s       *Service
+	userID  int32
+	ids     map[string]int32
+	created int
+}
+
+func (s *Service) newDeckPathResolver(ctx context.Context, userID int32) (*deckPathResolver, error) {
+	userDecks, err := s.DeckRepository.GetDecksByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resolver := &deckPathResolver{s: s, userID: userID, ids: make(map[string]int32, len(userDecks))}
+	paths := helpers.DeckPaths(userDecks)
+	for _, deck := range userDecks {
+		resolver.ids[paths[deck.ID]] = deck.ID
+	}
+	return resolver, nil
+}
+
+func (d *deckPathResolver) resolve(ctx context.Context, path string, dbs ...*gorm.DB) (int32, error) {
+	var names []string
+	for _, name := range strings.Split(path, constant.DeckPathSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return 0, fmt.Errorf("deck path is empty")
+	}
+
+	var parentID *int32
+	for index := range names {
+		current := strings.Join(names[:index+1], constant.DeckPathSeparator)
+		if id, ok := d.ids[current]; ok {
+			parentID = &id
+			continue
+		}
+		deck, err := d.s.DeckRepository.CreateDeck(ctx, dto.CreateDeckRequest{
+			Name:     names[index],
+			ParentID: parentID,
+			UserID:   d.userID,
+		}, dbs...)
+		if err != nil {
+			return 0, err
+		}
+		d.ids[current] = deck.ID
+		d.created++
+		parentID = &deck.ID
+	}
+	return *parentID, nil
+}
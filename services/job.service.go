@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const jobProgressSaveInterval = time.Second
+
+// jobRunner does the work of a background job and returns its result, which is stored
+// as JSON on the job even when an error is returned.
+type jobRunner func(ctx context.Context, progress *jobProgress) (any, error)
+
+// jobProgress persists the progress of a running job, throttled to one write per second.
+type jobProgress struct {
+	s         *Service
+	job       *models.Job
+	lastSaved time.Time
+}
+
+func (p *jobProgress) SetTotal(total int) {
+	p.job.Total = int32(total)
+	p.save(true)
+}
+
+func (p *jobProgress) Advance(count int) {
+	p.job.Progress += int32(count)
+	p.save(false)
+}
+
+func (p *jobProgress) save(force bool) {
+	if !force && time.Since(p.lastSaved) < jobProgressSaveInterval {
+		return
+	}
+	p.lastSaved = time.Now()
+	if err := p.s.JobRepository.UpdateJob(context.Background(), p.job); err != nil {
+		logger.Error("[jobProgress] JobRepository.UpdateJob got error", zap.Int32("jobId", p.job.ID), zap.Error(err))
+	}
+}
+
+// startJob records a job for the user and runs it in the background.
+func (s *Service) startJob(ctx context.Context, userID int32, jobType string, run jobRunner) (*models.Job, error) {
+	job := &models.Job{
+		UserID: userID,
+		Type:   jobType,
+		Status: models.JobStatusPending,
+	}
+	if err := s.JobRepository.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	created := *job
+	go s.runJob(job, run)
+	return &created, nil
+}
+
+func (s *Service) runJob(job *models.Job, run jobRunner) {
+	progress := &jobProgress{s: s, job: job}
+	job.Status = models.JobStatusRunning
+	progress.save(true)
+
+	var result any
+	var err error
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = fmt.Errorf("job panicked: %v", recovered)
+			}
+		}()
+		result, err = run(context.Background(), progress)
+	}()
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.Status = models.JobStatusSucceeded
+	if err != nil {
+		logger.Error("[runJob] Job failed", zap.Int32("jobId", job.ID), zap.String("type", job.Type), zap.Error(err))
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	} else if job.Total > 0 {
+		job.Progress = job.Total
+	}
+	if result != nil {
+		if encoded, marshalErr := json.Marshal(result); marshalErr == nil {
+			job.Result = string(encoded)
+		} else {
+			logger.Error("[runJob] Marshal job result got error", zap.Int32("jobId", job.ID), zap.Error(marshalErr))
+		}
+	}
+	progress.save(true)
+}
+
+// FailInterruptedJobs marks jobs left unfinished by a previous run of the server as failed.
+func (s *Service) FailInterruptedJobs(ctx context.Context) {
+	if err := s.JobRepository.FailUnfinishedJobs(ctx, "job was interrupted by a server restart"); err != nil {
+		logger.Error("[FailInterruptedJobs] JobRepository.FailUnfinishedJobs got error", zap.Error(err))
+	}
+}
+
+func (s *Service) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[GetJobHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetJobHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	job, err := s.getUserJob(r, user, id)
+	if err != nil {
+		logger.Error("[GetJobHandler] Get job got error", zap.Int32("jobId", id), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseJobItem(job))
+}
+
+func (s *Service) getUserJob(r *http.Request, user models.User, id int32) (*models.Job, error) {
+	job, err := s.JobRepository.GetJob(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("job not found"))
+		}
+		return nil, err
+	}
+	if job.UserID != user.ID {
+		return nil, helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("user does not have permission to view this job"))
+	}
+	return job, nil
+}
+
+func (s *Service) parseJobItem(job *models.Job) dto.JobItem {
+	item := dto.JobItem{
+		ID:         job.ID,
+		Type:       job.Type,
+		Status:     job.Status,
+		Progress:   job.Progress,
+		Total:      job.Total,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.Result != "" {
+		item.Result = json.RawMessage(job.Result)
+	}
+	return item
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const jobTypeJSONImport = "json_import"
+
+// jsonArrayWriter streams a JSON array, encoding the elements one by one.
+type jsonArrayWriter struct {
+	out   io.Writer
+	count int
+}
+
+func newJSONArrayWriter(out io.Writer) (*jsonArrayWriter, error) {
+	if _, err := io.WriteString(out, "["); err != nil {
+		return nil, err
+	}
+	return &jsonArrayWriter{out: out}, nil
+}
+
+func (j *jsonArrayWriter) Write(value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if j.count > 0 {
+		encoded = append([]byte(","), encoded...)
+	}
+	j.count++
+	_, err = j.out.Write(encoded)
+	return err
+}
+
+func (j *jsonArrayWriter) Close() error {
+	_, err := io.WriteString(j.out, "]")
+	return err
+}
+
+// jsonDeckWriter streams a dto.DeckFile, writing the cards one by one instead of building the array.
+type jsonDeckWriter struct {
+	out               io.Writer
+	cards             *jsonArrayWriter
+	includeScheduling bool
+}
+
+func newJSONDeckWriter(out io.Writer, deckPath string, includeScheduling bool) (*jsonDeckWriter, error) {
+	header, err := json.Marshal(dto.DeckFile{
+		Schema:     constant.DeckFileSchema,
+		Version:    constant.DeckFileVersion,
+		ExportedAt: time.Now().UTC(),
+		Deck:       deckPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// reopen the object to append the cards array
+	header = append(bytes.TrimSuffix(header, []byte("}")), []byte(`,"cards":`)...)
+	if _, err := out.Write(header); err != nil {
+		return nil, err
+	}
+	cards, err := newJSONArrayWriter(out)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonDeckWriter{out: out, cards: cards, includeScheduling: includeScheduling}, nil
+}
+
+func (j *jsonDeckWriter) WriteCard(card *models.Card, deckPath string) error {
+	fileCard := dto.DeckFileCard{
+		Front:      card.Front,
+		Back:       card.Back,
+		Tags:       helpers.SplitTags(card.Tags),
+		Deck:       deckPath,
+		TypeAnswer: card.TypeAnswer,
+	}
+	if j.includeScheduling {
+		fileCard.Scheduling = &dto.DeckFileScheduling{
+			EasinessFactor:   card.EasinessFactor,
+			RepetitionNumber: card.RepetitionNumber,
+			IntervalNumber:   card.IntervalNumber,
+			StudyTime:        card.StudyTime.UTC(),
+		}
+	}
+	return j.cards.Write(fileCard)
+}
+
+func (j *jsonDeckWriter) Flush() error {
+	return nil
+}
+
+func (j *jsonDeckWriter) Close() error {
+	if err := j.cards.Close(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(j.out, "}\n")
+	return err
+}
+
+func (s *Service) ImportJSONHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ImportJSONHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	path, err := s.saveUpload(w, r, user.ID, ".json")
+	if err != nil {
+		logger.Error("[ImportJSONHandler] Save upload got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := s.startJob(r.Context(), user.ID, jobTypeJSONImport, func(ctx context.Context, progress *jobProgress) (any, error) {
+		defer os.Remove(path)
+		return s.importDeckFile(ctx, user.ID, path, progress)
+	})
+	if err != nil {
+		os.Remove(path)
+		logger.Error("[ImportJSONHandler] Start job got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusAccepted, s.parseJobItem(job))
+}
+
+// importDeckFile reads a dto.DeckFile token by token so that the cards array is never held in memory.
+func (s *Service) importDeckFile(ctx context.Context, userID int32, path string, progress *jobProgress) (*dto.ImportSummary, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	progress.SetTotal(int(info.Size()))
+
+	source := &countingReader{reader: file}
+	decoder := json.NewDecoder(source)
+	if err := expectJSONDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	decks, err := s.newDeckPathResolver(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	summary := &dto.ImportSummary{Skipped: []dto.SkippedItem{}}
+	var header dto.DeckFile
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return summary, err
+		}
+		switch token {
+		case "schema":
+			err = decoder.Decode(&header.Schema)
+		case "version":
+			err = decoder.Decode(&header.Version)
+		case "deck":
+			err = decoder.Decode(&header.Deck)
+		case "cards":
+			if header.Schema != constant.DeckFileSchema {
+				return summary, fmt.Errorf("file is not a %s file, schema and version must come before cards", constant.DeckFileSchema)
+			}
+			if header.Version < 1 || header.Version > constant.DeckFileVersion {
+				return summary, fmt.Errorf("unsupported %s version %d", constant.DeckFileSchema, header.Version)
+			}
+			err = s.importDeckFileCards(ctx, userID, decoder, source, header, decks, summary, progress)
+		default:
+			var ignored json.RawMessage
+			err = decoder.Decode(&ignored)
+		}
+		if err != nil {
+			return summary, err
+		}
+	}
+	summary.Decks = decks.created
+	return summary, nil
+}
+
+func (s *Service) importDeckFileCards(ctx context.Context, userID int32, decoder *json.Decoder, source *countingReader, header dto.DeckFile, decks *deckPathResolver, summary *dto.ImportSummary, progress *jobProgress) error {
+	if err := expectJSONDelim(decoder, '['); err != nil {
+		return err
+	}
+	batch := make([]*models.Card, 0, importBatchSize)
+	var reported int64
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := s.CardRepository.CreateCards(ctx, batch); err != nil {
+				return err
+			}
+			summary.Cards += len(batch)
+			batch = batch[:0]
+		}
+		progress.Advance(int(source.count - reported))
+		reported = source.count
+		return nil
+	}
+
+	for index := 0; decoder.More(); index++ {
+		var fileCard dto.DeckFileCard
+		if err := decoder.Decode(&fileCard); err != nil {
+			// the position in the stream is lost after a syntax error
+			return fmt.Errorf("card %d: %w", index+1, err)
+		}
+		card, err := s.parseDeckFileCard(ctx, userID, fileCard, header, decks)
+		if err != nil {
+			skip(summary, "card", strconv.Itoa(index+1), err.Error())
+			continue
+		}
+		batch = append(batch, card)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := expectJSONDelim(decoder, ']'); err != nil {
+		return err
+	}
+	return flush()
+}
+
+func (s *Service) parseDeckFileCard(ctx context.Context, userID int32, fileCard dto.DeckFileCard, header dto.DeckFile, decks *deckPathResolver) (*models.Card, error) {
+	if fileCard.Front == "" {
+		return nil, fmt.Errorf("front is empty")
+	}
+	if fileCard.Back == "" {
+		return nil, fmt.Errorf("back is empty")
+	}
+	deckPath := fileCard.Deck
+	if deckPath == "" {
+		deckPath = header.Deck
+	}
+	deckID, err := decks.resolve(ctx, deckPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve deck %q: %w", deckPath, err)
+	}
+
+	card := &models.Card{
+		Front:      fileCard.Front,
+		Back:       fileCard.Back,
+		Tags:       helpers.JoinTags(fileCard.Tags),
+		DeckID:     deckID,
+		UserID:     userID,
+		TypeAnswer: fileCard.TypeAnswer,
+	}
+	if scheduling := fileCard.Scheduling; scheduling != nil {
+		card.EasinessFactor = max(scheduling.EasinessFactor, minEasinessFactor)
+		card.RepetitionNumber = max(scheduling.RepetitionNumber, 0)
+		card.IntervalNumber = max(scheduling.IntervalNumber, 0)
+		card.StudyTime = scheduling.StudyTime
+	}
+	return card, nil
+}
+
+func expectJSONDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid file, expected %q but got %v", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/jwtkeys"
+)
+
+// jwksMaxAge is how long verifiers may cache the key set, a key is published at least this long
+// before it signs.
+const jwksMaxAge = 300
+
+// JWKSHandler publishes the public keys access tokens are signed with, so other services can verify
+// them. The set is empty when the tokens are signed with the access key secret.
+func (s *Service) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keySet := jwtkeys.JSONWebKeySet{Keys: []jwtkeys.JSONWebKey{}}
+	if s.accessKeys != nil {
+		keySet = s.accessKeys.JWKS()
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+	// the document is read by JWT libraries, which expect it as is rather than in the api envelope
+	helpers.WriteRawJSON(w, http.StatusOK, keySet)
+}
+
+// ParseAccessToken verifies an access token and returns its claims. Tokens signed with the access
+// key secret are still accepted next to the key set while the secret is configured, so switching
+// to keys does not log anyone out.
+func (s *Service) ParseAccessToken(tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.accessTokenKey,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *Service) accessTokenKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if s.Config.AccessKeySecret == "" {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(s.Config.AccessKeySecret), nil
+	}
+	if s.accessKeys == nil {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	return s.accessKeys.Keyfunc(token)
+}
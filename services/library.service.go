@@ -0,0 +1,618 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+	"github.com/mrgThang/flashcard-be/repositories"
+)
+
+var deckReportReasons = []string{
+	models.DeckReportReasonSpam,
+	models.DeckReportReasonOffensive,
+	models.DeckReportReasonCopyright,
+	models.DeckReportReasonOther,
+}
+
+func (s *Service) PublishDeckHandler(w http.ResponseWriter, r *http.Request) {
+	deckID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[PublishDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	req, err := s.parsePublishDeckRequest(r)
+	if err != nil {
+		logger.Error("[PublishDeckHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[PublishDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	access, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner)
+	if err != nil {
+		logger.Error("[PublishDeckHandler] Authorize deck got error", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	publishedDeck, err := s.PublishedDeckRepository.GetPublishedDeckByDeck(r.Context(), deckID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		publishedDeck, err = &models.PublishedDeck{DeckID: deckID, UserID: user.ID, PublishedAt: time.Now()}, nil
+	}
+	if err != nil {
+		logger.Error("[PublishDeckHandler] PublishedDeckRepository.GetPublishedDeckByDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cardCount, err := s.CardRepository.CountCards(r.Context(), dto.GetCardsRequest{DeckIDs: helpers.DeckSubtreeIDs(access.OwnerDecks, deckID)})
+	if err != nil {
+		logger.Error("[PublishDeckHandler] CardRepository.CountCards got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	publishedDeck.Title = req.Title
+	publishedDeck.Description = req.Description
+	publishedDeck.Language = req.Language
+	publishedDeck.Tags = helpers.JoinTags(req.Tags)
+	publishedDeck.CardCount = int32(cardCount)
+	if err := s.PublishedDeckRepository.SavePublishedDeck(r.Context(), publishedDeck); err != nil {
+		logger.Error("[PublishDeckHandler] PublishedDeckRepository.SavePublishedDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseLibraryDeckItem(&models.PublishedDeckWithAuthor{
+		PublishedDeck: *publishedDeck,
+		AuthorName:    user.Name,
+	}))
+}
+
+func (s *Service) parsePublishDeckRequest(r *http.Request) (*dto.PublishDeckRequest, error) {
+	var req dto.PublishDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parsePublishDeckRequest] Decode json from req got error", zap.Error(err))
+		return nil, err
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	req.Language = strings.ToLower(strings.TrimSpace(req.Language))
+	if req.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if len(req.Title) > 100 {
+		return nil, fmt.Errorf("title can not be longer than 100 characters")
+	}
+	if len(req.Description) > 1000 {
+		return nil, fmt.Errorf("description can not be longer than 1000 characters")
+	}
+	if len(req.Language) > 20 {
+		return nil, fmt.Errorf("language can not be longer than 20 characters")
+	}
+	return &req, nil
+}
+
+func (s *Service) UnpublishDeckHandler(w http.ResponseWriter, r *http.Request) {
+	deckID, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[UnpublishDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[UnpublishDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	if _, err := s.authorizeDeck(r.Context(), user, deckID, models.DeckRoleOwner); err != nil {
+		logger.Error("[UnpublishDeckHandler] Authorize deck got error", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	publishedDeck, err := s.PublishedDeckRepository.GetPublishedDeckByDeck(r.Context(), deckID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck is not published"))
+			return
+		}
+		logger.Error("[UnpublishDeckHandler] PublishedDeckRepository.GetPublishedDeckByDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := s.removeFromLibrary(r.Context(), publishedDeck.ID); err != nil {
+		logger.Error("[UnpublishDeckHandler] Unpublish deck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// removeFromLibrary deletes the published deck with its subscriptions, conflicts and reports. The
+// copies of the subscribers stay, they just stop receiving updates.
+func (s *Service) removeFromLibrary(ctx context.Context, publishedDeckID int32) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return s.deletePublishedDeck(ctx, publishedDeckID, tx)
+	})
+}
+
+func (s *Service) deletePublishedDeck(ctx context.Context, publishedDeckID int32, tx *gorm.DB) error {
+	if err := s.CardConflictRepository.DeleteConflictsByPublishedDeck(ctx, publishedDeckID, tx); err != nil {
+		return err
+	}
+	if err := s.DeckSubscriptionRepository.DeleteSubscriptionsByPublishedDeck(ctx, publishedDeckID, tx); err != nil {
+		return err
+	}
+	if err := s.DeckReportRepository.DeleteReportsByPublishedDeck(ctx, publishedDeckID, tx); err != nil {
+		return err
+	}
+	return s.PublishedDeckRepository.DeletePublishedDeck(ctx, publishedDeckID, tx)
+}
+
+func (s *Service) GetLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseGetLibraryRequest(r)
+	if err != nil {
+		logger.Error("[GetLibraryHandler] Invalid request parameters", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	publishedDecks, totalItems, err := s.PublishedDeckRepository.SearchPublishedDecks(r.Context(), *req)
+	if err != nil {
+		logger.Error("[GetLibraryHandler] PublishedDeckRepository.SearchPublishedDecks got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.LibraryDeckItem, len(publishedDecks))
+	for index, publishedDeck := range publishedDecks {
+		items[index] = s.parseLibraryDeckItem(publishedDeck)
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetLibraryResponse{
+		Pagination: dto.Pagination{
+			Page:       req.Page,
+			PageSize:   req.PageSize,
+			TotalItems: totalItems,
+		},
+		Decks: items,
+	})
+}
+
+func (s *Service) parseGetLibraryRequest(r *http.Request) (*dto.GetLibraryRequest, error) {
+	q := r.URL.Query()
+	req := dto.GetLibraryRequest{
+		Query:    strings.TrimSpace(q.Get("q")),
+		Language: strings.ToLower(strings.TrimSpace(q.Get("language"))),
+		Tag:      strings.TrimSpace(q.Get("tag")),
+		Sort:     constant.LibrarySortRecent,
+		Page:     constant.DefaultPage,
+		PageSize: constant.DefaultPageSize,
+	}
+	if sort := q.Get("sort"); sort != "" {
+		if sort != constant.LibrarySortRecent && sort != constant.LibrarySortPopular {
+			return nil, fmt.Errorf("sort must be one of %s or %s", constant.LibrarySortRecent, constant.LibrarySortPopular)
+		}
+		req.Sort = sort
+	}
+	if pageStr := q.Get("page"); pageStr != "" {
+		page, err := strconv.Atoi(pageStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page")
+		}
+		req.Page = page
+	}
+	if pageSizeStr := q.Get("pageSize"); pageSizeStr != "" {
+		pageSize, err := strconv.Atoi(pageSizeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pageSize")
+		}
+		req.PageSize = pageSize
+	}
+	return &req, nil
+}
+
+func (s *Service) parseLibraryDeckItem(publishedDeck *models.PublishedDeckWithAuthor) dto.LibraryDeckItem {
+	return dto.LibraryDeckItem{
+		ID:              publishedDeck.ID,
+		DeckID:          publishedDeck.DeckID,
+		Title:           publishedDeck.Title,
+		Description:     publishedDeck.Description,
+		Language:        publishedDeck.Language,
+		Tags:            helpers.SplitTags(publishedDeck.Tags),
+		Author:          publishedDeck.AuthorName,
+		CardCount:       publishedDeck.CardCount,
+		SubscriberCount: publishedDeck.SubscriberCount,
+		ForkCount:       publishedDeck.ForkCount,
+		Hidden:          publishedDeck.Hidden,
+		PublishedAt:     publishedDeck.PublishedAt,
+		UpdatedAt:       publishedDeck.UpdatedAt,
+	}
+}
+
+func (s *Service) GetLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[GetLibraryDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	publishedDeck, err := s.getPublishedDeck(r.Context(), user, id)
+	if err != nil {
+		logger.Error("[GetLibraryDeckHandler] Get published deck got error", zap.Int32("id", id), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseLibraryDeckItem(publishedDeck))
+}
+
+// getPublishedDeck returns a deck of the library, hidden decks are only visible to their author.
+func (s *Service) getPublishedDeck(ctx context.Context, user models.User, id int32, dbs ...*gorm.DB) (*models.PublishedDeckWithAuthor, error) {
+	publishedDeck, err := s.PublishedDeckRepository.GetPublishedDeck(ctx, id, dbs...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("published deck not found"))
+		}
+		return nil, err
+	}
+	if publishedDeck.Hidden && publishedDeck.UserID != user.ID {
+		return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("published deck not found"))
+	}
+	return publishedDeck, nil
+}
+
+func (s *Service) GetSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetSubscriptionsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	subscriptions, err := s.DeckSubscriptionRepository.GetSubscriptionsByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetSubscriptionsHandler] DeckSubscriptionRepository.GetSubscriptionsByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.SubscriptionItem, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		publishedDeck, err := s.PublishedDeckRepository.GetPublishedDeck(r.Context(), subscription.PublishedDeckID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the author moved the deck to the trash
+			continue
+		}
+		if err != nil {
+			logger.Error("[GetSubscriptionsHandler] PublishedDeckRepository.GetPublishedDeck got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		items = append(items, dto.SubscriptionItem{
+			Deck:        s.parseLibraryDeckItem(publishedDeck),
+			LocalDeckID: subscription.DeckID,
+			SyncedAt:    subscription.SyncedAt,
+		})
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetSubscriptionsResponse{Subscriptions: items})
+}
+
+// SubscribeLibraryDeckHandler copies a published deck to the decks of the user, the copy keeps
+// receiving the content changes of the published deck through SyncLibraryDeckHandler.
+func (s *Service) SubscribeLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[SubscribeLibraryDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[SubscribeLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	var response *dto.LibraryCopyResponse
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		publishedDeck, err := s.getPublishedDeck(r.Context(), user, id, tx)
+		if err != nil {
+			return err
+		}
+		if publishedDeck.UserID == user.ID {
+			return helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("can not subscribe to your own deck"))
+		}
+		_, err = s.DeckSubscriptionRepository.GetSubscription(r.Context(), id, user.ID, tx)
+		if err == nil {
+			return helpers.NewHTTPError(http.StatusConflict, fmt.Errorf("already subscribed to this deck"))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		response, err = s.copyPublishedDeck(r.Context(), tx, &publishedDeck.PublishedDeck, user.ID, true)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		err = s.DeckSubscriptionRepository.CreateSubscription(r.Context(), &models.DeckSubscription{
+			PublishedDeckID: id,
+			UserID:          user.ID,
+			DeckID:          response.DeckID,
+			SyncedAt:        &now,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		return s.PublishedDeckRepository.IncrementCounter(r.Context(), id, repositories.PublishedDeckSubscriberCount, 1, tx)
+	})
+	if err != nil {
+		logger.Error("[SubscribeLibraryDeckHandler] Subscribe got error", zap.Int32("id", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, response)
+}
+
+// UnsubscribeLibraryDeckHandler stops the updates of a subscription, the copy stays as a regular deck.
+func (s *Service) UnsubscribeLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[UnsubscribeLibraryDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[UnsubscribeLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := s.DeckSubscriptionRepository.GetSubscription(r.Context(), id, user.ID, tx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("subscription not found"))
+			}
+			return err
+		}
+		if err := s.CardConflictRepository.DeleteConflictsBySubscription(r.Context(), subscription.ID, tx); err != nil {
+			return err
+		}
+		if err := s.DeckSubscriptionRepository.DeleteSubscription(r.Context(), subscription.ID, tx); err != nil {
+			return err
+		}
+		return s.PublishedDeckRepository.IncrementCounter(r.Context(), id, repositories.PublishedDeckSubscriberCount, -1, tx)
+	})
+	if err != nil {
+		logger.Error("[UnsubscribeLibraryDeckHandler] Unsubscribe got error", zap.Int32("id", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// ForkLibraryDeckHandler copies a published deck to the decks of the user as an independent deck.
+func (s *Service) ForkLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[ForkLibraryDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ForkLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	var response *dto.LibraryCopyResponse
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		publishedDeck, err := s.getPublishedDeck(r.Context(), user, id, tx)
+		if err != nil {
+			return err
+		}
+		response, err = s.copyPublishedDeck(r.Context(), tx, &publishedDeck.PublishedDeck, user.ID, false)
+		if err != nil {
+			return err
+		}
+		return s.PublishedDeckRepository.IncrementCounter(r.Context(), id, repositories.PublishedDeckForkCount, 1, tx)
+	})
+	if err != nil {
+		logger.Error("[ForkLibraryDeckHandler] Fork got error", zap.Int32("id", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, response)
+}
+
+// copyPublishedDeck copies the deck tree and the cards of a published deck to the user, as new
+// cards. The copy of a subscription remembers the decks and cards it was copied from.
+func (s *Service) copyPublishedDeck(ctx context.Context, tx *gorm.DB, publishedDeck *models.PublishedDeck, userID int32, subscribe bool) (*dto.LibraryCopyResponse, error) {
+	authorDecks, err := s.DeckRepository.GetDecksByUser(ctx, publishedDeck.UserID, tx)
+	if err != nil {
+		return nil, err
+	}
+	sourceDeckIDs := helpers.DeckSubtreeIDs(authorDecks, publishedDeck.DeckID)
+	deckIDs := make(map[int32]int32, len(sourceDeckIDs))
+	if err := s.copyPublishedDecks(ctx, tx, publishedDeck, authorDecks, sourceDeckIDs, deckIDs, userID, subscribe); err != nil {
+		return nil, err
+	}
+
+	response := &dto.LibraryCopyResponse{DeckID: deckIDs[publishedDeck.DeckID], Decks: len(deckIDs)}
+	err = s.CardRepository.StreamCards(ctx, dto.GetCardsRequest{DeckIDs: sourceDeckIDs}, importBatchSize, func(cards []*models.Card) error {
+		response.Cards += len(cards)
+		return s.copyPublishedCards(ctx, tx, cards, deckIDs, userID, subscribe)
+	}, tx)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// copyPublishedDecks creates the decks of sourceDeckIDs that are not in deckIDs yet, parents
+// first, and records the id of each copy in deckIDs. The root of the copy is named after the title.
+func (s *Service) copyPublishedDecks(ctx context.Context, tx *gorm.DB, publishedDeck *models.PublishedDeck, authorDecks []*models.DeckWithStats, sourceDeckIDs []int32, deckIDs map[int32]int32, userID int32, subscribe bool) error {
+	byID := make(map[int32]*models.DeckWithStats, len(authorDecks))
+	for _, deck := range authorDecks {
+		byID[deck.ID] = deck
+	}
+	for _, sourceID := range sourceDeckIDs {
+		if _, ok := deckIDs[sourceID]; ok {
+			continue
+		}
+		source := byID[sourceID]
+		req := dto.CreateDeckRequest{
+			Name:        source.Name,
+			Description: source.Description,
+			UserID:      userID,
+		}
+		if sourceID == publishedDeck.DeckID {
+			req.Name = publishedDeck.Title
+		} else if parentID, ok := deckIDs[*source.ParentID]; ok {
+			req.ParentID = &parentID
+		}
+		if subscribe {
+			req.SourceDeckID = &sourceID
+		}
+		deck, err := s.DeckRepository.CreateDeck(ctx, req, tx)
+		if err != nil {
+			return err
+		}
+		deckIDs[sourceID] = deck.ID
+	}
+	return nil
+}
+
+// copyPublishedCards creates new cards with the content of the published cards. Subscribed copies
+// record the content they were copied from, which later syncs compare with.
+func (s *Service) copyPublishedCards(ctx context.Context, tx *gorm.DB, cards []*models.Card, deckIDs map[int32]int32, userID int32, subscribe bool) error {
+	copies := make([]*models.Card, len(cards))
+	for index, card := range cards {
+		copies[index] = &models.Card{
+			Front:      card.Front,
+			Back:       card.Back,
+			Tags:       card.Tags,
+			DeckID:     deckIDs[card.DeckID],
+			UserID:     userID,
+			TypeAnswer: card.TypeAnswer,
+		}
+	}
+	if err := s.CardRepository.CreateCards(ctx, copies, tx); err != nil {
+		return err
+	}
+	if !subscribe {
+		return nil
+	}
+	upstreams := make([]*models.CardUpstream, len(cards))
+	for index, card := range cards {
+		upstreams[index] = &models.CardUpstream{
+			CardID:     copies[index].ID,
+			SourceGUID: card.GUID,
+			Version:    card.ContentVersion,
+			Front:      card.Front,
+			Back:       card.Back,
+			Tags:       card.Tags,
+		}
+	}
+	return s.CardUpstreamRepository.CreateUpstreams(ctx, upstreams, tx)
+}
+
+func (s *Service) ReportLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[ReportLibraryDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req dto.ReportDeckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[ReportLibraryDeckHandler] Decode json from req got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !slices.Contains(deckReportReasons, req.Reason) {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("reason must be one of %s", strings.Join(deckReportReasons, ", ")))
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ReportLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		publishedDeck, err := s.getPublishedDeck(r.Context(), user, id, tx)
+		if err != nil {
+			return err
+		}
+		if publishedDeck.UserID == user.ID {
+			return helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("can not report your own deck"))
+		}
+		reported, err := s.DeckReportRepository.HasReported(r.Context(), id, user.ID, tx)
+		if err != nil {
+			return err
+		}
+		if reported {
+			return helpers.NewHTTPError(http.StatusConflict, fmt.Errorf("already reported this deck"))
+		}
+		err = s.DeckReportRepository.CreateReport(r.Context(), &models.DeckReport{
+			PublishedDeckID: id,
+			UserID:          user.ID,
+			Reason:          req.Reason,
+			Details:         req.Details,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		if err := s.PublishedDeckRepository.IncrementCounter(r.Context(), id, repositories.PublishedDeckReportCount, 1, tx); err != nil {
+			return err
+		}
+		if publishedDeck.ReportCount+1 >= s.Config.LibraryReportHideThreshold {
+			logger.Info("[ReportLibraryDeckHandler] Hiding reported deck", zap.Int32("id", id))
+			return s.PublishedDeckRepository.HidePublishedDeck(r.Context(), id, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("[ReportLibraryDeckHandler] Report got error", zap.Int32("id", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusCreated, any(nil))
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	jobTypeLibrarySync = "library_sync"
+
+	librarySyncInterval = time.Hour
+)
+
+// SyncLibraryDeckHandler starts a job bringing the copy of a subscribed deck up to date with the published deck.
+func (s *Service) SyncLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[SyncLibraryDeckHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[SyncLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	subscription, err := s.getSubscription(r.Context(), user, id)
+	if err != nil {
+		logger.Error("[SyncLibraryDeckHandler] Get subscription got error", zap.Int32("id", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	publishedDeck, err := s.getPublishedDeck(r.Context(), user, id)
+	if err != nil {
+		logger.Error("[SyncLibraryDeckHandler] Get published deck got error", zap.Int32("id", id), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+
+	job, err := s.startJob(r.Context(), user.ID, jobTypeLibrarySync, func(ctx context.Context, progress *jobProgress) (any, error) {
+		var response *dto.SyncSubscriptionResponse
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			response, err = s.syncSubscription(ctx, tx, &publishedDeck.PublishedDeck, subscription, progress)
+			return err
+		})
+		return response, err
+	})
+	if err != nil {
+		logger.Error("[SyncLibraryDeckHandler] Start job got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusAccepted, s.parseJobItem(job))
+}
+
+func (s *Service) getSubscription(ctx context.Context, user models.User, publishedDeckID int32, dbs ...*gorm.DB) (*models.DeckSubscription, error) {
+	subscription, err := s.DeckSubscriptionRepository.GetSubscription(ctx, publishedDeckID, user.ID, dbs...)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("subscription not found"))
+		}
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// RunSubscriptionSyncer syncs the subscriptions that were not synced for an interval, until ctx is cancelled.
+func (s *Service) RunSubscriptionSyncer(ctx context.Context) {
+	ticker := time.NewTicker(librarySyncInterval)
+	defer ticker.Stop()
+	for {
+		s.syncStaleSubscriptions(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) syncStaleSubscriptions(ctx context.Context) {
+	subscriptions, err := s.DeckSubscriptionRepository.GetSubscriptionsSyncedBefore(ctx, time.Now().Add(-librarySyncInterval))
+	if err != nil {
+		logger.Error("[syncStaleSubscriptions] DeckSubscriptionRepository.GetSubscriptionsSyncedBefore got error", zap.Error(err))
+		return
+	}
+	for _, subscription := range subscriptions {
+		publishedDeck, err := s.PublishedDeckRepository.GetPublishedDeck(ctx, subscription.PublishedDeckID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the author moved the deck to the trash
+			continue
+		}
+		if err != nil {
+			logger.Error("[syncStaleSubscriptions] PublishedDeckRepository.GetPublishedDeck got error", zap.Int32("subscriptionId", subscription.ID), zap.Error(err))
+			continue
+		}
+		if publishedDeck.Hidden {
+			continue
+		}
+		var response *dto.SyncSubscriptionResponse
+		err = s.DB.Transaction(func(tx *gorm.DB) error {
+			response, err = s.syncSubscription(ctx, tx, &publishedDeck.PublishedDeck, subscription, nil)
+			return err
+		})
+		if err != nil {
+			logger.Error("[syncStaleSubscriptions] Sync subscription got error", zap.Int32("subscriptionId", subscription.ID), zap.Error(err))
+			continue
+		}
+		if response.Added > 0 || response.Updated > 0 || response.Conflicts > 0 {
+			logger.Info("[syncStaleSubscriptions] Subscription synced", zap.Int32("subscriptionId", subscription.ID),
+				zap.Int("added", response.Added), zap.Int("updated", response.Updated), zap.Int("conflicts", response.Conflicts))
+		}
+	}
+}
+
+// syncSubscription applies the changes of the published deck to the copy of the subscriber, keeping
+// the scheduling state of the copy. Cards are matched by GUID, and only the cards whose content
+// version moved since the last sync are merged: a field changed upstream is applied unless the
+// subscriber edited it too, in which case the local value is kept and a conflict is recorded.
+// Cards the subscriber moved to the trash are not brought back. progress can be nil.
+func (s *Service) syncSubscription(ctx context.Context, tx *gorm.DB, publishedDeck *models.PublishedDeck, subscription *models.DeckSubscription, progress *jobProgress) (*dto.SyncSubscriptionResponse, error) {
+	userDecks, err := s.DeckRepository.GetDecksByUser(ctx, subscription.UserID, tx)
+	if err != nil {
+		return nil, err
+	}
+	localDeckIDs := helpers.DeckSubtreeIDs(userDecks, subscription.DeckID)
+	deckIDs := map[int32]int32{publishedDeck.DeckID: subscription.DeckID}
+	found := false
+	for _, deck := range userDecks {
+		if deck.ID == subscription.DeckID {
+			found = true
+		}
+		if deck.SourceDeckID != nil && helpers.IsDeckInSubtree(userDecks, subscription.DeckID, deck.ID) {
+			deckIDs[*deck.SourceDeckID] = deck.ID
+		}
+	}
+	if !found {
+		return nil, helpers.NewHTTPError(http.StatusConflict, fmt.Errorf("the copy of the subscribed deck is in the trash"))
+	}
+
+	authorDecks, err := s.DeckRepository.GetDecksByUser(ctx, publishedDeck.UserID, tx)
+	if err != nil {
+		return nil, err
+	}
+	sourceDeckIDs := helpers.DeckSubtreeIDs(authorDecks, publishedDeck.DeckID)
+	copiedDecks := len(deckIDs)
+	if err := s.copyPublishedDecks(ctx, tx, publishedDeck, authorDecks, sourceDeckIDs, deckIDs, subscription.UserID, true); err != nil {
+		return nil, err
+	}
+	response := &dto.SyncSubscriptionResponse{DeckID: subscription.DeckID, Decks: len(deckIDs) - copiedDecks}
+
+	if progress != nil {
+		total, err := s.CardRepository.CountCards(ctx, dto.GetCardsRequest{DeckIDs: sourceDeckIDs}, tx)
+		if err != nil {
+			return nil, err
+		}
+		progress.SetTotal(int(total))
+	}
+
+	localCards, err := s.CardRepository.GetAllCards(ctx, dto.GetCardsRequest{DeckIDs: localDeckIDs, WithDeleted: true}, tx)
+	if err != nil {
+		return nil, err
+	}
+	cardsByID := make(map[int32]*models.Card, len(localCards))
+	for _, card := range localCards {
+		cardsByID[card.ID] = card
+	}
+	upstreams, err := s.CardUpstreamRepository.GetUpstreamsByDecks(ctx, localDeckIDs, tx)
+	if err != nil {
+		return nil, err
+	}
+	upstreamsByGUID := make(map[string]*models.CardUpstream, len(upstreams))
+	for _, upstream := range upstreams {
+		upstreamsByGUID[upstream.SourceGUID] = upstream
+	}
+
+	err = s.CardRepository.StreamCards(ctx, dto.GetCardsRequest{DeckIDs: sourceDeckIDs}, importBatchSize, func(cards []*models.Card) error {
+		var added []*models.Card
+		for _, card := range cards {
+			upstream, ok := upstreamsByGUID[card.GUID]
+			if !ok {
+				added = append(added, card)
+				continue
+			}
+			local, ok := cardsByID[upstream.CardID]
+			if !ok || local.DeletedAt.Valid || card.ContentVersion <= upstream.Version {
+				continue
+			}
+			updated, conflicts, err := s.mergeUpstreamCard(ctx, tx, subscription, publishedDeck.UserID, local, upstream, card)
+			if err != nil {
+				return err
+			}
+			if updated {
+				response.Updated++
+			}
+			response.Conflicts += conflicts
+		}
+		if progress != nil {
+			progress.Advance(len(cards))
+		}
+		if len(added) == 0 {
+			return nil
+		}
+		response.Added += len(added)
+		return s.copyPublishedCards(ctx, tx, added, deckIDs, subscription.UserID, true)
+	}, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	subscription.SyncedAt = &now
+	if err := s.DeckSubscriptionRepository.UpdateSubscription(ctx, subscription, tx); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// mergeUpstreamCard does a three way merge of the published card into the local copy, with the
+// content of the last sync as the base, and records the fields that changed on both sides as conflicts.
+// The changes applied are recorded in the history of the copy as edits of the author.
+func (s *Service) mergeUpstreamCard(ctx context.Context, tx *gorm.DB, subscription *models.DeckSubscription, authorID int32, local *models.Card, upstream *models.CardUpstream, source *models.Card) (bool, int, error) {
+	front, back, tags := local.Front, local.Back, local.Tags
+	fields := []struct {
+		name     string
+		value    *string
+		base     string
+		upstream string
+	}{
+		{models.CardFieldFront, &front, upstream.Front, source.Front},
+		{models.CardFieldBack, &back, upstream.Back, source.Back},
+		{models.CardFieldTags, &tags, upstream.Tags, source.Tags},
+	}
+
+	if err := s.CardConflictRepository.DeleteConflictsByCard(ctx, local.ID, tx); err != nil {
+		return false, 0, err
+	}
+	conflicts := 0
+	for _, field := range fields {
+		switch {
+		case field.upstream == field.base || field.upstream == *field.value:
+		case *field.value == field.base:
+			*field.value = field.upstream
+		default:
+			err := s.CardConflictRepository.SaveConflict(ctx, &models.CardConflict{
+				SubscriptionID: subscription.ID,
+				CardID:         local.ID,
+				Field:          field.name,
+				LocalValue:     *field.value,
+				UpstreamValue:  field.upstream,
+			}, tx)
+			if err != nil {
+				return false, 0, err
+			}
+			conflicts++
+		}
+	}
+
+	updated, err := s.updateCardContent(ctx, tx, local, authorID, front, back, tags)
+	if err != nil {
+		return false, 0, err
+	}
+	upstream.Version = source.ContentVersion
+	upstream.Front, upstream.Back, upstream.Tags = source.Front, source.Back, source.Tags
+	if err := s.CardUpstreamRepository.SaveUpstream(ctx, upstream, tx); err != nil {
+		return false, 0, err
+	}
+	return updated, conflicts, nil
+}
+
+func (s *Service) GetCardConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[GetCardConflictsHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetCardConflictsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	subscription, err := s.getSubscription(r.Context(), user, id)
+	if err != nil {
+		logger.Error("[GetCardConflictsHandler] Get subscription got error", zap.Int32("id", id), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	conflicts, err := s.CardConflictRepository.GetConflictsBySubscription(r.Context(), subscription.ID)
+	if err != nil {
+		logger.Error("[GetCardConflictsHandler] CardConflictRepository.GetConflictsBySubscription got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.CardConflictItem, len(conflicts))
+	for index, conflict := range conflicts {
+		items[index] = dto.CardConflictItem{
+			ID:            conflict.ID,
+			CardID:        conflict.CardID,
+			Field:         conflict.Field,
+			LocalValue:    conflict.LocalValue,
+			UpstreamValue: conflict.UpstreamValue,
+			UpdatedAt:     conflict.UpdatedAt,
+		}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetCardConflictsResponse{Conflicts: items})
+}
+
+// ResolveCardConflictHandler keeps the local value of a conflicting field, or replaces it with the upstream one.
+func (s *Service) ResolveCardConflictHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		logger.Error("[ResolveCardConflictHandler] Invalid id", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	conflictID, err := parseURLID(r, "conflictId")
+	if err != nil {
+		logger.Error("[ResolveCardConflictHandler] Invalid conflictId", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req dto.ResolveCardConflictRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[ResolveCardConflictHandler] Decode json from req got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Keep != models.CardConflictKeepLocal && req.Keep != models.CardConflictKeepUpstream {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("keep must be one of %s or %s", models.CardConflictKeepLocal, models.CardConflictKeepUpstream))
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ResolveCardConflictHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		subscription, err := s.getSubscription(r.Context(), user, id, tx)
+		if err != nil {
+			return err
+		}
+		conflict, err := s.CardConflictRepository.GetConflict(r.Context(), conflictID, subscription.ID, tx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("conflict not found"))
+			}
+			return err
+		}
+		if req.Keep == models.CardConflictKeepUpstream {
+			if err := s.applyConflictUpstream(r.Context(), tx, conflict, user.ID); err != nil {
+				return err
+			}
+		}
+		return s.CardConflictRepository.DeleteConflict(r.Context(), conflict.ID, tx)
+	})
+	if err != nil {
+		logger.Error("[ResolveCardConflictHandler] Resolve conflict got error", zap.Int32("conflictId", conflictID), zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+func (s *Service) applyConflictUpstream(ctx context.Context, tx *gorm.DB, conflict *models.CardConflict, userID int32) error {
+	card, err := s.CardRepository.GetDetailCard(ctx, conflict.CardID, tx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// the card was deleted since, there is nothing to apply the value to
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	front, back, tags := card.Front, card.Back, card.Tags
+	switch conflict.Field {
+	case models.CardFieldFront:
+		front = conflict.UpstreamValue
+	case models.CardFieldBack:
+		back = conflict.UpstreamValue
+	case models.CardFieldTags:
+		tags = conflict.UpstreamValue
+	}
+	_, err = s.updateCardContent(ctx, tx, card, userID, front, back, tags)
+	return err
+}
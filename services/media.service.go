@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+func (s *Service) GetMediaHandler(w http.ResponseWriter, r *http.Request) {
+	filename, err := cleanMediaFilename(chi.URLParam(r, "filename"))
+	if err != nil {
+		logger.Error("[GetMediaHandler] Invalid filename", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetMediaHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	// media referenced by the cards of a shared deck belong to the owner of the deck
+	ownerID := user.ID
+	if deckIDStr := r.URL.Query().Get("deckId"); deckIDStr != "" {
+		deckID, err := strconv.Atoi(deckIDStr)
+		if err != nil || deckID <= 0 {
+			logger.Error("[GetMediaHandler] Invalid deckId", zap.String("deckId", deckIDStr))
+			helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid deckId"))
+			return
+		}
+		access, err := s.authorizeDeck(r.Context(), user, int32(deckID), models.DeckRoleViewer)
+		if err != nil {
+			logger.Error("[GetMediaHandler] Authorize deck got error", zap.Int("deckId", deckID), zap.Int32("userId", user.ID), zap.Error(err))
+			helpers.WriteError(w, err)
+			return
+		}
+		ownerID = access.Deck.UserID
+	}
+
+	media, err := s.MediaRepository.GetMedia(r.Context(), ownerID, filename)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Error("[GetMediaHandler] Media not found", zap.String("filename", filename))
+			helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("media not found"))
+			return
+		}
+		logger.Error("[GetMediaHandler] MediaRepository.GetMedia got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	file, err := os.Open(s.mediaPath(ownerID, media.Filename))
+	if err != nil {
+		logger.Error("[GetMediaHandler] Open media file got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(media.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		logger.Error("[GetMediaHandler] Write media got error", zap.Error(err))
+	}
+}
+
+// storeMedia writes a media file of the user to the storage, replacing a file with the same name.
+func (s *Service) storeMedia(ctx context.Context, userID int32, filename string, content io.Reader) error {
+	filename, err := cleanMediaFilename(filename)
+	if err != nil {
+		return err
+	}
+	path := s.mediaPath(userID, filename)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return s.MediaRepository.SaveMedia(ctx, &models.Media{
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+	})
+}
+
+func (s *Service) mediaPath(userID int32, filename string) string {
+	return filepath.Join(s.mediaDir(userID), filename)
+}
+
+func (s *Service) mediaDir(userID int32) string {
+	return filepath.Join(s.Config.StorageDir, "media", strconv.Itoa(int(userID)))
+}
+
+// cleanMediaFilename rejects names that could escape the media directory of the user.
+func cleanMediaFilename(filename string) (string, error) {
+	if filename == "" || filename != filepath.Base(filename) || filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) {
+		return "", fmt.Errorf("invalid media filename %q", filename)
+	}
+	return filename, nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// AdminGetLibraryHandler lists the published decks for the moderators, hidden ones included and the
+// most reported first, filtered by `q` and `hidden`.
+func (s *Service) AdminGetLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := dto.AdminGetLibraryRequest{Query: strings.TrimSpace(q.Get("q"))}
+	var err error
+	if req.Hidden, err = parseOptionalBool(q, "hidden"); err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Page, req.PageSize, err = parsePage(q); err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	publishedDecks, totalItems, err := s.PublishedDeckRepository.SearchModeratedDecks(r.Context(), req)
+	if err != nil {
+		logger.Error("[AdminGetLibraryHandler] PublishedDeckRepository.SearchModeratedDecks got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.AdminLibraryDeckItem, len(publishedDecks))
+	for index, publishedDeck := range publishedDecks {
+		items[index] = dto.AdminLibraryDeckItem{
+			LibraryDeckItem: s.parseLibraryDeckItem(publishedDeck),
+			AuthorID:        publishedDeck.UserID,
+			ReportCount:     publishedDeck.ReportCount,
+		}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetLibraryResponse{
+		Pagination: dto.Pagination{
+			Page:       req.Page,
+			PageSize:   req.PageSize,
+			TotalItems: totalItems,
+		},
+		Decks: items,
+	})
+}
+
+func (s *Service) AdminGetDeckReportsHandler(w http.ResponseWriter, r *http.Request) {
+	publishedDeck, err := s.getModeratedDeck(r)
+	if err != nil {
+		logger.Error("[AdminGetDeckReportsHandler] Get published deck got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	reports, err := s.DeckReportRepository.GetReportsByPublishedDeck(r.Context(), publishedDeck.ID)
+	if err != nil {
+		logger.Error("[AdminGetDeckReportsHandler] DeckReportRepository.GetReportsByPublishedDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.DeckReportItem, len(reports))
+	for index, report := range reports {
+		items[index] = dto.DeckReportItem{
+			ID:        report.ID,
+			UserID:    report.UserID,
+			Reason:    report.Reason,
+			Details:   report.Details,
+			CreatedAt: report.CreatedAt,
+		}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.AdminGetDeckReportsResponse{Reports: items})
+}
+
+// AdminHideLibraryDeckHandler hides a published deck from the library, its subscribers keep their
+// copies and updates.
+func (s *Service) AdminHideLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminHideLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	publishedDeck, err := s.getModeratedDeck(r)
+	if err != nil {
+		logger.Error("[AdminHideLibraryDeckHandler] Get published deck got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if err := s.PublishedDeckRepository.HidePublishedDeck(r.Context(), publishedDeck.ID); err != nil {
+		logger.Error("[AdminHideLibraryDeckHandler] PublishedDeckRepository.HidePublishedDeck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminHideLibraryDeckHandler] Deck hidden", zap.Int32("moderatorId", moderator.ID), zap.Int32("id", publishedDeck.ID))
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// AdminUnhideLibraryDeckHandler lists a hidden deck in the library again and dismisses its reports.
+func (s *Service) AdminUnhideLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminUnhideLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	publishedDeck, err := s.getModeratedDeck(r)
+	if err != nil {
+		logger.Error("[AdminUnhideLibraryDeckHandler] Get published deck got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.DeckReportRepository.DeleteReportsByPublishedDeck(r.Context(), publishedDeck.ID, tx); err != nil {
+			return err
+		}
+		return s.PublishedDeckRepository.UnhidePublishedDeck(r.Context(), publishedDeck.ID, tx)
+	})
+	if err != nil {
+		logger.Error("[AdminUnhideLibraryDeckHandler] Unhide deck got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminUnhideLibraryDeckHandler] Deck unhidden", zap.Int32("moderatorId", moderator.ID), zap.Int32("id", publishedDeck.ID))
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// AdminDeleteLibraryDeckHandler removes a deck from the library as if its author unpublished it,
+// the deck of the author stays.
+func (s *Service) AdminDeleteLibraryDeckHandler(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[AdminDeleteLibraryDeckHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	publishedDeck, err := s.getModeratedDeck(r)
+	if err != nil {
+		logger.Error("[AdminDeleteLibraryDeckHandler] Get published deck got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if err := s.removeFromLibrary(r.Context(), publishedDeck.ID); err != nil {
+		logger.Error("[AdminDeleteLibraryDeckHandler] Remove from library got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[AdminDeleteLibraryDeckHandler] Deck removed from library", zap.Int32("moderatorId", moderator.ID), zap.Int32("id", publishedDeck.ID))
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// getModeratedDeck returns the published deck of the id url parameter, hidden or not.
+func (s *Service) getModeratedDeck(r *http.Request) (*models.PublishedDeckWithAuthor, error) {
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		return nil, helpers.NewHTTPError(http.StatusBadRequest, err)
+	}
+	publishedDeck, err := s.PublishedDeckRepository.GetPublishedDeck(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("published deck not found"))
+		}
+		return nil, err
+	}
+	return publishedDeck, nil
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+	"github.com/mrgThang/flashcard-be/oidc"
+)
+
+const (
+	oidcStateCookie   = "oidc_state"
+	oidcStateAudience = "oidc_state"
+	oidcStateTTL      = 10 * time.Minute
+	// oidcCallbackPath is the page of the app the sign-in ends on, with the tokens or the error in
+	// the fragment so they never reach a server log.
+	oidcCallbackPath = "/oauth/callback"
+)
+
+// Errors of the sign-in with a provider, their message is the error code the app receives.
+var (
+	errOIDCInvalidState  = errors.New("invalid_state")
+	errOIDCAccessDenied  = errors.New("access_denied")
+	errOIDCEmailRequired = errors.New("email_required")
+	errOIDCEmailInUse    = errors.New("email_in_use")
+	errOIDCDisabled      = errors.New("account_disabled")
+	errOIDCSignInFailed  = errors.New("sign_in_failed")
+)
+
+// oidcStateClaims are kept in a cookie during a sign-in, ID is the state sent to the provider.
+type oidcStateClaims struct {
+	jwt.RegisteredClaims
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"cv"`
+}
+
+// GetOIDCProvidersHandler lists the names of the providers users can sign in with.
+func (s *Service) GetOIDCProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	providers := make([]string, 0, len(s.OIDCProviders))
+	for name := range s.OIDCProviders {
+		providers = append(providers, name)
+	}
+	slices.Sort(providers)
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetOIDCProvidersResponse{Providers: providers})
+}
+
+// OIDCLoginHandler redirects to the sign-in page of the provider.
+func (s *Service) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := s.OIDCProviders[name]
+	if !ok {
+		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("provider not found"))
+		return
+	}
+
+	now := time.Now()
+	claims := oidcStateClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        oidc.RandomString(),
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+		},
+		Provider:     name,
+		Nonce:        oidc.RandomString(),
+		CodeVerifier: oidc.RandomString(),
+	}
+	stateCookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.Config.ActionKeySecret))
+	if err != nil {
+		logger.Error("[OIDCLoginHandler] Sign state got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), s.oidcAuthRequest(&claims))
+	if err != nil {
+		logger.Error("[OIDCLoginHandler] Provider.AuthCodeURL got error", zap.String("provider", name), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadGateway, fmt.Errorf("provider is unavailable"))
+		return
+	}
+
+	http.SetCookie(w, s.oidcStateCookie(name, stateCookie, int(oidcStateTTL/time.Second)))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes the sign-in the provider redirects back from: it signs in the user
+// linked to the identity, links the account with the same verified email, or creates an account,
+// then redirects to the app with the tokens of the new session, or the challenge token of the
+// second factor.
+func (s *Service) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := s.OIDCProviders[name]
+	if !ok {
+		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("provider not found"))
+		return
+	}
+	// the state is single use
+	http.SetCookie(w, s.oidcStateCookie(name, "", -1))
+
+	response, err := s.finishOIDCSignIn(r, name, provider)
+	if err != nil {
+		logger.Error("[OIDCCallbackHandler] Sign in got error", zap.String("provider", name), zap.Error(err))
+		code := errOIDCSignInFailed.Error()
+		for _, known := range []error{errOIDCInvalidState, errOIDCAccessDenied, errOIDCEmailRequired, errOIDCEmailInUse, errOIDCDisabled} {
+			if errors.Is(err, known) {
+				code = known.Error()
+			}
+		}
+		http.Redirect(w, r, s.oidcAppURL(url.Values{"error": {code}}), http.StatusFound)
+		return
+	}
+	fragment := url.Values{
+		"accessToken":  {response.AccessToken},
+		"refreshToken": {response.RefreshToken},
+	}
+	if response.TwoFactorRequired {
+		fragment = url.Values{"twoFactorRequired": {"true"}, "challengeToken": {response.ChallengeToken}}
+	}
+	http.Redirect(w, r, s.oidcAppURL(fragment), http.StatusFound)
+}
+
+func (s *Service) finishOIDCSignIn(r *http.Request, name string, provider oidc.Provider) (*dto.LoginResponse, error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, errOIDCInvalidState
+	}
+	claims := &oidcStateClaims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(s.Config.ActionKeySecret), nil
+	}, jwt.WithExpirationRequired(), jwt.WithAudience(oidcStateAudience))
+	query := r.URL.Query()
+	if err != nil || claims.Provider != name || claims.ID != query.Get("state") {
+		return nil, errOIDCInvalidState
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		return nil, fmt.Errorf("%w: %s", errOIDCAccessDenied, providerError)
+	}
+	if query.Get("code") == "" {
+		return nil, errOIDCInvalidState
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), s.oidcAuthRequest(claims))
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.resolveOIDCUser(r.Context(), name, identity)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, errOIDCDisabled
+	}
+	return s.startLogin(r, user)
+}
+
+// resolveOIDCUser returns the user the identity signs in, linking it to the account with the same
+// email when the provider verified that email, or creating an account.
+func (s *Service) resolveOIDCUser(ctx context.Context, provider string, identity *oidc.Identity) (*models.User, error) {
+	email := strings.TrimSpace(identity.Email)
+	if len(email) > maxUserEmailLength {
+		email = ""
+	}
+	now := time.Now()
+
+	var user *models.User
+	var takenOver bool
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		linked, err := s.UserIdentityRepository.GetIdentity(ctx, provider, identity.Subject, tx)
+		if err == nil {
+			if err := s.UserIdentityRepository.TouchIdentity(ctx, linked.ID, email, now, tx); err != nil {
+				return err
+			}
+			user, err = s.UserRepository.GetUser(ctx, dto.GetUserRequest{ID: linked.UserID}, tx)
+			return err
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if email == "" {
+			return errOIDCEmailRequired
+		}
+
+		user, err = s.UserRepository.GetUser(ctx, dto.GetUserRequest{Email: email}, tx)
+		switch {
+		case err == nil:
+			// only the provider vouching for the email proves the account is the same person's
+			if !identity.EmailVerified {
+				return errOIDCEmailInUse
+			}
+			if user.EmailVerifiedAt == nil {
+				// whoever signed up with this email never proved owning it, and could still know
+				// the password: the provider is now the only way in
+				if _, err := s.UserRepository.SetEmailVerified(ctx, user.ID, user.Email, &now, tx); err != nil {
+					return err
+				}
+				if err := s.UserRepository.ClearPassword(ctx, user.ID, tx); err != nil {
+					return err
+				}
+				// nor keep access through their tokens, or lock the owner out with their second factor
+				if err := s.AccessTokenRepository.DeleteAccessTokensByUser(ctx, user.ID, tx); err != nil {
+					return err
+				}
+				if err := s.UserRepository.UpdateTwoFactor(ctx, user.ID, nil, nil, tx); err != nil {
+					return err
+				}
+				if err := s.RecoveryCodeRepository.DeleteCodesByUser(ctx, user.ID, tx); err != nil {
+					return err
+				}
+				user.EmailVerifiedAt = &now
+				user.Password = nil
+				user.TwoFactorSecret = nil
+				user.TwoFactorEnabledAt = nil
+				takenOver = true
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			user = &models.User{Name: oidcUserName(identity.Name, email), Email: email}
+			if identity.EmailVerified {
+				user.EmailVerifiedAt = &now
+			}
+			if err := s.UserRepository.InsertUser(ctx, user, tx); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		return s.UserIdentityRepository.CreateIdentity(ctx, &models.UserIdentity{
+			UserID:     user.ID,
+			Provider:   provider,
+			Subject:    identity.Subject,
+			Email:      email,
+			LastUsedAt: now,
+		}, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if takenOver {
+		logger.Warn("[resolveOIDCUser] Linked an unverified account, its password, access tokens and second factor were removed", zap.Int32("userId", user.ID), zap.String("provider", provider))
+		if err := s.revokeUserSessions(ctx, user.ID, ""); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// GetUserIdentitiesHandler lists the providers linked to the account of the user.
+func (s *Service) GetUserIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetUserIdentitiesHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	identities, err := s.UserIdentityRepository.GetIdentitiesByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetUserIdentitiesHandler] UserIdentityRepository.GetIdentitiesByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	response := dto.GetUserIdentitiesResponse{Identities: make([]dto.UserIdentityItem, 0, len(identities))}
+	for _, identity := range identities {
+		response.Identities = append(response.Identities, dto.UserIdentityItem{
+			ID:         identity.ID,
+			Provider:   identity.Provider,
+			Email:      identity.Email,
+			LastUsedAt: identity.LastUsedAt,
+			CreatedAt:  identity.CreatedAt,
+		})
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+// DeleteUserIdentityHandler unlinks a provider, unless the account would be left with no way to
+// sign in.
+func (s *Service) DeleteUserIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteUserIdentityHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	id, err := parseURLID(r, "id")
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		identities, err := s.UserIdentityRepository.GetIdentitiesByUser(r.Context(), user.ID, tx)
+		if err != nil {
+			return err
+		}
+		if user.Password == nil && len(identities) == 1 && identities[0].ID == id {
+			return helpers.NewHTTPError(http.StatusConflict, fmt.Errorf("set a password before unlinking the last provider"))
+		}
+		deleted, err := s.UserIdentityRepository.DeleteIdentity(r.Context(), user.ID, id, tx)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return helpers.NewHTTPError(http.StatusNotFound, fmt.Errorf("identity not found"))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("[DeleteUserIdentityHandler] Delete identity got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+func (s *Service) oidcAuthRequest(claims *oidcStateClaims) oidc.AuthRequest {
+	return oidc.AuthRequest{
+		RedirectURL:  strings.TrimSuffix(s.Config.PublicURL, "/") + "/v1/auth/" + url.PathEscape(claims.Provider) + "/callback",
+		State:        claims.ID,
+		Nonce:        claims.Nonce,
+		CodeVerifier: claims.CodeVerifier,
+	}
+}
+
+// oidcStateCookie is sent back by the browser on the redirect from the provider, a top-level
+// navigation SameSite lax allows.
+func (s *Service) oidcStateCookie(provider string, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/v1/auth/" + url.PathEscape(provider),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.Config.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *Service) oidcAppURL(fragment url.Values) string {
+	return strings.TrimSuffix(s.Config.AppURL, "/") + oidcCallbackPath + "#" + fragment.Encode()
+}
+
+// oidcUserName is the name of an account created from an identity without one.
+func oidcUserName(name string, email string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	return truncate(name, maxUserNameLength)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mrgThang/flashcard-be/models"
+	"github.com/mrgThang/flashcard-be/oidc"
+)
+
+// TestResolveOIDCUserTakeover signs in with a provider vouching for the email of an account that
+// never verified it, whatever its creator set up to get back in must be gone.
+func TestResolveOIDCUserTakeover(t *testing.T) {
+	s, store := newTestService(t)
+	password := "password hash"
+	secret := "encrypted secret"
+	enabledAt := time.Now().Add(-time.Hour)
+	store.users = []*models.User{{
+		ID: 1, Name: "Squatter", Email: "lan@example.com", Password: &password,
+		TwoFactorSecret: &secret, TwoFactorEnabledAt: &enabledAt,
+	}}
+	store.accessTokens = []*models.AccessToken{{ID: 1, UserID: 1, Name: "script"}, {ID: 2, UserID: 2, Name: "other"}}
+	store.recoveryCodes = []*models.RecoveryCode{{ID: 1, UserID: 1}}
+	store.sessions = []*models.Session{{ID: "squatter", UserID: 1}}
+
+	user, err := s.resolveOIDCUser(context.Background(), "google", &oidc.Identity{
+		Subject: "google-lan", Email: "lan@example.com", EmailVerified: true, Name: "Lan",
+	})
+	if err != nil {
+		t.Fatalf("resolveOIDCUser() error = %v", err)
+	}
+	if user.ID != 1 {
+		t.Fatalf("resolveOIDCUser() = user %d, want the account of the email", user.ID)
+	}
+	// the sign-in goes on without a two-factor challenge
+	if user.Password != nil || user.TwoFactorEnabledAt != nil || user.EmailVerifiedAt == nil {
+		t.Errorf("resolveOIDCUser() = %+v, want a verified user without password nor two-factor", user)
+	}
+
+	stored := store.users[0]
+	if stored.Password != nil || stored.TwoFactorSecret != nil || stored.TwoFactorEnabledAt != nil {
+		t.Errorf("user = %+v, want the password and two-factor cleared", stored)
+	}
+	if stored.EmailVerifiedAt == nil {
+		t.Errorf("email is not verified after the takeover")
+	}
+	if len(store.accessTokens) != 1 || store.accessTokens[0].UserID != 2 {
+		t.Errorf("access tokens left = %v, want only the one of another user", store.accessTokens)
+	}
+	if len(store.recoveryCodes) != 0 {
+		t.Errorf("recovery codes left = %v, want none", store.recoveryCodes)
+	}
+	if store.sessions[0].RevokedAt == nil {
+		t.Errorf("session of the squatter was not revoked")
+	}
+	if len(store.identities) != 1 || store.identities[0].UserID != 1 {
+		t.Errorf("identities = %v, want the identity linked to the account", store.identities)
+	}
+}
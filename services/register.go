@@ -1,19 +1,56 @@
 package services
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 
 	"github.com/mrgThang/flashcard-be/config"
 	"github.com/mrgThang/flashcard-be/db"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/jwtkeys"
+	"github.com/mrgThang/flashcard-be/mailer"
+	"github.com/mrgThang/flashcard-be/oidc"
 	"github.com/mrgThang/flashcard-be/repositories"
+	"github.com/mrgThang/flashcard-be/throttle"
 )
 
 type Service struct {
-	Config         *config.Config
-	DB             *gorm.DB
-	UserRepository repositories.UserRepository
-	DeckRepository repositories.DeckRepository
-	CardRepository repositories.CardRepository
+	Config                     *config.Config
+	DB                         *gorm.DB
+	UserRepository             repositories.UserRepository
+	DeckRepository             repositories.DeckRepository
+	CardRepository             repositories.CardRepository
+	MediaRepository            repositories.MediaRepository
+	ReviewLogRepository        repositories.ReviewLogRepository
+	JobRepository              repositories.JobRepository
+	DeckMemberRepository       repositories.DeckMemberRepository
+	CardProgressRepository     repositories.CardProgressRepository
+	PublishedDeckRepository    repositories.PublishedDeckRepository
+	DeckSubscriptionRepository repositories.DeckSubscriptionRepository
+	DeckReportRepository       repositories.DeckReportRepository
+	CardUpstreamRepository     repositories.CardUpstreamRepository
+	CardConflictRepository     repositories.CardConflictRepository
+	CardRevisionRepository     repositories.CardRevisionRepository
+	DeckPresetRepository       repositories.DeckPresetRepository
+	SessionRepository          repositories.SessionRepository
+	UserTokenRepository        repositories.UserTokenRepository
+	UserIdentityRepository     repositories.UserIdentityRepository
+	RecoveryCodeRepository     repositories.RecoveryCodeRepository
+	AccessTokenRepository      repositories.AccessTokenRepository
+	Mailer                     mailer.Mailer
+	MailTemplates              *mailer.Templates
+	// OIDCProviders are the external sign-in providers by name
+	OIDCProviders map[string]oidc.Provider
+
+	sessionCache *sessionCache
+	// accountLimiter and ipLimiter count the failed logins per account and per address
+	accountLimiter *throttle.Limiter
+	ipLimiter      *throttle.Limiter
+	// twoFactorKey encrypts the TOTP secrets, nil when the config has none
+	twoFactorKey []byte
+	// accessKeys sign the access tokens, nil when they are signed with the access key secret
+	accessKeys *jwtkeys.KeySet
 }
 
 func NewService() *Service {
@@ -22,14 +59,92 @@ func NewService() *Service {
 	if err != nil {
 		panic("failed to load config: " + err.Error())
 	}
+	// anyone could forge login challenges, mailed links and tokens signed with an empty secret
+	if cfg.ActionKeySecret == "" {
+		panic("ACTION_KEY_SECRET is required")
+	}
+	if cfg.RefreshKeySecret == "" {
+		panic("REFRESH_KEY_SECRET is required")
+	}
+	if cfg.AccessKeySecret == "" && len(cfg.AccessTokenKeys) == 0 {
+		panic("ACCESS_KEY_SECRET or ACCESS_TOKEN_KEYS is required")
+	}
 
 	db := db.MustConnectMysql(cfg.MysqlConfig)
 
+	mail, err := mailer.New(cfg.MailerConfig)
+	if err != nil {
+		panic("failed to create mailer: " + err.Error())
+	}
+	mailTemplates, err := mailer.LoadTemplates(cfg.MailerConfig.TemplateDir)
+	if err != nil {
+		panic("failed to load email templates: " + err.Error())
+	}
+	oidcProviders := make(map[string]oidc.Provider, len(cfg.OIDCProviders))
+	for _, providerConfig := range cfg.OIDCProviders {
+		if _, ok := oidcProviders[providerConfig.Name]; ok {
+			panic("duplicate oidc provider " + providerConfig.Name)
+		}
+		provider, err := oidc.New(providerConfig, nil)
+		if err != nil {
+			panic("failed to create oidc provider: " + err.Error())
+		}
+		oidcProviders[providerConfig.Name] = provider
+	}
+	throttleStore, err := throttle.New(cfg.ThrottleConfig)
+	if err != nil {
+		panic("failed to create throttle store: " + err.Error())
+	}
+	lockout := throttle.Policy{
+		Lockout:    time.Duration(cfg.ThrottleConfig.LockoutSeconds) * time.Second,
+		MaxLockout: time.Duration(cfg.ThrottleConfig.MaxLockoutMinutes) * time.Minute,
+		Window:     time.Duration(cfg.ThrottleConfig.WindowMinutes) * time.Minute,
+	}
+	accountPolicy, ipPolicy := lockout, lockout
+	accountPolicy.FreeAttempts = cfg.ThrottleConfig.AccountAttempts
+	ipPolicy.FreeAttempts = cfg.ThrottleConfig.IPAttempts
+	accessKeys, err := jwtkeys.Load(cfg.AccessTokenKeys)
+	if err != nil {
+		panic("failed to load access token keys: " + err.Error())
+	}
+	var twoFactorKey []byte
+	if cfg.TwoFactorKey != "" {
+		if twoFactorKey, err = helpers.ParseSecretKey(cfg.TwoFactorKey); err != nil {
+			panic("failed to load two-factor key: " + err.Error())
+		}
+	}
+
 	return &Service{
-		Config:         cfg,
-		DB:             db,
-		UserRepository: repositories.NewUserRepository(db),
-		DeckRepository: repositories.NewDeckRepository(db),
-		CardRepository: repositories.NewCardRepository(db),
+		Config:                     cfg,
+		DB:                         db,
+		UserRepository:             repositories.NewUserRepository(db),
+		DeckRepository:             repositories.NewDeckRepository(db),
+		CardRepository:             repositories.NewCardRepository(db),
+		MediaRepository:            repositories.NewMediaRepository(db),
+		ReviewLogRepository:        repositories.NewReviewLogRepository(db),
+		JobRepository:              repositories.NewJobRepository(db),
+		DeckMemberRepository:       repositories.NewDeckMemberRepository(db),
+		CardProgressRepository:     repositories.NewCardProgressRepository(db),
+		PublishedDeckRepository:    repositories.NewPublishedDeckRepository(db),
+		DeckSubscriptionRepository: repositories.NewDeckSubscriptionRepository(db),
+		DeckReportRepository:       repositories.NewDeckReportRepository(db),
+		CardUpstreamRepository:     repositories.NewCardUpstreamRepository(db),
+		CardConflictRepository:     repositories.NewCardConflictRepository(db),
+		CardRevisionRepository:     repositories.NewCardRevisionRepository(db),
+		DeckPresetRepository:       repositories.NewDeckPresetRepository(db),
+		SessionRepository:          repositories.NewSessionRepository(db),
+		UserTokenRepository:        repositories.NewUserTokenRepository(db),
+		UserIdentityRepository:     repositories.NewUserIdentityRepository(db),
+		RecoveryCodeRepository:     repositories.NewRecoveryCodeRepository(db),
+		AccessTokenRepository:      repositories.NewAccessTokenRepository(db),
+		Mailer:                     mail,
+		MailTemplates:              mailTemplates,
+		OIDCProviders:              oidcProviders,
+
+		sessionCache:   newSessionCache(time.Duration(cfg.SessionCacheTTLSeconds) * time.Second),
+		twoFactorKey:   twoFactorKey,
+		accessKeys:     accessKeys,
+		accountLimiter: throttle.NewLimiter(throttleStore, accountPolicy),
+		ipLimiter:      throttle.NewLimiter(throttleStore, ipPolicy),
 	}
 }
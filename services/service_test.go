@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/config"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+	"github.com/mrgThang/flashcard-be/repositories"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.Init(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testConnector opens connections that only begin and end transactions, the repositories of the
+// tests keep their rows in a testStore instead of the database.
+type testConnector struct{}
+
+func (testConnector) Connect(context.Context) (driver.Conn, error) { return testConn{}, nil }
+func (testConnector) Driver() driver.Driver                        { return nil }
+
+type testConn struct{}
+
+func (testConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("the test database runs no queries")
+}
+func (testConn) Close() error              { return nil }
+func (testConn) Begin() (driver.Tx, error) { return testTx{}, nil }
+
+type testTx struct{}
+
+func (testTx) Commit() error   { return nil }
+func (testTx) Rollback() error { return nil }
+
+// testStore holds the rows of the tables the tests go through.
+type testStore struct {
+	users          []*models.User
+	userTokens     []*models.UserToken
+	sessions       []*models.Session
+	identities     []*models.UserIdentity
+	accessTokens   []*models.AccessToken
+	recoveryCodes  []*models.RecoveryCode
+	decks          []*models.Deck
+	cards          []*models.Card
+	reviewLogs     []*models.ReviewLog
+	progresses     []*models.CardProgress
+	revisions      []*models.CardRevision
+	upstreams      []*models.CardUpstream
+	conflicts      []*models.CardConflict
+	members        []*models.DeckMember
+	subscriptions  []*models.DeckSubscription
+	publishedDecks []*models.PublishedDeck
+	reports        []*models.DeckReport
+}
+
+// newTestService returns a service on top of a testStore, the repository methods the tests do not
+// go through are left nil and panic when called.
+func newTestService(t *testing.T) (*Service, *testStore) {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(testConnector{}), SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &testStore{}
+	return &Service{
+		Config:                     &config.Config{ActionKeySecret: "action-secret"},
+		DB:                         db,
+		UserRepository:             &testUserRepository{store: store},
+		UserTokenRepository:        &testUserTokenRepository{store: store},
+		SessionRepository:          &testSessionRepository{store: store},
+		UserIdentityRepository:     &testUserIdentityRepository{store: store},
+		AccessTokenRepository:      &testAccessTokenRepository{store: store},
+		RecoveryCodeRepository:     &testRecoveryCodeRepository{store: store},
+		DeckRepository:             &testDeckRepository{store: store},
+		CardRepository:             &testCardRepository{store: store},
+		ReviewLogRepository:        &testReviewLogRepository{store: store},
+		CardProgressRepository:     &testCardProgressRepository{store: store},
+		CardRevisionRepository:     &testCardRevisionRepository{store: store},
+		CardUpstreamRepository:     &testCardUpstreamRepository{store: store},
+		CardConflictRepository:     &testCardConflictRepository{store: store},
+		DeckMemberRepository:       &testDeckMemberRepository{store: store},
+		DeckSubscriptionRepository: &testDeckSubscriptionRepository{store: store},
+		PublishedDeckRepository:    &testPublishedDeckRepository{store: store},
+		DeckReportRepository:       &testDeckReportRepository{store: store},
+
+		sessionCache: newSessionCache(time.Minute),
+	}, store
+}
+
+type testUserRepository struct {
+	repositories.UserRepository
+	store *testStore
+}
+
+func (r *testUserRepository) GetUser(ctx context.Context, req dto.GetUserRequest, dbs ...*gorm.DB) (*models.User, error) {
+	for _, user := range r.store.users {
+		if (req.ID == 0 || user.ID == req.ID) && (req.Email == "" || strings.EqualFold(user.Email, req.Email)) {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *testUserRepository) UpdatePassword(ctx context.Context, userID int32, password string, dbs ...*gorm.DB) error {
+	for _, user := range r.store.users {
+		if user.ID == userID {
+			user.Password = &password
+		}
+	}
+	return nil
+}
+
+func (r *testUserRepository) SetEmailVerified(ctx context.Context, userID int32, email string, at *time.Time, dbs ...*gorm.DB) (bool, error) {
+	for _, user := range r.store.users {
+		if user.ID == userID && user.Email == email {
+			user.EmailVerifiedAt = at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *testUserRepository) ClearPassword(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	for _, user := range r.store.users {
+		if user.ID == userID {
+			user.Password = nil
+		}
+	}
+	return nil
+}
+
+func (r *testUserRepository) UpdateTwoFactor(ctx context.Context, userID int32, secret *string, enabledAt *time.Time, dbs ...*gorm.DB) error {
+	for _, user := range r.store.users {
+		if user.ID == userID {
+			user.TwoFactorSecret = secret
+			user.TwoFactorEnabledAt = enabledAt
+		}
+	}
+	return nil
+}
+
+type testUserIdentityRepository struct {
+	repositories.UserIdentityRepository
+	store *testStore
+}
+
+func (r *testUserIdentityRepository) CreateIdentity(ctx context.Context, identity *models.UserIdentity, dbs ...*gorm.DB) error {
+	r.store.identities = append(r.store.identities, identity)
+	return nil
+}
+
+func (r *testUserIdentityRepository) GetIdentity(ctx context.Context, provider string, subject string, dbs ...*gorm.DB) (*models.UserIdentity, error) {
+	for _, identity := range r.store.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type testAccessTokenRepository struct {
+	repositories.AccessTokenRepository
+	store *testStore
+}
+
+func (r *testAccessTokenRepository) DeleteAccessTokensByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	r.store.accessTokens = slices.DeleteFunc(r.store.accessTokens, func(token *models.AccessToken) bool {
+		return token.UserID == userID
+	})
+	return nil
+}
+
+type testRecoveryCodeRepository struct {
+	repositories.RecoveryCodeRepository
+	store *testStore
+}
+
+func (r *testRecoveryCodeRepository) DeleteCodesByUser(ctx context.Context, userID int32, dbs ...*gorm.DB) error {
+	r.store.recoveryCodes = slices.DeleteFunc(r.store.recoveryCodes, func(code *models.RecoveryCode) bool {
+		return code.UserID == userID
+	})
+	return nil
+}
+
+type testUserTokenRepository struct {
+	repositories.UserTokenRepository
+	store *testStore
+}
+
+func (r *testUserTokenRepository) CreateToken(ctx context.Context, token *models.UserToken, dbs ...*gorm.DB) error {
+	r.store.userTokens = append(r.store.userTokens, token)
+	return nil
+}
+
+func (r *testUserTokenRepository) GetToken(ctx context.Context, id string, dbs ...*gorm.DB) (*models.UserToken, error) {
+	for _, token := range r.store.userTokens {
+		if token.ID == id {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *testUserTokenRepository) UseToken(ctx context.Context, id string, usedAt time.Time, dbs ...*gorm.DB) (bool, error) {
+	for _, token := range r.store.userTokens {
+		if token.ID == id && token.UsedAt == nil {
+			token.UsedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *testUserTokenRepository) UseTokensByUser(ctx context.Context, userID int32, purpose string, usedAt time.Time, dbs ...*gorm.DB) error {
+	for _, token := range r.store.userTokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+type testSessionRepository struct {
+	repositories.SessionRepository
+	store *testStore
+}
+
+func (r *testSessionRepository) RevokeSessionsByUser(ctx context.Context, userID int32, exceptID string, revokedAt time.Time, dbs ...*gorm.DB) error {
+	for _, session := range r.store.sessions {
+		if session.UserID == userID && session.ID != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+type testDeckRepository struct {
+	repositories.DeckRepository
+	store *testStore
+}
+
+func (r *testDeckRepository) GetDeletedDecks(ctx context.Context, req dto.GetTrashRequest, dbs ...*gorm.DB) ([]*models.DeckWithStats, error) {
+	var decks []*models.DeckWithStats
+	for _, deck := range r.store.decks {
+		if deck.DeletedAt.Valid && deck.UserID == req.UserID {
+			decks = append(decks, &models.DeckWithStats{Deck: *deck})
+		}
+	}
+	return decks, nil
+}
+
+func (r *testDeckRepository) PurgeDecks(ctx context.Context, ids []int32, dbs ...*gorm.DB) error {
+	r.store.decks = slices.DeleteFunc(r.store.decks, func(deck *models.Deck) bool {
+		return deck.DeletedAt.Valid && slices.Contains(ids, deck.ID)
+	})
+	return nil
+}
+
+type testCardRepository struct {
+	repositories.CardRepository
+	store *testStore
+}
+
+func (r *testCardRepository) GetDeletedCards(ctx context.Context, req dto.GetTrashRequest, dbs ...*gorm.DB) ([]*models.Card, error) {
+	var cards []*models.Card
+	for _, card := range r.store.cards {
+		if card.DeletedAt.Valid && card.UserID == req.UserID && (len(req.CardIDs) == 0 || slices.Contains(req.CardIDs, card.ID)) {
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+func (r *testCardRepository) GetCardIDsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]int32, error) {
+	var ids []int32
+	for _, card := range r.store.cards {
+		if slices.Contains(deckIDs, card.DeckID) {
+			ids = append(ids, card.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (r *testCardRepository) PurgeCards(ctx context.Context, ids []int32, dbs ...*gorm.DB) error {
+	r.store.cards = slices.DeleteFunc(r.store.cards, func(card *models.Card) bool {
+		return card.DeletedAt.Valid && slices.Contains(ids, card.ID)
+	})
+	return nil
+}
+
+func (r *testCardRepository) PurgeCardsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) error {
+	r.store.cards = slices.DeleteFunc(r.store.cards, func(card *models.Card) bool {
+		return slices.Contains(deckIDs, card.DeckID)
+	})
+	return nil
+}
+
+type testReviewLogRepository struct {
+	repositories.ReviewLogRepository
+	store *testStore
+}
+
+func (r *testReviewLogRepository) DeleteReviewLogsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	r.store.reviewLogs = slices.DeleteFunc(r.store.reviewLogs, func(log *models.ReviewLog) bool {
+		return slices.Contains(cardIDs, log.CardID)
+	})
+	return nil
+}
+
+type testCardProgressRepository struct {
+	repositories.CardProgressRepository
+	store *testStore
+}
+
+func (r *testCardProgressRepository) DeleteProgressByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	r.store.progresses = slices.DeleteFunc(r.store.progresses, func(progress *models.CardProgress) bool {
+		return slices.Contains(cardIDs, progress.CardID)
+	})
+	return nil
+}
+
+type testCardRevisionRepository struct {
+	repositories.CardRevisionRepository
+	store *testStore
+}
+
+func (r *testCardRevisionRepository) DeleteRevisionsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	r.store.revisions = slices.DeleteFunc(r.store.revisions, func(revision *models.CardRevision) bool {
+		return slices.Contains(cardIDs, revision.CardID)
+	})
+	return nil
+}
+
+type testCardUpstreamRepository struct {
+	repositories.CardUpstreamRepository
+	store *testStore
+}
+
+func (r *testCardUpstreamRepository) DeleteUpstreamsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	r.store.upstreams = slices.DeleteFunc(r.store.upstreams, func(upstream *models.CardUpstream) bool {
+		return slices.Contains(cardIDs, upstream.CardID)
+	})
+	return nil
+}
+
+type testCardConflictRepository struct {
+	repositories.CardConflictRepository
+	store *testStore
+}
+
+func (r *testCardConflictRepository) DeleteConflictsByCards(ctx context.Context, cardIDs []int32, dbs ...*gorm.DB) error {
+	r.store.conflicts = slices.DeleteFunc(r.store.conflicts, func(conflict *models.CardConflict) bool {
+		return slices.Contains(cardIDs, conflict.CardID)
+	})
+	return nil
+}
+
+func (r *testCardConflictRepository) DeleteConflictsBySubscription(ctx context.Context, subscriptionID int32, dbs ...*gorm.DB) error {
+	r.store.conflicts = slices.DeleteFunc(r.store.conflicts, func(conflict *models.CardConflict) bool {
+		return conflict.SubscriptionID == subscriptionID
+	})
+	return nil
+}
+
+func (r *testCardConflictRepository) DeleteConflictsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error {
+	r.store.conflicts = slices.DeleteFunc(r.store.conflicts, func(conflict *models.CardConflict) bool {
+		return slices.ContainsFunc(r.store.subscriptions, func(subscription *models.DeckSubscription) bool {
+			return subscription.ID == conflict.SubscriptionID && subscription.PublishedDeckID == publishedDeckID
+		})
+	})
+	return nil
+}
+
+type testDeckMemberRepository struct {
+	repositories.DeckMemberRepository
+	store *testStore
+}
+
+func (r *testDeckMemberRepository) DeleteMembersByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) error {
+	r.store.members = slices.DeleteFunc(r.store.members, func(member *models.DeckMember) bool {
+		return slices.Contains(deckIDs, member.DeckID)
+	})
+	return nil
+}
+
+type testDeckSubscriptionRepository struct {
+	repositories.DeckSubscriptionRepository
+	store *testStore
+}
+
+func (r *testDeckSubscriptionRepository) GetSubscriptionsByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.DeckSubscription, error) {
+	var subscriptions []*models.DeckSubscription
+	for _, subscription := range r.store.subscriptions {
+		if slices.Contains(deckIDs, subscription.DeckID) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *testDeckSubscriptionRepository) DeleteSubscription(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	r.store.subscriptions = slices.DeleteFunc(r.store.subscriptions, func(subscription *models.DeckSubscription) bool {
+		return subscription.ID == id
+	})
+	return nil
+}
+
+func (r *testDeckSubscriptionRepository) DeleteSubscriptionsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error {
+	r.store.subscriptions = slices.DeleteFunc(r.store.subscriptions, func(subscription *models.DeckSubscription) bool {
+		return subscription.PublishedDeckID == publishedDeckID
+	})
+	return nil
+}
+
+type testPublishedDeckRepository struct {
+	repositories.PublishedDeckRepository
+	store *testStore
+}
+
+func (r *testPublishedDeckRepository) GetPublishedDecksByDecks(ctx context.Context, deckIDs []int32, dbs ...*gorm.DB) ([]*models.PublishedDeck, error) {
+	var publishedDecks []*models.PublishedDeck
+	for _, publishedDeck := range r.store.publishedDecks {
+		if slices.Contains(deckIDs, publishedDeck.DeckID) {
+			publishedDecks = append(publishedDecks, publishedDeck)
+		}
+	}
+	return publishedDecks, nil
+}
+
+func (r *testPublishedDeckRepository) IncrementCounter(ctx context.Context, id int32, counter string, delta int, dbs ...*gorm.DB) error {
+	for _, publishedDeck := range r.store.publishedDecks {
+		if publishedDeck.ID == id && counter == repositories.PublishedDeckSubscriberCount {
+			publishedDeck.SubscriberCount = max(publishedDeck.SubscriberCount+int32(delta), 0)
+		}
+	}
+	return nil
+}
+
+func (r *testPublishedDeckRepository) DeletePublishedDeck(ctx context.Context, id int32, dbs ...*gorm.DB) error {
+	r.store.publishedDecks = slices.DeleteFunc(r.store.publishedDecks, func(publishedDeck *models.PublishedDeck) bool {
+		return publishedDeck.ID == id
+	})
+	return nil
+}
+
+type testDeckReportRepository struct {
+	repositories.DeckReportRepository
+	store *testStore
+}
+
+func (r *testDeckReportRepository) DeleteReportsByPublishedDeck(ctx context.Context, publishedDeckID int32, dbs ...*gorm.DB) error {
+	r.store.reports = slices.DeleteFunc(r.store.reports, func(report *models.DeckReport) bool {
+		return report.PublishedDeckID == publishedDeckID
+	})
+	return nil
+}
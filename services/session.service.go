@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const sessionPruneInterval = time.Hour
+
+var (
+	errInvalidRefreshToken = helpers.NewHTTPError(http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+	errSessionRevoked      = helpers.NewHTTPError(http.StatusUnauthorized, fmt.Errorf("session expired or logged out"))
+)
+
+// refreshClaims are the claims of a refresh token, ID is the session and Generation the rotation
+// the token was issued at.
+type refreshClaims struct {
+	jwt.RegisteredClaims
+	Generation int32 `json:"gen"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new refresh token.
+// Replaying a refresh token that was already exchanged revokes its session.
+func (s *Service) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[RefreshTokenHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.RefreshToken == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("refreshToken is required"))
+		return
+	}
+
+	response, err := s.refreshSession(r, req.RefreshToken)
+	if err != nil {
+		logger.Error("[RefreshTokenHandler] Refresh session got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+func (s *Service) refreshSession(r *http.Request, refreshToken string) (*dto.LoginResponse, error) {
+	claims := &refreshClaims{}
+	_, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(s.Config.RefreshKeySecret), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	session, err := s.SessionRepository.GetSession(r.Context(), claims.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil || strconv.FormatInt(int64(session.UserID), 10) != claims.Subject {
+		return nil, errInvalidRefreshToken
+	}
+	if claims.Generation != session.Generation || hashToken(refreshToken) != session.RefreshTokenHash {
+		// the token was already rotated, whoever holds the family can no longer be trusted
+		logger.Warn("[refreshSession] Refresh token reused, revoking session", zap.String("sessionId", session.ID), zap.Int32("userId", session.UserID))
+		if err := s.revokeSession(r.Context(), session.ID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	previousGeneration := session.Generation
+	session.Generation++
+	refreshTokenString, err := s.signRefreshToken(session, r)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.SessionRepository.RotateSession(r.Context(), session, previousGeneration)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// a concurrent refresh used the same token first
+		if err := s.revokeSession(r.Context(), session.ID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+	accessTokenString, err := s.signAccessToken(session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.LoginResponse{AccessToken: accessTokenString, RefreshToken: refreshTokenString}, nil
+}
+
+// createSession starts a session for the user logging in with the request and returns its tokens.
+func (s *Service) createSession(r *http.Request, user *models.User) (*dto.LoginResponse, error) {
+	session := &models.Session{
+		ID:     uuid.NewString(),
+		UserID: user.ID,
+	}
+	refreshTokenString, err := s.signRefreshToken(session, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SessionRepository.CreateSession(r.Context(), session); err != nil {
+		return nil, err
+	}
+	accessTokenString, err := s.signAccessToken(user.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.LoginResponse{AccessToken: accessTokenString, RefreshToken: refreshTokenString}, nil
+}
+
+// signAccessToken issues an access token of the session, its jti is the session id. It is signed by
+// the current key of the key set when there is one, with the access key secret otherwise.
+func (s *Service) signAccessToken(userID int32, sessionID string) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		ID:        sessionID,
+		Subject:   strconv.FormatInt(int64(userID), 10),
+		Issuer:    s.Config.PublicURL,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(s.Config.AccessTokenTTLMinutes) * time.Minute)),
+	}
+	if s.accessKeys != nil {
+		return s.accessKeys.Sign(claims)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.Config.AccessKeySecret))
+}
+
+// signRefreshToken issues the refresh token of the current generation of the session, and records
+// its hash, its expiry and the client it was issued to on the session.
+func (s *Service) signRefreshToken(session *models.Session, r *http.Request) (string, error) {
+	now := time.Now()
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(time.Duration(s.Config.RefreshTokenTTLDays) * 24 * time.Hour)
+	session.UserAgent = truncate(r.UserAgent(), 255)
+	session.IP = clientIP(r)
+
+	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID,
+			Subject:   strconv.FormatInt(int64(session.UserID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+		},
+		Generation: session.Generation,
+	})
+	refreshTokenString, err := refreshToken.SignedString([]byte(s.Config.RefreshKeySecret))
+	if err != nil {
+		return "", err
+	}
+	session.RefreshTokenHash = hashToken(refreshTokenString)
+	return refreshTokenString, nil
+}
+
+// CheckSession fails when the session an access token was issued for is revoked or expired.
+func (s *Service) CheckSession(ctx context.Context, sessionID string, userID int32) error {
+	if entry, ok := s.sessionCache.get(sessionID); ok {
+		if !entry.active || entry.userID != userID {
+			return errSessionRevoked
+		}
+		return nil
+	}
+
+	session, err := s.SessionRepository.GetSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errSessionRevoked
+		}
+		return err
+	}
+	now := time.Now()
+	active := session.RevokedAt == nil && session.ExpiresAt.After(now)
+	if active && now.Sub(session.LastSeenAt) > time.Minute {
+		if err := s.SessionRepository.TouchSession(ctx, session.ID, now); err != nil {
+			logger.Error("[CheckSession] SessionRepository.TouchSession got error", zap.String("sessionId", session.ID), zap.Error(err))
+		}
+	}
+	s.sessionCache.set(session.ID, session.UserID, active, session.ExpiresAt)
+	if !active || session.UserID != userID {
+		return errSessionRevoked
+	}
+	return nil
+}
+
+func (s *Service) revokeSession(ctx context.Context, sessionID string) error {
+	if err := s.SessionRepository.RevokeSession(ctx, sessionID, time.Now()); err != nil {
+		return err
+	}
+	s.sessionCache.revoke(sessionID)
+	return nil
+}
+
+// revokeUserSessions revokes every session of the user but exceptID, which can be empty.
+func (s *Service) revokeUserSessions(ctx context.Context, userID int32, exceptID string) error {
+	if err := s.SessionRepository.RevokeSessionsByUser(ctx, userID, exceptID, time.Now()); err != nil {
+		return err
+	}
+	s.sessionCache.revokeUser(userID, exceptID)
+	return nil
+}
+
+// revokeUserAccess revokes every session of the user but exceptID along with all their personal
+// access tokens, for when their credentials changed. The routes changing credentials never accept
+// access tokens, so none is in use.
+func (s *Service) revokeUserAccess(ctx context.Context, userID int32, exceptID string) error {
+	if err := s.AccessTokenRepository.DeleteAccessTokensByUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.revokeUserSessions(ctx, userID, exceptID)
+}
+
+func (s *Service) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetSessionsHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	currentID, _ := r.Context().Value(constant.SessionContextKey).(string)
+
+	sessions, err := s.SessionRepository.GetActiveSessionsByUser(r.Context(), user.ID)
+	if err != nil {
+		logger.Error("[GetSessionsHandler] SessionRepository.GetActiveSessionsByUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	items := make([]dto.SessionItem, len(sessions))
+	for index, session := range sessions {
+		items[index] = dto.SessionItem{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Current:    session.ID == currentID,
+			LastSeenAt: session.LastSeenAt,
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+		}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.GetSessionsResponse{Sessions: items})
+}
+
+// DeleteSessionHandler logs out one of the sessions of the user.
+func (s *Service) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "id")
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[DeleteSessionHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	session, err := s.SessionRepository.GetSession(r.Context(), sessionID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("[DeleteSessionHandler] SessionRepository.GetSession got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err != nil || session.UserID != user.ID {
+		helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("session not found"))
+		return
+	}
+	if err := s.revokeSession(r.Context(), session.ID); err != nil {
+		logger.Error("[DeleteSessionHandler] Revoke session got error", zap.String("sessionId", session.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// LogoutHandler revokes the session the request was made with, its access and refresh tokens stop working.
+func (s *Service) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := r.Context().Value(constant.SessionContextKey).(string)
+	if !ok {
+		logger.Error("[LogoutHandler] Can not get session from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get session from context"))
+		return
+	}
+	if err := s.revokeSession(r.Context(), sessionID); err != nil {
+		logger.Error("[LogoutHandler] Revoke session got error", zap.String("sessionId", sessionID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// LogoutAllHandler revokes every session of the user, including the one the request was made with.
+func (s *Service) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[LogoutAllHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	if err := s.revokeUserSessions(r.Context(), user.ID, ""); err != nil {
+		logger.Error("[LogoutAllHandler] Revoke sessions got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// hashToken returns the hex SHA-256 of a token, tokens are only stored hashed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return truncate(r.RemoteAddr, 45)
+	}
+	return host
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return strings.ToValidUTF8(value[:length], "")
+}
+
+// RunSessionPruner deletes the expired sessions and user tokens, until ctx is cancelled.
+func (s *Service) RunSessionPruner(ctx context.Context) {
+	ticker := time.NewTicker(sessionPruneInterval)
+	defer ticker.Stop()
+	for {
+		pruned, err := s.SessionRepository.DeleteSessionsBefore(ctx, time.Now())
+		if err != nil {
+			logger.Error("[RunSessionPruner] SessionRepository.DeleteSessionsBefore got error", zap.Error(err))
+		} else if pruned > 0 {
+			logger.Info("[RunSessionPruner] Pruned expired sessions", zap.Int64("sessions", pruned))
+		}
+		pruned, err = s.UserTokenRepository.DeleteTokensBefore(ctx, time.Now())
+		if err != nil {
+			logger.Error("[RunSessionPruner] UserTokenRepository.DeleteTokensBefore got error", zap.Error(err))
+		} else if pruned > 0 {
+			logger.Info("[RunSessionPruner] Pruned expired user tokens", zap.Int64("tokens", pruned))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
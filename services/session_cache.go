@@ -0,0 +1,103 @@
+package services
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSessionCacheEntries bounds the session cache, expired entries are swept when it is reached and
+// the soonest to expire are evicted when that is not enough.
+const maxSessionCacheEntries = 10000
+
+// sessionCacheEvictions is how many entries are evicted at once, so a full cache is not sorted again
+// for every session.
+const sessionCacheEvictions = maxSessionCacheEntries / 10
+
+// sessionCache remembers for a short time whether sessions are active, so authenticating a request
+// does not read the session from the database. Revocations made by this instance apply at once,
+// the ones made by other instances once the entry expires.
+type sessionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	userID    int32
+	active    bool
+	expiresAt time.Time
+}
+
+func newSessionCache(ttl time.Duration) *sessionCache {
+	return &sessionCache{ttl: ttl, entries: map[string]sessionCacheEntry{}}
+}
+
+func (c *sessionCache) get(id string) (sessionCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return sessionCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// set caches the state of the session, never past the time the session itself expires.
+func (c *sessionCache) set(id string, userID int32, active bool, sessionExpiresAt time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if _, ok := c.entries[id]; !ok && len(c.entries) >= maxSessionCacheEntries {
+		c.evict(now)
+	}
+	expiresAt := now.Add(c.ttl)
+	if active && sessionExpiresAt.Before(expiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+	c.entries[id] = sessionCacheEntry{userID: userID, active: active, expiresAt: expiresAt}
+}
+
+// evict makes room for entries: it removes the expired entries, then the ones expiring soonest when
+// the cache is still full. An evicted session is just read from the database again.
+func (c *sessionCache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < maxSessionCacheEntries {
+		return
+	}
+	excess := len(c.entries) - maxSessionCacheEntries + sessionCacheEvictions
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return c.entries[a].expiresAt.Compare(c.entries[b].expiresAt)
+	})
+	for _, key := range keys[:excess] {
+		delete(c.entries, key)
+	}
+}
+
+func (c *sessionCache) revoke(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+// revokeUser forgets the sessions of the user but exceptID.
+func (c *sessionCache) revokeUser(userID int32, exceptID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if entry.userID == userID && key != exceptID {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSessionCacheBound(t *testing.T) {
+	cache := newSessionCache(time.Minute)
+	sessionExpiresAt := time.Now().Add(time.Hour)
+	for i := range maxSessionCacheEntries + 100 {
+		cache.set(strconv.Itoa(i), 1, true, sessionExpiresAt)
+		if len(cache.entries) > maxSessionCacheEntries {
+			t.Fatalf("cache holds %d entries after %d sets, want at most %d", len(cache.entries), i+1, maxSessionCacheEntries)
+		}
+	}
+	// the last session cached is kept, the first ones expire soonest and were evicted
+	if _, ok := cache.get(strconv.Itoa(maxSessionCacheEntries + 99)); !ok {
+		t.Errorf("get() of the last session = false, want it cached")
+	}
+	if _, ok := cache.get("0"); ok {
+		t.Errorf("get() of the first session = true, want it evicted")
+	}
+
+	// updating a cached session does not evict anything
+	before := len(cache.entries)
+	cache.set(strconv.Itoa(maxSessionCacheEntries+99), 1, false, sessionExpiresAt)
+	if len(cache.entries) != before {
+		t.Errorf("cache holds %d entries after an update, want %d", len(cache.entries), before)
+	}
+
+	// expired entries go before any other
+	cache = newSessionCache(time.Minute)
+	for i := range maxSessionCacheEntries {
+		cache.set(strconv.Itoa(i), 1, true, sessionExpiresAt)
+	}
+	cache.entries["0"] = sessionCacheEntry{userID: 1, active: true, expiresAt: time.Now().Add(-time.Second)}
+	cache.set("new", 1, true, sessionExpiresAt)
+	if len(cache.entries) != maxSessionCacheEntries {
+		t.Errorf("cache holds %d entries, want only the expired one replaced", len(cache.entries))
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+)
+
+var (
+	// errInvalidCredentials is the answer to every failed login, whether the email is signed up or
+	// not, so the login can not tell which emails are.
+	errInvalidCredentials = helpers.NewHTTPError(http.StatusUnauthorized, fmt.Errorf("invalid email or password"))
+	errTooManyAttempts    = fmt.Errorf("too many failed attempts, try again later")
+)
+
+// dummyPasswordHash is compared against when the email has no password, so a failed login takes
+// the time of a bcrypt comparison either way.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not the password of anyone"), bcrypt.DefaultCost)
+	return hash
+})
+
+// throttleKeys are the keys an attempt is counted under: the account it targets and the address it
+// comes from.
+type throttleKeys struct {
+	account string
+	ip      string
+}
+
+// loginThrottleKeys returns the keys of an attempt of the action, such as login, on the account.
+func loginThrottleKeys(r *http.Request, action string, account string) throttleKeys {
+	return throttleKeys{
+		account: action + ":account:" + strings.ToLower(strings.TrimSpace(account)),
+		ip:      action + ":ip:" + clientIP(r),
+	}
+}
+
+// checkThrottle returns how long the attempt has to wait for, 0 when it is allowed.
+func (s *Service) checkThrottle(ctx context.Context, keys throttleKeys) (time.Duration, error) {
+	accountWait, err := s.accountLimiter.Check(ctx, keys.account)
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := s.ipLimiter.Check(ctx, keys.ip)
+	if err != nil {
+		return 0, err
+	}
+	return max(accountWait, ipWait), nil
+}
+
+// failThrottle records a failed attempt, both the account and the address get closer to a lockout.
+func (s *Service) failThrottle(ctx context.Context, keys throttleKeys) error {
+	accountLockout, err := s.accountLimiter.Fail(ctx, keys.account)
+	if err != nil {
+		return err
+	}
+	ipLockout, err := s.ipLimiter.Fail(ctx, keys.ip)
+	if err != nil {
+		return err
+	}
+	if accountLockout > 0 || ipLockout > 0 {
+		logger.Warn("[failThrottle] Too many failed attempts, locking",
+			zap.String("accountKey", keys.account), zap.Duration("accountLockout", accountLockout),
+			zap.String("ipKey", keys.ip), zap.Duration("ipLockout", ipLockout))
+	}
+	return nil
+}
+
+// resetThrottle forgets the failures of the account after a successful attempt. The failures of the
+// address are kept, or logging into an own account would unlock guessing the others.
+func (s *Service) resetThrottle(ctx context.Context, keys throttleKeys) error {
+	return s.accountLimiter.Reset(ctx, keys.account)
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	helpers.WriteJSONError(w, http.StatusTooManyRequests, errTooManyAttempts)
+}
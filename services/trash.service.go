@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+	"github.com/mrgThang/flashcard-be/repositories"
+)
+
+const trashPurgeInterval = time.Hour
+
+func (s *Service) GetTrashHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[GetTrashHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	decks, err := s.DeckRepository.GetDeletedDecks(r.Context(), dto.GetTrashRequest{UserID: user.ID})
+	if err != nil {
+		logger.Error("[GetTrashHandler] DeckRepository.GetDeletedDecks got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cards, err := s.CardRepository.GetDeletedCards(r.Context(), dto.GetTrashRequest{UserID: user.ID})
+	if err != nil {
+		logger.Error("[GetTrashHandler] CardRepository.GetDeletedCards got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseGetTrashResponse(decks, cards))
+}
+
+// parseGetTrashResponse lists every deletion once: subdecks and cards that were deleted together
+// with a deck are folded into that deck instead of being listed on their own.
+func (s *Service) parseGetTrashResponse(decks []*models.DeckWithStats, cards []*models.Card) dto.GetTrashResponse {
+	batches := trashBatches(decks)
+	stats := helpers.RollUpDeckStats(batches)
+	retention := s.trashRetention()
+
+	response := dto.GetTrashResponse{
+		Decks: []dto.TrashDeckItem{},
+		Cards: []dto.TrashCardItem{},
+	}
+	deletedDecks := make(map[int32]*models.DeckWithStats, len(decks))
+	for index, deck := range decks {
+		deletedDecks[deck.ID] = deck
+		if batches[index].ParentID != nil {
+			continue
+		}
+		response.Decks = append(response.Decks, dto.TrashDeckItem{
+			ID:         deck.ID,
+			Name:       deck.Name,
+			ParentID:   deck.ParentID,
+			TotalCards: stats[deck.ID].TotalCards,
+			DeletedAt:  deck.DeletedAt.Time,
+			PurgeAt:    deck.DeletedAt.Time.Add(retention),
+		})
+	}
+	for _, card := range cards {
+		if deck, ok := deletedDecks[card.DeckID]; ok && deck.DeletedAt.Time.Equal(card.DeletedAt.Time) {
+			continue
+		}
+		response.Cards = append(response.Cards, dto.TrashCardItem{
+			ID:        card.ID,
+			Front:     card.Front,
+			Back:      card.Back,
+			DeckID:    card.DeckID,
+			DeletedAt: card.DeletedAt.Time,
+			PurgeAt:   card.DeletedAt.Time.Add(retention),
+		})
+	}
+	return response
+}
+
+// trashBatches copies the deleted decks keeping the parent only when it was deleted in the same batch,
+// so that the roots of the returned hierarchy are the decks the user actually deleted.
+func trashBatches(decks []*models.DeckWithStats) []*models.DeckWithStats {
+	byID := make(map[int32]*models.DeckWithStats, len(decks))
+	for _, deck := range decks {
+		byID[deck.ID] = deck
+	}
+	batches := make([]*models.DeckWithStats, len(decks))
+	for index, deck := range decks {
+		batch := *deck
+		if deck.ParentID != nil {
+			parent, ok := byID[*deck.ParentID]
+			if !ok || !parent.DeletedAt.Time.Equal(deck.DeletedAt.Time) {
+				batch.ParentID = nil
+			}
+		}
+		batches[index] = &batch
+	}
+	return batches
+}
+
+func (s *Service) RestoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseTrashItemsRequest(r)
+	if err != nil {
+		logger.Error("[RestoreTrashHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.DeckIDs) == 0 && len(req.CardIDs) == 0 {
+		logger.Error("[RestoreTrashHandler] Nothing to restore")
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("deckIds or cardIds is required"))
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[RestoreTrashHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	deletedDecks, err := s.DeckRepository.GetDeletedDecks(r.Context(), dto.GetTrashRequest{UserID: user.ID})
+	if err != nil {
+		logger.Error("[RestoreTrashHandler] DeckRepository.GetDeletedDecks got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	deletedByID := make(map[int32]*models.DeckWithStats, len(deletedDecks))
+	for _, deck := range deletedDecks {
+		deletedByID[deck.ID] = deck
+	}
+	batches := trashBatches(deletedDecks)
+
+	restoring := map[int32]bool{}
+	for _, deckID := range req.DeckIDs {
+		if _, ok := deletedByID[deckID]; !ok {
+			logger.Error("[RestoreTrashHandler] Deck not found in trash", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID))
+			helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck %d not found in trash", deckID))
+			return
+		}
+		for _, id := range helpers.DeckSubtreeIDs(batches, deckID) {
+			restoring[id] = true
+		}
+	}
+
+	var cards []*models.Card
+	if len(req.CardIDs) > 0 {
+		cards, err = s.CardRepository.GetDeletedCards(r.Context(), dto.GetTrashRequest{UserID: user.ID, CardIDs: req.CardIDs})
+		if err != nil {
+			logger.Error("[RestoreTrashHandler] CardRepository.GetDeletedCards got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(cards) != len(req.CardIDs) {
+			logger.Error("[RestoreTrashHandler] Some cards are not found in trash", zap.Int32("userId", user.ID))
+			helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("some cards are not found in trash"))
+			return
+		}
+		for _, card := range cards {
+			if _, ok := deletedByID[card.DeckID]; ok && !restoring[card.DeckID] {
+				logger.Error("[RestoreTrashHandler] Deck of card is in trash", zap.Int32("cardId", card.ID), zap.Int32("deckId", card.DeckID))
+				helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("deck of card %d is in trash, restore the deck first", card.ID))
+				return
+			}
+		}
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, deckID := range req.DeckIDs {
+			deck := deletedByID[deckID]
+			deckIDs := helpers.DeckSubtreeIDs(batches, deckID)
+			if err := s.DeckRepository.RestoreDecks(r.Context(), deckIDs, tx); err != nil {
+				return err
+			}
+			if err := s.CardRepository.RestoreCardsByDecks(r.Context(), deckIDs, deck.DeletedAt.Time, tx); err != nil {
+				return err
+			}
+			if deck.ParentID == nil {
+				continue
+			}
+			// a deck whose parent stays in the trash is restored at the root
+			if _, ok := deletedByID[*deck.ParentID]; ok && !restoring[*deck.ParentID] {
+				if err := s.DeckRepository.MoveDeck(r.Context(), dto.MoveDeckRequest{ID: deckID}, tx); err != nil {
+					return err
+				}
+			}
+		}
+		if len(req.CardIDs) > 0 {
+			return s.CardRepository.RestoreCards(r.Context(), req.CardIDs, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("[RestoreTrashHandler] Restore got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+func (s *Service) PurgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseTrashItemsRequest(r)
+	if err != nil {
+		logger.Error("[PurgeTrashHandler] Invalid request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[PurgeTrashHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+
+	deletedDecks, err := s.DeckRepository.GetDeletedDecks(r.Context(), dto.GetTrashRequest{UserID: user.ID})
+	if err != nil {
+		logger.Error("[PurgeTrashHandler] DeckRepository.GetDeletedDecks got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	emptyTrash := len(req.DeckIDs) == 0 && len(req.CardIDs) == 0
+	var deckIDs []int32
+	if emptyTrash {
+		for _, deck := range deletedDecks {
+			deckIDs = append(deckIDs, deck.ID)
+		}
+	} else {
+		deletedByID := make(map[int32]bool, len(deletedDecks))
+		for _, deck := range deletedDecks {
+			deletedByID[deck.ID] = true
+		}
+		for _, deckID := range req.DeckIDs {
+			if !deletedByID[deckID] {
+				logger.Error("[PurgeTrashHandler] Deck not found in trash", zap.Int32("deckId", deckID), zap.Int32("userId", user.ID))
+				helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("deck %d not found in trash", deckID))
+				return
+			}
+			deckIDs = append(deckIDs, helpers.DeckSubtreeIDs(deletedDecks, deckID)...)
+		}
+	}
+
+	cardIDs := req.CardIDs
+	if len(cardIDs) > 0 || emptyTrash {
+		cards, err := s.CardRepository.GetDeletedCards(r.Context(), dto.GetTrashRequest{UserID: user.ID, CardIDs: req.CardIDs})
+		if err != nil {
+			logger.Error("[PurgeTrashHandler] CardRepository.GetDeletedCards got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !emptyTrash && len(cards) != len(req.CardIDs) {
+			logger.Error("[PurgeTrashHandler] Some cards are not found in trash", zap.Int32("userId", user.ID))
+			helpers.WriteJSONError(w, http.StatusNotFound, fmt.Errorf("some cards are not found in trash"))
+			return
+		}
+		cardIDs = make([]int32, len(cards))
+		for index, card := range cards {
+			cardIDs[index] = card.ID
+		}
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		return s.purgeTrash(r.Context(), deckIDs, cardIDs, tx)
+	})
+	if err != nil {
+		logger.Error("[PurgeTrashHandler] Purge got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// purgeTrash permanently deletes the decks with their cards and the cards, along with the rows of
+// other tables referring to them: the progress, history and revisions of the cards, the members of
+// the decks, their subscriptions and their publication in the library.
+func (s *Service) purgeTrash(ctx context.Context, deckIDs []int32, cardIDs []int32, tx *gorm.DB) error {
+	purgedCardIDs := cardIDs
+	if len(deckIDs) > 0 {
+		deckCardIDs, err := s.CardRepository.GetCardIDsByDecks(ctx, deckIDs, tx)
+		if err != nil {
+			return err
+		}
+		purgedCardIDs = append(slices.Clone(cardIDs), deckCardIDs...)
+	}
+
+	if len(purgedCardIDs) > 0 {
+		if err := s.ReviewLogRepository.DeleteReviewLogsByCards(ctx, purgedCardIDs, tx); err != nil {
+			return err
+		}
+		if err := s.CardProgressRepository.DeleteProgressByCards(ctx, purgedCardIDs, tx); err != nil {
+			return err
+		}
+		if err := s.CardRevisionRepository.DeleteRevisionsByCards(ctx, purgedCardIDs, tx); err != nil {
+			return err
+		}
+		if err := s.CardConflictRepository.DeleteConflictsByCards(ctx, purgedCardIDs, tx); err != nil {
+			return err
+		}
+		if err := s.CardUpstreamRepository.DeleteUpstreamsByCards(ctx, purgedCardIDs, tx); err != nil {
+			return err
+		}
+	}
+
+	if len(deckIDs) > 0 {
+		if err := s.DeckMemberRepository.DeleteMembersByDecks(ctx, deckIDs, tx); err != nil {
+			return err
+		}
+		// a purged copy of a published deck stops being a subscriber
+		subscriptions, err := s.DeckSubscriptionRepository.GetSubscriptionsByDecks(ctx, deckIDs, tx)
+		if err != nil {
+			return err
+		}
+		for _, subscription := range subscriptions {
+			if err := s.CardConflictRepository.DeleteConflictsBySubscription(ctx, subscription.ID, tx); err != nil {
+				return err
+			}
+			if err := s.DeckSubscriptionRepository.DeleteSubscription(ctx, subscription.ID, tx); err != nil {
+				return err
+			}
+			if err := s.PublishedDeckRepository.IncrementCounter(ctx, subscription.PublishedDeckID, repositories.PublishedDeckSubscriberCount, -1, tx); err != nil {
+				return err
+			}
+		}
+		// a purged published deck leaves the library
+		publishedDecks, err := s.PublishedDeckRepository.GetPublishedDecksByDecks(ctx, deckIDs, tx)
+		if err != nil {
+			return err
+		}
+		for _, publishedDeck := range publishedDecks {
+			if err := s.deletePublishedDeck(ctx, publishedDeck.ID, tx); err != nil {
+				return err
+			}
+		}
+
+		if err := s.CardRepository.PurgeCardsByDecks(ctx, deckIDs, tx); err != nil {
+			return err
+		}
+		if err := s.DeckRepository.PurgeDecks(ctx, deckIDs, tx); err != nil {
+			return err
+		}
+	}
+	if len(cardIDs) > 0 {
+		return s.CardRepository.PurgeCards(ctx, cardIDs, tx)
+	}
+	return nil
+}
+
+func (s *Service) parseTrashItemsRequest(r *http.Request) (*dto.TrashItemsRequest, error) {
+	var req dto.TrashItemsRequest
+	if r.ContentLength == 0 {
+		return &req, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseTrashItemsRequest] Decode json from req got error", zap.Error(err))
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *Service) trashRetention() time.Duration {
+	return time.Duration(s.Config.TrashRetentionDays) * 24 * time.Hour
+}
+
+// RunTrashPurger permanently deletes decks and cards that stayed in the trash longer than
+// the retention window, until ctx is cancelled.
+func (s *Service) RunTrashPurger(ctx context.Context) {
+	if s.Config.TrashRetentionDays <= 0 {
+		logger.Info("[RunTrashPurger] Trash retention is disabled")
+		return
+	}
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		s.purgeExpiredTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) purgeExpiredTrash(ctx context.Context) {
+	before := time.Now().Add(-s.trashRetention())
+	var cardIDs, deckIDs []int32
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cardIDs, err = s.CardRepository.GetCardIDsDeletedBefore(ctx, before, tx); err != nil {
+			return err
+		}
+		if deckIDs, err = s.DeckRepository.GetDeckIDsDeletedBefore(ctx, before, tx); err != nil {
+			return err
+		}
+		return s.purgeTrash(ctx, deckIDs, cardIDs, tx)
+	})
+	if err != nil {
+		logger.Error("[purgeExpiredTrash] Purge got error", zap.Error(err))
+		return
+	}
+	if len(cardIDs) > 0 || len(deckIDs) > 0 {
+		logger.Info("[purgeExpiredTrash] Purged expired trash", zap.Int("cards", len(cardIDs)), zap.Int("decks", len(deckIDs)))
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// TestPurgeTrash empties the trash of a user, the rows of other tables referring to the purged
+// decks and cards must go with them while the ones of the decks and cards kept stay.
+func TestPurgeTrash(t *testing.T) {
+	s, store := newTestService(t)
+	deletedAt := gorm.DeletedAt{Time: time.Now().Add(-time.Hour), Valid: true}
+	store.decks = []*models.Deck{
+		// a published deck in the trash and the copy of a published deck of another author
+		{ID: 1, UserID: 1, DeletedAt: deletedAt},
+		{ID: 2, UserID: 1, DeletedAt: deletedAt},
+		{ID: 3, UserID: 1},
+		// the copy of another user subscribed to deck 1
+		{ID: 9, UserID: 2},
+	}
+	store.cards = []*models.Card{
+		{ID: 10, DeckID: 1, UserID: 1, DeletedAt: deletedAt},
+		{ID: 20, DeckID: 2, UserID: 1, DeletedAt: deletedAt},
+		{ID: 30, DeckID: 3, UserID: 1, DeletedAt: deletedAt},
+		{ID: 40, DeckID: 3, UserID: 1},
+		{ID: 90, DeckID: 9, UserID: 2},
+	}
+	for _, cardID := range []int32{10, 20, 30, 40} {
+		store.reviewLogs = append(store.reviewLogs, &models.ReviewLog{CardID: cardID, UserID: 2})
+		store.progresses = append(store.progresses, &models.CardProgress{CardID: cardID, UserID: 2})
+		store.revisions = append(store.revisions, &models.CardRevision{CardID: cardID, UserID: 2})
+	}
+	store.members = []*models.DeckMember{{DeckID: 1, Email: "lan@example.com"}, {DeckID: 3, Email: "lan@example.com"}}
+	store.publishedDecks = []*models.PublishedDeck{
+		{ID: 1, DeckID: 1, UserID: 1, SubscriberCount: 1},
+		{ID: 5, DeckID: 50, UserID: 3, SubscriberCount: 2},
+	}
+	store.subscriptions = []*models.DeckSubscription{
+		{ID: 1, PublishedDeckID: 1, UserID: 2, DeckID: 9},
+		{ID: 2, PublishedDeckID: 5, UserID: 1, DeckID: 2},
+	}
+	store.upstreams = []*models.CardUpstream{{CardID: 20}, {CardID: 90}}
+	store.conflicts = []*models.CardConflict{
+		{ID: 1, SubscriptionID: 1, CardID: 90},
+		{ID: 2, SubscriptionID: 2, CardID: 20},
+	}
+	store.reports = []*models.DeckReport{{PublishedDeckID: 1, UserID: 2}, {PublishedDeckID: 5, UserID: 2}}
+
+	r := httptest.NewRequest(http.MethodDelete, "/v1/trash", nil)
+	r = r.WithContext(context.WithValue(r.Context(), constant.UserContextKey, models.User{ID: 1}))
+	w := httptest.NewRecorder()
+	s.PurgeTrashHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PurgeTrashHandler() status = %d, body %s", w.Code, w.Body)
+	}
+
+	if len(store.decks) != 2 || store.decks[0].ID != 3 || store.decks[1].ID != 9 {
+		t.Errorf("decks left = %v, want decks 3 and 9", store.decks)
+	}
+	if len(store.cards) != 2 || store.cards[0].ID != 40 || store.cards[1].ID != 90 {
+		t.Errorf("cards left = %v, want cards 40 and 90", store.cards)
+	}
+	if len(store.reviewLogs) != 1 || store.reviewLogs[0].CardID != 40 {
+		t.Errorf("review logs left = %v, want the one of card 40", store.reviewLogs)
+	}
+	if len(store.progresses) != 1 || store.progresses[0].CardID != 40 {
+		t.Errorf("progresses left = %v, want the one of card 40", store.progresses)
+	}
+	if len(store.revisions) != 1 || store.revisions[0].CardID != 40 {
+		t.Errorf("revisions left = %v, want the one of card 40", store.revisions)
+	}
+	if len(store.members) != 1 || store.members[0].DeckID != 3 {
+		t.Errorf("members left = %v, want the one of deck 3", store.members)
+	}
+	if len(store.upstreams) != 1 || store.upstreams[0].CardID != 90 {
+		t.Errorf("upstreams left = %v, want the one of card 90", store.upstreams)
+	}
+	if len(store.subscriptions) != 0 {
+		t.Errorf("subscriptions left = %v, want none", store.subscriptions)
+	}
+	if len(store.conflicts) != 0 {
+		t.Errorf("conflicts left = %v, want none", store.conflicts)
+	}
+	if len(store.reports) != 1 || store.reports[0].PublishedDeckID != 5 {
+		t.Errorf("reports left = %v, want the one of published deck 5", store.reports)
+	}
+	if len(store.publishedDecks) != 1 || store.publishedDecks[0].ID != 5 || store.publishedDecks[0].SubscriberCount != 1 {
+		t.Errorf("published decks left = %v, want published deck 5 with 1 subscriber", store.publishedDecks)
+	}
+}
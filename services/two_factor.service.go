@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+const (
+	twoFactorChallengeAudience = "2fa_challenge"
+	recoveryCodeCount          = 10
+)
+
+var (
+	errTwoFactorNotConfigured = helpers.NewHTTPError(http.StatusServiceUnavailable, fmt.Errorf("two-factor authentication is not configured"))
+	errInvalidTwoFactorCode   = helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("invalid two-factor code"))
+	errInvalidLoginChallenge  = helpers.NewHTTPError(http.StatusUnauthorized, fmt.Errorf("invalid or expired login challenge"))
+)
+
+// startLogin signs in the user who proved their password or their identity at a provider: it starts
+// a session, unless two-factor authentication is enabled and a challenge token is returned instead.
+func (s *Service) startLogin(r *http.Request, user *models.User) (*dto.LoginResponse, error) {
+	if user.DisabledAt != nil {
+		return nil, errAccountDisabled
+	}
+	if user.TwoFactorEnabledAt == nil {
+		return s.createSession(r, user)
+	}
+	challenge := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   strconv.FormatInt(int64(user.ID), 10),
+		Audience:  jwt.ClaimStrings{twoFactorChallengeAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(s.Config.TwoFactorChallengeTTLMinutes) * time.Minute)),
+	})
+	challengeToken, err := challenge.SignedString([]byte(s.Config.ActionKeySecret))
+	if err != nil {
+		return nil, err
+	}
+	return &dto.LoginResponse{TwoFactorRequired: true, ChallengeToken: challengeToken}, nil
+}
+
+// LoginTwoFactorHandler completes a login with the challenge token and a TOTP or a recovery code.
+func (s *Service) LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.LoginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[LoginTwoFactorHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.ChallengeToken == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("challengeToken is required"))
+		return
+	}
+
+	user, err := s.getChallengedUser(r.Context(), req.ChallengeToken)
+	if err != nil {
+		logger.Error("[LoginTwoFactorHandler] Check challenge got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if user.DisabledAt != nil {
+		// disabled since the password was entered
+		helpers.WriteError(w, errAccountDisabled)
+		return
+	}
+	keys := loginThrottleKeys(r, "login_2fa", strconv.FormatInt(int64(user.ID), 10))
+	wait, err := s.checkThrottle(r.Context(), keys)
+	if err != nil {
+		logger.Error("[LoginTwoFactorHandler] Check throttle got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	if err := s.verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode); err != nil {
+		logger.Error("[LoginTwoFactorHandler] Second factor got error", zap.Int32("userId", user.ID), zap.Error(err))
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			if err := s.failThrottle(r.Context(), keys); err != nil {
+				logger.Error("[LoginTwoFactorHandler] Record failed attempt got error", zap.Error(err))
+			}
+		}
+		helpers.WriteError(w, err)
+		return
+	}
+	if err := s.resetThrottle(r.Context(), keys); err != nil {
+		logger.Error("[LoginTwoFactorHandler] Reset throttle got error", zap.Int32("userId", user.ID), zap.Error(err))
+	}
+	response, err := s.createSession(r, user)
+	if err != nil {
+		logger.Error("[LoginTwoFactorHandler] Failed to create session", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+func (s *Service) getChallengedUser(ctx context.Context, challengeToken string) (*models.User, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(s.Config.ActionKeySecret), nil
+	}, jwt.WithExpirationRequired(), jwt.WithAudience(twoFactorChallengeAudience))
+	if err != nil {
+		return nil, errInvalidLoginChallenge
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, errInvalidLoginChallenge
+	}
+	user, err := s.UserRepository.GetUser(ctx, dto.GetUserRequest{ID: int32(userID)})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidLoginChallenge
+		}
+		return nil, err
+	}
+	if user.TwoFactorEnabledAt == nil {
+		return nil, errInvalidLoginChallenge
+	}
+	return user, nil
+}
+
+// EnrollTwoFactorHandler generates a new TOTP secret for the user, which only becomes required
+// once activated with a code of it.
+func (s *Service) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[EnrollTwoFactorHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	if s.twoFactorKey == nil {
+		helpers.WriteError(w, errTwoFactorNotConfigured)
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret := helpers.GenerateTOTPSecret()
+	encrypted, err := helpers.EncryptSecret(s.twoFactorKey, secret, twoFactorAssociatedData(user.ID))
+	if err != nil {
+		logger.Error("[EnrollTwoFactorHandler] Encrypt secret got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.UserRepository.UpdateTwoFactor(r.Context(), user.ID, &encrypted, nil); err != nil {
+		logger.Error("[EnrollTwoFactorHandler] UserRepository.UpdateTwoFactor got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.EnrollTwoFactorResponse{
+		Secret: secret,
+		URI:    helpers.TOTPURI(s.Config.TwoFactorIssuer, user.Email, secret),
+	})
+}
+
+// ActivateTwoFactorHandler enables two-factor authentication with a code of the enrolled secret,
+// and returns the recovery codes.
+func (s *Service) ActivateTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ActivateTwoFactorHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	var req dto.ActivateTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[ActivateTwoFactorHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Code == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("code is required"))
+		return
+	}
+	if user.TwoFactorEnabledAt != nil {
+		helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+	if user.TwoFactorSecret == nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enrolled"))
+		return
+	}
+
+	secret, err := s.decryptTwoFactorSecret(&user)
+	if err != nil {
+		logger.Error("[ActivateTwoFactorHandler] Decrypt secret got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	step, valid := helpers.ValidateTOTP(secret, req.Code, time.Now(), 0)
+	if !valid {
+		helpers.WriteError(w, errInvalidTwoFactorCode)
+		return
+	}
+
+	var codes []string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := s.UserRepository.UpdateTwoFactor(r.Context(), user.ID, user.TwoFactorSecret, &now, tx); err != nil {
+			return err
+		}
+		if _, err := s.UserRepository.UseTwoFactorStep(r.Context(), user.ID, step, tx); err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(r.Context(), user.ID, tx)
+		return err
+	})
+	if err != nil {
+		logger.Error("[ActivateTwoFactorHandler] Enable two-factor got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	logger.Info("[ActivateTwoFactorHandler] Two-factor authentication enabled", zap.Int32("userId", user.ID))
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off with the password and a second factor.
+func (s *Service) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user, req, err := s.checkTwoFactorRequest(r)
+	if err != nil {
+		logger.Error("[DisableTwoFactorHandler] Check second factor got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode, tx); err != nil {
+			return err
+		}
+		if err := s.UserRepository.UpdateTwoFactor(r.Context(), user.ID, nil, nil, tx); err != nil {
+			return err
+		}
+		return s.RecoveryCodeRepository.DeleteCodesByUser(r.Context(), user.ID, tx)
+	})
+	if err != nil {
+		logger.Error("[DisableTwoFactorHandler] Disable two-factor got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	logger.Info("[DisableTwoFactorHandler] Two-factor authentication disabled", zap.Int32("userId", user.ID))
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the user, the previous ones stop
+// working.
+func (s *Service) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, req, err := s.checkTwoFactorRequest(r)
+	if err != nil {
+		logger.Error("[RegenerateRecoveryCodesHandler] Check second factor got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	var codes []string
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.verifySecondFactor(r.Context(), user, req.Code, req.RecoveryCode, tx); err != nil {
+			return err
+		}
+		codes, err = s.replaceRecoveryCodes(r.Context(), user.ID, tx)
+		return err
+	})
+	if err != nil {
+		logger.Error("[RegenerateRecoveryCodesHandler] Replace recovery codes got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// checkTwoFactorRequest reads a request changing the two-factor authentication of the user, and
+// checks the password of accounts that have one.
+func (s *Service) checkTwoFactorRequest(r *http.Request) (*models.User, *dto.TwoFactorRequest, error) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		return nil, nil, fmt.Errorf("can not get user from context")
+	}
+	var req dto.TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, nil, helpers.NewHTTPError(http.StatusBadRequest, err)
+	}
+	if user.TwoFactorEnabledAt == nil {
+		return nil, nil, helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enabled"))
+	}
+	if user.Password != nil && !checkUserPassword(&user, req.Password) {
+		return nil, nil, helpers.NewHTTPError(http.StatusForbidden, fmt.Errorf("password is incorrect"))
+	}
+	return &user, &req, nil
+}
+
+// verifySecondFactor checks the TOTP code or uses up the recovery code of the user.
+func (s *Service) verifySecondFactor(ctx context.Context, user *models.User, code string, recoveryCode string, dbs ...*gorm.DB) error {
+	now := time.Now()
+	if recoveryCode != "" {
+		used, err := s.RecoveryCodeRepository.UseCode(ctx, user.ID, hashToken(helpers.NormalizeRecoveryCode(recoveryCode)), now, dbs...)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidTwoFactorCode
+		}
+		logger.Info("[verifySecondFactor] Recovery code used", zap.Int32("userId", user.ID))
+		return nil
+	}
+	if code == "" {
+		return helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("code or recoveryCode is required"))
+	}
+
+	secret, err := s.decryptTwoFactorSecret(user)
+	if err != nil {
+		return err
+	}
+	step, valid := helpers.ValidateTOTP(secret, code, now, user.TwoFactorLastStep)
+	if !valid {
+		return errInvalidTwoFactorCode
+	}
+	// a concurrent request may have used a code of this step since the user was read
+	used, err := s.UserRepository.UseTwoFactorStep(ctx, user.ID, step, dbs...)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *Service) decryptTwoFactorSecret(user *models.User) (string, error) {
+	if s.twoFactorKey == nil {
+		return "", errTwoFactorNotConfigured
+	}
+	if user.TwoFactorSecret == nil {
+		return "", fmt.Errorf("user %d has no two-factor secret", user.ID)
+	}
+	return helpers.DecryptSecret(s.twoFactorKey, *user.TwoFactorSecret, twoFactorAssociatedData(user.ID))
+}
+
+// replaceRecoveryCodes generates new recovery codes for the user and returns them, only their
+// hashes are stored.
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID int32, tx *gorm.DB) ([]string, error) {
+	if err := s.RecoveryCodeRepository.DeleteCodesByUser(ctx, userID, tx); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]*models.RecoveryCode, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code := helpers.GenerateRecoveryCode()
+		codes = append(codes, code)
+		rows = append(rows, &models.RecoveryCode{UserID: userID, CodeHash: hashToken(helpers.NormalizeRecoveryCode(code))})
+	}
+	if err := s.RecoveryCodeRepository.CreateCodes(ctx, rows, tx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// twoFactorAssociatedData binds an encrypted TOTP secret to its user.
+func twoFactorAssociatedData(userID int32) []byte {
+	return []byte("user:" + strconv.FormatInt(int64(userID), 10))
+}
@@ -5,10 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"time"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -20,6 +20,11 @@ import (
 	"github.com/mrgThang/flashcard-be/models"
 )
 
+const (
+	maxUserNameLength  = 100
+	maxUserEmailLength = 100
+)
+
 func (s *Service) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
 	if !ok {
@@ -33,9 +38,15 @@ func (s *Service) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *Service) parseGetUserResponse(user models.User) dto.GetUserResponse {
 	return dto.GetUserResponse{User: dto.UserItem{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
+		ID:                  user.ID,
+		Name:                user.Name,
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerifiedAt != nil,
+		PendingEmail:        user.PendingEmail,
+		HasPassword:         user.Password != nil,
+		TwoFactorEnabled:    user.TwoFactorEnabledAt != nil,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		Role:                user.Role,
 	}}
 }
 
@@ -61,6 +72,14 @@ func (s *Service) SignupHandler(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
+
+	// the account is created either way, the user can ask for another verification email
+	user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{Email: req.Email})
+	if err != nil {
+		logger.Error("[SignUpHandler] UserRepository.GetUser got error", zap.Error(err))
+	} else if err := s.sendEmailVerification(r.Context(), user); err != nil {
+		logger.Error("[SignUpHandler] Send verification email got error", zap.Int32("userId", user.ID), zap.Error(err))
+	}
 	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
 }
 
@@ -79,53 +98,218 @@ func (s *Service) parseSignupRequest(r *http.Request) (*dto.CreateUserRequest, e
 	if req.Password == "" {
 		return nil, fmt.Errorf("password is required")
 	}
+	if err := s.passwordPolicy().Validate(req.Password, req.Name, req.Email); err != nil {
+		return nil, err
+	}
 	return &req, nil
 }
 
-func (s *Service) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	req, err := s.parseLoginRequest(r)
+// UpdateUserHandler changes the name and the email of the user. A new email stays pending until it
+// is verified with the link sent to it, the current email is kept until then.
+func (s *Service) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[UpdateUserHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	req, err := s.parseUpdateUserRequest(r)
 	if err != nil {
-		logger.Error("[LoginHandler] Failed to parse request", zap.Error(err))
+		logger.Error("[UpdateUserHandler] Invalid request body", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	getUserReq := dto.GetUserRequest{
-		Email: req.Email,
+	if req.Name != nil {
+		user.Name = *req.Name
 	}
-	user, err := s.UserRepository.GetUser(r.Context(), getUserReq)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logger.Error("[LoginHandler] UserRepository.GetUser not found record", zap.Error(err))
-			helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("email is not signed up yet"))
+	emailChanged := req.Email != nil && !strings.EqualFold(*req.Email, user.Email)
+	if emailChanged {
+		if user.Password != nil && !checkUserPassword(&user, req.CurrentPassword) {
+			logger.Error("[UpdateUserHandler] Invalid password", zap.Int32("userId", user.ID))
+			helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("password is incorrect"))
 			return
 		}
-		logger.Error("[LoginHandler] UserRepository.GetUser got error", zap.Error(err))
+		_, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{Email: *req.Email})
+		if err == nil {
+			helpers.WriteJSONError(w, http.StatusConflict, fmt.Errorf("email is already used by another account"))
+			return
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Error("[UpdateUserHandler] UserRepository.GetUser got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		user.PendingEmail = req.Email
+	} else if req.Email != nil {
+		// only the case changes, the address stays verified, and a pending change is cancelled
+		user.Email = *req.Email
+		user.PendingEmail = nil
+	}
+
+	if err := s.UserRepository.UpdateProfile(r.Context(), &user); err != nil {
+		logger.Error("[UpdateUserHandler] UserRepository.UpdateProfile got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if emailChanged {
+		if err := s.sendEmailVerification(r.Context(), &user); err != nil {
+			logger.Error("[UpdateUserHandler] Send verification email got error", zap.Int32("userId", user.ID), zap.Error(err))
+		}
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, s.parseGetUserResponse(user))
+}
+
+func (s *Service) parseUpdateUserRequest(r *http.Request) (*dto.UpdateUserRequest, error) {
+	var req dto.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[parseUpdateUserRequest] Failed to decode request body", zap.Error(err))
+		return nil, err
+	}
+	if req.Name == nil && req.Email == nil {
+		return nil, fmt.Errorf("name or email is required")
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("name is required")
+		}
+		if utf8.RuneCountInString(name) > maxUserNameLength {
+			return nil, fmt.Errorf("name must be at most %d characters long", maxUserNameLength)
+		}
+		req.Name = &name
+	}
+	if req.Email != nil {
+		address, err := mail.ParseAddress(strings.TrimSpace(*req.Email))
+		if err != nil || address.Name != "" {
+			return nil, fmt.Errorf("email is invalid")
+		}
+		if len(address.Address) > maxUserEmailLength {
+			return nil, fmt.Errorf("email must be at most %d characters long", maxUserEmailLength)
+		}
+		req.Email = &address.Address
+	}
+	return &req, nil
+}
+
+// ChangePasswordHandler replaces the password of the user after checking the current one, logs out
+// every other session of the user and revokes their personal access tokens.
+func (s *Service) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[ChangePasswordHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	var req dto.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[ChangePasswordHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	// an account signing in only through an external provider sets its first password
+	if user.Password != nil && req.CurrentPassword == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("currentPassword is required"))
+		return
+	}
+	if user.Password != nil && !checkUserPassword(&user, req.CurrentPassword) {
+		logger.Error("[ChangePasswordHandler] Invalid password", zap.Int32("userId", user.ID))
+		helpers.WriteJSONError(w, http.StatusForbidden, fmt.Errorf("password is incorrect"))
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("newPassword must differ from the current password"))
+		return
+	}
+	if err := s.passwordPolicy().Validate(req.NewPassword, user.Name, user.Email); err != nil {
 		helpers.WriteJSONError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
 	if err != nil {
-		logger.Error("[LoginHandler] Invalid password", zap.Error(err))
+		logger.Error("[ChangePasswordHandler] Hashing password got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.UserRepository.UpdatePassword(r.Context(), user.ID, string(hash)); err != nil {
+		logger.Error("[ChangePasswordHandler] UserRepository.UpdatePassword got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sessionID, _ := r.Context().Value(constant.SessionContextKey).(string)
+	if err := s.revokeUserAccess(r.Context(), user.ID, sessionID); err != nil {
+		logger.Error("[ChangePasswordHandler] Revoke access got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// checkUserPassword reports whether password is the password of the user, which fails for accounts
+// without a password.
+func checkUserPassword(user *models.User, password string) bool {
+	return user.Password != nil && bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(password)) == nil
+}
+
+func (s *Service) passwordPolicy() helpers.PasswordPolicy {
+	return helpers.PasswordPolicy{MinLength: s.Config.PasswordMinLength, MinClasses: s.Config.PasswordMinClasses}
+}
+
+func (s *Service) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := s.parseLoginRequest(r)
+	if err != nil {
+		logger.Error("[LoginHandler] Failed to parse request", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Subject:   strconv.FormatInt(int64(user.ID), 10),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
-	})
-	accessTokenString, err := accessToken.SignedString([]byte(s.Config.AccessKeySecret))
+	keys := loginThrottleKeys(r, "login", req.Email)
+	wait, err := s.checkThrottle(r.Context(), keys)
 	if err != nil {
-		logger.Error("[LoginHandler] Failed to create accessToken", zap.Error(err))
+		logger.Error("[LoginHandler] Check throttle got error", zap.Error(err))
 		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
 
-	helpers.WriteJSONResponse(w, http.StatusOK, dto.LoginResponse{
-		AccessToken: accessTokenString,
-	})
+	getUserReq := dto.GetUserRequest{
+		Email: req.Email,
+	}
+	user, err := s.UserRepository.GetUser(r.Context(), getUserReq)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error("[LoginHandler] UserRepository.GetUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if user == nil || !checkUserPassword(user, req.Password) {
+		if user == nil || user.Password == nil {
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+		}
+		logger.Info("[LoginHandler] Failed login", zap.String("ip", clientIP(r)))
+		if err := s.failThrottle(r.Context(), keys); err != nil {
+			logger.Error("[LoginHandler] Record failed login got error", zap.Error(err))
+			helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		helpers.WriteError(w, errInvalidCredentials)
+		return
+	}
+	if err := s.resetThrottle(r.Context(), keys); err != nil {
+		logger.Error("[LoginHandler] Reset throttle got error", zap.Int32("userId", user.ID), zap.Error(err))
+	}
+
+	response, err := s.startLogin(r, user)
+	if err != nil {
+		logger.Error("[LoginHandler] Failed to start login", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, response)
 }
 
 func (s *Service) parseLoginRequest(r *http.Request) (*dto.LoginRequest, error) {
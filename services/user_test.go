@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+// TestChangePasswordRevokesAccess checks changing the password logs out the other sessions and
+// revokes the personal access tokens, which an attacker may have created with the old password.
+func TestChangePasswordRevokesAccess(t *testing.T) {
+	s, store := newTestService(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("Old password 1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := string(hash)
+	user := &models.User{ID: 1, Name: "Lan", Email: "lan@example.com", Password: &password}
+	store.users = []*models.User{user}
+	store.sessions = []*models.Session{{ID: "current", UserID: 1}, {ID: "other", UserID: 1}}
+	store.accessTokens = []*models.AccessToken{{ID: 1, UserID: 1}, {ID: 2, UserID: 1}, {ID: 3, UserID: 2}}
+
+	body := `{"currentPassword":"Old password 1","newPassword":"Correct horse battery 9"}`
+	r := httptest.NewRequest(http.MethodPut, "/v1/users/password", strings.NewReader(body))
+	ctx := context.WithValue(r.Context(), constant.UserContextKey, *user)
+	ctx = context.WithValue(ctx, constant.SessionContextKey, "current")
+	w := httptest.NewRecorder()
+	s.ChangePasswordHandler(w, r.WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ChangePasswordHandler() status = %d, body %s", w.Code, w.Body)
+	}
+
+	if !checkUserPassword(user, "Correct horse battery 9") {
+		t.Errorf("password was not changed")
+	}
+	if store.sessions[0].RevokedAt != nil || store.sessions[1].RevokedAt == nil {
+		t.Errorf("sessions = %+v, want only the other session revoked", store.sessions)
+	}
+	if len(store.accessTokens) != 1 || store.accessTokens[0].UserID != 2 {
+		t.Errorf("access tokens left = %v, want only the one of another user", store.accessTokens)
+	}
+}
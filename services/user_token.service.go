@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mrgThang/flashcard-be/constant"
+	"github.com/mrgThang/flashcard-be/dto"
+	"github.com/mrgThang/flashcard-be/helpers"
+	"github.com/mrgThang/flashcard-be/logger"
+	"github.com/mrgThang/flashcard-be/mailer"
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+var errInvalidUserToken = helpers.NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid or expired link"))
+
+// userTokenEmail is the data of the email templates.
+type userTokenEmail struct {
+	Name      string
+	Email     string
+	Link      string
+	ExpiresIn string
+}
+
+// RequestEmailVerificationHandler mails the user a new link verifying their email.
+func (s *Service) RequestEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(constant.UserContextKey).(models.User)
+	if !ok {
+		logger.Error("[RequestEmailVerificationHandler] Can not get user from context")
+		helpers.WriteJSONError(w, http.StatusInternalServerError, fmt.Errorf("can not get user from context"))
+		return
+	}
+	if user.EmailVerifiedAt != nil && user.PendingEmail == nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("email is already verified"))
+		return
+	}
+	if err := s.sendEmailVerification(r.Context(), &user); err != nil {
+		logger.Error("[RequestEmailVerificationHandler] Send verification email got error", zap.Int32("userId", user.ID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// ConfirmEmailVerificationHandler marks the email of the user verified with the token of the link,
+// or replaces it with the pending email the link was sent to.
+func (s *Service) ConfirmEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.ConfirmEmailVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[ConfirmEmailVerificationHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Token == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("token is required"))
+		return
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := s.useUserToken(r.Context(), req.Token, models.UserTokenVerifyEmail, tx)
+		if err != nil {
+			return err
+		}
+		user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: token.UserID}, tx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		var verified bool
+		if user.PendingEmail != nil && strings.EqualFold(*user.PendingEmail, token.Email) {
+			// another account may have signed up with the email while it was pending
+			other, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{Email: token.Email}, tx)
+			if err == nil && other.ID != user.ID {
+				return helpers.NewHTTPError(http.StatusConflict, fmt.Errorf("email is already used by another account"))
+			}
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			verified, err = s.UserRepository.ConfirmPendingEmail(r.Context(), user.ID, token.Email, &now, tx)
+		} else {
+			verified, err = s.UserRepository.SetEmailVerified(r.Context(), user.ID, token.Email, &now, tx)
+		}
+		if err != nil {
+			return err
+		}
+		if !verified {
+			// the user changed their email since the link was sent
+			return errInvalidUserToken
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("[ConfirmEmailVerificationHandler] Verify email got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// RequestPasswordResetHandler mails a password reset link to the user of the email. It answers the
+// same whether or not the email is signed up, so it can not be used to find out accounts.
+func (s *Service) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.RequestPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[RequestPasswordResetHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("email is required"))
+		return
+	}
+
+	// every request counts as a failure, which bounds the emails sent to an address
+	keys := loginThrottleKeys(r, "password_reset", req.Email)
+	wait, err := s.checkThrottle(r.Context(), keys)
+	if err != nil {
+		logger.Error("[RequestPasswordResetHandler] Check throttle got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if wait > 0 {
+		writeTooManyAttempts(w, wait)
+		return
+	}
+	if err := s.failThrottle(r.Context(), keys); err != nil {
+		logger.Error("[RequestPasswordResetHandler] Record attempt got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{Email: req.Email})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+			return
+		}
+		logger.Error("[RequestPasswordResetHandler] UserRepository.GetUser got error", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the email is sent after answering, neither its errors nor the time it takes tell the email is signed up
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		if err := s.sendPasswordReset(ctx, user); err != nil {
+			logger.Error("[RequestPasswordResetHandler] Send password reset email got error", zap.Int32("userId", user.ID), zap.Error(err))
+		}
+	}()
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// ConfirmPasswordResetHandler sets the new password of the user with the token of the link, logs out
+// every session of the user and revokes their personal access tokens.
+func (s *Service) ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req dto.ConfirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Error("[ConfirmPasswordResetHandler] Failed to decode request body", zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Token == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("token is required"))
+		return
+	}
+	if req.Password == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, fmt.Errorf("password is required"))
+		return
+	}
+
+	var userID int32
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := s.useUserToken(r.Context(), req.Token, models.UserTokenResetPassword, tx)
+		if err != nil {
+			return err
+		}
+		user, err := s.UserRepository.GetUser(r.Context(), dto.GetUserRequest{ID: token.UserID}, tx)
+		if err != nil {
+			return err
+		}
+		// whoever still reads the previous email of the user must not take the account back
+		if !strings.EqualFold(token.Email, user.Email) {
+			return errInvalidUserToken
+		}
+		if err := s.passwordPolicy().Validate(req.Password, user.Name, user.Email); err != nil {
+			return helpers.NewHTTPError(http.StatusBadRequest, err)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+		return s.UserRepository.UpdatePassword(r.Context(), token.UserID, string(hash), tx)
+	})
+	if err != nil {
+		logger.Error("[ConfirmPasswordResetHandler] Reset password got error", zap.Error(err))
+		helpers.WriteError(w, err)
+		return
+	}
+	if err := s.revokeUserAccess(r.Context(), userID, ""); err != nil {
+		logger.Error("[ConfirmPasswordResetHandler] Revoke access got error", zap.Int32("userId", userID), zap.Error(err))
+		helpers.WriteJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	helpers.WriteJSONResponse(w, http.StatusOK, any(nil))
+}
+
+// sendEmailVerification mails the verification link to the pending email of the user, or to their
+// email when no change is pending.
+func (s *Service) sendEmailVerification(ctx context.Context, user *models.User) error {
+	ttl := time.Duration(s.Config.EmailVerificationTTLHours) * time.Hour
+	email := user.Email
+	if user.PendingEmail != nil {
+		email = *user.PendingEmail
+	}
+	return s.sendUserToken(ctx, user, email, models.UserTokenVerifyEmail, mailer.TemplateVerifyEmail, "/verify-email", ttl)
+}
+
+func (s *Service) sendPasswordReset(ctx context.Context, user *models.User) error {
+	ttl := time.Duration(s.Config.PasswordResetTTLMinutes) * time.Minute
+	return s.sendUserToken(ctx, user, user.Email, models.UserTokenResetPassword, mailer.TemplateResetPassword, "/reset-password", ttl)
+}
+
+// sendUserToken issues a token of the purpose for the email and mails the link of the app page
+// using it there.
+func (s *Service) sendUserToken(ctx context.Context, user *models.User, email string, purpose string, templateName string, path string, ttl time.Duration) error {
+	tokenString, err := s.issueUserToken(ctx, user, email, purpose, ttl)
+	if err != nil {
+		return err
+	}
+	message, err := s.MailTemplates.Render(templateName, email, userTokenEmail{
+		Name:      user.Name,
+		Email:     email,
+		Link:      strings.TrimSuffix(s.Config.AppURL, "/") + path + "?token=" + url.QueryEscape(tokenString),
+		ExpiresIn: formatTTL(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(ctx, message)
+}
+
+// issueUserToken records a single-use token of the purpose for the email and returns it signed, its
+// jti is the id of the record and its audience the purpose.
+func (s *Service) issueUserToken(ctx context.Context, user *models.User, email string, purpose string, ttl time.Duration) (string, error) {
+	token := &models.UserToken{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.UserTokenRepository.CreateToken(ctx, token); err != nil {
+		return "", err
+	}
+	signed := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ID:        token.ID,
+		Subject:   strconv.FormatInt(int64(user.ID), 10),
+		Audience:  jwt.ClaimStrings{purpose},
+		ExpiresAt: jwt.NewNumericDate(token.ExpiresAt),
+	})
+	return signed.SignedString([]byte(s.Config.ActionKeySecret))
+}
+
+// useUserToken checks the signed token is a valid token of the purpose and uses it up, along with
+// the other tokens of the user for the purpose.
+func (s *Service) useUserToken(ctx context.Context, tokenString string, purpose string, tx *gorm.DB) (*models.UserToken, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(s.Config.ActionKeySecret), nil
+	}, jwt.WithExpirationRequired(), jwt.WithAudience(purpose))
+	if err != nil {
+		return nil, errInvalidUserToken
+	}
+
+	token, err := s.UserTokenRepository.GetToken(ctx, claims.ID, tx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvalidUserToken
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if token.Purpose != purpose || token.UsedAt != nil || !token.ExpiresAt.After(now) ||
+		strconv.FormatInt(int64(token.UserID), 10) != claims.Subject {
+		return nil, errInvalidUserToken
+	}
+	used, err := s.UserTokenRepository.UseToken(ctx, token.ID, now, tx)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, errInvalidUserToken
+	}
+	if err := s.UserTokenRepository.UseTokensByUser(ctx, token.UserID, purpose, now, tx); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// formatTTL returns how long a link is valid in words, in hours when it is a whole number of them.
+func formatTTL(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		if hours := int(ttl / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	if minutes := int(ttl / time.Minute); minutes != 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	return "1 minute"
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrgThang/flashcard-be/models"
+)
+
+func confirmPasswordReset(s *Service, token string, password string) *httptest.ResponseRecorder {
+	body := `{"token":"` + token + `","password":"` + password + `"}`
+	w := httptest.NewRecorder()
+	s.ConfirmPasswordResetHandler(w, httptest.NewRequest(http.MethodPost, "/v1/password/reset/confirm", strings.NewReader(body)))
+	return w
+}
+
+// TestConfirmPasswordResetAfterEmailChange checks a reset link mailed before the user changed their
+// email does not work anymore, while a link mailed to the new email does.
+func TestConfirmPasswordResetAfterEmailChange(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t)
+	password := "old password hash"
+	user := &models.User{ID: 1, Name: "Lan", Email: "lan@example.com", Password: &password}
+	store.users = []*models.User{user}
+	store.sessions = []*models.Session{{ID: "session", UserID: 1}}
+	store.accessTokens = []*models.AccessToken{{ID: 1, UserID: 1}, {ID: 2, UserID: 2}}
+
+	oldLink, err := s.issueUserToken(ctx, user, user.Email, models.UserTokenResetPassword, time.Hour)
+	if err != nil {
+		t.Fatalf("issueUserToken() error = %v", err)
+	}
+	user.Email = "lan@new.example.com"
+
+	if w := confirmPasswordReset(s, oldLink, "Correct horse battery 9"); w.Code != http.StatusBadRequest {
+		t.Fatalf("confirm with the link of the previous email: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if *user.Password != password {
+		t.Errorf("password changed with the link of the previous email")
+	}
+	if store.sessions[0].RevokedAt != nil || len(store.accessTokens) != 2 {
+		t.Errorf("sessions or access tokens revoked with the link of the previous email")
+	}
+
+	newLink, err := s.issueUserToken(ctx, user, user.Email, models.UserTokenResetPassword, time.Hour)
+	if err != nil {
+		t.Fatalf("issueUserToken() error = %v", err)
+	}
+	if w := confirmPasswordReset(s, newLink, "Correct horse battery 9"); w.Code != http.StatusOK {
+		t.Fatalf("confirm with the link of the current email: status = %d, body %s", w.Code, w.Body)
+	}
+	if !checkUserPassword(user, "Correct horse battery 9") {
+		t.Errorf("password was not changed with the link of the current email")
+	}
+	if store.sessions[0].RevokedAt == nil {
+		t.Errorf("sessions were not revoked after the reset")
+	}
+	if len(store.accessTokens) != 1 || store.accessTokens[0].UserID != 2 {
+		t.Errorf("access tokens left = %v, want only the one of another user", store.accessTokens)
+	}
+}
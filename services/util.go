@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mrgThang/flashcard-be/constant"
+)
+
+// parseURLID reads a positive id from the chi url parameter with the given name.
+func parseURLID(r *http.Request, name string) (int32, error) {
+	idStr := chi.URLParam(r, name)
+	if idStr == "" {
+		return 0, fmt.Errorf("%s is required", name)
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	if id <= 0 {
+		return 0, fmt.Errorf("%s is required", name)
+	}
+	return int32(id), nil
+}
+
+// parsePage reads the page and pageSize query parameters, with the default ones when missing.
+func parsePage(q url.Values) (int, int, error) {
+	page, pageSize := constant.DefaultPage, constant.DefaultPageSize
+	if pageStr := q.Get("page"); pageStr != "" {
+		value, err := strconv.Atoi(pageStr)
+		if err != nil || value <= 0 {
+			return 0, 0, fmt.Errorf("invalid page")
+		}
+		page = value
+	}
+	if pageSizeStr := q.Get("pageSize"); pageSizeStr != "" {
+		value, err := strconv.Atoi(pageSizeStr)
+		if err != nil || value <= 0 {
+			return 0, 0, fmt.Errorf("invalid pageSize")
+		}
+		pageSize = value
+	}
+	return page, pageSize, nil
+}
+
+// parseOptionalBool reads a true or false query parameter, nil when it is missing.
+func parseOptionalBool(q url.Values, name string) (*bool, error) {
+	valueStr := q.Get(name)
+	if valueStr == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &value, nil
+}
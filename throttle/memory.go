@@ -0,0 +1,91 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval is how often the expired entries are removed from the map.
+const memorySweepInterval = time.Minute
+
+// MemoryStore keeps the counters in the memory of the process.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.sweep()
+	entry := s.get(key, now)
+	entry.value++
+	entry.expiresAt = now.Add(ttl)
+	s.entries[key] = entry
+	return entry.value, nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.sweep()
+	s.entries[key] = memoryEntry{value: 1, expiresAt: now.Add(duration)}
+	return nil
+}
+
+func (s *MemoryStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	entry := s.get(key, now)
+	if entry.value == 0 {
+		return 0, nil
+	}
+	return entry.expiresAt.Sub(now), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// get returns the entry of the key, the zero entry when it expired.
+func (s *MemoryStore) get(key string, now time.Time) memoryEntry {
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return memoryEntry{}
+	}
+	return entry
+}
+
+// sweep removes the expired entries now and then so the map does not grow with every address that
+// ever failed, it returns the current time.
+func (s *MemoryStore) sweep() time.Time {
+	now := s.now()
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return now
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	return now
+}
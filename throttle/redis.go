@@ -0,0 +1,51 @@
+package throttle
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incrScript increments the counter and sets its expiry in one round trip, so a counter never
+// outlives its window without expiring.
+var incrScript = redis.NewScript(`local n = redis.call('INCR', KEYS[1]) redis.call('PEXPIRE', KEYS[1], ARGV[1]) return n`)
+
+// RedisStore keeps the counters in Redis, or any server speaking its protocol such as Valkey, so
+// every instance of the server shares them.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(addr string, password string, db int) *RedisStore {
+	return &RedisStore{client: redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})}
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, s.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, duration time.Duration) error {
+	return s.client.Set(ctx, key, 1, max(duration, time.Millisecond)).Err()
+}
+
+func (s *RedisStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// negative when the key does not exist or has no expiry, which a lock always has
+	return max(ttl, 0), nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Close closes the connections to the server.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
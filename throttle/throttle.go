@@ -0,0 +1,109 @@
+// Package throttle counts failed attempts, such as logins, and locks the key for longer and longer
+// once too many failed.
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mrgThang/flashcard-be/config"
+)
+
+const (
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+)
+
+// Store keeps the counters and locks. The memory store only works for a single instance of the
+// server, instances behind a load balancer share a Redis.
+type Store interface {
+	// Incr increments the counter of the key and returns it, the counter expires ttl after its
+	// last increment.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Lock locks the key for the duration.
+	Lock(ctx context.Context, key string, duration time.Duration) error
+	// LockedFor returns how long the key stays locked, 0 when it is not.
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Delete removes the keys.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// New returns the store selected by the driver of the config.
+func New(cfg *config.ThrottleConfig) (Store, error) {
+	switch cfg.Driver {
+	case DriverMemory, "":
+		return NewMemoryStore(), nil
+	case DriverRedis:
+		return NewRedisStore(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB), nil
+	default:
+		return nil, fmt.Errorf("unknown throttle driver %q", cfg.Driver)
+	}
+}
+
+// Policy is how many failures a key is allowed and how long it is locked after.
+type Policy struct {
+	// FreeAttempts is the number of failures before the key is locked.
+	FreeAttempts int
+	// Lockout is the first lockout, it doubles on every further failure up to MaxLockout.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// LockoutAfter returns how long the key is locked after the number of failures.
+func (p Policy) LockoutAfter(failures int64) time.Duration {
+	excess := failures - int64(p.FreeAttempts)
+	if excess <= 0 {
+		return 0
+	}
+	lockout := p.Lockout
+	for range excess - 1 {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return min(lockout, p.MaxLockout)
+}
+
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+// Check returns how long the key stays locked, 0 when an attempt is allowed.
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	return l.store.LockedFor(ctx, lockKey(key))
+}
+
+// Fail records a failed attempt of the key and returns how long the key is now locked for.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	failures, err := l.store.Incr(ctx, countKey(key), l.policy.Window)
+	if err != nil {
+		return 0, err
+	}
+	lockout := l.policy.LockoutAfter(failures)
+	if lockout == 0 {
+		return 0, nil
+	}
+	return lockout, l.store.Lock(ctx, lockKey(key), lockout)
+}
+
+// Reset forgets the failures of the key, after a successful attempt.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.store.Delete(ctx, countKey(key), lockKey(key))
+}
+
+func countKey(key string) string {
+	return "throttle:" + key + ":count"
+}
+
+func lockKey(key string) string {
+	return "throttle:" + key + ":lock"
+}
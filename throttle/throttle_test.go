@@ -0,0 +1,137 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestPolicyLockoutAfter(t *testing.T) {
+	policy := Policy{FreeAttempts: 3, Lockout: 30 * time.Second, MaxLockout: 5 * time.Minute}
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: 30 * time.Second},
+		{failures: 5, want: time.Minute},
+		{failures: 7, want: 4 * time.Minute},
+		{failures: 8, want: 5 * time.Minute},
+		{failures: 1000, want: 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.LockoutAfter(tt.failures); got != tt.want {
+			t.Errorf("LockoutAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limiter := NewLimiter(store, Policy{FreeAttempts: 2, Lockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+
+	for range 2 {
+		if lockout, err := limiter.Fail(ctx, "ada"); err != nil || lockout != 0 {
+			t.Fatalf("Fail() = (%v, %v), want no lockout", lockout, err)
+		}
+	}
+	if lockout, _ := limiter.Fail(ctx, "ada"); lockout != time.Minute {
+		t.Fatalf("Fail() lockout = %v, want 1m", lockout)
+	}
+	if wait, _ := limiter.Check(ctx, "ada"); wait != time.Minute {
+		t.Errorf("Check() = %v, want 1m", wait)
+	}
+	if wait, _ := limiter.Check(ctx, "bob"); wait != 0 {
+		t.Errorf("Check() of another key = %v, want 0", wait)
+	}
+
+	now = now.Add(time.Minute)
+	if wait, _ := limiter.Check(ctx, "ada"); wait != 0 {
+		t.Errorf("Check() after the lockout = %v, want 0", wait)
+	}
+	if lockout, _ := limiter.Fail(ctx, "ada"); lockout != 2*time.Minute {
+		t.Errorf("Fail() after the lockout = %v, want it doubled", lockout)
+	}
+
+	if err := limiter.Reset(ctx, "ada"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := limiter.Check(ctx, "ada"); wait != 0 {
+		t.Errorf("Check() after Reset() = %v, want 0", wait)
+	}
+
+	// failures are forgotten a window after the last one
+	limiter.Fail(ctx, "ada")
+	limiter.Fail(ctx, "ada")
+	now = now.Add(time.Hour)
+	if lockout, _ := limiter.Fail(ctx, "ada"); lockout != 0 {
+		t.Errorf("Fail() after the window = %v, want no lockout", lockout)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	store := NewRedisStore(server.Addr(), "", 0)
+	defer store.Close()
+
+	for want := int64(1); want <= 3; want++ {
+		if got, err := store.Incr(ctx, "fail", time.Minute); err != nil || got != want {
+			t.Fatalf("Incr() = (%d, %v), want %d", got, err, want)
+		}
+	}
+	// every increment pushes the expiry of the counter back
+	server.FastForward(59 * time.Second)
+	if got, err := store.Incr(ctx, "fail", time.Minute); err != nil || got != 4 {
+		t.Fatalf("Incr() before expiry = (%d, %v), want 4", got, err)
+	}
+	server.FastForward(time.Minute)
+	if got, err := store.Incr(ctx, "fail", time.Minute); err != nil || got != 1 {
+		t.Fatalf("Incr() after expiry = (%d, %v), want 1", got, err)
+	}
+
+	if locked, err := store.LockedFor(ctx, "lock"); err != nil || locked != 0 {
+		t.Fatalf("LockedFor() a missing key = (%v, %v), want 0", locked, err)
+	}
+	if err := store.Lock(ctx, "lock", 30*time.Second); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if locked, err := store.LockedFor(ctx, "lock"); err != nil || locked != 30*time.Second {
+		t.Fatalf("LockedFor() = (%v, %v), want 30s", locked, err)
+	}
+	server.FastForward(30 * time.Second)
+	if locked, err := store.LockedFor(ctx, "lock"); err != nil || locked != 0 {
+		t.Fatalf("LockedFor() after the lockout = (%v, %v), want 0", locked, err)
+	}
+
+	if err := store.Lock(ctx, "lock", time.Minute); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	if err := store.Delete(ctx, "fail", "lock"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if server.Exists("fail") || server.Exists("lock") {
+		t.Errorf("Delete() left keys %v", server.Keys())
+	}
+	if err := store.Delete(ctx); err != nil {
+		t.Errorf("Delete() without keys error = %v", err)
+	}
+
+	// the limiter works the same on top of it
+	limiter := NewLimiter(store, Policy{FreeAttempts: 1, Lockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+	limiter.Fail(ctx, "user")
+	if lockout, _ := limiter.Fail(ctx, "user"); lockout != time.Minute {
+		t.Errorf("Fail() = %v, want a 1m lockout", lockout)
+	}
+
+	server.SetError("server down")
+	if _, err := store.Incr(ctx, "fail", time.Minute); err == nil {
+		t.Errorf("Incr() error = nil, want the error of the server")
+	}
+}